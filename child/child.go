@@ -45,6 +45,9 @@ type Child struct {
 
 	timeout time.Duration
 
+	timeoutSignal os.Signal
+	timeoutGrace  time.Duration
+
 	reloadSignal os.Signal
 
 	killSignal  os.Signal
@@ -92,6 +95,16 @@ type NewInput struct {
 	// set to 0, the command is permitted to run infinitely.
 	Timeout time.Duration
 
+	// TimeoutSignal is the signal to send to the command when it does not exit
+	// within the Timeout, to let it terminate gracefully. If it has not exited
+	// after the TimeoutGrace, it is force-killed. This value may be nil, in
+	// which case the command is force-killed right away.
+	TimeoutSignal os.Signal
+
+	// TimeoutGrace is the amount of time to wait for the command to exit after
+	// the TimeoutSignal before force-killing it.
+	TimeoutGrace time.Duration
+
 	// Env represents the condition of the child processes' environment
 	// variables. Only these environment variables will be given to the child, so
 	// it is the responsibility of the caller to include the parent processes
@@ -147,21 +160,23 @@ func New(i *NewInput) (*Child, error) {
 	}
 
 	child := &Child{
-		stdin:        i.Stdin,
-		stdout:       i.Stdout,
-		stderr:       i.Stderr,
-		command:      i.Command,
-		args:         i.Args,
-		env:          i.Env,
-		timeout:      i.Timeout,
-		reloadSignal: i.ReloadSignal,
-		killSignal:   i.KillSignal,
-		killTimeout:  i.KillTimeout,
-		splay:        i.Splay,
-		stopCh:       make(chan struct{}, 1),
-		setpgid:      i.Setpgid && !i.Setsid,
-		setsid:       i.Setsid,
-		logger:       i.Logger,
+		stdin:         i.Stdin,
+		stdout:        i.Stdout,
+		stderr:        i.Stderr,
+		command:       i.Command,
+		args:          i.Args,
+		env:           i.Env,
+		timeout:       i.Timeout,
+		timeoutSignal: i.TimeoutSignal,
+		timeoutGrace:  i.TimeoutGrace,
+		reloadSignal:  i.ReloadSignal,
+		killSignal:    i.KillSignal,
+		killTimeout:   i.KillTimeout,
+		splay:         i.Splay,
+		stopCh:        make(chan struct{}, 1),
+		setpgid:       i.Setpgid && !i.Setsid,
+		setsid:        i.Setsid,
+		logger:        i.Logger,
 	}
 
 	return child, nil
@@ -352,12 +367,7 @@ func (c *Child) start() error {
 				)
 			}
 		case <-time.After(c.timeout):
-			// Force-kill the process
-			c.stopLock.Lock()
-			defer c.stopLock.Unlock()
-			if c.cmd != nil && c.cmd.Process != nil {
-				c.signal(os.Kill)
-			}
+			c.terminate(exitCh)
 
 			return fmt.Errorf(
 				"command did not exit within time limit (%q):\n    %s",
@@ -368,6 +378,33 @@ func (c *Child) start() error {
 	return nil
 }
 
+// terminate ends a process which did not exit within the timeout. If a timeout
+// signal was given, the process is sent it first and given the grace period to
+// exit before it is force-killed.
+func (c *Child) terminate(exitCh <-chan int) {
+	if c.timeoutSignal != nil && c.timeoutSignal != signals.SIGNULL {
+		if err := c.signal(c.timeoutSignal); err != nil {
+			c.logger.Printf("[ERR] (child) failed to send %s after timeout: %s",
+				c.timeoutSignal, err)
+		} else {
+			select {
+			case <-exitCh:
+				return
+			case <-time.After(c.timeoutGrace):
+				c.logger.Printf("[WARN] (child) process did not exit within %q of %s",
+					c.timeoutGrace, c.timeoutSignal)
+			}
+		}
+	}
+
+	// Force-kill the process
+	c.stopLock.Lock()
+	defer c.stopLock.Unlock()
+	if c.cmd != nil && c.cmd.Process != nil {
+		c.signal(os.Kill)
+	}
+}
+
 func (c *Child) pid() int {
 	if !c.running() {
 		return 0
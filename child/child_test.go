@@ -205,6 +205,61 @@ func TestStart(t *testing.T) {
 	}
 }
 
+func TestStart_timeoutSignal(t *testing.T) {
+	t.Run("escalates", func(t *testing.T) {
+		c := testChild(t)
+		c.command = "sh"
+		c.args = []string{"-c", "trap 'echo term' TERM; while true; do sleep 0.02; done"}
+		c.timeout = 100 * time.Millisecond
+		c.timeoutSignal = syscall.SIGTERM
+		c.timeoutGrace = 200 * time.Millisecond
+
+		out := gatedio.NewByteBuffer()
+		c.stdout = out
+
+		start := time.Now()
+		err := c.Start()
+		if err == nil || !strings.Contains(err.Error(), "time limit") {
+			t.Fatalf("expected a timeout error, got %v", err)
+		}
+		defer c.Stop()
+
+		// The command ignores the signal, so it is only killed after the grace
+		if d := time.Since(start); d < c.timeout+c.timeoutGrace {
+			t.Errorf("expected the command to be killed after %s, got %s",
+				c.timeout+c.timeoutGrace, d)
+		}
+		select {
+		case <-c.ExitCh():
+		case <-time.After(fileWaitSleepDelay):
+			t.Fatal("process should have been killed")
+		}
+		if exp, act := "term\n", out.String(); exp != act {
+			t.Errorf("expected %q to be %q", act, exp)
+		}
+	})
+
+	t.Run("exits", func(t *testing.T) {
+		c := testChild(t)
+		c.command = "sh"
+		c.args = []string{"-c", "trap 'exit 0' TERM; while true; do sleep 0.02; done"}
+		c.timeout = 100 * time.Millisecond
+		c.timeoutSignal = syscall.SIGTERM
+		c.timeoutGrace = 5 * time.Second
+
+		start := time.Now()
+		if err := c.Start(); err == nil {
+			t.Fatal("expected a timeout error")
+		}
+		defer c.Stop()
+
+		// The command exits on the signal, without waiting out the grace
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("expected the command to exit on the signal, took %s", d)
+		}
+	})
+}
+
 func TestSignal(t *testing.T) {
 	c := testChild(t)
 	c.command = "sh"
@@ -38,6 +38,11 @@ const (
 	ExitCodeConfigError
 )
 
+// ExitCodeDiff is returned in diff mode when any destination differs from its
+// rendered contents. It is declared apart from the error codes above so their
+// values do not change.
+const ExitCodeDiff int = 1
+
 // CLI is the main entry point.
 type CLI struct {
 	sync.Mutex
@@ -162,6 +167,9 @@ func (cli *CLI) Run(args []string) int {
 				return logError(err, code)
 			}
 		case <-runner.DoneCh:
+			if config.DiffMode && len(runner.Changed()) > 0 {
+				return ExitCodeDiff
+			}
 			return ExitCodeOK
 		case <-service_os.Shutdown_Channel():
 			fmt.Fprintf(cli.errStream, "Cleaning up...\n")
@@ -254,6 +262,16 @@ func (cli *CLI) ParseFlags(args []string) (
 		return nil
 	}), "config", "")
 
+	flags.Var((funcVar)(func(s string) error {
+		c.ConfigDirs = append(c.ConfigDirs, s)
+		return nil
+	}), "config-dir", "")
+
+	flags.Var((funcBoolVar)(func(b bool) error {
+		c.ConfigDirsRecursive = b
+		return nil
+	}), "config-dir-recursive", "")
+
 	flags.Var((funcVar)(func(s string) error {
 		c.Consul.Address = config.String(s)
 		return nil
@@ -373,6 +391,11 @@ func (cli *CLI) ParseFlags(args []string) (
 		return nil
 	}), "default-right-delimiter", "")
 
+	flags.Var((funcBoolVar)(func(b bool) error {
+		c.DiffMode = *(config.Bool(b))
+		return nil
+	}), "diff", "")
+
 	flags.BoolVar(&dry, "dry", false, "")
 
 	flags.Var((funcVar)(func(s string) error {
@@ -688,6 +711,15 @@ func loadConfigs(paths []string, o *config.Config) (*config.Config, error) {
 		finalC = finalC.Merge(c)
 	}
 
+	for _, dir := range o.ConfigDirs {
+		c, err := config.FromDir(dir, o.ConfigDirsRecursive)
+		if err != nil {
+			return nil, err
+		}
+
+		finalC = finalC.Merge(c)
+	}
+
 	finalC = finalC.Merge(o)
 	if o.TemplateErrFatal != nil {
 		for _, tmpl := range *finalC.Templates {
@@ -736,6 +768,14 @@ Options:
       values are given, they are merged left-to-right, and CLI arguments take
       the top-most precedence.
 
+  -config-dir=<path>
+      Sets the path to a directory whose .hcl and .json files are merged in
+      lexical order, after any -config paths. Subdirectories are ignored. This
+      can be specified multiple times.
+
+  -config-dir-recursive
+      Also merge the files in the subdirectories of each -config-dir.
+
   -consul-addr=<address>
       Sets the address of the Consul instance
 
@@ -809,6 +849,10 @@ Options:
   -default-right-delimiter
       The default right delimiter for templating
 
+  -diff
+      Render each template once and print a unified diff against its
+      destination to stdout instead of rendering, exiting with 1 if any differ
+
   -dry
       Print generated templates to stdout instead of rendering
 
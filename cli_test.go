@@ -6,6 +6,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"syscall"
@@ -18,6 +19,31 @@ import (
 	gatedio "github.com/hashicorp/go-gatedio"
 )
 
+func TestExitCodes(t *testing.T) {
+	// The exit codes are public, so their values must never change
+	cases := []struct {
+		name string
+		code int
+		exp  int
+	}{
+		{"ok", ExitCodeOK, 0},
+		{"diff", ExitCodeDiff, 1},
+		{"error", ExitCodeError, 11},
+		{"interrupt", ExitCodeInterrupt, 12},
+		{"parse_flags_error", ExitCodeParseFlagsError, 13},
+		{"runner_error", ExitCodeRunnerError, 14},
+		{"config_error", ExitCodeConfigError, 15},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			if tc.code != tc.exp {
+				t.Errorf("expected %d, got %d", tc.exp, tc.code)
+			}
+		})
+	}
+}
+
 func TestCLI_ParseFlags(t *testing.T) {
 	f, err := os.CreateTemp("", "")
 	if err != nil {
@@ -871,6 +897,23 @@ func TestCLI_ParseFlags(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"config-dir",
+			[]string{"-config-dir", "/etc/ct.d", "-config-dir", "/etc/ct.local.d"},
+			&config.Config{
+				ConfigDirs: []string{"/etc/ct.d", "/etc/ct.local.d"},
+			},
+			false,
+		},
+		{
+			"config-dir-recursive",
+			[]string{"-config-dir", "/etc/ct.d", "-config-dir-recursive"},
+			&config.Config{
+				ConfigDirs:          []string{"/etc/ct.d"},
+				ConfigDirsRecursive: true,
+			},
+			false,
+		},
 		{
 			"once-wait",
 			[]string{"-once", "-wait", "10s"},
@@ -882,6 +925,18 @@ func TestCLI_ParseFlags(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"diff",
+			[]string{"-diff"},
+			&config.Config{
+				Wait: &config.WaitConfig{
+					Enabled: config.Bool(false),
+				},
+				Once:     true,
+				DiffMode: true,
+			},
+			false,
+		},
 		{
 			"parse-only",
 			[]string{"-parse-only"},
@@ -1026,6 +1081,62 @@ func TestCLI_Run(t *testing.T) {
 		}
 	})
 
+	t.Run("diff", func(t *testing.T) {
+		f, err := os.CreateTemp(t.TempDir(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString("hello\n"); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, tc := range map[string]struct {
+			dest string
+			exp  int
+		}{
+			"unchanged": {"hello\n", ExitCodeOK},
+			"changed":   {"bye\n", ExitCodeDiff},
+		} {
+			t.Run(name, func(t *testing.T) {
+				dest := filepath.Join(t.TempDir(), "dest")
+				if err := os.WriteFile(dest, []byte(tc.dest), 0o644); err != nil {
+					t.Fatal(err)
+				}
+
+				out := gatedio.NewByteBuffer()
+				cli := NewCLI(out, out)
+
+				ch := make(chan int, 1)
+				go func() {
+					ch <- cli.Run([]string{
+						"consul-template",
+						"-diff",
+						"-consul-addr", testConsul.HTTPAddr,
+						"-vault-renew-token=false",
+						"-template", f.Name() + ":" + dest,
+					})
+				}()
+
+				select {
+				case status := <-ch:
+					if status != tc.exp {
+						t.Errorf("\nexp: %#v\nact: %#v\nout: %s", tc.exp, status, out.String())
+					}
+				case <-time.After(2 * time.Second):
+					t.Fatalf("timeout: %q", out.String())
+				}
+
+				b, err := os.ReadFile(dest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != tc.dest {
+					t.Errorf("expected destination not to be written, got %q", b)
+				}
+			})
+		}
+	})
+
 	t.Run("reload", func(t *testing.T) {
 		f, err := os.CreateTemp("", "")
 		if err != nil {
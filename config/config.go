@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
@@ -39,6 +40,10 @@ const (
 
 	// DefaultBlockQueryWaitTime is amount of time in seconds to do a blocking query for
 	DefaultBlockQueryWaitTime = 60 * time.Second
+
+	// DefaultRenderConcurrency is the default number of templates rendered at
+	// once, which renders them one after the other.
+	DefaultRenderConcurrency = 1
 )
 
 // homePath is the location to the user's home directory.
@@ -58,9 +63,19 @@ type Config struct {
 	// Exec is the configuration for exec/supervise mode.
 	Exec *ExecConfig `mapstructure:"exec"`
 
+	// ExecDebounce is the window over which the commands of templates are
+	// coalesced. When set, a command runs at most once per window, however
+	// many of the templates it belongs to were rendered in the meantime.
+	ExecDebounce *time.Duration `mapstructure:"exec_debounce"`
+
 	// KillSignal is the signal to listen for a graceful terminate event.
 	KillSignal *os.Signal `mapstructure:"kill_signal"`
 
+	// RenderConcurrency is the maximum number of templates rendered at once.
+	// The commands of rendered templates still run in the order of the
+	// templates.
+	RenderConcurrency *int `mapstructure:"render_concurrency"`
+
 	// LogLevel is the level with which to log for this config.
 	LogLevel *string `mapstructure:"log_level"`
 
@@ -76,15 +91,25 @@ type Config struct {
 	// this processes PID.
 	PidFile *string `mapstructure:"pid_file"`
 
+	// RateLimit is the configuration for pacing the requests made for each
+	// class of dependencies.
+	RateLimit *RateLimitsConfig `mapstructure:"rate_limit"`
+
 	// ReloadSignal is the signal to listen for a reload event.
 	ReloadSignal *os.Signal `mapstructure:"reload_signal"`
 
 	// Syslog is the configuration for syslog.
 	Syslog *SyslogConfig `mapstructure:"syslog"`
 
+	// Telemetry is the configuration for emitting metrics.
+	Telemetry *TelemetryConfig `mapstructure:"telemetry"`
+
 	// Templates is the list of templates.
 	Templates *TemplateConfigs `mapstructure:"template"`
 
+	// Tracing is the configuration for OpenTelemetry tracing of render cycles.
+	Tracing *TracingConfig `mapstructure:"tracing"`
+
 	// TemplateErrFatal determines whether template errors should cause the
 	// process to exit, or just log and continue.
 	TemplateErrFatal *bool `mapstructure:"template_error_fatal"`
@@ -92,20 +117,40 @@ type Config struct {
 	// Vault is the configuration for connecting to a vault server.
 	Vault *VaultConfig `mapstructure:"vault"`
 
+	// VaultClusters are the configurations for connecting to additional,
+	// named Vault clusters.
+	VaultClusters *VaultConfigs `mapstructure:"vault_cluster"`
+
 	// Nomad is the configuration for connecting to a Nomad agent.
 	Nomad *NomadConfig `mapstructure:"nomad"`
 
 	// Wait is the quiescence timers.
 	Wait *WaitConfig `mapstructure:"wait"`
 
+	// Webhook is the configuration for notifying an external system of each
+	// render which changed a destination.
+	Webhook *WebhookConfig `mapstructure:"webhook"`
+
 	// Additional command line options
 	// Run once, executing each template exactly once, and exit
 	Once bool
 
+	// DiffMode runs once in dry mode, printing a unified diff between each
+	// destination and its rendered contents instead of writing it.
+	DiffMode bool
+
 	// ParseOnly prevents any rendering and only loads the templates for
 	// checking well formedness.
 	ParseOnly bool
 
+	// ConfigDirs are the directories whose .hcl and .json files are merged,
+	// in lexical order, over the configuration paths.
+	ConfigDirs []string `mapstructure:"-"`
+
+	// ConfigDirsRecursive also merges the files in subdirectories of the
+	// ConfigDirs, which are otherwise ignored.
+	ConfigDirsRecursive bool `mapstructure:"-"`
+
 	// BlockQueryWaitTime is amount of time in seconds to do a blocking query for
 	BlockQueryWaitTime *time.Duration `mapstructure:"block_query_wait"`
 
@@ -156,6 +201,9 @@ func (c *Config) Copy() *Config {
 		o.Exec = c.Exec.Copy()
 	}
 
+	o.ExecDebounce = c.ExecDebounce
+	o.RenderConcurrency = c.RenderConcurrency
+
 	o.KillSignal = c.KillSignal
 
 	o.LogLevel = c.LogLevel
@@ -164,6 +212,10 @@ func (c *Config) Copy() *Config {
 
 	o.PidFile = c.PidFile
 
+	if c.RateLimit != nil {
+		o.RateLimit = c.RateLimit.Copy()
+	}
+
 	o.ReloadSignal = c.ReloadSignal
 
 	if c.FileLog != nil {
@@ -174,10 +226,18 @@ func (c *Config) Copy() *Config {
 		o.Syslog = c.Syslog.Copy()
 	}
 
+	if c.Telemetry != nil {
+		o.Telemetry = c.Telemetry.Copy()
+	}
+
 	if c.Templates != nil {
 		o.Templates = c.Templates.Copy()
 	}
 
+	if c.Tracing != nil {
+		o.Tracing = c.Tracing.Copy()
+	}
+
 	if c.TemplateErrFatal != nil {
 		o.TemplateErrFatal = c.TemplateErrFatal
 	}
@@ -186,12 +246,25 @@ func (c *Config) Copy() *Config {
 		o.Vault = c.Vault.Copy()
 	}
 
+	if c.VaultClusters != nil {
+		o.VaultClusters = c.VaultClusters.Copy()
+	}
+
 	if c.Wait != nil {
 		o.Wait = c.Wait.Copy()
 	}
 
+	if c.Webhook != nil {
+		o.Webhook = c.Webhook.Copy()
+	}
+
 	o.Once = c.Once
+	o.DiffMode = c.DiffMode
 	o.ParseOnly = c.ParseOnly
+	if c.ConfigDirs != nil {
+		o.ConfigDirs = append([]string{}, c.ConfigDirs...)
+	}
+	o.ConfigDirsRecursive = c.ConfigDirsRecursive
 	o.ErrOnFailedLookup = c.ErrOnFailedLookup
 	o.BlockQueryWaitTime = c.BlockQueryWaitTime
 
@@ -237,6 +310,14 @@ func (c *Config) Merge(o *Config) *Config {
 		r.Exec = r.Exec.Merge(o.Exec)
 	}
 
+	if o.ExecDebounce != nil {
+		r.ExecDebounce = o.ExecDebounce
+	}
+
+	if o.RenderConcurrency != nil {
+		r.RenderConcurrency = o.RenderConcurrency
+	}
+
 	if o.KillSignal != nil {
 		r.KillSignal = o.KillSignal
 	}
@@ -253,6 +334,10 @@ func (c *Config) Merge(o *Config) *Config {
 		r.PidFile = o.PidFile
 	}
 
+	if o.RateLimit != nil {
+		r.RateLimit = r.RateLimit.Merge(o.RateLimit)
+	}
+
 	if o.ReloadSignal != nil {
 		r.ReloadSignal = o.ReloadSignal
 	}
@@ -265,10 +350,18 @@ func (c *Config) Merge(o *Config) *Config {
 		r.Syslog = r.Syslog.Merge(o.Syslog)
 	}
 
+	if o.Telemetry != nil {
+		r.Telemetry = r.Telemetry.Merge(o.Telemetry)
+	}
+
 	if o.Templates != nil {
 		r.Templates = r.Templates.Merge(o.Templates)
 	}
 
+	if o.Tracing != nil {
+		r.Tracing = r.Tracing.Merge(o.Tracing)
+	}
+
 	if o.TemplateErrFatal != nil {
 		r.TemplateErrFatal = o.TemplateErrFatal
 	}
@@ -277,16 +370,31 @@ func (c *Config) Merge(o *Config) *Config {
 		r.Vault = r.Vault.Merge(o.Vault)
 	}
 
+	if o.VaultClusters != nil {
+		r.VaultClusters = r.VaultClusters.Merge(o.VaultClusters)
+	}
+
 	if o.Wait != nil {
 		r.Wait = r.Wait.Merge(o.Wait)
 	}
 
+	if o.Webhook != nil {
+		r.Webhook = r.Webhook.Merge(o.Webhook)
+	}
+
 	if o.BlockQueryWaitTime != nil {
 		r.BlockQueryWaitTime = o.BlockQueryWaitTime
 	}
 
 	r.Once = o.Once
+	r.DiffMode = o.DiffMode
 	r.ParseOnly = o.ParseOnly
+	if o.ConfigDirs != nil {
+		r.ConfigDirs = append(r.ConfigDirs, o.ConfigDirs...)
+	}
+	if o.ConfigDirsRecursive {
+		r.ConfigDirsRecursive = o.ConfigDirsRecursive
+	}
 	if o.ErrOnFailedLookup {
 		r.ErrOnFailedLookup = o.ErrOnFailedLookup
 	}
@@ -330,17 +438,28 @@ func Parse(s string) (*Config, error) {
 		"env",
 		"exec",
 		"exec.env",
+		"exec.retry",
 		"log_file",
 		"nomad",
 		"nomad.ssl",
 		"nomad.transport",
+		"rate_limit",
+		"rate_limit.catalog",
+		"rate_limit.health",
+		"rate_limit.kv",
+		"rate_limit.vault",
 		"ssl",
 		"syslog",
+		"telemetry",
+		"tracing",
 		"vault",
 		"vault.retry",
 		"vault.ssl",
 		"vault.transport",
 		"wait",
+		"webhook",
+		"webhook.headers",
+		"webhook.retry",
 	})
 
 	// FlattenFlatten keys belonging to the templates. We cannot do this above
@@ -351,11 +470,38 @@ func Parse(s string) (*Config, error) {
 				"env",
 				"exec",
 				"exec.env",
+				"exec.retry",
 				"wait",
 			})
 		}
 	}
 
+	// Flatten the keys belonging to each of the named Vault clusters. The
+	// retries of Vault queries are configured once, by the vault block.
+	if clusters, ok := parsed["vault_cluster"].([]map[string]interface{}); ok {
+		for _, cluster := range clusters {
+			if _, ok := cluster["retry"]; ok {
+				return nil, errors.New("vault_cluster: retry is only supported in the vault block")
+			}
+			flattenKeys(cluster, []string{
+				"ssl",
+				"transport",
+			})
+		}
+	}
+
+	// The vault block configures the default cluster, which has no name.
+	if vault, ok := parsed["vault"].(map[string]interface{}); ok {
+		if _, ok := vault["name"]; ok {
+			return nil, errors.New("vault: name is only supported in vault_cluster blocks")
+		}
+	}
+
+	// Expand any environment variable references before the values are decoded
+	if err := expandEnv(parsed); err != nil {
+		return nil, errors.Wrap(err, "error expanding environment variables")
+	}
+
 	// Create a new, empty config
 	var c Config
 
@@ -433,47 +579,60 @@ func FromPath(path string) (*Config, error) {
 
 	// Recursively parse directories, single load files
 	if stat.Mode().IsDir() {
-		// Ensure the given filepath has at least one config file
-		_, err := os.ReadDir(path)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed listing dir: "+path)
-		}
+		return fromDir(path, true, nil)
+	} else if stat.Mode().IsRegular() {
+		return FromFile(path)
+	}
 
-		// Create a blank config to merge off of
-		var c *Config
+	return nil, fmt.Errorf("unknown filetype: %q", stat.Mode().String())
+}
 
-		// Potential bug: Walk does not follow symlinks!
-		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-			// If WalkFunc had an error, just return it
-			if err != nil {
-				return err
-			}
+// configDirExts are the extensions of the files merged by FromDir.
+var configDirExts = map[string]struct{}{
+	".hcl":  {},
+	".json": {},
+}
 
-			// Do nothing for directories
-			if info.IsDir() {
-				return nil
-			}
+// FromDir merges the .hcl and .json files in the given directory in lexical
+// order, returning the resulting config. Subdirectories are ignored unless
+// recursive is set, in which case their files are merged in the place of the
+// subdirectory.
+func FromDir(path string, recursive bool) (*Config, error) {
+	return fromDir(path, recursive, configDirExts)
+}
 
-			// Parse and merge the config
-			newConfig, err := FromFile(path)
-			if err != nil {
-				return err
-			}
-			c = c.Merge(newConfig)
+// fromDir merges the files in the given directory in lexical order, recursing
+// into subdirectories if recursive is set. If exts is given, only the files
+// with one of those extensions are merged.
+func fromDir(path string, recursive bool, exts map[string]struct{}) (*Config, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing dir: "+path)
+	}
 
-			return nil
-		})
+	var c *Config
+	for _, entry := range entries {
+		entryPath := filepath.Join(path, entry.Name())
 
+		var newConfig *Config
+		if entry.IsDir() {
+			if !recursive {
+				continue
+			}
+			newConfig, err = fromDir(entryPath, recursive, exts)
+		} else {
+			if _, ok := exts[filepath.Ext(entry.Name())]; exts != nil && !ok {
+				continue
+			}
+			newConfig, err = FromFile(entryPath)
+		}
 		if err != nil {
-			return nil, errors.Wrap(err, "walk error")
+			return nil, err
 		}
-
-		return c, nil
-	} else if stat.Mode().IsRegular() {
-		return FromFile(path)
+		c = c.Merge(newConfig)
 	}
 
-	return nil, fmt.Errorf("unknown filetype: %q", stat.Mode().String())
+	return c, nil
 }
 
 // GoString defines the printable version of this struct.
@@ -487,18 +646,26 @@ func (c *Config) GoString() string {
 		"Dedup:%#v, "+
 		"DefaultDelims:%#v, "+
 		"Exec:%#v, "+
+		"ExecDebounce:%s, "+
+		"RenderConcurrency:%s, "+
 		"KillSignal:%s, "+
 		"LogLevel:%s, "+
 		"MaxStale:%s, "+
 		"PidFile:%s, "+
+		"RateLimit:%#v, "+
 		"ReloadSignal:%s, "+
 		"FileLog:%#v, "+
 		"Syslog:%#v, "+
+		"Telemetry:%#v, "+
 		"Templates:%#v, "+
 		"TemplateErrFatal:%#v"+
+		"Tracing:%#v, "+
 		"Vault:%#v, "+
+		"VaultClusters:%#v, "+
 		"Wait:%#v, "+
+		"Webhook:%#v, "+
 		"Once:%#v, "+
+		"DiffMode:%#v, "+
 		"BlockQueryWaitTime:%#v, "+
 		"ErrOnFailedLookup:%#v"+
 		"}",
@@ -506,18 +673,26 @@ func (c *Config) GoString() string {
 		c.Dedup,
 		c.DefaultDelims,
 		c.Exec,
+		TimeDurationGoString(c.ExecDebounce),
+		IntGoString(c.RenderConcurrency),
 		SignalGoString(c.KillSignal),
 		StringGoString(c.LogLevel),
 		TimeDurationGoString(c.MaxStale),
 		StringGoString(c.PidFile),
+		c.RateLimit,
 		SignalGoString(c.ReloadSignal),
 		c.FileLog,
 		c.Syslog,
+		c.Telemetry,
 		c.Templates,
 		c.TemplateErrFatal,
+		c.Tracing,
 		c.Vault,
+		c.VaultClusters,
 		c.Wait,
+		c.Webhook,
 		c.Once,
+		c.DiffMode,
 		TimeDurationGoString(c.BlockQueryWaitTime),
 		c.ErrOnFailedLookup,
 	)
@@ -560,10 +735,15 @@ func DefaultConfig() *Config {
 		Exec:          DefaultExecConfig(),
 		FileLog:       DefaultLogFileConfig(),
 		Nomad:         DefaultNomadConfig(),
+		RateLimit:     DefaultRateLimitsConfig(),
 		Syslog:        DefaultSyslogConfig(),
+		Telemetry:     DefaultTelemetryConfig(),
 		Templates:     DefaultTemplateConfigs(),
+		Tracing:       DefaultTracingConfig(),
 		Vault:         DefaultVaultConfig(),
+		VaultClusters: DefaultVaultConfigs(),
 		Wait:          DefaultWaitConfig(),
+		Webhook:       DefaultWebhookConfig(),
 	}
 }
 
@@ -607,6 +787,14 @@ func (c *Config) Finalize() {
 		}, DefaultLogLevel)
 	}
 
+	if c.ExecDebounce == nil {
+		c.ExecDebounce = TimeDuration(0)
+	}
+
+	if c.RenderConcurrency == nil || *c.RenderConcurrency < 1 {
+		c.RenderConcurrency = Int(DefaultRenderConcurrency)
+	}
+
 	if c.MaxStale == nil {
 		c.MaxStale = TimeDuration(DefaultMaxStale)
 	}
@@ -619,6 +807,11 @@ func (c *Config) Finalize() {
 		c.ReloadSignal = Signal(DefaultReloadSignal)
 	}
 
+	if c.RateLimit == nil {
+		c.RateLimit = DefaultRateLimitsConfig()
+	}
+	c.RateLimit.Finalize()
+
 	if c.FileLog == nil {
 		c.FileLog = DefaultLogFileConfig()
 	}
@@ -644,16 +837,41 @@ func (c *Config) Finalize() {
 	}
 	c.Templates.Finalize()
 
+	if c.Telemetry == nil {
+		c.Telemetry = DefaultTelemetryConfig()
+	}
+	c.Telemetry.Finalize()
+
+	if c.Tracing == nil {
+		c.Tracing = DefaultTracingConfig()
+	}
+	c.Tracing.Finalize()
+
 	if c.Vault == nil {
 		c.Vault = DefaultVaultConfig()
 	}
 	c.Vault.Finalize()
 
+	if c.VaultClusters == nil {
+		c.VaultClusters = DefaultVaultConfigs()
+	}
+	c.VaultClusters.Finalize()
+
+	if c.Webhook == nil {
+		c.Webhook = DefaultWebhookConfig()
+	}
+	c.Webhook.Finalize()
+
 	if c.Wait == nil {
 		c.Wait = DefaultWaitConfig()
 	}
 	c.Wait.Finalize()
 
+	// diff mode compares a single render of each template
+	if c.DiffMode {
+		c.Once = true
+	}
+
 	// disable Wait if -once was specified
 	if c.Once {
 		c.Wait = &WaitConfig{Enabled: Bool(false)}
@@ -757,3 +975,86 @@ func flattenKeys(m map[string]interface{}, keys []string) {
 
 	flatten(m, "")
 }
+
+// envRefRe matches the "${NAME}" and "${NAME:-default}" environment variable
+// references in config values. A leading "$$" escapes the reference.
+var envRefRe = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnvSkipKeys are the keys whose values are left as-is when expanding
+// environment variables, since they hold template text or commands, both of
+// which commonly contain their own "${...}" references.
+var expandEnvSkipKeys = map[string]struct{}{
+	"command":  {},
+	"contents": {},
+}
+
+// expandEnv recursively replaces the environment variable references in all of
+// the string values of the given map. It returns an error naming the variable
+// and key for any reference to an unset variable which does not have a default.
+func expandEnv(m map[string]interface{}) error {
+	var expand func(interface{}, string) (interface{}, error)
+	expand = func(v interface{}, key string) (interface{}, error) {
+		switch typed := v.(type) {
+		case string:
+			return expandEnvString(typed, key)
+		case map[string]interface{}:
+			for k, v := range typed {
+				if _, ok := expandEnvSkipKeys[k]; ok {
+					continue
+				}
+				mapKey := k
+				if key != "" {
+					mapKey = key + "." + k
+				}
+				expanded, err := expand(v, mapKey)
+				if err != nil {
+					return nil, err
+				}
+				typed[k] = expanded
+			}
+		case []map[string]interface{}:
+			for _, item := range typed {
+				if _, err := expand(item, key); err != nil {
+					return nil, err
+				}
+			}
+		case []interface{}:
+			for i, item := range typed {
+				expanded, err := expand(item, key)
+				if err != nil {
+					return nil, err
+				}
+				typed[i] = expanded
+			}
+		}
+		return v, nil
+	}
+
+	_, err := expand(m, "")
+	return err
+}
+
+// expandEnvString replaces the environment variable references in s. As in the
+// shell, the default is used when the variable is unset or empty.
+func expandEnvString(s, key string) (string, error) {
+	var err error
+	result := envRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+
+		match := envRefRe.FindStringSubmatch(ref)
+		name, def := match[1], match[2]
+		if val, ok := os.LookupEnv(name); ok && (val != "" || def == "") {
+			return val
+		}
+		if def != "" {
+			return strings.TrimPrefix(def, ":-")
+		}
+		if err == nil {
+			err = fmt.Errorf("%s: environment variable %q is not set", key, name)
+		}
+		return ref
+	})
+	return result, err
+}
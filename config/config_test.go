@@ -6,8 +6,10 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -537,6 +539,44 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"exec_timeout_signal",
+			`exec {
+				timeout        = "30s"
+				timeout_signal = "SIGTERM"
+				timeout_grace  = "10s"
+			 }`,
+			&Config{
+				Exec: &ExecConfig{
+					Timeout:       TimeDuration(30 * time.Second),
+					TimeoutSignal: Signal(syscall.SIGTERM),
+					TimeoutGrace:  TimeDuration(10 * time.Second),
+				},
+			},
+			false,
+		},
+		{
+			"exec_retry",
+			`exec {
+				retry {
+					attempts   = 3
+					backoff    = "2s"
+					multiplier = 1.5
+				}
+				rollback = true
+			 }`,
+			&Config{
+				Exec: &ExecConfig{
+					Retry: &ExecRetryConfig{
+						Attempts:   Int(3),
+						Backoff:    TimeDuration(2 * time.Second),
+						Multiplier: Float64(1.5),
+					},
+					Rollback: Bool(true),
+				},
+			},
+			false,
+		},
 		{
 			"kill_signal",
 			`kill_signal = "SIGUSR1"`,
@@ -629,6 +669,22 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"exec_debounce",
+			`exec_debounce = "2s"`,
+			&Config{
+				ExecDebounce: TimeDuration(2 * time.Second),
+			},
+			false,
+		},
+		{
+			"render_concurrency",
+			`render_concurrency = 4`,
+			&Config{
+				RenderConcurrency: Int(4),
+			},
+			false,
+		},
 		{
 			"block_query_wait",
 			`block_query_wait = "61s"`,
@@ -749,6 +805,84 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"telemetry",
+			`telemetry {
+				statsd_address     = "127.0.0.1:8125"
+				metrics_prefix     = "ct"
+				prometheus_address = "127.0.0.1:9102"
+			}`,
+			&Config{
+				Telemetry: &TelemetryConfig{
+					StatsdAddress:     String("127.0.0.1:8125"),
+					MetricsPrefix:     String("ct"),
+					PrometheusAddress: String("127.0.0.1:9102"),
+				},
+			},
+			false,
+		},
+		{
+			"tracing",
+			`tracing {
+				endpoint = "collector:4318"
+				insecure = true
+			}`,
+			&Config{
+				Tracing: &TracingConfig{
+					Endpoint: String("collector:4318"),
+					Insecure: Bool(true),
+				},
+			},
+			false,
+		},
+		{
+			"webhook",
+			`webhook {
+				url     = "https://deploy.example.com/hook"
+				headers = {
+					Authorization = "Bearer secret"
+				}
+				timeout = "5s"
+				retry {
+					attempts = 3
+				}
+			}`,
+			&Config{
+				Webhook: &WebhookConfig{
+					URL:     String("https://deploy.example.com/hook"),
+					Headers: map[string]string{"Authorization": "Bearer secret"},
+					Timeout: TimeDuration(5 * time.Second),
+					Retry: &RetryConfig{
+						Attempts: Int(3),
+					},
+				},
+			},
+			false,
+		},
+		{
+			"rate_limit",
+			`rate_limit {
+				catalog {
+					rate  = 10
+					burst = 20
+				}
+				vault {
+					rate = 0.5
+				}
+			}`,
+			&Config{
+				RateLimit: &RateLimitsConfig{
+					Catalog: &RateLimitConfig{
+						Rate:  Float64(10),
+						Burst: Int(20),
+					},
+					Vault: &RateLimitConfig{
+						Rate: Float64(0.5),
+					},
+				},
+			},
+			false,
+		},
 		{
 			"template",
 			`template {}`,
@@ -1311,6 +1445,50 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"template_skip_if_unchanged_remote",
+			`template {
+				skip_if_unchanged_remote = "consul://kv/foo/bar"
+			}`,
+			&Config{
+				Templates: &TemplateConfigs{
+					&TemplateConfig{
+						SkipIfUnchangedRemote: String("consul://kv/foo/bar"),
+					},
+				},
+			},
+			false,
+		},
+		{
+			"template_render_group",
+			`template {
+				render_group = "proxy"
+			}`,
+			&Config{
+				Templates: &TemplateConfigs{
+					&TemplateConfig{
+						RenderGroup: String("proxy"),
+					},
+				},
+			},
+			false,
+		},
+		{
+			"template_plugin_limits",
+			`template {
+				plugin_timeout = "5s"
+				plugin_max_output_bytes = 4096
+			}`,
+			&Config{
+				Templates: &TemplateConfigs{
+					&TemplateConfig{
+						PluginTimeout:        TimeDuration(5 * time.Second),
+						PluginMaxOutputBytes: Int(4096),
+					},
+				},
+			},
+			false,
+		},
 		{
 			"vault",
 			`vault {}`,
@@ -1699,6 +1877,57 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"vault_cluster",
+			`vault_cluster {
+				name    = "primary"
+				address = "https://primary.vault:8200"
+			}
+			vault_cluster {
+				name    = "regional"
+				address = "https://regional.vault:8200"
+				token   = "abcd1234"
+				ssl {
+					ca_cert = "ca.pem"
+				}
+			}`,
+			&Config{
+				VaultClusters: &VaultConfigs{
+					&VaultConfig{
+						Name:    String("primary"),
+						Address: String("https://primary.vault:8200"),
+					},
+					&VaultConfig{
+						Name:    String("regional"),
+						Address: String("https://regional.vault:8200"),
+						Token:   String("abcd1234"),
+						SSL: &SSLConfig{
+							CaCert: String("ca.pem"),
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"vault_cluster_retry",
+			`vault_cluster {
+				name = "regional"
+				retry {
+					attempts = 3
+				}
+			}`,
+			nil,
+			true,
+		},
+		{
+			"vault_name",
+			`vault {
+				name = "primary"
+			}`,
+			nil,
+			true,
+		},
 		{
 			"wait",
 			`wait {
@@ -1872,6 +2101,123 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestParse_envInterpolation(t *testing.T) {
+	t.Setenv("CT_TEST_ADDR", "1.2.3.4:8500")
+	t.Setenv("CT_TEST_TOKEN", "abcd1234")
+	t.Setenv("CT_TEST_DIR", "/tmp/ct")
+	t.Setenv("CT_TEST_EMPTY", "")
+
+	cases := []struct {
+		name string
+		i    string
+		e    *Config
+		err  string
+	}{
+		{
+			"expands",
+			`consul {
+				address = "${CT_TEST_ADDR}"
+			}
+			vault {
+				token = "${CT_TEST_TOKEN}"
+			}
+			template {
+				source      = "${CT_TEST_DIR}/in.tpl"
+				destination = "${CT_TEST_DIR}/out.txt"
+			}`,
+			&Config{
+				Consul: &ConsulConfig{
+					Address: String("1.2.3.4:8500"),
+				},
+				Vault: &VaultConfig{
+					Token: String("abcd1234"),
+				},
+				Templates: &TemplateConfigs{
+					&TemplateConfig{
+						Source:      String("/tmp/ct/in.tpl"),
+						Destination: String("/tmp/ct/out.txt"),
+					},
+				},
+			},
+			"",
+		},
+		{
+			"default",
+			`consul {
+				address = "${CT_TEST_UNSET:-127.0.0.1:8500}"
+				token   = "${CT_TEST_EMPTY:-fallback}"
+			}
+			vault {
+				token = "${CT_TEST_UNSET:-}"
+			}`,
+			&Config{
+				Consul: &ConsulConfig{
+					Address: String("127.0.0.1:8500"),
+					Token:   String("fallback"),
+				},
+				Vault: &VaultConfig{
+					Token: String(""),
+				},
+			},
+			"",
+		},
+		{
+			"escaped",
+			`consul {
+				address = "$${CT_TEST_ADDR}"
+			}`,
+			&Config{
+				Consul: &ConsulConfig{
+					Address: String("${CT_TEST_ADDR}"),
+				},
+			},
+			"",
+		},
+		{
+			"skips_contents_and_commands",
+			`template {
+				contents = "${CT_TEST_UNSET}"
+				command  = "echo ${CT_TEST_UNSET}"
+			}`,
+			&Config{
+				Templates: &TemplateConfigs{
+					&TemplateConfig{
+						Contents: String("${CT_TEST_UNSET}"),
+						Command:  []string{"echo ${CT_TEST_UNSET}"},
+					},
+				},
+			},
+			"",
+		},
+		{
+			"undefined",
+			`vault {
+				address = "${CT_TEST_UNSET}"
+			}`,
+			nil,
+			`vault.address: environment variable "CT_TEST_UNSET" is not set`,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			c, err := Parse(tc.i)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.e, c) {
+				t.Errorf("Config diff: %s", tc.e.Diff(c))
+			}
+		})
+	}
+}
+
 func TestFinalize(t *testing.T) {
 	testFileContents := "testing123"
 	testFilePath, remove := testFile(t, testFileContents)
@@ -1984,6 +2330,24 @@ func TestFinalize(t *testing.T) {
 				},
 			},
 		},
+		{
+			"diff-mode-runs-once",
+			func(act, exp *Config) (bool, error) {
+				if act.Once != exp.Once || !reflect.DeepEqual(act.Wait, exp.Wait) {
+					return false, fmt.Errorf("\nexp: %#v\nact: %#v", exp, act)
+				}
+				return true, nil
+			},
+			&Config{
+				DiffMode: true,
+			},
+			&Config{
+				Once: true,
+				Wait: &WaitConfig{
+					Enabled: Bool(false),
+				},
+			},
+		},
 		{
 			"uid_backward_compat",
 			func(act, exp *Config) (bool, error) {
@@ -2204,6 +2568,30 @@ func TestConfig_Merge(t *testing.T) {
 				MaxStale: TimeDuration(20 * time.Second),
 			},
 		},
+		{
+			"exec_debounce",
+			&Config{
+				ExecDebounce: TimeDuration(1 * time.Second),
+			},
+			&Config{
+				ExecDebounce: TimeDuration(2 * time.Second),
+			},
+			&Config{
+				ExecDebounce: TimeDuration(2 * time.Second),
+			},
+		},
+		{
+			"render_concurrency",
+			&Config{
+				RenderConcurrency: Int(1),
+			},
+			&Config{
+				RenderConcurrency: Int(4),
+			},
+			&Config{
+				RenderConcurrency: Int(4),
+			},
+		},
 		{
 			"block_query_wait",
 			&Config{
@@ -2403,6 +2791,20 @@ func TestFromPath(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// Files in subdirectories are merged too, whatever their extension.
+	nestedDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(nestedDir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	d = []byte(`
+		consul {
+			address = "5.6.7.8"
+		}
+	`)
+	if err := os.WriteFile(filepath.Join(nestedDir, "sub", "consul.conf"), d, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
 	cases := []struct {
 		name string
 		path string
@@ -2438,6 +2840,16 @@ func TestFromPath(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"nested_dir",
+			nestedDir,
+			&Config{
+				Consul: &ConsulConfig{
+					Address: String("5.6.7.8"),
+				},
+			},
+			false,
+		},
 	}
 
 	for i, tc := range cases {
@@ -2453,6 +2865,100 @@ func TestFromPath(t *testing.T) {
 	}
 }
 
+func TestFromDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"10-consul.hcl": `
+			consul {
+				address = "1.2.3.4"
+				token   = "token"
+			}
+			template {
+				source      = "a.tpl"
+				destination = "a.out"
+			}`,
+		"20-override.json": `{
+			"consul": { "address": "5.6.7.8" },
+			"template": [{ "source": "b.tpl", "destination": "b.out" }]
+		}`,
+		"30-notes.txt": `not a config file`,
+		"15-sub/template.hcl": `
+			template {
+				source      = "c.tpl"
+				destination = "c.out"
+			}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpl := func(name string) *TemplateConfig {
+		return &TemplateConfig{
+			Source:      String(name + ".tpl"),
+			Destination: String(name + ".out"),
+		}
+	}
+
+	cases := []struct {
+		name      string
+		path      string
+		recursive bool
+		e         *Config
+		err       bool
+	}{
+		{
+			"missing_dir",
+			"/not/a/real/dir",
+			false,
+			nil,
+			true,
+		},
+		{
+			"merged",
+			dir,
+			false,
+			&Config{
+				Consul: &ConsulConfig{
+					Address: String("5.6.7.8"),
+					Token:   String("token"),
+				},
+				Templates: &TemplateConfigs{tmpl("a"), tmpl("b")},
+			},
+			false,
+		},
+		{
+			"recursive",
+			dir,
+			true,
+			&Config{
+				Consul: &ConsulConfig{
+					Address: String("5.6.7.8"),
+					Token:   String("token"),
+				},
+				Templates: &TemplateConfigs{tmpl("a"), tmpl("c"), tmpl("b")},
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			c, err := FromDir(tc.path, tc.recursive)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.e, c) {
+				t.Errorf("Config diff: %s", tc.e.Diff(c))
+			}
+		})
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	// Can't use t.Parallel() as this sets/unsets environment variables
 	cases := []struct {
@@ -23,12 +23,21 @@ const (
 	// command to exit. By default, this is disabled, which means the command
 	// is allowed to run for an infinite amount of time.
 	DefaultExecTimeout = 0 * time.Second
+
+	// DefaultExecTimeoutGrace is the default amount of time to wait for a
+	// command which timed out to exit after the timeout signal before
+	// force-killing it.
+	DefaultExecTimeoutGrace = 5 * time.Second
 )
 
 // DefaultExecReloadSignal is the default signal to send to the process to
 // tell it to reload its configuration.
 var DefaultExecReloadSignal = (os.Signal)(nil)
 
+// DefaultExecTimeoutSignal is the default signal to send to a command which
+// timed out. By default, no signal is sent and the command is force-killed.
+var DefaultExecTimeoutSignal = (os.Signal)(nil)
+
 // ExecConfig is used to configure the application when it runs in
 // exec/supervise mode.
 type ExecConfig struct {
@@ -60,6 +69,24 @@ type ExecConfig struct {
 	// Timeout is the maximum amount of time to wait for a command to complete.
 	// By default, this is 0, which means "wait forever".
 	Timeout *time.Duration `mapstructure:"timeout"`
+
+	// TimeoutSignal is the signal to send to a command which did not complete
+	// within the timeout, to let it terminate gracefully. If it has not exited
+	// after the TimeoutGrace, it is force-killed. By default, no signal is sent
+	// and the command is force-killed right away.
+	TimeoutSignal *os.Signal `mapstructure:"timeout_signal"`
+
+	// TimeoutGrace is the amount of time to give a command which timed out to
+	// exit after the TimeoutSignal before force-killing it.
+	TimeoutGrace *time.Duration `mapstructure:"timeout_grace"`
+
+	// Retry is the configuration for retrying the command of a template when it
+	// exits with a non-zero code.
+	Retry *ExecRetryConfig `mapstructure:"retry"`
+
+	// Rollback restores the previous contents of the template destination when
+	// its command fails, once any retries are exhausted.
+	Rollback *bool `mapstructure:"rollback"`
 }
 
 // commandList is a []string with a common method for testing for content
@@ -73,7 +100,8 @@ func (c commandList) Empty() bool {
 // default values.
 func DefaultExecConfig() *ExecConfig {
 	return &ExecConfig{
-		Env: DefaultEnvConfig(),
+		Env:   DefaultEnvConfig(),
+		Retry: DefaultExecRetryConfig(),
 	}
 }
 
@@ -103,6 +131,16 @@ func (c *ExecConfig) Copy() *ExecConfig {
 
 	o.Timeout = c.Timeout
 
+	o.TimeoutSignal = c.TimeoutSignal
+
+	o.TimeoutGrace = c.TimeoutGrace
+
+	if c.Retry != nil {
+		o.Retry = c.Retry.Copy()
+	}
+
+	o.Rollback = c.Rollback
+
 	return &o
 }
 
@@ -156,6 +194,22 @@ func (c *ExecConfig) Merge(o *ExecConfig) *ExecConfig {
 		r.Timeout = o.Timeout
 	}
 
+	if o.TimeoutSignal != nil {
+		r.TimeoutSignal = o.TimeoutSignal
+	}
+
+	if o.TimeoutGrace != nil {
+		r.TimeoutGrace = o.TimeoutGrace
+	}
+
+	if o.Retry != nil {
+		r.Retry = r.Retry.Merge(o.Retry)
+	}
+
+	if o.Rollback != nil {
+		r.Rollback = o.Rollback
+	}
+
 	return r
 }
 
@@ -193,6 +247,23 @@ func (c *ExecConfig) Finalize() {
 	if c.Timeout == nil {
 		c.Timeout = TimeDuration(DefaultExecTimeout)
 	}
+
+	if c.TimeoutSignal == nil {
+		c.TimeoutSignal = Signal(DefaultExecTimeoutSignal)
+	}
+
+	if c.TimeoutGrace == nil {
+		c.TimeoutGrace = TimeDuration(DefaultExecTimeoutGrace)
+	}
+
+	if c.Retry == nil {
+		c.Retry = DefaultExecRetryConfig()
+	}
+	c.Retry.Finalize()
+
+	if c.Rollback == nil {
+		c.Rollback = Bool(false)
+	}
 }
 
 // GoString defines the printable version of this struct.
@@ -209,7 +280,11 @@ func (c *ExecConfig) GoString() string {
 		"KillTimeout:%s, "+
 		"ReloadSignal:%s, "+
 		"Splay:%s, "+
-		"Timeout:%s"+
+		"Timeout:%s, "+
+		"TimeoutSignal:%s, "+
+		"TimeoutGrace:%s, "+
+		"Retry:%#v, "+
+		"Rollback:%s"+
 		"}",
 		c.Command,
 		BoolGoString(c.Enabled),
@@ -219,5 +294,9 @@ func (c *ExecConfig) GoString() string {
 		SignalGoString(c.ReloadSignal),
 		TimeDurationGoString(c.Splay),
 		TimeDurationGoString(c.Timeout),
+		SignalGoString(c.TimeoutSignal),
+		TimeDurationGoString(c.TimeoutGrace),
+		c.Retry,
+		BoolGoString(c.Rollback),
 	)
 }
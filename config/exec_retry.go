@@ -0,0 +1,138 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultExecRetryAttempts is the default number of times to retry a failed
+	// command. By default, failed commands are not retried.
+	DefaultExecRetryAttempts = 0
+
+	// DefaultExecRetryBackoff is the default amount of time to wait before the
+	// first retry of a failed command.
+	DefaultExecRetryBackoff = 1 * time.Second
+
+	// DefaultExecRetryMultiplier is the default factor by which the time to
+	// wait grows with each retry of a failed command.
+	DefaultExecRetryMultiplier = 2.0
+)
+
+// ExecRetryConfig is the configuration for retrying a command which exits with
+// a non-zero code. This is separate from RetryConfig, which retries requests to
+// the upstreams.
+type ExecRetryConfig struct {
+	// Attempts is the maximum number of times to retry a failed command before
+	// giving up. 0 disables retries.
+	Attempts *int `mapstructure:"attempts"`
+
+	// Backoff is the amount of time to wait before the first retry.
+	Backoff *time.Duration `mapstructure:"backoff"`
+
+	// Multiplier is the factor by which the time to wait grows with each
+	// further retry.
+	Multiplier *float64 `mapstructure:"multiplier"`
+}
+
+// DefaultExecRetryConfig returns a configuration that is populated with the
+// default values.
+func DefaultExecRetryConfig() *ExecRetryConfig {
+	return &ExecRetryConfig{}
+}
+
+// Copy returns a deep copy of this configuration.
+func (c *ExecRetryConfig) Copy() *ExecRetryConfig {
+	if c == nil {
+		return nil
+	}
+
+	var o ExecRetryConfig
+
+	o.Attempts = c.Attempts
+
+	o.Backoff = c.Backoff
+
+	o.Multiplier = c.Multiplier
+
+	return &o
+}
+
+// Merge combines all values in this configuration with the values in the other
+// configuration, with values in the other configuration taking precedence.
+// Maps and slices are merged, most other values are overwritten. Complex
+// structs define their own merge functionality.
+func (c *ExecRetryConfig) Merge(o *ExecRetryConfig) *ExecRetryConfig {
+	if c == nil {
+		if o == nil {
+			return nil
+		}
+		return o.Copy()
+	}
+
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.Attempts != nil {
+		r.Attempts = o.Attempts
+	}
+
+	if o.Backoff != nil {
+		r.Backoff = o.Backoff
+	}
+
+	if o.Multiplier != nil {
+		r.Multiplier = o.Multiplier
+	}
+
+	return r
+}
+
+// RetryBackoff returns the amount of time to wait before the given retry of a
+// failed command, starting at 0 for the first retry.
+func (c *ExecRetryConfig) RetryBackoff(retry int) time.Duration {
+	backoff := float64(TimeDurationVal(c.Backoff))
+	if c.Multiplier != nil {
+		backoff *= math.Pow(*c.Multiplier, float64(retry))
+	}
+	return time.Duration(backoff)
+}
+
+// Finalize ensures there no nil pointers.
+func (c *ExecRetryConfig) Finalize() {
+	if c.Attempts == nil {
+		c.Attempts = Int(DefaultExecRetryAttempts)
+	}
+
+	if c.Backoff == nil {
+		c.Backoff = TimeDuration(DefaultExecRetryBackoff)
+	}
+
+	if c.Multiplier == nil {
+		c.Multiplier = Float64(DefaultExecRetryMultiplier)
+	}
+}
+
+// GoString defines the printable version of this struct.
+func (c *ExecRetryConfig) GoString() string {
+	if c == nil {
+		return "(*ExecRetryConfig)(nil)"
+	}
+
+	return fmt.Sprintf("&ExecRetryConfig{"+
+		"Attempts:%s, "+
+		"Backoff:%s, "+
+		"Multiplier:%s"+
+		"}",
+		IntGoString(c.Attempts),
+		TimeDurationGoString(c.Backoff),
+		FloatGoString(c.Multiplier),
+	)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExecRetryConfig_Copy(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *ExecRetryConfig
+	}{
+		{
+			"nil",
+			nil,
+		},
+		{
+			"empty",
+			&ExecRetryConfig{},
+		},
+		{
+			"copy",
+			&ExecRetryConfig{
+				Attempts:   Int(3),
+				Backoff:    TimeDuration(2 * time.Second),
+				Multiplier: Float64(1.5),
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Copy()
+			if !reflect.DeepEqual(tc.a, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.a, r)
+			}
+		})
+	}
+}
+
+func TestExecRetryConfig_Merge(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *ExecRetryConfig
+		b    *ExecRetryConfig
+		r    *ExecRetryConfig
+	}{
+		{
+			"nil_a",
+			nil,
+			&ExecRetryConfig{},
+			&ExecRetryConfig{},
+		},
+		{
+			"nil_b",
+			&ExecRetryConfig{},
+			nil,
+			&ExecRetryConfig{},
+		},
+		{
+			"nil_both",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"attempts_overrides",
+			&ExecRetryConfig{Attempts: Int(1)},
+			&ExecRetryConfig{Attempts: Int(3)},
+			&ExecRetryConfig{Attempts: Int(3)},
+		},
+		{
+			"backoff_empty_two",
+			&ExecRetryConfig{Backoff: TimeDuration(time.Second)},
+			&ExecRetryConfig{},
+			&ExecRetryConfig{Backoff: TimeDuration(time.Second)},
+		},
+		{
+			"multiplier_empty_one",
+			&ExecRetryConfig{},
+			&ExecRetryConfig{Multiplier: Float64(3)},
+			&ExecRetryConfig{Multiplier: Float64(3)},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Merge(tc.b)
+			if !reflect.DeepEqual(tc.r, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, r)
+			}
+		})
+	}
+}
+
+func TestExecRetryConfig_RetryBackoff(t *testing.T) {
+	c := &ExecRetryConfig{
+		Backoff:    TimeDuration(100 * time.Millisecond),
+		Multiplier: Float64(3),
+	}
+	for retry, exp := range []time.Duration{
+		100 * time.Millisecond,
+		300 * time.Millisecond,
+		900 * time.Millisecond,
+	} {
+		if act := c.RetryBackoff(retry); exp != act {
+			t.Errorf("retry %d\nexp: %s\nact: %s", retry, exp, act)
+		}
+	}
+}
+
+func TestExecRetryConfig_Finalize(t *testing.T) {
+	cases := []struct {
+		name string
+		i    *ExecRetryConfig
+		r    *ExecRetryConfig
+	}{
+		{
+			"empty",
+			&ExecRetryConfig{},
+			&ExecRetryConfig{
+				Attempts:   Int(DefaultExecRetryAttempts),
+				Backoff:    TimeDuration(DefaultExecRetryBackoff),
+				Multiplier: Float64(DefaultExecRetryMultiplier),
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			tc.i.Finalize()
+			if !reflect.DeepEqual(tc.r, tc.i) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, tc.i)
+			}
+		})
+	}
+}
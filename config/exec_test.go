@@ -27,14 +27,18 @@ func TestExecConfig_Copy(t *testing.T) {
 		{
 			"copy",
 			&ExecConfig{
-				Command:      []string{"command"},
-				Enabled:      Bool(true),
-				Env:          &EnvConfig{Pristine: Bool(true)},
-				KillSignal:   Signal(syscall.SIGINT),
-				KillTimeout:  TimeDuration(10 * time.Second),
-				ReloadSignal: Signal(syscall.SIGINT),
-				Splay:        TimeDuration(10 * time.Second),
-				Timeout:      TimeDuration(10 * time.Second),
+				Command:       []string{"command"},
+				Enabled:       Bool(true),
+				Env:           &EnvConfig{Pristine: Bool(true)},
+				KillSignal:    Signal(syscall.SIGINT),
+				KillTimeout:   TimeDuration(10 * time.Second),
+				ReloadSignal:  Signal(syscall.SIGINT),
+				Splay:         TimeDuration(10 * time.Second),
+				Timeout:       TimeDuration(10 * time.Second),
+				TimeoutSignal: Signal(syscall.SIGTERM),
+				TimeoutGrace:  TimeDuration(10 * time.Second),
+				Retry:         &ExecRetryConfig{Attempts: Int(3)},
+				Rollback:      Bool(true),
 			},
 		},
 	}
@@ -272,6 +276,42 @@ func TestExecConfig_Merge(t *testing.T) {
 			&ExecConfig{Timeout: TimeDuration(10 * time.Second)},
 			&ExecConfig{Timeout: TimeDuration(10 * time.Second)},
 		},
+		{
+			"timeout_signal_overrides",
+			&ExecConfig{TimeoutSignal: Signal(syscall.SIGINT)},
+			&ExecConfig{TimeoutSignal: Signal(syscall.SIGTERM)},
+			&ExecConfig{TimeoutSignal: Signal(syscall.SIGTERM)},
+		},
+		{
+			"timeout_signal_empty_one",
+			&ExecConfig{TimeoutSignal: Signal(syscall.SIGTERM)},
+			&ExecConfig{},
+			&ExecConfig{TimeoutSignal: Signal(syscall.SIGTERM)},
+		},
+		{
+			"timeout_signal_empty_two",
+			&ExecConfig{},
+			&ExecConfig{TimeoutSignal: Signal(syscall.SIGTERM)},
+			&ExecConfig{TimeoutSignal: Signal(syscall.SIGTERM)},
+		},
+		{
+			"timeout_grace_overrides",
+			&ExecConfig{TimeoutGrace: TimeDuration(10 * time.Second)},
+			&ExecConfig{TimeoutGrace: TimeDuration(0 * time.Second)},
+			&ExecConfig{TimeoutGrace: TimeDuration(0 * time.Second)},
+		},
+		{
+			"timeout_grace_empty_one",
+			&ExecConfig{TimeoutGrace: TimeDuration(10 * time.Second)},
+			&ExecConfig{},
+			&ExecConfig{TimeoutGrace: TimeDuration(10 * time.Second)},
+		},
+		{
+			"timeout_grace_empty_two",
+			&ExecConfig{},
+			&ExecConfig{TimeoutGrace: TimeDuration(10 * time.Second)},
+			&ExecConfig{TimeoutGrace: TimeDuration(10 * time.Second)},
+		},
 	}
 
 	for i, tc := range cases {
@@ -304,11 +344,19 @@ func TestExecConfig_Finalize(t *testing.T) {
 					Denylist:            []string{},
 					DenylistDeprecated:  []string{},
 				},
-				KillSignal:   Signal(DefaultExecKillSignal),
-				KillTimeout:  TimeDuration(DefaultExecKillTimeout),
-				ReloadSignal: Signal(DefaultExecReloadSignal),
-				Splay:        TimeDuration(0 * time.Second),
-				Timeout:      TimeDuration(DefaultExecTimeout),
+				KillSignal:    Signal(DefaultExecKillSignal),
+				KillTimeout:   TimeDuration(DefaultExecKillTimeout),
+				ReloadSignal:  Signal(DefaultExecReloadSignal),
+				Splay:         TimeDuration(0 * time.Second),
+				Timeout:       TimeDuration(DefaultExecTimeout),
+				TimeoutSignal: Signal(DefaultExecTimeoutSignal),
+				TimeoutGrace:  TimeDuration(DefaultExecTimeoutGrace),
+				Retry: &ExecRetryConfig{
+					Attempts:   Int(DefaultExecRetryAttempts),
+					Backoff:    TimeDuration(DefaultExecRetryBackoff),
+					Multiplier: Float64(DefaultExecRetryMultiplier),
+				},
+				Rollback: Bool(false),
 			},
 		},
 		{
@@ -327,11 +375,19 @@ func TestExecConfig_Finalize(t *testing.T) {
 					Allowlist:           []string{},
 					AllowlistDeprecated: []string{},
 				},
-				KillSignal:   Signal(DefaultExecKillSignal),
-				KillTimeout:  TimeDuration(DefaultExecKillTimeout),
-				ReloadSignal: Signal(DefaultExecReloadSignal),
-				Splay:        TimeDuration(0 * time.Second),
-				Timeout:      TimeDuration(DefaultExecTimeout),
+				KillSignal:    Signal(DefaultExecKillSignal),
+				KillTimeout:   TimeDuration(DefaultExecKillTimeout),
+				ReloadSignal:  Signal(DefaultExecReloadSignal),
+				Splay:         TimeDuration(0 * time.Second),
+				Timeout:       TimeDuration(DefaultExecTimeout),
+				TimeoutSignal: Signal(DefaultExecTimeoutSignal),
+				TimeoutGrace:  TimeDuration(DefaultExecTimeoutGrace),
+				Retry: &ExecRetryConfig{
+					Attempts:   Int(DefaultExecRetryAttempts),
+					Backoff:    TimeDuration(DefaultExecRetryBackoff),
+					Multiplier: Float64(DefaultExecRetryMultiplier),
+				},
+				Rollback: Bool(false),
 			},
 		},
 		{
@@ -350,11 +406,19 @@ func TestExecConfig_Finalize(t *testing.T) {
 					Allowlist:           []string{},
 					AllowlistDeprecated: []string{},
 				},
-				KillSignal:   Signal(DefaultExecKillSignal),
-				KillTimeout:  TimeDuration(DefaultExecKillTimeout),
-				ReloadSignal: Signal(DefaultExecReloadSignal),
-				Splay:        TimeDuration(0 * time.Second),
-				Timeout:      TimeDuration(DefaultExecTimeout),
+				KillSignal:    Signal(DefaultExecKillSignal),
+				KillTimeout:   TimeDuration(DefaultExecKillTimeout),
+				ReloadSignal:  Signal(DefaultExecReloadSignal),
+				Splay:         TimeDuration(0 * time.Second),
+				Timeout:       TimeDuration(DefaultExecTimeout),
+				TimeoutSignal: Signal(DefaultExecTimeoutSignal),
+				TimeoutGrace:  TimeDuration(DefaultExecTimeoutGrace),
+				Retry: &ExecRetryConfig{
+					Attempts:   Int(DefaultExecRetryAttempts),
+					Backoff:    TimeDuration(DefaultExecRetryBackoff),
+					Multiplier: Float64(DefaultExecRetryMultiplier),
+				},
+				Rollback: Bool(false),
 			},
 		},
 		{
@@ -373,11 +437,19 @@ func TestExecConfig_Finalize(t *testing.T) {
 					Allowlist:           []string{},
 					AllowlistDeprecated: []string{},
 				},
-				KillSignal:   Signal(DefaultExecKillSignal),
-				KillTimeout:  TimeDuration(DefaultExecKillTimeout),
-				ReloadSignal: Signal(DefaultExecReloadSignal),
-				Splay:        TimeDuration(0 * time.Second),
-				Timeout:      TimeDuration(DefaultExecTimeout),
+				KillSignal:    Signal(DefaultExecKillSignal),
+				KillTimeout:   TimeDuration(DefaultExecKillTimeout),
+				ReloadSignal:  Signal(DefaultExecReloadSignal),
+				Splay:         TimeDuration(0 * time.Second),
+				Timeout:       TimeDuration(DefaultExecTimeout),
+				TimeoutSignal: Signal(DefaultExecTimeoutSignal),
+				TimeoutGrace:  TimeDuration(DefaultExecTimeoutGrace),
+				Retry: &ExecRetryConfig{
+					Attempts:   Int(DefaultExecRetryAttempts),
+					Backoff:    TimeDuration(DefaultExecRetryBackoff),
+					Multiplier: Float64(DefaultExecRetryMultiplier),
+				},
+				Rollback: Bool(false),
 			},
 		},
 	}
@@ -0,0 +1,249 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import "fmt"
+
+const (
+	// DefaultRateLimitBurst is the default number of requests which may be
+	// made at once, regardless of the rate.
+	DefaultRateLimitBurst = 1
+)
+
+// RateLimitConfig is the configuration for pacing the requests made for one
+// class of dependencies.
+type RateLimitConfig struct {
+	// Enabled controls whether the requests are paced.
+	Enabled *bool `mapstructure:"enabled"`
+
+	// Rate is the maximum number of requests per second, averaged over time.
+	Rate *float64 `mapstructure:"rate"`
+
+	// Burst is the maximum number of requests which may be made at once.
+	Burst *int `mapstructure:"burst"`
+}
+
+// DefaultRateLimitConfig returns a configuration that is populated with the
+// default values.
+func DefaultRateLimitConfig() *RateLimitConfig {
+	return &RateLimitConfig{}
+}
+
+// Copy returns a deep copy of this configuration.
+func (c *RateLimitConfig) Copy() *RateLimitConfig {
+	if c == nil {
+		return nil
+	}
+
+	var o RateLimitConfig
+
+	o.Enabled = c.Enabled
+
+	o.Rate = c.Rate
+
+	o.Burst = c.Burst
+
+	return &o
+}
+
+// Merge combines all values in this configuration with the values in the other
+// configuration, with values in the other configuration taking precedence.
+// Maps and slices are merged, most other values are overwritten. Complex
+// structs define their own merge functionality.
+func (c *RateLimitConfig) Merge(o *RateLimitConfig) *RateLimitConfig {
+	if c == nil {
+		if o == nil {
+			return nil
+		}
+		return o.Copy()
+	}
+
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.Enabled != nil {
+		r.Enabled = o.Enabled
+	}
+
+	if o.Rate != nil {
+		r.Rate = o.Rate
+	}
+
+	if o.Burst != nil {
+		r.Burst = o.Burst
+	}
+
+	return r
+}
+
+// Finalize ensures there no nil pointers.
+func (c *RateLimitConfig) Finalize() {
+	if c.Rate == nil {
+		c.Rate = Float64(0)
+	}
+
+	if c.Enabled == nil {
+		c.Enabled = Bool(*c.Rate > 0)
+	}
+
+	if c.Burst == nil {
+		c.Burst = Int(DefaultRateLimitBurst)
+	}
+}
+
+// GoString defines the printable version of this struct.
+func (c *RateLimitConfig) GoString() string {
+	if c == nil {
+		return "(*RateLimitConfig)(nil)"
+	}
+
+	return fmt.Sprintf("&RateLimitConfig{"+
+		"Enabled:%s, "+
+		"Rate:%s, "+
+		"Burst:%s"+
+		"}",
+		BoolGoString(c.Enabled),
+		FloatGoString(c.Rate),
+		IntGoString(c.Burst),
+	)
+}
+
+// RateLimitsConfig is the configuration for pacing the requests made for each
+// class of dependencies, so that a burst of changes does not trip the rate
+// limits of the upstream.
+type RateLimitsConfig struct {
+	// Catalog paces the requests for the Consul and Nomad service catalogs and
+	// the local Consul agent.
+	Catalog *RateLimitConfig `mapstructure:"catalog"`
+
+	// Health paces the requests for the health of Consul services and
+	// servers.
+	Health *RateLimitConfig `mapstructure:"health"`
+
+	// KV paces the requests for the Consul KV store and Nomad variables.
+	KV *RateLimitConfig `mapstructure:"kv"`
+
+	// Vault paces the requests for Vault secrets.
+	Vault *RateLimitConfig `mapstructure:"vault"`
+}
+
+// DefaultRateLimitsConfig returns a configuration that is populated with the
+// default values.
+func DefaultRateLimitsConfig() *RateLimitsConfig {
+	return &RateLimitsConfig{
+		Catalog: DefaultRateLimitConfig(),
+		Health:  DefaultRateLimitConfig(),
+		KV:      DefaultRateLimitConfig(),
+		Vault:   DefaultRateLimitConfig(),
+	}
+}
+
+// Copy returns a deep copy of this configuration.
+func (c *RateLimitsConfig) Copy() *RateLimitsConfig {
+	if c == nil {
+		return nil
+	}
+
+	var o RateLimitsConfig
+
+	if c.Catalog != nil {
+		o.Catalog = c.Catalog.Copy()
+	}
+
+	if c.Health != nil {
+		o.Health = c.Health.Copy()
+	}
+
+	if c.KV != nil {
+		o.KV = c.KV.Copy()
+	}
+
+	if c.Vault != nil {
+		o.Vault = c.Vault.Copy()
+	}
+
+	return &o
+}
+
+// Merge combines all values in this configuration with the values in the other
+// configuration, with values in the other configuration taking precedence.
+// Maps and slices are merged, most other values are overwritten. Complex
+// structs define their own merge functionality.
+func (c *RateLimitsConfig) Merge(o *RateLimitsConfig) *RateLimitsConfig {
+	if c == nil {
+		if o == nil {
+			return nil
+		}
+		return o.Copy()
+	}
+
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.Catalog != nil {
+		r.Catalog = r.Catalog.Merge(o.Catalog)
+	}
+
+	if o.Health != nil {
+		r.Health = r.Health.Merge(o.Health)
+	}
+
+	if o.KV != nil {
+		r.KV = r.KV.Merge(o.KV)
+	}
+
+	if o.Vault != nil {
+		r.Vault = r.Vault.Merge(o.Vault)
+	}
+
+	return r
+}
+
+// Finalize ensures there no nil pointers.
+func (c *RateLimitsConfig) Finalize() {
+	if c.Catalog == nil {
+		c.Catalog = DefaultRateLimitConfig()
+	}
+	c.Catalog.Finalize()
+
+	if c.Health == nil {
+		c.Health = DefaultRateLimitConfig()
+	}
+	c.Health.Finalize()
+
+	if c.KV == nil {
+		c.KV = DefaultRateLimitConfig()
+	}
+	c.KV.Finalize()
+
+	if c.Vault == nil {
+		c.Vault = DefaultRateLimitConfig()
+	}
+	c.Vault.Finalize()
+}
+
+// GoString defines the printable version of this struct.
+func (c *RateLimitsConfig) GoString() string {
+	if c == nil {
+		return "(*RateLimitsConfig)(nil)"
+	}
+
+	return fmt.Sprintf("&RateLimitsConfig{"+
+		"Catalog:%#v, "+
+		"Health:%#v, "+
+		"KV:%#v, "+
+		"Vault:%#v"+
+		"}",
+		c.Catalog,
+		c.Health,
+		c.KV,
+		c.Vault,
+	)
+}
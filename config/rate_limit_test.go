@@ -0,0 +1,151 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRateLimitsConfig_Copy(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *RateLimitsConfig
+	}{
+		{
+			"nil",
+			nil,
+		},
+		{
+			"empty",
+			&RateLimitsConfig{},
+		},
+		{
+			"copy",
+			&RateLimitsConfig{
+				Catalog: &RateLimitConfig{Rate: Float64(10), Burst: Int(20)},
+				Vault:   &RateLimitConfig{Enabled: Bool(true), Rate: Float64(0.5)},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Copy()
+			if !reflect.DeepEqual(tc.a, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.a, r)
+			}
+		})
+	}
+}
+
+func TestRateLimitsConfig_Merge(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *RateLimitsConfig
+		b    *RateLimitsConfig
+		r    *RateLimitsConfig
+	}{
+		{
+			"nil_a",
+			nil,
+			&RateLimitsConfig{},
+			&RateLimitsConfig{},
+		},
+		{
+			"nil_b",
+			&RateLimitsConfig{},
+			nil,
+			&RateLimitsConfig{},
+		},
+		{
+			"nil_both",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"rate_overrides",
+			&RateLimitsConfig{KV: &RateLimitConfig{Rate: Float64(10), Burst: Int(5)}},
+			&RateLimitsConfig{KV: &RateLimitConfig{Rate: Float64(20)}},
+			&RateLimitsConfig{KV: &RateLimitConfig{Rate: Float64(20), Burst: Int(5)}},
+		},
+		{
+			"classes_merge",
+			&RateLimitsConfig{Health: &RateLimitConfig{Rate: Float64(10)}},
+			&RateLimitsConfig{Vault: &RateLimitConfig{Rate: Float64(1)}},
+			&RateLimitsConfig{
+				Health: &RateLimitConfig{Rate: Float64(10)},
+				Vault:  &RateLimitConfig{Rate: Float64(1)},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Merge(tc.b)
+			if !reflect.DeepEqual(tc.r, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, r)
+			}
+		})
+	}
+}
+
+func TestRateLimitsConfig_Finalize(t *testing.T) {
+	disabled := func() *RateLimitConfig {
+		return &RateLimitConfig{
+			Enabled: Bool(false),
+			Rate:    Float64(0),
+			Burst:   Int(DefaultRateLimitBurst),
+		}
+	}
+
+	cases := []struct {
+		name string
+		i    *RateLimitsConfig
+		r    *RateLimitsConfig
+	}{
+		{
+			"empty",
+			&RateLimitsConfig{},
+			&RateLimitsConfig{
+				Catalog: disabled(),
+				Health:  disabled(),
+				KV:      disabled(),
+				Vault:   disabled(),
+			},
+		},
+		{
+			"with_rate",
+			&RateLimitsConfig{
+				Catalog: &RateLimitConfig{Rate: Float64(10), Burst: Int(20)},
+				Vault:   &RateLimitConfig{Enabled: Bool(false), Rate: Float64(1)},
+			},
+			&RateLimitsConfig{
+				Catalog: &RateLimitConfig{
+					Enabled: Bool(true),
+					Rate:    Float64(10),
+					Burst:   Int(20),
+				},
+				Health: disabled(),
+				KV:     disabled(),
+				Vault: &RateLimitConfig{
+					Enabled: Bool(false),
+					Rate:    Float64(1),
+					Burst:   Int(DefaultRateLimitBurst),
+				},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			tc.i.Finalize()
+			if !reflect.DeepEqual(tc.r, tc.i) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, tc.i)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+)
+
+const (
+	// DefaultMetricsPrefix is the default prefix of every metric name.
+	DefaultMetricsPrefix = "consul_template"
+)
+
+// TelemetryConfig is the configuration for emitting metrics about renders and
+// the data they depend on.
+type TelemetryConfig struct {
+	// StatsdAddress is the host:port of a statsd server to send metrics to
+	// over UDP. Metrics are not sent when it is empty.
+	StatsdAddress *string `mapstructure:"statsd_address"`
+
+	// MetricsPrefix is prepended to the name of every metric.
+	MetricsPrefix *string `mapstructure:"metrics_prefix"`
+
+	// PrometheusAddress is the host:port to serve metrics on for Prometheus
+	// to scrape, at the "/metrics" path. Metrics are not served when it is
+	// empty.
+	PrometheusAddress *string `mapstructure:"prometheus_address"`
+}
+
+// DefaultTelemetryConfig returns a configuration that is populated with the
+// default values.
+func DefaultTelemetryConfig() *TelemetryConfig {
+	return &TelemetryConfig{}
+}
+
+// Copy returns a deep copy of this configuration.
+func (c *TelemetryConfig) Copy() *TelemetryConfig {
+	if c == nil {
+		return nil
+	}
+
+	var o TelemetryConfig
+	o.StatsdAddress = c.StatsdAddress
+	o.MetricsPrefix = c.MetricsPrefix
+	o.PrometheusAddress = c.PrometheusAddress
+	return &o
+}
+
+// Merge combines all values in this configuration with the values in the other
+// configuration, with values in the other configuration taking precedence.
+// Maps and slices are merged, most other values are overwritten. Complex
+// structs define their own merge functionality.
+func (c *TelemetryConfig) Merge(o *TelemetryConfig) *TelemetryConfig {
+	if c == nil {
+		if o == nil {
+			return nil
+		}
+		return o.Copy()
+	}
+
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.StatsdAddress != nil {
+		r.StatsdAddress = o.StatsdAddress
+	}
+
+	if o.MetricsPrefix != nil {
+		r.MetricsPrefix = o.MetricsPrefix
+	}
+
+	if o.PrometheusAddress != nil {
+		r.PrometheusAddress = o.PrometheusAddress
+	}
+
+	return r
+}
+
+// Finalize ensures there no nil pointers.
+func (c *TelemetryConfig) Finalize() {
+	if c.StatsdAddress == nil {
+		c.StatsdAddress = String("")
+	}
+
+	if c.MetricsPrefix == nil {
+		c.MetricsPrefix = String(DefaultMetricsPrefix)
+	}
+
+	if c.PrometheusAddress == nil {
+		c.PrometheusAddress = String("")
+	}
+}
+
+// GoString defines the printable version of this struct.
+func (c *TelemetryConfig) GoString() string {
+	if c == nil {
+		return "(*TelemetryConfig)(nil)"
+	}
+
+	return fmt.Sprintf("&TelemetryConfig{"+
+		"StatsdAddress:%s, "+
+		"MetricsPrefix:%s, "+
+		"PrometheusAddress:%s"+
+		"}",
+		StringGoString(c.StatsdAddress),
+		StringGoString(c.MetricsPrefix),
+		StringGoString(c.PrometheusAddress),
+	)
+}
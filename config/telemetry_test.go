@@ -0,0 +1,154 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTelemetryConfig_Copy(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *TelemetryConfig
+	}{
+		{
+			"nil",
+			nil,
+		},
+		{
+			"empty",
+			&TelemetryConfig{},
+		},
+		{
+			"same_enabled",
+			&TelemetryConfig{
+				StatsdAddress:     String("127.0.0.1:8125"),
+				MetricsPrefix:     String("ct"),
+				PrometheusAddress: String("127.0.0.1:9102"),
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Copy()
+			if !reflect.DeepEqual(tc.a, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.a, r)
+			}
+		})
+	}
+}
+
+func TestTelemetryConfig_Merge(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *TelemetryConfig
+		b    *TelemetryConfig
+		r    *TelemetryConfig
+	}{
+		{
+			"nil_a",
+			nil,
+			&TelemetryConfig{},
+			&TelemetryConfig{},
+		},
+		{
+			"nil_b",
+			&TelemetryConfig{},
+			nil,
+			&TelemetryConfig{},
+		},
+		{
+			"nil_both",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"empty",
+			&TelemetryConfig{},
+			&TelemetryConfig{},
+			&TelemetryConfig{},
+		},
+		{
+			"statsd_address_overrides",
+			&TelemetryConfig{StatsdAddress: String("one:8125")},
+			&TelemetryConfig{StatsdAddress: String("two:8125")},
+			&TelemetryConfig{StatsdAddress: String("two:8125")},
+		},
+		{
+			"statsd_address_empty_one",
+			&TelemetryConfig{StatsdAddress: String("one:8125")},
+			&TelemetryConfig{},
+			&TelemetryConfig{StatsdAddress: String("one:8125")},
+		},
+		{
+			"metrics_prefix_overrides",
+			&TelemetryConfig{MetricsPrefix: String("one")},
+			&TelemetryConfig{MetricsPrefix: String("two")},
+			&TelemetryConfig{MetricsPrefix: String("two")},
+		},
+		{
+			"metrics_prefix_empty_two",
+			&TelemetryConfig{},
+			&TelemetryConfig{MetricsPrefix: String("two")},
+			&TelemetryConfig{MetricsPrefix: String("two")},
+		},
+		{
+			"prometheus_address_overrides",
+			&TelemetryConfig{PrometheusAddress: String("one:9102")},
+			&TelemetryConfig{PrometheusAddress: String("two:9102")},
+			&TelemetryConfig{PrometheusAddress: String("two:9102")},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Merge(tc.b)
+			if !reflect.DeepEqual(tc.r, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, r)
+			}
+		})
+	}
+}
+
+func TestTelemetryConfig_Finalize(t *testing.T) {
+	cases := []struct {
+		name string
+		i    *TelemetryConfig
+		r    *TelemetryConfig
+	}{
+		{
+			"empty",
+			&TelemetryConfig{},
+			&TelemetryConfig{
+				StatsdAddress:     String(""),
+				MetricsPrefix:     String(DefaultMetricsPrefix),
+				PrometheusAddress: String(""),
+			},
+		},
+		{
+			"with_statsd_address",
+			&TelemetryConfig{
+				StatsdAddress: String("127.0.0.1:8125"),
+			},
+			&TelemetryConfig{
+				StatsdAddress:     String("127.0.0.1:8125"),
+				MetricsPrefix:     String(DefaultMetricsPrefix),
+				PrometheusAddress: String(""),
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			tc.i.Finalize()
+			if !reflect.DeepEqual(tc.r, tc.i) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, tc.i)
+			}
+		})
+	}
+}
@@ -20,6 +20,14 @@ const (
 	// DefaultTemplateCommandTimeout is the amount of time to wait for a command
 	// to return.
 	DefaultTemplateCommandTimeout = 30 * time.Second
+
+	// DefaultTemplatePluginTimeout is the amount of time to wait for a plugin
+	// to return.
+	DefaultTemplatePluginTimeout = 30 * time.Second
+
+	// DefaultTemplatePluginMaxOutputBytes is the maximum size of the output of
+	// a plugin, where 0 means there is no limit.
+	DefaultTemplatePluginMaxOutputBytes = 0
 )
 
 var (
@@ -123,11 +131,31 @@ type TemplateConfig struct {
 	// this are combined to FunctionDenylist in Finalize().
 	FunctionDenylistDeprecated []string `mapstructure:"function_blacklist" json:"-"`
 
-	// SandboxPath adds a prefix to any path provided to the `file` function
-	// and causes an error if a relative path tries to traverse outside that
-	// prefix.
+	// SandboxPath adds a prefix to any path provided to the `file` and
+	// `writeToFile` functions and causes an error if a relative path tries to
+	// traverse outside that prefix.
 	SandboxPath *string `mapstructure:"sandbox_path"`
 
+	// PluginTimeout is the amount of time to wait for each invocation of the
+	// `plugin` function before killing the plugin and failing the render.
+	PluginTimeout *time.Duration `mapstructure:"plugin_timeout"`
+
+	// PluginMaxOutputBytes is the maximum number of bytes a plugin may write to
+	// its output before it is killed and the render fails. Zero means there is
+	// no limit.
+	PluginMaxOutputBytes *int `mapstructure:"plugin_max_output_bytes"`
+
+	// SkipIfUnchangedRemote is the address of a remote copy of the rendered
+	// contents, either "consul://kv/<key>" or "vault://<path>#<field>". When
+	// the newly rendered contents are identical to the remote value, the
+	// template is not written and its command is not run.
+	SkipIfUnchangedRemote *string `mapstructure:"skip_if_unchanged_remote"`
+
+	// RenderGroup is the name of the group of templates this template is
+	// rendered with. The templates of a group are only written once all of
+	// them rendered successfully, and none of them are written otherwise.
+	RenderGroup *string `mapstructure:"render_group"`
+
 	// MapToEnvironmentVariable is the name of the environment variable this
 	// template should map to. It is currently only used by Vault Agent and
 	// will be ignored otherwise. When specified, Vault Agent will render the
@@ -201,6 +229,14 @@ func (c *TemplateConfig) Copy() *TemplateConfig {
 
 	o.SandboxPath = c.SandboxPath
 
+	o.PluginTimeout = c.PluginTimeout
+
+	o.PluginMaxOutputBytes = c.PluginMaxOutputBytes
+
+	o.SkipIfUnchangedRemote = c.SkipIfUnchangedRemote
+
+	o.RenderGroup = c.RenderGroup
+
 	o.MapToEnvironmentVariable = c.MapToEnvironmentVariable
 
 	return &o
@@ -311,6 +347,22 @@ func (c *TemplateConfig) Merge(o *TemplateConfig) *TemplateConfig {
 		r.SandboxPath = o.SandboxPath
 	}
 
+	if o.PluginTimeout != nil {
+		r.PluginTimeout = o.PluginTimeout
+	}
+
+	if o.PluginMaxOutputBytes != nil {
+		r.PluginMaxOutputBytes = o.PluginMaxOutputBytes
+	}
+
+	if o.SkipIfUnchangedRemote != nil {
+		r.SkipIfUnchangedRemote = o.SkipIfUnchangedRemote
+	}
+
+	if o.RenderGroup != nil {
+		r.RenderGroup = o.RenderGroup
+	}
+
 	if o.MapToEnvironmentVariable != nil {
 		r.MapToEnvironmentVariable = o.MapToEnvironmentVariable
 	}
@@ -407,6 +459,22 @@ func (c *TemplateConfig) Finalize() {
 		c.SandboxPath = String("")
 	}
 
+	if c.PluginTimeout == nil {
+		c.PluginTimeout = TimeDuration(DefaultTemplatePluginTimeout)
+	}
+
+	if c.PluginMaxOutputBytes == nil {
+		c.PluginMaxOutputBytes = Int(DefaultTemplatePluginMaxOutputBytes)
+	}
+
+	if c.SkipIfUnchangedRemote == nil {
+		c.SkipIfUnchangedRemote = String("")
+	}
+
+	if c.RenderGroup == nil {
+		c.RenderGroup = String("")
+	}
+
 	if c.ExtFuncMap == nil {
 		c.ExtFuncMap = make(template.FuncMap, 0)
 	}
@@ -446,7 +514,11 @@ func (c *TemplateConfig) GoString() string {
 		"RightDelim:%s, "+
 		"ExtFuncMap:%s, "+
 		"FunctionDenylist:%s, "+
-		"SandboxPath:%s "+
+		"SandboxPath:%s, "+
+		"PluginTimeout:%s, "+
+		"PluginMaxOutputBytes:%s, "+
+		"SkipIfUnchangedRemote:%s, "+
+		"RenderGroup:%s, "+
 		"MapToEnvironmentVariable:%s"+
 		"}",
 		BoolGoString(c.Backup),
@@ -466,6 +538,10 @@ func (c *TemplateConfig) GoString() string {
 		maps.Keys(c.ExtFuncMap),
 		combineLists(c.FunctionDenylist, c.FunctionDenylistDeprecated),
 		StringGoString(c.SandboxPath),
+		TimeDurationGoString(c.PluginTimeout),
+		IntGoString(c.PluginMaxOutputBytes),
+		StringGoString(c.SkipIfUnchangedRemote),
+		StringGoString(c.RenderGroup),
 		StringGoString(c.MapToEnvironmentVariable),
 	)
 }
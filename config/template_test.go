@@ -397,6 +397,24 @@ func TestTemplateConfig_Merge(t *testing.T) {
 			&TemplateConfig{RightDelim: String("right_delim")},
 			&TemplateConfig{RightDelim: String("right_delim")},
 		},
+		{
+			"skip_if_unchanged_remote_override",
+			&TemplateConfig{SkipIfUnchangedRemote: String("consul://kv/foo")},
+			&TemplateConfig{SkipIfUnchangedRemote: String("consul://kv/bar")},
+			&TemplateConfig{SkipIfUnchangedRemote: String("consul://kv/bar")},
+		},
+		{
+			"plugin_limits_override",
+			&TemplateConfig{PluginTimeout: TimeDuration(10 * time.Second), PluginMaxOutputBytes: Int(1024)},
+			&TemplateConfig{PluginTimeout: TimeDuration(20 * time.Second)},
+			&TemplateConfig{PluginTimeout: TimeDuration(20 * time.Second), PluginMaxOutputBytes: Int(1024)},
+		},
+		{
+			"render_group_override",
+			&TemplateConfig{RenderGroup: String("foo")},
+			&TemplateConfig{RenderGroup: String("bar")},
+			&TemplateConfig{RenderGroup: String("bar")},
+		},
 		{
 			"map_to_env_var_empty_one",
 			&TemplateConfig{MapToEnvironmentVariable: String("FOO")},
@@ -456,11 +474,19 @@ func TestTemplateConfig_Finalize(t *testing.T) {
 						Allowlist:           []string{},
 						AllowlistDeprecated: []string{},
 					},
-					KillSignal:   Signal(DefaultExecKillSignal),
-					KillTimeout:  TimeDuration(DefaultExecKillTimeout),
-					ReloadSignal: Signal(DefaultExecReloadSignal),
-					Splay:        TimeDuration(0 * time.Second),
-					Timeout:      TimeDuration(DefaultTemplateCommandTimeout),
+					KillSignal:    Signal(DefaultExecKillSignal),
+					KillTimeout:   TimeDuration(DefaultExecKillTimeout),
+					ReloadSignal:  Signal(DefaultExecReloadSignal),
+					Splay:         TimeDuration(0 * time.Second),
+					Timeout:       TimeDuration(DefaultTemplateCommandTimeout),
+					TimeoutSignal: Signal(DefaultExecTimeoutSignal),
+					TimeoutGrace:  TimeDuration(DefaultExecTimeoutGrace),
+					Retry: &ExecRetryConfig{
+						Attempts:   Int(DefaultExecRetryAttempts),
+						Backoff:    TimeDuration(DefaultExecRetryBackoff),
+						Multiplier: Float64(DefaultExecRetryMultiplier),
+					},
+					Rollback: Bool(false),
 				},
 				Perms:  FileMode(0),
 				Source: String(""),
@@ -475,6 +501,10 @@ func TestTemplateConfig_Finalize(t *testing.T) {
 				FunctionDenylist:           []string{},
 				FunctionDenylistDeprecated: []string{},
 				SandboxPath:                String(""),
+				PluginTimeout:              TimeDuration(DefaultTemplatePluginTimeout),
+				PluginMaxOutputBytes:       Int(DefaultTemplatePluginMaxOutputBytes),
+				SkipIfUnchangedRemote:      String(""),
+				RenderGroup:                String(""),
 				MapToEnvironmentVariable:   String(""),
 			},
 		},
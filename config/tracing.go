@@ -0,0 +1,110 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+)
+
+const (
+	// DefaultTracingEndpoint is the default OTLP/HTTP collector endpoint.
+	DefaultTracingEndpoint = "localhost:4318"
+)
+
+// TracingConfig is the configuration for exporting OpenTelemetry traces of
+// each render cycle.
+type TracingConfig struct {
+	// Enabled controls whether traces are recorded and exported.
+	Enabled *bool `mapstructure:"enabled"`
+
+	// Endpoint is the host:port of the OTLP/HTTP collector.
+	Endpoint *string `mapstructure:"endpoint"`
+
+	// Insecure disables TLS when talking to the collector.
+	Insecure *bool `mapstructure:"insecure"`
+}
+
+// DefaultTracingConfig returns a configuration that is populated with the
+// default values.
+func DefaultTracingConfig() *TracingConfig {
+	return &TracingConfig{}
+}
+
+// Copy returns a deep copy of this configuration.
+func (c *TracingConfig) Copy() *TracingConfig {
+	if c == nil {
+		return nil
+	}
+
+	var o TracingConfig
+	o.Enabled = c.Enabled
+	o.Endpoint = c.Endpoint
+	o.Insecure = c.Insecure
+	return &o
+}
+
+// Merge combines all values in this configuration with the values in the other
+// configuration, with values in the other configuration taking precedence.
+// Maps and slices are merged, most other values are overwritten. Complex
+// structs define their own merge functionality.
+func (c *TracingConfig) Merge(o *TracingConfig) *TracingConfig {
+	if c == nil {
+		if o == nil {
+			return nil
+		}
+		return o.Copy()
+	}
+
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.Enabled != nil {
+		r.Enabled = o.Enabled
+	}
+
+	if o.Endpoint != nil {
+		r.Endpoint = o.Endpoint
+	}
+
+	if o.Insecure != nil {
+		r.Insecure = o.Insecure
+	}
+
+	return r
+}
+
+// Finalize ensures there no nil pointers.
+func (c *TracingConfig) Finalize() {
+	if c.Enabled == nil {
+		c.Enabled = Bool(StringPresent(c.Endpoint))
+	}
+
+	if c.Endpoint == nil {
+		c.Endpoint = String(DefaultTracingEndpoint)
+	}
+
+	if c.Insecure == nil {
+		c.Insecure = Bool(false)
+	}
+}
+
+// GoString defines the printable version of this struct.
+func (c *TracingConfig) GoString() string {
+	if c == nil {
+		return "(*TracingConfig)(nil)"
+	}
+
+	return fmt.Sprintf("&TracingConfig{"+
+		"Enabled:%s, "+
+		"Endpoint:%s, "+
+		"Insecure:%s"+
+		"}",
+		BoolGoString(c.Enabled),
+		StringGoString(c.Endpoint),
+		BoolGoString(c.Insecure),
+	)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTracingConfig_Copy(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *TracingConfig
+	}{
+		{
+			"nil",
+			nil,
+		},
+		{
+			"empty",
+			&TracingConfig{},
+		},
+		{
+			"same_enabled",
+			&TracingConfig{
+				Enabled:  Bool(true),
+				Endpoint: String("collector:4318"),
+				Insecure: Bool(true),
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Copy()
+			if !reflect.DeepEqual(tc.a, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.a, r)
+			}
+		})
+	}
+}
+
+func TestTracingConfig_Merge(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *TracingConfig
+		b    *TracingConfig
+		r    *TracingConfig
+	}{
+		{
+			"nil_a",
+			nil,
+			&TracingConfig{},
+			&TracingConfig{},
+		},
+		{
+			"nil_b",
+			&TracingConfig{},
+			nil,
+			&TracingConfig{},
+		},
+		{
+			"nil_both",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"empty",
+			&TracingConfig{},
+			&TracingConfig{},
+			&TracingConfig{},
+		},
+		{
+			"enabled_overrides",
+			&TracingConfig{Enabled: Bool(true)},
+			&TracingConfig{Enabled: Bool(false)},
+			&TracingConfig{Enabled: Bool(false)},
+		},
+		{
+			"enabled_empty_one",
+			&TracingConfig{Enabled: Bool(true)},
+			&TracingConfig{},
+			&TracingConfig{Enabled: Bool(true)},
+		},
+		{
+			"endpoint_overrides",
+			&TracingConfig{Endpoint: String("one:4318")},
+			&TracingConfig{Endpoint: String("two:4318")},
+			&TracingConfig{Endpoint: String("two:4318")},
+		},
+		{
+			"endpoint_empty_two",
+			&TracingConfig{},
+			&TracingConfig{Endpoint: String("one:4318")},
+			&TracingConfig{Endpoint: String("one:4318")},
+		},
+		{
+			"insecure_overrides",
+			&TracingConfig{Insecure: Bool(true)},
+			&TracingConfig{Insecure: Bool(false)},
+			&TracingConfig{Insecure: Bool(false)},
+		},
+		{
+			"insecure_empty_one",
+			&TracingConfig{Insecure: Bool(true)},
+			&TracingConfig{},
+			&TracingConfig{Insecure: Bool(true)},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Merge(tc.b)
+			if !reflect.DeepEqual(tc.r, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, r)
+			}
+		})
+	}
+}
+
+func TestTracingConfig_Finalize(t *testing.T) {
+	cases := []struct {
+		name string
+		i    *TracingConfig
+		r    *TracingConfig
+	}{
+		{
+			"empty",
+			&TracingConfig{},
+			&TracingConfig{
+				Enabled:  Bool(false),
+				Endpoint: String(DefaultTracingEndpoint),
+				Insecure: Bool(false),
+			},
+		},
+		{
+			"with_endpoint",
+			&TracingConfig{
+				Endpoint: String("collector:4318"),
+			},
+			&TracingConfig{
+				Enabled:  Bool(true),
+				Endpoint: String("collector:4318"),
+				Insecure: Bool(false),
+			},
+		},
+		{
+			"enabled",
+			&TracingConfig{
+				Enabled:  Bool(true),
+				Insecure: Bool(true),
+			},
+			&TracingConfig{
+				Enabled:  Bool(true),
+				Endpoint: String(DefaultTracingEndpoint),
+				Insecure: Bool(true),
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			tc.i.Finalize()
+			if !reflect.DeepEqual(tc.r, tc.i) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, tc.i)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/api"
@@ -38,6 +39,10 @@ const (
 	// lease to wait for before refreshing
 	DefaultLeaseRenewalThreshold = .90
 
+	// DefaultLeaseRenewalJitter is the default width of the random stagger
+	// around the lease renewal threshold, as a fraction of the lease duration.
+	DefaultLeaseRenewalJitter = .10
+
 	// DefaultK8SServiceAccountTokenPath is a default path to a file
 	// with service token for the k8s auth method.
 	DefaultK8SServiceAccountTokenPath = "/run/secrets/kubernetes.io/serviceaccount/token"
@@ -55,6 +60,13 @@ type VaultConfig struct {
 	// Enabled controls whether the Vault integration is active.
 	Enabled *bool `mapstructure:"enabled"`
 
+	// Name is the name of an additional Vault cluster, which queries select by
+	// prefixing their path with "@<name>:". It is only used for the clusters
+	// in vault_cluster blocks; the vault block configures the default cluster.
+	// Named clusters are only configured by their block, not by the VAULT_*
+	// environment variables.
+	Name *string `mapstructure:"name"`
+
 	// Namespace is the Vault namespace to use for reading/writing secrets. This can
 	// also be set via the VAULT_NAMESPACE environment variable.
 	Namespace *string `mapstructure:"namespace"`
@@ -62,7 +74,9 @@ type VaultConfig struct {
 	// RenewToken renews the Vault token.
 	RenewToken *bool `mapstructure:"renew_token"`
 
-	// Retry is the configuration for specifying how to behave on failure.
+	// Retry is the configuration for specifying how to behave on failure. It
+	// is only set by the vault block, and applies to the queries of every
+	// cluster.
 	Retry *RetryConfig `mapstructure:"retry"`
 
 	// SSL indicates we should use a secure connection while talking to Vault.
@@ -99,6 +113,23 @@ type VaultConfig struct {
 	// duration.
 	LeaseRenewalThreshold *float64 `mapstructure:"lease_renewal_threshold"`
 
+	// LeaseRenewalJitter configures the width of the random stagger applied
+	// around LeaseRenewalThreshold, measured as a fraction of the lease
+	// duration, so that many non-renewable secrets expiring at once are not
+	// refreshed at once.
+	LeaseRenewalJitter *float64 `mapstructure:"lease_renewal_jitter"`
+
+	// LeaseRenewalMinSleep is the minimum time Consul Template waits for
+	// before refreshing a non-renewable secret.
+	LeaseRenewalMinSleep *time.Duration `mapstructure:"lease_renewal_min_sleep"`
+
+	// LeaseRenewalGrace configures when a renewable lease is given up on and
+	// its secret read again, measured as a fraction of its original lease
+	// duration. Once a renewal leaves less than this fraction, e.g. because
+	// the lease is reaching its maximum TTL, fresh credentials are read before
+	// the old ones expire. Zero disables this.
+	LeaseRenewalGrace *float64 `mapstructure:"lease_renewal_grace"`
+
 	// If Token is empty and K8SAuthRoleName is set, it means to use
 	// k8s vault auth method.
 	//
@@ -154,6 +185,8 @@ func (c *VaultConfig) Copy() *VaultConfig {
 
 	o.Enabled = c.Enabled
 
+	o.Name = c.Name
+
 	o.Namespace = c.Namespace
 
 	o.RenewToken = c.RenewToken
@@ -178,6 +211,9 @@ func (c *VaultConfig) Copy() *VaultConfig {
 
 	o.DefaultLeaseDuration = c.DefaultLeaseDuration
 	o.LeaseRenewalThreshold = c.LeaseRenewalThreshold
+	o.LeaseRenewalJitter = c.LeaseRenewalJitter
+	o.LeaseRenewalMinSleep = c.LeaseRenewalMinSleep
+	o.LeaseRenewalGrace = c.LeaseRenewalGrace
 
 	o.K8SAuthRoleName = c.K8SAuthRoleName
 	o.K8SServiceAccountToken = c.K8SServiceAccountToken
@@ -213,6 +249,10 @@ func (c *VaultConfig) Merge(o *VaultConfig) *VaultConfig {
 		r.Enabled = o.Enabled
 	}
 
+	if o.Name != nil {
+		r.Name = o.Name
+	}
+
 	if o.Namespace != nil {
 		r.Namespace = o.Namespace
 	}
@@ -257,6 +297,18 @@ func (c *VaultConfig) Merge(o *VaultConfig) *VaultConfig {
 		r.LeaseRenewalThreshold = o.LeaseRenewalThreshold
 	}
 
+	if o.LeaseRenewalJitter != nil {
+		r.LeaseRenewalJitter = o.LeaseRenewalJitter
+	}
+
+	if o.LeaseRenewalMinSleep != nil {
+		r.LeaseRenewalMinSleep = o.LeaseRenewalMinSleep
+	}
+
+	if o.LeaseRenewalGrace != nil {
+		r.LeaseRenewalGrace = o.LeaseRenewalGrace
+	}
+
 	if o.K8SAuthRoleName != nil {
 		r.K8SAuthRoleName = o.K8SAuthRoleName
 	}
@@ -278,14 +330,24 @@ func (c *VaultConfig) Merge(o *VaultConfig) *VaultConfig {
 
 // Finalize ensures there no nil pointers.
 func (c *VaultConfig) Finalize() {
+	// The environment configures the default cluster, so named clusters
+	// only take the defaults.
+	envString, envBool, envAntibool := stringFromEnv, boolFromEnv, antiboolFromEnv
+	named := StringPresent(c.Name)
+	if named {
+		envString = func(_ []string, def string) *string { return String(def) }
+		envBool = func(_ []string, def bool) *bool { return Bool(def) }
+		envAntibool = envBool
+	}
+
 	if c.Address == nil {
-		c.Address = stringFromEnv([]string{
+		c.Address = envString([]string{
 			api.EnvVaultAddress,
 		}, "")
 	}
 
 	if c.Namespace == nil {
-		c.Namespace = stringFromEnv([]string{"VAULT_NAMESPACE"}, "")
+		c.Namespace = envString([]string{"VAULT_NAMESPACE"}, "")
 	}
 
 	if c.Retry == nil {
@@ -301,25 +363,25 @@ func (c *VaultConfig) Finalize() {
 		c.SSL.Enabled = Bool(true)
 	}
 	if c.SSL.CaCert == nil {
-		c.SSL.CaCert = stringFromEnv([]string{api.EnvVaultCACert}, "")
+		c.SSL.CaCert = envString([]string{api.EnvVaultCACert}, "")
 	}
 	if c.SSL.CaCertBytes == nil {
-		c.SSL.CaCertBytes = stringFromEnv([]string{api.EnvVaultCACertBytes}, "")
+		c.SSL.CaCertBytes = envString([]string{api.EnvVaultCACertBytes}, "")
 	}
 	if c.SSL.CaPath == nil {
-		c.SSL.CaPath = stringFromEnv([]string{api.EnvVaultCAPath}, "")
+		c.SSL.CaPath = envString([]string{api.EnvVaultCAPath}, "")
 	}
 	if c.SSL.Cert == nil {
-		c.SSL.Cert = stringFromEnv([]string{api.EnvVaultClientCert}, "")
+		c.SSL.Cert = envString([]string{api.EnvVaultClientCert}, "")
 	}
 	if c.SSL.Key == nil {
-		c.SSL.Key = stringFromEnv([]string{api.EnvVaultClientKey}, "")
+		c.SSL.Key = envString([]string{api.EnvVaultClientKey}, "")
 	}
 	if c.SSL.ServerName == nil {
-		c.SSL.ServerName = stringFromEnv([]string{api.EnvVaultTLSServerName}, "")
+		c.SSL.ServerName = envString([]string{api.EnvVaultTLSServerName}, "")
 	}
 	if c.SSL.Verify == nil {
-		c.SSL.Verify = antiboolFromEnv([]string{
+		c.SSL.Verify = envAntibool([]string{
 			EnvVaultSkipVerify, api.EnvVaultInsecure,
 		}, true)
 	}
@@ -330,14 +392,14 @@ func (c *VaultConfig) Finalize() {
 	// 2. `token` configuration value`
 	// 3. `VAULT_TOKEN` environment variable
 	if c.Token == nil {
-		c.Token = stringFromEnv([]string{
+		c.Token = envString([]string{
 			"VAULT_TOKEN",
 		}, "")
 	}
 
 	if c.VaultAgentTokenFile == nil {
 		if StringVal(c.Token) == "" {
-			if homePath != "" {
+			if homePath != "" && !named {
 				c.Token = stringFromFile([]string{
 					homePath + "/.vault-token",
 				}, "")
@@ -355,7 +417,7 @@ func (c *VaultConfig) Finalize() {
 		} else if StringVal(c.Token) == "" {
 			default_renew = false
 		}
-		c.RenewToken = boolFromEnv([]string{
+		c.RenewToken = envBool([]string{
 			"VAULT_RENEW_TOKEN",
 		}, default_renew)
 	}
@@ -366,7 +428,7 @@ func (c *VaultConfig) Finalize() {
 	c.Transport.Finalize()
 
 	if c.UnwrapToken == nil {
-		c.UnwrapToken = boolFromEnv([]string{
+		c.UnwrapToken = envBool([]string{
 			"VAULT_UNWRAP_TOKEN",
 		}, DefaultVaultUnwrapToken)
 	}
@@ -375,6 +437,10 @@ func (c *VaultConfig) Finalize() {
 		c.Enabled = Bool(StringPresent(c.Address))
 	}
 
+	if c.Name == nil {
+		c.Name = String("")
+	}
+
 	if c.DefaultLeaseDuration == nil {
 		c.DefaultLeaseDuration = TimeDuration(DefaultVaultLeaseDuration)
 	}
@@ -383,23 +449,35 @@ func (c *VaultConfig) Finalize() {
 		c.LeaseRenewalThreshold = Float64(DefaultLeaseRenewalThreshold)
 	}
 
+	if c.LeaseRenewalJitter == nil {
+		c.LeaseRenewalJitter = Float64(DefaultLeaseRenewalJitter)
+	}
+
+	if c.LeaseRenewalMinSleep == nil {
+		c.LeaseRenewalMinSleep = TimeDuration(0)
+	}
+
+	if c.LeaseRenewalGrace == nil {
+		c.LeaseRenewalGrace = Float64(0)
+	}
+
 	if c.K8SAuthRoleName == nil {
-		c.K8SAuthRoleName = stringFromEnv([]string{
+		c.K8SAuthRoleName = envString([]string{
 			"VAULT_K8S_AUTH_ROLE_NAME",
 		}, "")
 	}
 	if c.K8SServiceAccountToken == nil {
-		c.K8SServiceAccountToken = stringFromEnv([]string{
+		c.K8SServiceAccountToken = envString([]string{
 			"VAULT_K8S_SERVICE_ACCOUNT_TOKEN",
 		}, "")
 	}
 	if c.K8SServiceAccountTokenPath == nil {
-		c.K8SServiceAccountTokenPath = stringFromEnv([]string{
+		c.K8SServiceAccountTokenPath = envString([]string{
 			"VAULT_K8S_SERVICE_ACCOUNT_TOKEN_PATH",
 		}, DefaultK8SServiceAccountTokenPath)
 	}
 	if c.K8SServiceMountPath == nil {
-		c.K8SServiceMountPath = stringFromEnv([]string{
+		c.K8SServiceMountPath = envString([]string{
 			"VAULT_K8S_SERVICE_MOUNT_PATH",
 		}, DefaultK8SServiceMountPath)
 	}
@@ -414,6 +492,7 @@ func (c *VaultConfig) GoString() string {
 	return fmt.Sprintf("&VaultConfig{"+
 		"Address:%s, "+
 		"Enabled:%s, "+
+		"Name:%s, "+
 		"Namespace:%s,"+
 		"RenewToken:%s, "+
 		"Retry:%#v, "+
@@ -424,6 +503,9 @@ func (c *VaultConfig) GoString() string {
 		"UnwrapToken:%s, "+
 		"DefaultLeaseDuration:%s, "+
 		"LeaseRenewalThreshold:%s, "+
+		"LeaseRenewalJitter:%s, "+
+		"LeaseRenewalMinSleep:%s, "+
+		"LeaseRenewalGrace:%s, "+
 		"K8SAuthRoleName:%s, "+
 		"K8SServiceAccountToken:%s, "+
 		"K8SServiceAccountTokenPath:%s, "+
@@ -431,6 +513,7 @@ func (c *VaultConfig) GoString() string {
 		"}",
 		StringGoString(c.Address),
 		BoolGoString(c.Enabled),
+		StringGoString(c.Name),
 		StringGoString(c.Namespace),
 		BoolGoString(c.RenewToken),
 		c.Retry,
@@ -441,9 +524,87 @@ func (c *VaultConfig) GoString() string {
 		BoolGoString(c.UnwrapToken),
 		TimeDurationGoString(c.DefaultLeaseDuration),
 		FloatGoString(c.LeaseRenewalThreshold),
+		FloatGoString(c.LeaseRenewalJitter),
+		TimeDurationGoString(c.LeaseRenewalMinSleep),
+		FloatGoString(c.LeaseRenewalGrace),
 		StringGoString(c.K8SAuthRoleName),
 		StringGoString(c.K8SServiceAccountToken),
 		StringGoString(c.K8SServiceAccountTokenPath),
 		StringGoString(c.K8SServiceMountPath),
 	)
 }
+
+// VaultConfigs is a collection of the configurations of named Vault clusters.
+type VaultConfigs []*VaultConfig
+
+// DefaultVaultConfigs returns a configuration that is populated with the
+// default values.
+func DefaultVaultConfigs() *VaultConfigs {
+	return &VaultConfigs{}
+}
+
+// Copy returns a deep copy of this configuration.
+func (c *VaultConfigs) Copy() *VaultConfigs {
+	if c == nil {
+		return nil
+	}
+
+	o := make(VaultConfigs, len(*c))
+	for i, v := range *c {
+		o[i] = v.Copy()
+	}
+	return &o
+}
+
+// Merge combines all values in this configuration with the values in the other
+// configuration, with values in the other configuration taking precedence.
+// Clusters of the same name are merged, others are appended.
+func (c *VaultConfigs) Merge(o *VaultConfigs) *VaultConfigs {
+	if c == nil {
+		if o == nil {
+			return nil
+		}
+		return o.Copy()
+	}
+
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+OUTER:
+	for _, v := range *o {
+		for i, existing := range *r {
+			if StringVal(existing.Name) == StringVal(v.Name) {
+				(*r)[i] = existing.Merge(v)
+				continue OUTER
+			}
+		}
+		*r = append(*r, v.Copy())
+	}
+
+	return r
+}
+
+// Finalize ensures the configuration has no nil pointers and sets default
+// values.
+func (c *VaultConfigs) Finalize() {
+	for _, v := range *c {
+		v.Finalize()
+	}
+}
+
+// GoString defines the printable version of this struct.
+func (c *VaultConfigs) GoString() string {
+	if c == nil {
+		return "(*VaultConfigs)(nil)"
+	}
+
+	s := make([]string, len(*c))
+	for i, v := range *c {
+		s[i] = v.GoString()
+	}
+
+	return "{" + strings.Join(s, ", ") + "}"
+}
@@ -30,6 +30,7 @@ func TestVaultConfig_Copy(t *testing.T) {
 			&VaultConfig{
 				Address:    String("address"),
 				Enabled:    Bool(true),
+				Name:       String("regional"),
 				Namespace:  String("foo"),
 				RenewToken: Bool(true),
 				Retry:      &RetryConfig{Enabled: Bool(true)},
@@ -42,6 +43,9 @@ func TestVaultConfig_Copy(t *testing.T) {
 				VaultAgentTokenFile:        String("/tmp/vault/agent/token"),
 				DefaultLeaseDuration:       TimeDuration(5 * time.Minute),
 				LeaseRenewalThreshold:      Float64(0.70),
+				LeaseRenewalJitter:         Float64(0.20),
+				LeaseRenewalMinSleep:       TimeDuration(10 * time.Second),
+				LeaseRenewalGrace:          Float64(0.20),
 				K8SAuthRoleName:            String("default"),
 				K8SServiceAccountTokenPath: String("account_token_path"),
 				K8SServiceAccountToken:     String("account_token"),
@@ -146,6 +150,24 @@ func TestVaultConfig_Merge(t *testing.T) {
 			&VaultConfig{Address: String("address")},
 			&VaultConfig{Address: String("address")},
 		},
+		{
+			"name_overrides",
+			&VaultConfig{Name: String("foo")},
+			&VaultConfig{Name: String("bar")},
+			&VaultConfig{Name: String("bar")},
+		},
+		{
+			"name_empty_one",
+			&VaultConfig{Name: String("foo")},
+			&VaultConfig{},
+			&VaultConfig{Name: String("foo")},
+		},
+		{
+			"name_empty_two",
+			&VaultConfig{},
+			&VaultConfig{Name: String("bar")},
+			&VaultConfig{Name: String("bar")},
+		},
 		{
 			"namespace_overrides",
 			&VaultConfig{Namespace: String("foo")},
@@ -362,6 +384,42 @@ func TestVaultConfig_Merge(t *testing.T) {
 			&VaultConfig{LeaseRenewalThreshold: Float64(0.7)},
 			&VaultConfig{LeaseRenewalThreshold: Float64(0.7)},
 		},
+		{
+			"lease_renewal_jitter_overrides",
+			&VaultConfig{LeaseRenewalJitter: Float64(0.1)},
+			&VaultConfig{LeaseRenewalJitter: Float64(0.2)},
+			&VaultConfig{LeaseRenewalJitter: Float64(0.2)},
+		},
+		{
+			"lease_renewal_jitter_empty_one",
+			&VaultConfig{LeaseRenewalJitter: Float64(0.2)},
+			&VaultConfig{},
+			&VaultConfig{LeaseRenewalJitter: Float64(0.2)},
+		},
+		{
+			"lease_renewal_min_sleep_overrides",
+			&VaultConfig{LeaseRenewalMinSleep: TimeDuration(5 * time.Second)},
+			&VaultConfig{LeaseRenewalMinSleep: TimeDuration(30 * time.Second)},
+			&VaultConfig{LeaseRenewalMinSleep: TimeDuration(30 * time.Second)},
+		},
+		{
+			"lease_renewal_min_sleep_empty_two",
+			&VaultConfig{},
+			&VaultConfig{LeaseRenewalMinSleep: TimeDuration(30 * time.Second)},
+			&VaultConfig{LeaseRenewalMinSleep: TimeDuration(30 * time.Second)},
+		},
+		{
+			"lease_renewal_grace_overrides",
+			&VaultConfig{LeaseRenewalGrace: Float64(0.1)},
+			&VaultConfig{LeaseRenewalGrace: Float64(0.2)},
+			&VaultConfig{LeaseRenewalGrace: Float64(0.2)},
+		},
+		{
+			"lease_renewal_grace_empty_one",
+			&VaultConfig{LeaseRenewalGrace: Float64(0.2)},
+			&VaultConfig{},
+			&VaultConfig{LeaseRenewalGrace: Float64(0.2)},
+		},
 		{
 			"k8s_auth_role_name_overrides",
 			&VaultConfig{K8SAuthRoleName: String("first")},
@@ -484,6 +542,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String(""),
 				Enabled:    Bool(false),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -516,6 +575,9 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
 				LeaseRenewalThreshold:      Float64(DefaultLeaseRenewalThreshold),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String(""),
 				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
 				K8SServiceAccountToken:     String(""),
@@ -531,6 +593,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String("address"),
 				Enabled:    Bool(true),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -563,6 +626,9 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
 				LeaseRenewalThreshold:      Float64(DefaultLeaseRenewalThreshold),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String(""),
 				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
 				K8SServiceAccountToken:     String(""),
@@ -583,6 +649,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String("address"),
 				Enabled:    Bool(true),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -615,6 +682,9 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
 				LeaseRenewalThreshold:      Float64(DefaultLeaseRenewalThreshold),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String(""),
 				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
 				K8SServiceAccountToken:     String(""),
@@ -640,6 +710,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String("address"),
 				Enabled:    Bool(true),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -672,6 +743,9 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
 				LeaseRenewalThreshold:      Float64(DefaultLeaseRenewalThreshold),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String(""),
 				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
 				K8SServiceAccountToken:     String(""),
@@ -695,6 +769,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String("address"),
 				Enabled:    Bool(true),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -727,6 +802,66 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
 				LeaseRenewalThreshold:      Float64(DefaultLeaseRenewalThreshold),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
+				K8SAuthRoleName:            String(""),
+				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
+				K8SServiceAccountToken:     String(""),
+				K8SServiceMountPath:        String(DefaultK8SServiceMountPath),
+			},
+		},
+		{
+			"named_without_env",
+			map[string]string{
+				api.EnvVaultAddress:    "env_address",
+				api.EnvVaultToken:      "env_token",
+				api.EnvVaultCACert:     "ca_cert",
+				api.EnvVaultSkipVerify: "true",
+				"VAULT_NAMESPACE":      "env_namespace",
+			},
+			&VaultConfig{
+				Name: String("regional"),
+			},
+			&VaultConfig{
+				Address:    String(""),
+				Enabled:    Bool(false),
+				Name:       String("regional"),
+				Namespace:  String(""),
+				RenewToken: Bool(false),
+				Retry: &RetryConfig{
+					Backoff:    TimeDuration(DefaultRetryBackoff),
+					MaxBackoff: TimeDuration(DefaultRetryMaxBackoff),
+					Enabled:    Bool(true),
+					Attempts:   Int(DefaultRetryAttempts),
+				},
+				SSL: &SSLConfig{
+					CaCert:      String(""),
+					CaCertBytes: String(""),
+					CaPath:      String(""),
+					Cert:        String(""),
+					Enabled:     Bool(true),
+					Key:         String(""),
+					ServerName:  String(""),
+					Verify:      Bool(true),
+				},
+				Token: String(""),
+				Transport: &TransportConfig{
+					DialKeepAlive:       TimeDuration(DefaultDialKeepAlive),
+					DialTimeout:         TimeDuration(DefaultDialTimeout),
+					DisableKeepAlives:   Bool(false),
+					IdleConnTimeout:     TimeDuration(DefaultIdleConnTimeout),
+					MaxIdleConns:        Int(DefaultMaxIdleConns),
+					MaxIdleConnsPerHost: Int(DefaultMaxIdleConnsPerHost),
+					MaxConnsPerHost:     Int(DefaultMaxConnsPerHost),
+					TLSHandshakeTimeout: TimeDuration(DefaultTLSHandshakeTimeout),
+				},
+				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
+				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
+				LeaseRenewalThreshold:      Float64(DefaultLeaseRenewalThreshold),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String(""),
 				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
 				K8SServiceAccountToken:     String(""),
@@ -743,6 +878,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String("address"),
 				Enabled:    Bool(true),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -775,6 +911,9 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(1 * time.Minute),
 				LeaseRenewalThreshold:      Float64(DefaultLeaseRenewalThreshold),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String(""),
 				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
 				K8SServiceAccountToken:     String(""),
@@ -791,6 +930,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String("address"),
 				Enabled:    Bool(true),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -823,6 +963,9 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
 				LeaseRenewalThreshold:      Float64(0.70),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String(""),
 				K8SServiceAccountTokenPath: String(DefaultK8SServiceAccountTokenPath),
 				K8SServiceAccountToken:     String(""),
@@ -841,6 +984,7 @@ func TestVaultConfig_Finalize(t *testing.T) {
 			&VaultConfig{
 				Address:    String(""),
 				Enabled:    Bool(false),
+				Name:       String(""),
 				Namespace:  String(""),
 				RenewToken: Bool(false),
 				Retry: &RetryConfig{
@@ -873,6 +1017,9 @@ func TestVaultConfig_Finalize(t *testing.T) {
 				UnwrapToken:                Bool(DefaultVaultUnwrapToken),
 				DefaultLeaseDuration:       TimeDuration(DefaultVaultLeaseDuration),
 				LeaseRenewalThreshold:      Float64(0.90),
+				LeaseRenewalJitter:         Float64(DefaultLeaseRenewalJitter),
+				LeaseRenewalMinSleep:       TimeDuration(0),
+				LeaseRenewalGrace:          Float64(0),
 				K8SAuthRoleName:            String("K8SAuthRoleName"),
 				K8SServiceAccountTokenPath: String("K8SServiceAccountTokenPath"),
 				K8SServiceAccountToken:     String("K8SServiceAccountToken"),
@@ -896,6 +1043,60 @@ func TestVaultConfig_Finalize(t *testing.T) {
 	}
 }
 
+func TestVaultConfigs_Merge(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *VaultConfigs
+		b    *VaultConfigs
+		r    *VaultConfigs
+	}{
+		{
+			"nil_a",
+			nil,
+			&VaultConfigs{},
+			&VaultConfigs{},
+		},
+		{
+			"nil_b",
+			&VaultConfigs{},
+			nil,
+			&VaultConfigs{},
+		},
+		{
+			"appends",
+			&VaultConfigs{&VaultConfig{Name: String("a")}},
+			&VaultConfigs{&VaultConfig{Name: String("b")}},
+			&VaultConfigs{
+				&VaultConfig{Name: String("a")},
+				&VaultConfig{Name: String("b")},
+			},
+		},
+		{
+			"merges_same_name",
+			&VaultConfigs{
+				&VaultConfig{Name: String("a"), Address: String("foo")},
+				&VaultConfig{Name: String("b")},
+			},
+			&VaultConfigs{
+				&VaultConfig{Name: String("a"), Token: String("token")},
+			},
+			&VaultConfigs{
+				&VaultConfig{Name: String("a"), Address: String("foo"), Token: String("token")},
+				&VaultConfig{Name: String("b")},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Merge(tc.b)
+			if !reflect.DeepEqual(tc.r, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, r)
+			}
+		})
+	}
+}
+
 func TestVaultConfig_TokenRenew(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -0,0 +1,171 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultWebhookTimeout is the default amount of time to wait for the
+	// webhook to respond.
+	DefaultWebhookTimeout = 10 * time.Second
+)
+
+// WebhookConfig is the configuration for notifying an external system of each
+// render which changed a destination.
+type WebhookConfig struct {
+	// Enabled controls whether the webhook is notified.
+	Enabled *bool `mapstructure:"enabled"`
+
+	// URL is the address each notification is POSTed to.
+	URL *string `mapstructure:"url"`
+
+	// Headers are additional headers to send with each notification. They
+	// may hold credentials, so they are not logged.
+	Headers map[string]string `mapstructure:"headers" json:"-"`
+
+	// Timeout is the maximum amount of time to wait for the webhook to
+	// respond.
+	Timeout *time.Duration `mapstructure:"timeout"`
+
+	// Retry is the configuration for retrying failed notifications. By
+	// default, they are not retried.
+	Retry *RetryConfig `mapstructure:"retry"`
+}
+
+// DefaultWebhookConfig returns a configuration that is populated with the
+// default values.
+func DefaultWebhookConfig() *WebhookConfig {
+	return &WebhookConfig{}
+}
+
+// Copy returns a deep copy of this configuration.
+func (c *WebhookConfig) Copy() *WebhookConfig {
+	if c == nil {
+		return nil
+	}
+
+	var o WebhookConfig
+
+	o.Enabled = c.Enabled
+
+	o.URL = c.URL
+
+	if c.Headers != nil {
+		o.Headers = make(map[string]string, len(c.Headers))
+		for k, v := range c.Headers {
+			o.Headers[k] = v
+		}
+	}
+
+	o.Timeout = c.Timeout
+
+	if c.Retry != nil {
+		o.Retry = c.Retry.Copy()
+	}
+
+	return &o
+}
+
+// Merge combines all values in this configuration with the values in the other
+// configuration, with values in the other configuration taking precedence.
+// Maps and slices are merged, most other values are overwritten. Complex
+// structs define their own merge functionality.
+func (c *WebhookConfig) Merge(o *WebhookConfig) *WebhookConfig {
+	if c == nil {
+		if o == nil {
+			return nil
+		}
+		return o.Copy()
+	}
+
+	if o == nil {
+		return c.Copy()
+	}
+
+	r := c.Copy()
+
+	if o.Enabled != nil {
+		r.Enabled = o.Enabled
+	}
+
+	if o.URL != nil {
+		r.URL = o.URL
+	}
+
+	if o.Headers != nil {
+		if r.Headers == nil {
+			r.Headers = make(map[string]string, len(o.Headers))
+		}
+		for k, v := range o.Headers {
+			r.Headers[k] = v
+		}
+	}
+
+	if o.Timeout != nil {
+		r.Timeout = o.Timeout
+	}
+
+	if o.Retry != nil {
+		r.Retry = r.Retry.Merge(o.Retry)
+	}
+
+	return r
+}
+
+// Finalize ensures there no nil pointers.
+func (c *WebhookConfig) Finalize() {
+	if c.Enabled == nil {
+		c.Enabled = Bool(StringPresent(c.URL))
+	}
+
+	if c.URL == nil {
+		c.URL = String("")
+	}
+
+	if c.Headers == nil {
+		c.Headers = map[string]string{}
+	}
+
+	if c.Timeout == nil {
+		c.Timeout = TimeDuration(DefaultWebhookTimeout)
+	}
+
+	// Notifications are only retried when a retry block is given.
+	if c.Retry == nil {
+		c.Retry = &RetryConfig{Enabled: Bool(false)}
+	}
+	c.Retry.Finalize()
+}
+
+// GoString defines the printable version of this struct. The headers may hold
+// credentials, so only their names are printed.
+func (c *WebhookConfig) GoString() string {
+	if c == nil {
+		return "(*WebhookConfig)(nil)"
+	}
+
+	names := make([]string, 0, len(c.Headers))
+	for k := range c.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return fmt.Sprintf("&WebhookConfig{"+
+		"Enabled:%s, "+
+		"URL:%s, "+
+		"Headers:%s, "+
+		"Timeout:%s, "+
+		"Retry:%#v"+
+		"}",
+		BoolGoString(c.Enabled),
+		StringGoString(c.URL),
+		names,
+		TimeDurationGoString(c.Timeout),
+		c.Retry,
+	)
+}
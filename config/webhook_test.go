@@ -0,0 +1,157 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhookConfig_Copy(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *WebhookConfig
+	}{
+		{
+			"nil",
+			nil,
+		},
+		{
+			"empty",
+			&WebhookConfig{},
+		},
+		{
+			"copy",
+			&WebhookConfig{
+				Enabled: Bool(true),
+				URL:     String("http://127.0.0.1/hook"),
+				Headers: map[string]string{"X-Token": "secret"},
+				Timeout: TimeDuration(5 * time.Second),
+				Retry:   &RetryConfig{Attempts: Int(3)},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Copy()
+			if !reflect.DeepEqual(tc.a, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.a, r)
+			}
+		})
+	}
+}
+
+func TestWebhookConfig_Merge(t *testing.T) {
+	cases := []struct {
+		name string
+		a    *WebhookConfig
+		b    *WebhookConfig
+		r    *WebhookConfig
+	}{
+		{
+			"nil_a",
+			nil,
+			&WebhookConfig{},
+			&WebhookConfig{},
+		},
+		{
+			"nil_b",
+			&WebhookConfig{},
+			nil,
+			&WebhookConfig{},
+		},
+		{
+			"nil_both",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"url_overrides",
+			&WebhookConfig{URL: String("one")},
+			&WebhookConfig{URL: String("two")},
+			&WebhookConfig{URL: String("two")},
+		},
+		{
+			"headers_merge",
+			&WebhookConfig{Headers: map[string]string{"A": "1", "B": "1"}},
+			&WebhookConfig{Headers: map[string]string{"B": "2", "C": "2"}},
+			&WebhookConfig{Headers: map[string]string{"A": "1", "B": "2", "C": "2"}},
+		},
+		{
+			"retry_merge",
+			&WebhookConfig{Retry: &RetryConfig{Attempts: Int(3)}},
+			&WebhookConfig{Retry: &RetryConfig{Backoff: TimeDuration(time.Second)}},
+			&WebhookConfig{Retry: &RetryConfig{
+				Attempts: Int(3),
+				Backoff:  TimeDuration(time.Second),
+			}},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			r := tc.a.Merge(tc.b)
+			if !reflect.DeepEqual(tc.r, r) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, r)
+			}
+		})
+	}
+}
+
+func TestWebhookConfig_Finalize(t *testing.T) {
+	cases := []struct {
+		name string
+		i    *WebhookConfig
+		r    *WebhookConfig
+	}{
+		{
+			"empty",
+			&WebhookConfig{},
+			&WebhookConfig{
+				Enabled: Bool(false),
+				URL:     String(""),
+				Headers: map[string]string{},
+				Timeout: TimeDuration(DefaultWebhookTimeout),
+				Retry: &RetryConfig{
+					Attempts:   Int(DefaultRetryAttempts),
+					Backoff:    TimeDuration(DefaultRetryBackoff),
+					MaxBackoff: TimeDuration(DefaultRetryMaxBackoff),
+					Enabled:    Bool(false),
+				},
+			},
+		},
+		{
+			"with_url_and_retry",
+			&WebhookConfig{
+				URL:   String("http://127.0.0.1/hook"),
+				Retry: &RetryConfig{Attempts: Int(3)},
+			},
+			&WebhookConfig{
+				Enabled: Bool(true),
+				URL:     String("http://127.0.0.1/hook"),
+				Headers: map[string]string{},
+				Timeout: TimeDuration(DefaultWebhookTimeout),
+				Retry: &RetryConfig{
+					Attempts:   Int(3),
+					Backoff:    TimeDuration(DefaultRetryBackoff),
+					MaxBackoff: TimeDuration(DefaultRetryMaxBackoff),
+					Enabled:    Bool(true),
+				},
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			tc.i.Finalize()
+			if !reflect.DeepEqual(tc.r, tc.i) {
+				t.Errorf("\nexp: %#v\nact: %#v", tc.r, tc.i)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"sort"
 
+	"github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
 )
 
@@ -52,6 +53,8 @@ type CatalogNodeService struct {
 	Port              int
 	Address           string
 	EnableTagOverride bool
+	Weights           api.AgentWeights
+	TaggedAddresses   map[string]api.ServiceAddress
 }
 
 // NewCatalogNodeQuery parses the given string into a dependency. If the name is
@@ -135,6 +138,8 @@ func (d *CatalogNodeQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interf
 			Port:              v.Port,
 			Address:           v.Address,
 			EnableTagOverride: v.EnableTagOverride,
+			Weights:           v.Weights,
+			TaggedAddresses:   v.TaggedAddresses,
 		})
 	}
 	sort.Stable(ByService(services))
@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/consul-template/test"
 	"testing"
 
+	"github.com/hashicorp/consul/api"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -185,6 +186,10 @@ func TestCatalogNodeQuery_Fetch(t *testing.T) {
 							Tags:    ServiceTags([]string{}),
 							Meta:    map[string]string{},
 							Port:    12345,
+							Weights: api.AgentWeights{
+								Passing: 1,
+								Warning: 1,
+							},
 						},
 						{
 							ID:      fmt.Sprintf("conn-enabled-service-proxy-%s-%s", tenancy.Partition, tenancy.Namespace),
@@ -192,6 +197,10 @@ func TestCatalogNodeQuery_Fetch(t *testing.T) {
 							Tags:    ServiceTags([]string{}),
 							Meta:    map[string]string{},
 							Port:    21999,
+							Weights: api.AgentWeights{
+								Passing: 1,
+								Warning: 1,
+							},
 						},
 						{
 
@@ -201,12 +210,30 @@ func TestCatalogNodeQuery_Fetch(t *testing.T) {
 							Meta: map[string]string{
 								"meta1": "value1",
 							},
+							Weights: api.AgentWeights{
+								Passing: 1,
+								Warning: 1,
+							},
 						},
 						{
 							ID:      fmt.Sprintf("service-taggedAddresses-%s-%s", tenancy.Partition, tenancy.Namespace),
 							Service: fmt.Sprintf("service-taggedAddresses-%s-%s", tenancy.Partition, tenancy.Namespace),
 							Tags:    ServiceTags([]string{}),
 							Meta:    map[string]string{},
+							Weights: api.AgentWeights{
+								Passing: 1,
+								Warning: 1,
+							},
+							TaggedAddresses: map[string]api.ServiceAddress{
+								"lan": {
+									Address: "192.0.2.1",
+									Port:    80,
+								},
+								"wan": {
+									Address: "192.0.2.2",
+									Port:    443,
+								},
+							},
 						},
 					},
 				},
@@ -244,6 +271,10 @@ func TestCatalogNodeQuery_Fetch(t *testing.T) {
 							Port:    testConsul.Config.Ports.Server,
 							Tags:    ServiceTags([]string{}),
 							Meta:    map[string]string{},
+							Weights: api.AgentWeights{
+								Passing: 1,
+								Warning: 1,
+							},
 						},
 					},
 				},
@@ -287,6 +318,58 @@ func TestCatalogNodeQuery_Fetch(t *testing.T) {
 	}
 }
 
+func TestCatalogNodeQuery_Fetch_ServiceDetails(t *testing.T) {
+	catalog := testClients.Consul().Catalog()
+	if _, err := catalog.Register(&api.CatalogRegistration{
+		Node:    "service-details-node",
+		Address: "127.0.0.1",
+		Service: &api.AgentService{
+			ID:      "routed",
+			Service: "routed",
+			Meta: map[string]string{
+				"route": "canary",
+			},
+			Weights: api.AgentWeights{
+				Passing: 10,
+				Warning: 2,
+			},
+			TaggedAddresses: map[string]api.ServiceAddress{
+				"lan": {
+					Address: "192.0.2.10",
+					Port:    8080,
+				},
+			},
+		},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Deregister(&api.CatalogDeregistration{Node: "service-details-node"}, nil)
+
+	d, err := NewCatalogNodeQuery("service-details-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	act, _, err := d.Fetch(testClients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := act.(*CatalogNode).Services
+	if len(services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(services))
+	}
+	svc := services[0]
+	assert.Equal(t, map[string]string{"route": "canary"}, filterVersionMeta(svc.Meta))
+	assert.Equal(t, api.AgentWeights{Passing: 10, Warning: 2}, svc.Weights)
+	assert.Equal(t, map[string]api.ServiceAddress{
+		"lan": {
+			Address: "192.0.2.10",
+			Port:    8080,
+		},
+	}, svc.TaggedAddresses)
+}
+
 func TestCatalogNodeQuery_String(t *testing.T) {
 	type testCase struct {
 		name string
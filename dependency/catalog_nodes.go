@@ -7,6 +7,7 @@ import (
 	"encoding/gob"
 	"fmt"
 	"log"
+	"net/netip"
 	"net/url"
 	"regexp"
 	"sort"
@@ -44,6 +45,10 @@ type CatalogNodesQuery struct {
 	near      string
 	namespace string
 	partition string
+
+	// nodeCIDR restricts the results to nodes with an address in the
+	// network, when it is valid.
+	nodeCIDR netip.Prefix
 }
 
 // NewCatalogNodesQuery parses the given string into a dependency. If the name is
@@ -54,17 +59,23 @@ func NewCatalogNodesQuery(s string) (*CatalogNodesQuery, error) {
 	}
 
 	m := regexpMatch(CatalogNodesQueryRe, s)
-	queryParams, err := GetConsulQueryOpts(m, "catalog.nodes")
+	queryParams, err := GetConsulQueryOpts(m, "catalog.nodes", QueryNodeCIDR)
 	if err != nil {
 		return nil, err
 	}
 
+	nodeCIDR, err := parseNodeCIDR(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("catalog.nodes: %s", err)
+	}
+
 	return &CatalogNodesQuery{
 		dc:        m["dc"],
 		near:      m["near"],
 		stopCh:    make(chan struct{}, 1),
 		namespace: queryParams.Get(QueryNamespace),
 		partition: queryParams.Get(QueryPartition),
+		nodeCIDR:  nodeCIDR,
 	}, nil
 }
 
@@ -97,6 +108,9 @@ func (d *CatalogNodesQuery) Fetch(clients *ClientSet, opts *QueryOptions) (inter
 
 	nodes := make([]*Node, 0, len(n))
 	for _, node := range n {
+		if !nodeInCIDR(d.nodeCIDR, node.Address) {
+			continue
+		}
 		nodes = append(nodes, &Node{
 			ID:              node.ID,
 			Node:            node.Node,
@@ -137,6 +151,9 @@ func (d *CatalogNodesQuery) String() string {
 	if d.namespace != "" {
 		name = name + "@ns=" + d.namespace
 	}
+	if d.nodeCIDR.IsValid() {
+		name = name + "@node-cidr=" + d.nodeCIDR.String()
+	}
 	if d.near != "" {
 		name = name + "~" + d.near
 	}
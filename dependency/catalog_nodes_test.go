@@ -6,8 +6,10 @@ package dependency
 import (
 	"fmt"
 	"github.com/hashicorp/consul-template/test"
+	"net/netip"
 	"testing"
 
+	"github.com/hashicorp/consul/api"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -118,6 +120,36 @@ func TestNewCatalogNodesQuery(t *testing.T) {
 				},
 				false,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_cidr", tenancy),
+				"?node-cidr=10.1.2.3/8@dc1",
+				&CatalogNodesQuery{
+					dc:       "dc1",
+					nodeCIDR: netip.MustParsePrefix("10.0.0.0/8"),
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_cidr_ipv6", tenancy),
+				"?node-cidr=2001:db8::/32~node1",
+				&CatalogNodesQuery{
+					near:     "node1",
+					nodeCIDR: netip.MustParsePrefix("2001:db8::/32"),
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_cidr_invalid", tenancy),
+				"?node-cidr=10.0.0.0/33",
+				nil,
+				true,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_cidr_not_cidr", tenancy),
+				"?node-cidr=10.0.0.1",
+				nil,
+				true,
+			},
 		}
 	})
 
@@ -306,6 +338,52 @@ func TestCatalogNodesQuery_Fetch(t *testing.T) {
 	}
 }
 
+func TestCatalogNodesQuery_Fetch_NodeCIDR(t *testing.T) {
+	catalog := testClients.Consul().Catalog()
+	for node, address := range map[string]string{
+		"cidr-node-v4": "10.1.2.3",
+		"cidr-node-v6": "2001:db8::1",
+	} {
+		if _, err := catalog.Register(&api.CatalogRegistration{
+			Node:    node,
+			Address: address,
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+		defer catalog.Deregister(&api.CatalogDeregistration{Node: node}, nil)
+	}
+
+	cases := []struct {
+		name string
+		i    string
+		exp  []string
+	}{
+		{"ipv4", "?node-cidr=10.0.0.0/8", []string{"cidr-node-v4"}},
+		{"ipv6", "?node-cidr=2001:db8::/32", []string{"cidr-node-v6"}},
+		{"none", "?node-cidr=192.0.2.0/24", []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := NewCatalogNodesQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Stop()
+
+			act, _, err := d.Fetch(testClients, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, n := range act.([]*Node) {
+				names = append(names, n.Node)
+			}
+			assert.Equal(t, tc.exp, names)
+		})
+	}
+}
+
 func TestCatalogNodesQuery_String(t *testing.T) {
 	type testCase struct {
 		name string
@@ -344,6 +422,11 @@ func TestCatalogNodesQuery_String(t *testing.T) {
 				fmt.Sprintf("?partition=%s&ns=%s@dc1~node1", tenancy.Partition, tenancy.Namespace),
 				fmt.Sprintf("catalog.nodes(@dc1@partition=%s@ns=%s~node1)", tenancy.Partition, tenancy.Namespace),
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_cidr", tenancy),
+				"?node-cidr=2001:db8::1/32@dc1~node1",
+				"catalog.nodes(@dc1@node-cidr=2001:db8::/32~node1)",
+			},
 		}
 	})
 
@@ -9,6 +9,8 @@ import (
 	"log"
 	"net/url"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -52,6 +54,18 @@ type CatalogServiceQuery struct {
 	tag       string
 	namespace string
 	partition string
+
+	// nodeMeta restricts the results to services on nodes with all of the
+	// given metadata.
+	nodeMeta map[string]string
+
+	// stale allows any server to answer the query, rather than only the
+	// leader.
+	stale bool
+
+	// debug logs the fetches and changes of this dependency at INFO rather
+	// than TRACE.
+	debug bool
 }
 
 // NewCatalogServiceQuery parses a string into a CatalogServiceQuery.
@@ -61,11 +75,26 @@ func NewCatalogServiceQuery(s string) (*CatalogServiceQuery, error) {
 	}
 
 	m := regexpMatch(CatalogServiceQueryRe, s)
-	queryParams, err := GetConsulQueryOpts(m, "catalog.service")
+	queryParams, err := GetConsulQueryOpts(m, "catalog.service", QueryNodeMeta, QueryStale, QueryDebug)
 	if err != nil {
 		return nil, err
 	}
 
+	nodeMeta, err := parseNodeMeta(queryParams[QueryNodeMeta])
+	if err != nil {
+		return nil, fmt.Errorf("catalog.service: %s", err)
+	}
+
+	stale, err := parseStale(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("catalog.service: %s", err)
+	}
+
+	debug, err := parseDebug(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("catalog.service: %s", err)
+	}
+
 	return &CatalogServiceQuery{
 		stopCh:    make(chan struct{}, 1),
 		dc:        m["dc"],
@@ -74,9 +103,42 @@ func NewCatalogServiceQuery(s string) (*CatalogServiceQuery, error) {
 		tag:       m["tag"],
 		namespace: queryParams.Get(QueryNamespace),
 		partition: queryParams.Get(QueryPartition),
+		nodeMeta:  nodeMeta,
+		stale:     stale,
+		debug:     debug,
 	}, nil
 }
 
+// parseNodeMeta parses node-meta query parameter values of the form
+// "key:value" into a map. It returns nil if no values are given.
+func parseNodeMeta(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	meta := make(map[string]string, len(values))
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %s %q: expected key:value", QueryNodeMeta, v)
+		}
+		if prev, ok := meta[key]; ok && prev != value {
+			return nil, fmt.Errorf("conflicting %s values for %q", QueryNodeMeta, key)
+		}
+		meta[key] = value
+	}
+	return meta, nil
+}
+
+// nodeMetaPairs returns the node metadata filter as sorted "key:value" pairs.
+func nodeMetaPairs(meta map[string]string) []string {
+	pairs := make([]string, 0, len(meta))
+	for k, v := range meta {
+		pairs = append(pairs, k+":"+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
 // Fetch queries the Consul API defined by the given client and returns a slice
 // of CatalogService objects.
 func (d *CatalogServiceQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
@@ -91,20 +153,28 @@ func (d *CatalogServiceQuery) Fetch(clients *ClientSet, opts *QueryOptions) (int
 		Near:            d.near,
 		ConsulPartition: d.partition,
 		ConsulNamespace: d.namespace,
+		AllowStale:      d.stale,
 	})
 
 	u := &url.URL{
 		Path:     "/v1/catalog/service/" + d.name,
 		RawQuery: opts.String(),
 	}
-	if d.tag != "" {
+	if d.tag != "" || len(d.nodeMeta) > 0 {
 		q := u.Query()
-		q.Set("tag", d.tag)
+		if d.tag != "" {
+			q.Set("tag", d.tag)
+		}
+		for _, pair := range nodeMetaPairs(d.nodeMeta) {
+			q.Add(QueryNodeMeta, pair)
+		}
 		u.RawQuery = q.Encode()
 	}
 	log.Printf("[TRACE] %s: GET %s", d, u)
 
-	entries, qm, err := clients.Consul().Catalog().Service(d.name, d.tag, opts.ToConsulOpts())
+	consulOpts := opts.ToConsulOpts()
+	consulOpts.NodeMeta = d.nodeMeta
+	entries, qm, err := clients.Consul().Catalog().Service(d.name, d.tag, consulOpts)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, d.String())
 	}
@@ -142,6 +212,11 @@ func (d *CatalogServiceQuery) CanShare() bool {
 	return true
 }
 
+// Debug returns whether this dependency was tagged for verbose logging.
+func (d *CatalogServiceQuery) Debug() bool {
+	return d.debug
+}
+
 // String returns the human-friendly version of this dependency.
 func (d *CatalogServiceQuery) String() string {
 	name := d.name
@@ -157,6 +232,15 @@ func (d *CatalogServiceQuery) String() string {
 	if d.namespace != "" {
 		name = name + "@ns=" + d.namespace
 	}
+	if len(d.nodeMeta) > 0 {
+		name = name + "@node-meta=" + strings.Join(nodeMetaPairs(d.nodeMeta), ",")
+	}
+	if d.stale {
+		name = name + "@stale"
+	}
+	if d.debug {
+		name = name + "@debug"
+	}
 	if d.near != "" {
 		name = name + "~" + d.near
 	}
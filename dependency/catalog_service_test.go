@@ -45,6 +45,24 @@ func TestNewCatalogServiceQuery(t *testing.T) {
 				nil,
 				true,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale", tenancy),
+				"tag.name?stale@dc1~near",
+				&CatalogServiceQuery{
+					dc:    "dc1",
+					name:  "name",
+					near:  "near",
+					tag:   "tag",
+					stale: true,
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale_invalid", tenancy),
+				"name?stale=maybe",
+				nil,
+				true,
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("near_only", tenancy),
 				"~near",
@@ -141,6 +159,35 @@ func TestNewCatalogServiceQuery(t *testing.T) {
 				},
 				false,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_partition", tenancy),
+				fmt.Sprintf("name?partition=%s", tenancy.Partition),
+				&CatalogServiceQuery{
+					name:      "name",
+					partition: tenancy.Partition,
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_partition_dc", tenancy),
+				fmt.Sprintf("name?partition=%s@dc1", tenancy.Partition),
+				&CatalogServiceQuery{
+					dc:        "dc1",
+					name:      "name",
+					partition: tenancy.Partition,
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("tag_name_partition", tenancy),
+				fmt.Sprintf("tag.name?partition=%s", tenancy.Partition),
+				&CatalogServiceQuery{
+					name:      "name",
+					tag:       "tag",
+					partition: tenancy.Partition,
+				},
+				false,
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("every_option", tenancy),
 				fmt.Sprintf("tag.name?ns=%s&partition=%s@dc~near", tenancy.Namespace, tenancy.Partition),
@@ -163,6 +210,70 @@ func TestNewCatalogServiceQuery(t *testing.T) {
 				},
 				false,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_node_meta", tenancy),
+				"name?node-meta=instance-class:memory",
+				&CatalogServiceQuery{
+					name:     "name",
+					nodeMeta: map[string]string{"instance-class": "memory"},
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("tag_name_node_meta_dc", tenancy),
+				"tag.name?node-meta=instance-class:memory&node-meta=rack:r1@dc~near",
+				&CatalogServiceQuery{
+					dc:   "dc",
+					name: "name",
+					near: "near",
+					tag:  "tag",
+					nodeMeta: map[string]string{
+						"instance-class": "memory",
+						"rack":           "r1",
+					},
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_meta_every_option", tenancy),
+				fmt.Sprintf("tag:value.name?ns=%s&partition=%s&node-meta=rack:r1@dc", tenancy.Namespace, tenancy.Partition),
+				&CatalogServiceQuery{
+					dc:        "dc",
+					name:      "name",
+					tag:       "tag:value",
+					namespace: tenancy.Namespace,
+					partition: tenancy.Partition,
+					nodeMeta:  map[string]string{"rack": "r1"},
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_meta_empty_value", tenancy),
+				"name?node-meta=rack:",
+				&CatalogServiceQuery{
+					name:     "name",
+					nodeMeta: map[string]string{"rack": ""},
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_meta_missing_value", tenancy),
+				"name?node-meta=rack",
+				nil,
+				true,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_meta_missing_key", tenancy),
+				"name?node-meta=:r1",
+				nil,
+				true,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("node_meta_conflicting", tenancy),
+				"name?node-meta=rack:r1&node-meta=rack:r2",
+				nil,
+				true,
+			},
 		}
 	})
 
@@ -336,6 +447,16 @@ func TestCatalogServiceQuery_String(t *testing.T) {
 				"name@dc~near",
 				"catalog.service(name@dc~near)",
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_dc_near_stale", tenancy),
+				"name?stale@dc~near",
+				"catalog.service(name@dc@stale~near)",
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("tag_name_node_meta_dc", tenancy),
+				"tag.name?node-meta=rack:r1&node-meta=instance-class:memory@dc",
+				"catalog.service(tag.name@dc@node-meta=instance-class:memory,rack:r1)",
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("tag_name", tenancy),
 				"tag.name",
@@ -361,6 +482,16 @@ func TestCatalogServiceQuery_String(t *testing.T) {
 				fmt.Sprintf("tag.name?ns=%s@dc~near", tenancy.Namespace),
 				fmt.Sprintf("catalog.service(tag.name@dc@ns=%s~near)", tenancy.Namespace),
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_partition", tenancy),
+				fmt.Sprintf("name?partition=%s", tenancy.Partition),
+				fmt.Sprintf("catalog.service(name@partition=%s)", tenancy.Partition),
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("tag_name_dc_partition", tenancy),
+				fmt.Sprintf("tag.name?partition=%s@dc", tenancy.Partition),
+				fmt.Sprintf("catalog.service(tag.name@dc@partition=%s)", tenancy.Partition),
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("tag_name_dc_near_ns_partiton", tenancy),
 				fmt.Sprintf("tag.name?ns=%s&partition=%s@dc~near", tenancy.Namespace, tenancy.Partition),
@@ -28,18 +28,26 @@ type ClientSet struct {
 	vault  *vaultClient
 	consul *consulClient
 	nomad  *nomadClient
+
+	// vaults are the clients of the named Vault clusters, which queries
+	// select with the "@<name>:" prefix.
+	vaults map[string]*vaultClient
 }
 
 // consulClient is a wrapper around a real Consul API client.
 type consulClient struct {
 	client    *consulapi.Client
 	transport *http.Transport
+
+	// tokenFileStopCh stops watching the token file, when there is one.
+	tokenFileStopCh chan struct{}
 }
 
 // vaultClient is a wrapper around a real Vault API client.
 type vaultClient struct {
-	client     *vaultapi.Client
-	httpClient *http.Client
+	client       *vaultapi.Client
+	httpClient   *http.Client
+	onRenewError func(path string, err error)
 }
 
 // nomadClient is a wrapper around a real Nomad API client.
@@ -87,6 +95,10 @@ type CreateConsulClientInput struct {
 
 // CreateVaultClientInput is used as input to the CreateVaultClient function.
 type CreateVaultClientInput struct {
+	// Name is the name of the Vault cluster the client is created for. The
+	// client of the default cluster has no name.
+	Name string
+
 	Address         string
 	Namespace       string
 	Token           string
@@ -115,6 +127,11 @@ type CreateVaultClientInput struct {
 	TransportMaxIdleConnsPerHost int
 	TransportMaxConnsPerHost     int
 	TransportTLSHandshakeTimeout time.Duration
+
+	// OnRenewError, if set, is called whenever renewing a token or the lease
+	// of a secret fails, with the dependency and the error. It is called from
+	// the renewer goroutine, so it should not block.
+	OnRenewError func(path string, err error)
 }
 
 // CreateNomadClientInput is used as input to the CreateNomadClient function.
@@ -242,18 +259,44 @@ func (c *ClientSet) CreateConsulClient(i *CreateConsulClientInput) error {
 	// Setup the new transport
 	consulConfig.Transport = transport
 
+	// The API client only reads the token file once, so set the token of each
+	// request instead, and swap it whenever the file changes.
+	var tokenTransport *consulTokenTransport
+	if i.TokenFile != "" {
+		httpClient, err := consulapi.NewHttpClient(transport, consulConfig.TLSConfig)
+		if err != nil {
+			return fmt.Errorf("client set: consul: %s", err)
+		}
+		tokenTransport = &consulTokenTransport{base: httpClient.Transport}
+		if token, err := readConsulTokenFile(i.TokenFile); err == nil {
+			tokenTransport.token.Store(token)
+		}
+		httpClient.Transport = tokenTransport
+		consulConfig.HttpClient = httpClient
+	}
+
 	// Create the API client
 	client, err := consulapi.NewClient(consulConfig)
 	if err != nil {
 		return fmt.Errorf("client set: consul: %s", err)
 	}
 
-	// Save the data on ourselves
-	c.Lock()
-	c.consul = &consulClient{
+	consul := &consulClient{
 		client:    client,
 		transport: transport,
 	}
+	if tokenTransport != nil {
+		consul.tokenFileStopCh = make(chan struct{})
+		go watchConsulTokenFile(i.TokenFile, tokenTransport,
+			consulTokenFileSleepTime, consul.tokenFileStopCh)
+	}
+
+	// Save the data on ourselves
+	c.Lock()
+	if c.consul != nil && c.consul.tokenFileStopCh != nil {
+		close(c.consul.tokenFileStopCh)
+	}
+	c.consul = consul
 	c.Unlock()
 
 	return nil
@@ -368,10 +411,19 @@ func (c *ClientSet) CreateVaultClient(i *CreateVaultClientInput) error {
 	}
 
 	// Save the data on ourselves
+	vc := &vaultClient{
+		client:       client,
+		httpClient:   vaultConfig.HttpClient,
+		onRenewError: i.OnRenewError,
+	}
 	c.Lock()
-	c.vault = &vaultClient{
-		client:     client,
-		httpClient: vaultConfig.HttpClient,
+	if i.Name == "" {
+		c.vault = vc
+	} else {
+		if c.vaults == nil {
+			c.vaults = make(map[string]*vaultClient)
+		}
+		c.vaults[i.Name] = vc
 	}
 	c.Unlock()
 
@@ -505,6 +557,37 @@ func (c *ClientSet) Vault() *vaultapi.Client {
 	return c.vault.client
 }
 
+// VaultCluster returns the Vault client of the named cluster of this set, or
+// the default Vault client if the name is empty.
+func (c *ClientSet) VaultCluster(name string) (*vaultapi.Client, error) {
+	if name == "" {
+		return c.Vault(), nil
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+	vc, ok := c.vaults[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown vault cluster %q", name)
+	}
+	return vc.client, nil
+}
+
+// vaultRenewError reports a failed renewal to the OnRenewError hook of the
+// client of the named Vault cluster, or of the default cluster if the name is
+// empty, if there is one.
+func (c *ClientSet) vaultRenewError(cluster, path string, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	vc := c.vault
+	if cluster != "" {
+		vc = c.vaults[cluster]
+	}
+	if vc != nil && vc.onRenewError != nil {
+		vc.onRenewError(path, err)
+	}
+}
+
 // Nomad returns the Nomad client for this set.
 func (c *ClientSet) Nomad() *nomadapi.Client {
 	c.RLock()
@@ -519,12 +602,20 @@ func (c *ClientSet) Stop() {
 
 	if c.consul != nil {
 		c.consul.transport.CloseIdleConnections()
+		if c.consul.tokenFileStopCh != nil {
+			close(c.consul.tokenFileStopCh)
+			c.consul.tokenFileStopCh = nil
+		}
 	}
 
 	if c.vault != nil {
 		c.vault.httpClient.Transport.(*http.Transport).CloseIdleConnections()
 	}
 
+	for _, vc := range c.vaults {
+		vc.httpClient.Transport.(*http.Transport).CloseIdleConnections()
+	}
+
 	if c.nomad != nil {
 		c.nomad.httpClient.Transport.(*http.Transport).CloseIdleConnections()
 	}
@@ -9,7 +9,10 @@ import (
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul-template/test"
 	"github.com/hashicorp/vault/api"
@@ -248,3 +251,87 @@ func newVaultMockReversedProxy(tb testing.TB, mocks ...vaultMock) string {
 
 	return testServer.URL
 }
+
+func TestClientSet_ConsulTokenFile(t *testing.T) {
+	sleepTime := consulTokenFileSleepTime
+	consulTokenFileSleepTime = 10 * time.Millisecond
+	defer func() { consulTokenFileSleepTime = sleepTime }()
+
+	tokens := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens <- r.Header.Get("X-Consul-Token")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	clientSet := NewClientSet()
+	defer clientSet.Stop()
+	require.NoError(t, clientSet.CreateConsulClient(&CreateConsulClientInput{
+		Address:   ts.URL,
+		TokenFile: path,
+	}))
+
+	// requestToken makes a request and returns the token it was sent with
+	requestToken := func() string {
+		_, _, err := clientSet.Consul().KV().Get("foo", nil)
+		require.NoError(t, err)
+		return <-tokens
+	}
+
+	// waitToken waits until requests are sent with the expected token
+	waitToken := func(exp string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for act := requestToken(); act != exp; act = requestToken() {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected token %q, got %q", exp, act)
+			}
+			time.Sleep(consulTokenFileSleepTime)
+		}
+	}
+
+	assert.Equal(t, "first", requestToken())
+
+	// A rotated token is used for subsequent requests
+	require.NoError(t, os.WriteFile(path, []byte("second\n"), 0o600))
+	waitToken("second")
+
+	// An empty token file does not replace the working token
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	time.Sleep(5 * consulTokenFileSleepTime)
+	assert.Equal(t, "second", requestToken())
+
+	require.NoError(t, os.WriteFile(path, []byte("third"), 0o600))
+	waitToken("third")
+}
+
+func TestClientSet_vaultRenewError(t *testing.T) {
+	reported := map[string][]string{}
+	hook := func(cluster string) func(string, error) {
+		return func(path string, err error) {
+			reported[cluster] = append(reported[cluster], path)
+		}
+	}
+
+	clients := NewClientSet()
+	for _, name := range []string{"", "regional"} {
+		require.NoError(t, clients.CreateVaultClient(&CreateVaultClientInput{
+			Name:         name,
+			Address:      "http://127.0.0.1:8200",
+			OnRenewError: hook(name),
+		}))
+	}
+
+	// Failures are reported to the hook of the cluster of the secret
+	clients.vaultRenewError("", "vault.read(secret/foo)", ErrLeaseExpired)
+	clients.vaultRenewError("regional", "vault.read(@regional:secret/bar)", ErrLeaseExpired)
+	clients.vaultRenewError("unknown", "vault.read(@unknown:secret/baz)", ErrLeaseExpired)
+
+	assert.Equal(t, map[string][]string{
+		"":         {"vault.read(secret/foo)"},
+		"regional": {"vault.read(@regional:secret/bar)"},
+	}, reported)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*AgentSelfQuery)(nil)
+
+	// AgentSelfQuerySleepTime is the default amount of time to sleep between
+	// queries, since the endpoint does not support blocking queries.
+	AgentSelfQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+func init() {
+	gob.Register(&AgentSelf{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// AgentSelf is the configuration and membership of the local Consul agent.
+// The runtime statistics and network coordinates are omitted, since they
+// change on every query and would trigger a render each time.
+type AgentSelf struct {
+	// Config is the configuration of the agent, such as its NodeName,
+	// Datacenter and AdvertiseAddr.
+	Config map[string]interface{}
+
+	// Member is the gossip membership of the agent, such as its Name, Addr
+	// and Tags.
+	Member map[string]interface{}
+
+	// Meta is the node metadata of the agent.
+	Meta map[string]string
+}
+
+// AgentSelfQuery is the dependency to query the configuration of the local
+// Consul agent.
+type AgentSelfQuery struct {
+	stopCh chan struct{}
+
+	// interval is the time to sleep between queries.
+	interval time.Duration
+}
+
+// NewAgentSelfQuery creates a new agent self query which polls at the given
+// interval, or AgentSelfQuerySleepTime if it is zero.
+func NewAgentSelfQuery(interval time.Duration) (*AgentSelfQuery, error) {
+	if interval < 0 {
+		return nil, fmt.Errorf("agent.self: invalid interval: %s", interval)
+	}
+	return &AgentSelfQuery{
+		stopCh:   make(chan struct{}, 1),
+		interval: interval,
+	}, nil
+}
+
+// Fetch queries the Consul API defined by the given client and returns the
+// configuration of the local agent.
+func (d *AgentSelfQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// The agent self endpoint does not support blocking queries, so sleep
+	// between queries after the first one.
+	if opts.WaitIndex != 0 {
+		dur := d.interval
+		if dur == 0 {
+			dur = AgentSelfQuerySleepTime
+		}
+		log.Printf("[TRACE] %s: long polling for %s", d, dur)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(dur):
+		}
+	}
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/agent/self",
+		RawQuery: opts.String(),
+	})
+
+	reply, err := clients.Consul().Agent().Self()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", d, err)
+	}
+
+	self := &AgentSelf{
+		Config: reply["Config"],
+		Member: reply["Member"],
+		Meta:   make(map[string]string, len(reply["Meta"])),
+	}
+	for k, v := range reply["Meta"] {
+		if s, ok := v.(string); ok {
+			self.Meta[k] = s
+		}
+	}
+
+	log.Printf("[TRACE] %s: returned response", d)
+
+	// Use respWithMetadata which always increments LastIndex and results
+	// in fetching new data for endpoints that don't support blocking queries
+	return respWithMetadata(self)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *AgentSelfQuery) CanShare() bool {
+	return true
+}
+
+// Stop halts the dependency's fetch function.
+func (d *AgentSelfQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *AgentSelfQuery) String() string {
+	if d.interval != 0 {
+		return fmt.Sprintf("agent.self(%s)", d.interval)
+	}
+	return "agent.self"
+}
+
+// Type returns the type of this dependency.
+func (d *AgentSelfQuery) Type() Type {
+	return TypeConsul
+}
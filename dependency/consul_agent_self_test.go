@@ -0,0 +1,67 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	AgentSelfQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestNewAgentSelfQuery(t *testing.T) {
+	_, err := NewAgentSelfQuery(-time.Second)
+	assert.Error(t, err)
+
+	d, err := NewAgentSelfQuery(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, d.interval)
+}
+
+func TestAgentSelfQuery_Fetch(t *testing.T) {
+	d, err := NewAgentSelfQuery(0)
+	require.NoError(t, err)
+	defer d.Stop()
+
+	act, _, err := d.Fetch(testClients, nil)
+	require.NoError(t, err)
+
+	self := act.(*AgentSelf)
+	assert.Equal(t, testConsul.Config.NodeName, self.Config["NodeName"])
+	assert.Equal(t, "dc1", self.Config["Datacenter"])
+	assert.Equal(t, testConsul.Config.NodeName, self.Member["Name"])
+	assert.NotNil(t, self.Meta)
+
+	t.Run("stops", func(t *testing.T) {
+		d, err := NewAgentSelfQuery(time.Hour)
+		require.NoError(t, err)
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: 1})
+			errCh <- err
+		}()
+
+		d.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestAgentSelfQuery_String(t *testing.T) {
+	d, err := NewAgentSelfQuery(0)
+	require.NoError(t, err)
+	assert.Equal(t, "agent.self", d.String())
+
+	d, err = NewAgentSelfQuery(30 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "agent.self(30s)", d.String())
+}
@@ -0,0 +1,136 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*AutopilotHealthQuery)(nil)
+
+	// AutopilotHealthQuerySleepTime is the amount of time to sleep between
+	// queries, since the endpoint does not support blocking queries.
+	AutopilotHealthQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+func init() {
+	gob.Register(&AutopilotHealth{})
+}
+
+// AutopilotHealth is the health of the Consul servers as reported by
+// autopilot.
+type AutopilotHealth struct {
+	Healthy          bool
+	FailureTolerance int
+	Servers          []*AutopilotServerHealth
+}
+
+// AutopilotServerHealth is the health of a single Consul server. Fields which
+// change on every query, such as the last contact and the raft index, are
+// omitted so that polling only triggers a render when the health changes.
+type AutopilotServerHealth struct {
+	ID         string
+	Name       string
+	Address    string
+	SerfStatus string
+	Version    string
+	Leader     bool
+	Voter      bool
+	Healthy    bool
+}
+
+// AutopilotHealthQuery is the dependency to query the autopilot health of the
+// Consul servers. The operator:read ACL is required.
+type AutopilotHealthQuery struct {
+	stopCh chan struct{}
+}
+
+// NewAutopilotHealthQuery creates a new autopilot health query.
+func NewAutopilotHealthQuery() (*AutopilotHealthQuery, error) {
+	return &AutopilotHealthQuery{
+		stopCh: make(chan struct{}, 1),
+	}, nil
+}
+
+// Fetch queries the Consul API defined by the given client and returns the
+// autopilot health of the servers.
+func (d *AutopilotHealthQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	opts = opts.Merge(&QueryOptions{})
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/operator/autopilot/health",
+		RawQuery: opts.String(),
+	})
+
+	// The autopilot health endpoint does not support blocking queries, so
+	// sleep between queries after the first one.
+	if opts.WaitIndex != 0 {
+		log.Printf("[TRACE] %s: long polling for %s", d, AutopilotHealthQuerySleepTime)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(AutopilotHealthQuerySleepTime):
+		}
+	}
+
+	reply, err := clients.Consul().Operator().AutopilotServerHealth(opts.ToConsulOpts())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", d, err)
+	}
+
+	log.Printf("[TRACE] %s: returned %d servers", d, len(reply.Servers))
+
+	health := &AutopilotHealth{
+		Healthy:          reply.Healthy,
+		FailureTolerance: reply.FailureTolerance,
+		Servers:          make([]*AutopilotServerHealth, 0, len(reply.Servers)),
+	}
+	for _, s := range reply.Servers {
+		health.Servers = append(health.Servers, &AutopilotServerHealth{
+			ID:         s.ID,
+			Name:       s.Name,
+			Address:    s.Address,
+			SerfStatus: s.SerfStatus,
+			Version:    s.Version,
+			Leader:     s.Leader,
+			Voter:      s.Voter,
+			Healthy:    s.Healthy,
+		})
+	}
+	sort.Slice(health.Servers, func(i, j int) bool {
+		return health.Servers[i].Name < health.Servers[j].Name
+	})
+
+	// Use respWithMetadata which always increments LastIndex and results
+	// in fetching new data for endpoints that don't support blocking queries
+	return respWithMetadata(health)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *AutopilotHealthQuery) CanShare() bool {
+	return true
+}
+
+// Stop halts the dependency's fetch function.
+func (d *AutopilotHealthQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *AutopilotHealthQuery) String() string {
+	return "autopilot.health"
+}
+
+// Type returns the type of this dependency.
+func (d *AutopilotHealthQuery) Type() Type {
+	return TypeConsul
+}
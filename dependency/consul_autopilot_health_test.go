@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	AutopilotHealthQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestAutopilotHealthQuery_Fetch(t *testing.T) {
+	d, err := NewAutopilotHealthQuery()
+	require.NoError(t, err)
+
+	// Autopilot needs a moment after the leader election to report healthy
+	var health *AutopilotHealth
+	for i := 0; i < 20; i++ {
+		act, _, err := d.Fetch(testClients, nil)
+		require.NoError(t, err)
+		health = act.(*AutopilotHealth)
+		if health.Healthy {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+
+	assert.True(t, health.Healthy)
+	require.NotEmpty(t, health.Servers)
+	for _, s := range health.Servers {
+		assert.NotEmpty(t, s.ID)
+		assert.NotEmpty(t, s.Name)
+		assert.NotEmpty(t, s.Address)
+		assert.True(t, s.Healthy)
+	}
+	assert.True(t, health.Servers[0].Leader)
+}
+
+func TestAutopilotHealthQuery_String(t *testing.T) {
+	d, err := NewAutopilotHealthQuery()
+	require.NoError(t, err)
+	assert.Equal(t, "autopilot.health", d.String())
+}
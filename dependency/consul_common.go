@@ -0,0 +1,69 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+)
+
+// parseNodeCIDR parses the node-cidr query parameter, which restricts results
+// to nodes with an address in the given network. It returns the zero prefix
+// when the parameter is not given.
+func parseNodeCIDR(queryParams url.Values) (netip.Prefix, error) {
+	if !queryParams.Has(QueryNodeCIDR) {
+		return netip.Prefix{}, nil
+	}
+	v := queryParams.Get(QueryNodeCIDR)
+	prefix, err := netip.ParsePrefix(v)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid %s value: %q: %w", QueryNodeCIDR, v, err)
+	}
+	return prefix.Masked(), nil
+}
+
+// nodeInCIDR returns whether the node address is within the prefix. Every
+// address is accepted when no prefix is given, while addresses which are not
+// IPs, such as host names, are never within one.
+func nodeInCIDR(prefix netip.Prefix, address string) bool {
+	if !prefix.IsValid() {
+		return true
+	}
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(addr.Unmap())
+}
+
+// parseStale parses the stale query parameter, which allows any server to
+// answer the query rather than only the leader.
+func parseStale(queryParams url.Values) (bool, error) {
+	return parseFlag(queryParams, QueryStale)
+}
+
+// parseDebug parses the debug query parameter, which logs the fetches and
+// changes of the dependency at INFO rather than TRACE.
+func parseDebug(queryParams url.Values) (bool, error) {
+	return parseFlag(queryParams, QueryDebug)
+}
+
+// parseFlag parses a boolean query parameter. The parameter may be given
+// without a value to enable it.
+func parseFlag(queryParams url.Values, key string) (bool, error) {
+	if !queryParams.Has(key) {
+		return false, nil
+	}
+	v := queryParams.Get(key)
+	if v == "" {
+		return true, nil
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value: %q", key, v)
+	}
+	return enabled, nil
+}
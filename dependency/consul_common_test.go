@@ -3,6 +3,17 @@
 
 package dependency
 
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 // filter is used as a helper for filtering values out of maps.
 func filter(data map[string]string, remove []string) map[string]string {
 	if data == nil {
@@ -33,3 +44,142 @@ func filterAddresses(addrs map[string]string) map[string]string {
 	ipvKeys := []string{"lan_ipv4", "wan_ipv4", "lan_ipv6", "wan_ipv6", "lan", "wan"}
 	return filter(addrs, ipvKeys)
 }
+
+func TestNodeInCIDR(t *testing.T) {
+	v4 := netip.MustParsePrefix("10.0.0.0/8")
+	v6 := netip.MustParsePrefix("2001:db8::/32")
+
+	cases := []struct {
+		name    string
+		prefix  netip.Prefix
+		address string
+		exp     bool
+	}{
+		{"no_prefix", netip.Prefix{}, "192.0.2.1", true},
+		{"no_prefix_hostname", netip.Prefix{}, "node.example.com", true},
+		{"ipv4_in", v4, "10.1.2.3", true},
+		{"ipv4_out", v4, "11.1.2.3", false},
+		{"ipv4_mapped", v4, "::ffff:10.1.2.3", true},
+		{"ipv6_in", v6, "2001:db8::1", true},
+		{"ipv6_out", v6, "2001:db9::1", false},
+		{"ipv4_in_ipv6", v6, "10.1.2.3", false},
+		{"ipv6_in_ipv4", v4, "2001:db8::1", false},
+		{"hostname", v4, "node.example.com", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if act := nodeInCIDR(tc.prefix, tc.address); act != tc.exp {
+				t.Errorf("expected %t, got %t", tc.exp, act)
+			}
+		})
+	}
+}
+
+func TestStaleQueries(t *testing.T) {
+	// A fake Consul records whether each request allowed stale reads.
+	var mu sync.Mutex
+	stale := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		stale[r.URL.Path] = r.URL.Query().Has("stale")
+		mu.Unlock()
+
+		w.Header().Set("X-Consul-Index", "1")
+		if r.URL.Path == "/v1/kv/key" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	clients := NewClientSet()
+	require.NoError(t, clients.CreateConsulClient(&CreateConsulClientInput{
+		Address: srv.URL,
+	}))
+
+	newKVGet := func(s string) (Dependency, error) { return NewKVGetQuery(s) }
+	newKVList := func(s string) (Dependency, error) { return NewKVListQuery(s) }
+	newCatalogService := func(s string) (Dependency, error) { return NewCatalogServiceQuery(s) }
+	newHealthService := func(s string) (Dependency, error) { return NewHealthServiceQuery(s) }
+
+	cases := []struct {
+		name string
+		new  func(string) (Dependency, error)
+		i    string
+		path string
+		exp  bool
+	}{
+		{"kv_get", newKVGet, "key", "/v1/kv/key", false},
+		{"kv_get_stale", newKVGet, "key?stale", "/v1/kv/key", true},
+		{"kv_list", newKVList, "prefix", "/v1/kv/prefix", false},
+		{"kv_list_stale", newKVList, "prefix?stale", "/v1/kv/prefix", true},
+		{"catalog_service", newCatalogService, "web", "/v1/catalog/service/web", false},
+		{"catalog_service_stale", newCatalogService, "web?stale", "/v1/catalog/service/web", true},
+		{"health_service", newHealthService, "web", "/v1/health/service/web", false},
+		{"health_service_stale", newHealthService, "web?stale", "/v1/health/service/web", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := tc.new(tc.i)
+			require.NoError(t, err)
+			defer d.Stop()
+
+			_, _, err = d.Fetch(clients, nil)
+			require.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			act, ok := stale[tc.path]
+			require.True(t, ok, "no request to %s", tc.path)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestDebugQueries(t *testing.T) {
+	newKVGet := func(s string) (Dependency, error) { return NewKVGetQuery(s) }
+	newKVList := func(s string) (Dependency, error) { return NewKVListQuery(s) }
+	newCatalogService := func(s string) (Dependency, error) { return NewCatalogServiceQuery(s) }
+	newHealthService := func(s string) (Dependency, error) { return NewHealthServiceQuery(s) }
+
+	cases := []struct {
+		name string
+		new  func(string) (Dependency, error)
+		i    string
+		str  string
+		exp  bool
+	}{
+		{"kv_get", newKVGet, "key", "kv.get(key)", false},
+		{"kv_get_debug", newKVGet, "key?debug", "kv.get(key@debug)", true},
+		{"kv_list", newKVList, "prefix", "kv.list(prefix)", false},
+		{"kv_list_debug", newKVList, "prefix?debug", "kv.list(prefix@debug)", true},
+		{"catalog_service", newCatalogService, "web", "catalog.service(web)", false},
+		{"catalog_service_debug", newCatalogService, "web?debug", "catalog.service(web@debug)", true},
+		{"health_service", newHealthService, "web", "health.service(web|passing)", false},
+		{"health_service_debug", newHealthService, "web?debug", "health.service(web@debug|passing)", true},
+		{"health_service_debug_stale", newHealthService, "web?stale&debug", "health.service(web@stale@debug|passing)", true},
+		{"debug_false", newKVGet, "key?debug=false", "kv.get(key)", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := tc.new(tc.i)
+			require.NoError(t, err)
+			defer d.Stop()
+
+			assert.Equal(t, tc.str, d.String())
+			debugger, ok := d.(Debugger)
+			require.True(t, ok)
+			assert.Equal(t, tc.exp, debugger.Debug())
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewKVGetQuery("key?debug=maybe")
+		assert.Error(t, err)
+	})
+}
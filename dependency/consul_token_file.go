@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errEmptyConsulTokenFile is the error returned when the Consul token file is
+// empty, for example while it is being rewritten.
+var errEmptyConsulTokenFile = errors.New("token file is empty")
+
+// consulTokenFileSleepTime is the amount of time to sleep between checks of the
+// Consul token file for changes.
+var consulTokenFileSleepTime = DefaultNonBlockingQuerySleepTime
+
+// consulTokenTransport sets the token of each request to the Consul token read
+// last from a token file, so the token can be rotated without recreating the
+// client. Requests already in flight, like blocking queries, keep the token
+// they were sent with.
+type consulTokenTransport struct {
+	base  http.RoundTripper
+	token atomic.Value // string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *consulTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if token, _ := t.token.Load().(string); token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Consul-Token", token)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// readConsulTokenFile returns the token in the given file. An empty file is an
+// error, so it does not replace a working token.
+func readConsulTokenFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", errEmptyConsulTokenFile
+	}
+	return token, nil
+}
+
+// watchConsulTokenFile polls the given token file every interval until stopCh
+// is closed, swapping the token of the transport whenever the file changes. A
+// file which cannot be read or is empty is logged, and the previous token kept.
+func watchConsulTokenFile(path string, t *consulTokenTransport, interval time.Duration,
+	stopCh <-chan struct{},
+) {
+	lastStat, _ := os.Stat(path)
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			log.Printf("[WARN] (clients) consul token file %s: %s", path, err)
+			continue
+		}
+
+		changed := lastStat == nil ||
+			lastStat.Size() != stat.Size() ||
+			lastStat.ModTime() != stat.ModTime()
+		if !changed {
+			continue
+		}
+		lastStat = stat
+
+		token, err := readConsulTokenFile(path)
+		if err != nil {
+			log.Printf("[WARN] (clients) consul token file %s: %s, keeping "+
+				"the current token", path, err)
+			continue
+		}
+
+		if token != t.token.Load() {
+			log.Printf("[INFO] (clients) reloaded the consul token from %s", path)
+			t.token.Store(token)
+		}
+	}
+}
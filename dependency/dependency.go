@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	consulapi "github.com/hashicorp/consul/api"
@@ -17,10 +19,11 @@ import (
 
 const (
 	dcRe           = `(@(?P<dc>[[:word:]\.\-\_]+))?`
+	dcListRe       = `(@(?P<dc>[[:word:]\.\-\_]+(,[[:word:]\.\-\_]+)*))?`
 	keyRe          = `/?(?P<key>[^@\?]+)`
 	filterRe       = `(\|(?P<filter>[[:word:]\,]+))?`
 	serviceNameRe  = `(?P<name>[[:word:]\-\_]+)`
-	queryRe        = `(\?(?P<query>[[:word:]\-\_\=\&]+))?`
+	queryRe        = `(\?(?P<query>[[:word:]\-\_\=\&:\./\*]+))?`
 	nodeNameRe     = `(?P<name>[[:word:]\.\-\_]+)`
 	nearRe         = `(~(?P<near>[[:word:]\.\-\_]+))?`
 	prefixRe       = `/?(?P<prefix>[^@\?]+)`
@@ -63,6 +66,13 @@ type Dependency interface {
 	Type() Type
 }
 
+// Debugger is implemented by dependencies which may be tagged with the debug
+// query parameter, so their fetches and changes are logged verbosely without
+// lowering the log level for every other dependency.
+type Debugger interface {
+	Debug() bool
+}
+
 // ServiceTags is a slice of tags assigned to a Service
 type ServiceTags []string
 
@@ -83,6 +93,7 @@ type QueryOptions struct {
 	ConsulPartition     string
 	ConsulNamespace     string
 	ConsulSamenessGroup string
+	NomadNamespace      string
 }
 
 func (q *QueryOptions) Merge(o *QueryOptions) *QueryOptions {
@@ -150,6 +161,10 @@ func (q *QueryOptions) Merge(o *QueryOptions) *QueryOptions {
 		r.ConsulSamenessGroup = o.ConsulSamenessGroup
 	}
 
+	if o.NomadNamespace != "" {
+		r.NomadNamespace = o.NomadNamespace
+	}
+
 	return &r
 }
 
@@ -169,8 +184,9 @@ func (q *QueryOptions) ToConsulOpts() *consulapi.QueryOptions {
 }
 
 // GetConsulQueryOpts parses optional consul query params into key pairs.
-// supports namespace, peer and partition params
-func GetConsulQueryOpts(queryMap map[string]string, endpointLabel string) (url.Values, error) {
+// supports namespace, peer and partition params, along with any extra keys
+// supported by the particular endpoint.
+func GetConsulQueryOpts(queryMap map[string]string, endpointLabel string, extraKeys ...string) (url.Values, error) {
 	queryParams := url.Values{}
 
 	if queryRaw := queryMap["query"]; queryRaw != "" {
@@ -181,15 +197,11 @@ func GetConsulQueryOpts(queryMap map[string]string, endpointLabel string) (url.V
 				"%s: invalid query: %q: %s", endpointLabel, queryRaw, err)
 		}
 		// Validate keys.
+		supported := append([]string{QueryNamespace, QueryPeer, QueryPartition, QuerySamenessGroup}, extraKeys...)
 		for key := range queryParams {
-			switch key {
-			case QueryNamespace,
-				QueryPeer,
-				QueryPartition,
-				QuerySamenessGroup:
-			default:
+			if !slices.Contains(supported, key) {
 				return nil,
-					fmt.Errorf("%s: invalid query parameter key %q in query %q: supported keys: %s,%s,%s,%s", endpointLabel, key, queryRaw, QueryNamespace, QueryPeer, QueryPartition, QuerySamenessGroup)
+					fmt.Errorf("%s: invalid query parameter key %q in query %q: supported keys: %s", endpointLabel, key, queryRaw, strings.Join(supported, ","))
 			}
 		}
 	}
@@ -207,6 +219,7 @@ func (q *QueryOptions) ToNomadOpts() *nomadapi.QueryOptions {
 	return &nomadapi.QueryOptions{
 		AllowStale: q.AllowStale,
 		Region:     q.Region,
+		Namespace:  q.NomadNamespace,
 		Params:     params,
 		WaitIndex:  q.WaitIndex,
 		WaitTime:   q.WaitTime,
@@ -236,6 +249,10 @@ func (q *QueryOptions) String() string {
 		u.Add(QueryPeer, q.ConsulPeer)
 	}
 
+	if q.NomadNamespace != "" {
+		u.Add("namespace", q.NomadNamespace)
+	}
+
 	if q.ConsulPartition != "" {
 		u.Add(QueryPartition, q.ConsulPartition)
 	}
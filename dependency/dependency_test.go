@@ -434,8 +434,10 @@ func runTestVault() {
 	if err != nil || path == "" {
 		Fatalf("vault not found on $PATH")
 	}
+	// -dev-ha uses HA capable in-memory storage so the server reports itself
+	// as the active node on sys/leader.
 	args := []string{
-		"server", "-dev", "-dev-root-token-id", vaultToken,
+		"server", "-dev", "-dev-ha", "-dev-root-token-id", vaultToken,
 		"-dev-no-store-token",
 	}
 	cmd := exec.Command("vault", args...)
@@ -496,9 +498,20 @@ func TestCanShare(t *testing.T) {
 	deps := []Dependency{
 		&CatalogNodeQuery{},
 		&FileQuery{},
+		&VaultAllVersionsQuery{},
+		&VaultAuditDevicesQuery{},
+		&VaultEntityAliasQuery{},
+		&VaultHostInfoQuery{},
+		&VaultKeyStatusQuery{},
+		&VaultLeaderQuery{},
 		&VaultListQuery{},
+		&VaultMetadataWatchQuery{},
+		&VaultReadMultiQuery{},
 		&VaultReadQuery{},
+		&VaultRequestQuery{},
+		&VaultStaticRoleQuery{},
 		&VaultTokenQuery{},
+		&VaultTransitQuery{},
 		&VaultWriteQuery{},
 	}
 
@@ -4,7 +4,9 @@
 package dependency
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
@@ -26,8 +28,9 @@ var (
 type FileQuery struct {
 	stopCh chan struct{}
 
-	path string
-	stat os.FileInfo
+	path  string
+	lines bool
+	stat  os.FileInfo
 }
 
 // NewFileQuery creates a file dependency from the given path.
@@ -43,6 +46,17 @@ func NewFileQuery(s string) (*FileQuery, error) {
 	}, nil
 }
 
+// NewFileLinesQuery creates a file dependency from the given path which
+// returns the contents of the file as a slice of lines.
+func NewFileLinesQuery(s string) (*FileQuery, error) {
+	d, err := NewFileQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	d.lines = true
+	return d, nil
+}
+
 // Fetch retrieves this dependency and returns the result or any errors that
 // occur in the process.
 func (d *FileQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
@@ -59,6 +73,16 @@ func (d *FileQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{},
 
 		log.Printf("[TRACE] %s: reported change", d)
 
+		if d.lines {
+			lines, err := readLines(d.path)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, d.String())
+			}
+
+			d.stat = r.stat
+			return respWithMetadata(lines)
+		}
+
 		data, err := os.ReadFile(d.path)
 		if err != nil {
 			return "", nil, errors.Wrap(err, d.String())
@@ -81,6 +105,9 @@ func (d *FileQuery) Stop() {
 
 // String returns the human-friendly version of this dependency.
 func (d *FileQuery) String() string {
+	if d.lines {
+		return fmt.Sprintf("file.lines(%s)", d.path)
+	}
 	return fmt.Sprintf("file(%s)", d.path)
 }
 
@@ -89,6 +116,36 @@ func (d *FileQuery) Type() Type {
 	return TypeLocal
 }
 
+// readLines reads the file at the given path line by line, without loading
+// the whole file at once. Both LF and CRLF line endings are supported and a
+// trailing newline does not produce an empty last line.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		lines = append(lines, line)
+		if err == io.EOF {
+			break
+		}
+	}
+	return lines, nil
+}
+
 type watchResult struct {
 	stat os.FileInfo
 	err  error
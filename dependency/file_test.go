@@ -194,6 +194,71 @@ func TestFileQuery_Fetch(t *testing.T) {
 	})
 }
 
+func TestFileLinesQuery_Fetch(t *testing.T) {
+	cases := []struct {
+		name     string
+		contents string
+		exp      []string
+	}{
+		{
+			"lf",
+			"a\nb\n\nc",
+			[]string{"a", "b", "", "c"},
+		},
+		{
+			"crlf",
+			"a\r\nb\r\nc",
+			[]string{"a", "b", "c"},
+		},
+		{
+			"trailing_newline",
+			"a\nb\n",
+			[]string{"a", "b"},
+		},
+		{
+			"empty",
+			"",
+			[]string{},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			f, err := os.CreateTemp("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			if _, err := f.WriteString(tc.contents); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := NewFileLinesQuery(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			act, _, err := d.Fetch(nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+
+	t.Run("non_existent", func(t *testing.T) {
+		d, err := NewFileLinesQuery("/not/a/real/path/ever")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := d.Fetch(nil, nil); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
 func TestFileQuery_String(t *testing.T) {
 	cases := []struct {
 		name string
@@ -217,3 +282,11 @@ func TestFileQuery_String(t *testing.T) {
 		})
 	}
 }
+
+func TestFileLinesQuery_String(t *testing.T) {
+	d, err := NewFileLinesQuery("path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "file.lines(path)", d.String())
+}
@@ -0,0 +1,156 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*HealthPreparedQuery)(nil)
+
+	// HealthPreparedQueryRe is the regular expression to use.
+	HealthPreparedQueryRe = regexp.MustCompile(`\A` + serviceNameRe + dcRe + nearRe + `\z`)
+
+	// HealthPreparedQuerySleepTime is the amount of time to sleep between
+	// queries, since executing a prepared query does not support blocking
+	// queries.
+	HealthPreparedQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+// HealthPreparedQuery is the dependency to Consul for the services returned by
+// executing a prepared query.
+type HealthPreparedQuery struct {
+	stopCh chan struct{}
+
+	// name is the name or ID of the prepared query.
+	name string
+	dc   string
+	near string
+}
+
+// NewHealthPreparedQuery parses a string of the form "<name>@<dc>~<near>",
+// where name is the name or ID of a prepared query, into a dependency.
+func NewHealthPreparedQuery(s string) (*HealthPreparedQuery, error) {
+	if !HealthPreparedQueryRe.MatchString(s) {
+		return nil, fmt.Errorf("health.service.query: invalid format: %q", s)
+	}
+
+	m := regexpMatch(HealthPreparedQueryRe, s)
+	return &HealthPreparedQuery{
+		stopCh: make(chan struct{}, 1),
+		name:   m["name"],
+		dc:     m["dc"],
+		near:   m["near"],
+	}, nil
+}
+
+// Fetch executes the prepared query and returns a slice of HealthService
+// objects.
+func (d *HealthPreparedQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{
+		Datacenter: d.dc,
+		Near:       d.near,
+	})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		log.Printf("[TRACE] %s: long polling for %s", d, HealthPreparedQuerySleepTime)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(HealthPreparedQuerySleepTime):
+		}
+	}
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/query/" + d.name + "/execute",
+		RawQuery: opts.String(),
+	})
+
+	// The index of a prepared query response does not change with its
+	// results, so it must not be used to block.
+	consulOpts := opts.ToConsulOpts()
+	consulOpts.WaitIndex = 0
+	resp, _, err := clients.Consul().PreparedQuery().Execute(d.name, consulOpts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	log.Printf("[TRACE] %s: returned %d results from %s after %d failovers",
+		d, len(resp.Nodes), resp.Datacenter, resp.Failovers)
+
+	list := make([]*HealthService, 0, len(resp.Nodes))
+	for _, entry := range resp.Nodes {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+
+		list = append(list, &HealthService{
+			Node:                   entry.Node.Node,
+			NodeID:                 entry.Node.ID,
+			NodeAddress:            entry.Node.Address,
+			NodeTaggedAddresses:    entry.Node.TaggedAddresses,
+			NodeMeta:               entry.Node.Meta,
+			ServiceMeta:            entry.Service.Meta,
+			Address:                address,
+			ServiceTaggedAddresses: entry.Service.TaggedAddresses,
+			ID:                     entry.Service.ID,
+			Name:                   entry.Service.Service,
+			Tags: ServiceTags(
+				deepCopyAndSortTags(entry.Service.Tags)),
+			Status:        entry.Checks.AggregatedStatus(),
+			Checks:        entry.Checks,
+			Port:          entry.Service.Port,
+			Weights:       entry.Service.Weights,
+			ConnectNative: entry.Service.Connect != nil && entry.Service.Connect.Native,
+		})
+	}
+
+	// The order of the results is kept, as the prepared query may sort them
+	// by round trip time itself.
+	return respWithMetadata(list)
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *HealthPreparedQuery) CanShare() bool {
+	return true
+}
+
+// Stop halts the dependency's fetch function.
+func (d *HealthPreparedQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *HealthPreparedQuery) String() string {
+	name := d.name
+	if d.dc != "" {
+		name = name + "@" + d.dc
+	}
+	if d.near != "" {
+		name = name + "~" + d.near
+	}
+	return fmt.Sprintf("health.service.query(%s)", name)
+}
+
+// Type returns the type of this dependency.
+func (d *HealthPreparedQuery) Type() Type {
+	return TypeConsul
+}
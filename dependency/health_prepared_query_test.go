@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	HealthPreparedQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestNewHealthPreparedQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  *HealthPreparedQuery
+		err  bool
+	}{
+		{"empty", "", nil, true},
+		{"dc_only", "@dc1", nil, true},
+		{"tag", "tag.name", nil, true},
+		{"name", "web-failover", &HealthPreparedQuery{name: "web-failover"}, false},
+		{
+			"id",
+			"8f246b77-f3e1-ff88-5b48-8ec93abf3e05",
+			&HealthPreparedQuery{name: "8f246b77-f3e1-ff88-5b48-8ec93abf3e05"},
+			false,
+		},
+		{"name_dc", "name@dc1", &HealthPreparedQuery{name: "name", dc: "dc1"}, false},
+		{
+			"name_dc_near",
+			"name@dc1~_agent",
+			&HealthPreparedQuery{name: "name", dc: "dc1", near: "_agent"},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewHealthPreparedQuery(tc.i)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if act != nil {
+				act.stopCh = nil
+			}
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestHealthPreparedQuery_Fetch(t *testing.T) {
+	id, _, err := testClients.Consul().PreparedQuery().Create(&api.PreparedQueryDefinition{
+		Name: "consul-query",
+		Service: api.ServiceQuery{
+			Service:     "consul",
+			OnlyPassing: true,
+		},
+	}, nil)
+	require.NoError(t, err)
+	defer testClients.Consul().PreparedQuery().Delete(id, nil)
+
+	exp := []*HealthService{
+		{
+			Node:                testConsul.Config.NodeName,
+			NodeAddress:         testConsul.Config.Bind,
+			NodeTaggedAddresses: map[string]string{},
+			NodeMeta:            map[string]string{},
+			ServiceMeta:         map[string]string{},
+			Address:             testConsul.Config.Bind,
+			ID:                  "consul",
+			Name:                "consul",
+			Tags:                []string{},
+			Status:              "passing",
+			Port:                testConsul.Config.Ports.Server,
+			Weights: api.AgentWeights{
+				Passing: 1,
+				Warning: 1,
+			},
+		},
+	}
+
+	for _, name := range []string{"consul-query", id} {
+		t.Run(name, func(t *testing.T) {
+			d, err := NewHealthPreparedQuery(name)
+			require.NoError(t, err)
+			defer d.Stop()
+
+			act, _, err := d.Fetch(testClients, nil)
+			require.NoError(t, err)
+
+			list := act.([]*HealthService)
+			for _, v := range list {
+				v.NodeID = ""
+				v.Checks = nil
+				v.NodeTaggedAddresses = filterAddresses(v.NodeTaggedAddresses)
+				v.NodeMeta = filterVersionMeta(v.NodeMeta)
+				v.ServiceMeta = filterVersionMeta(v.ServiceMeta)
+			}
+			assert.Equal(t, exp, list)
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		d, err := NewHealthPreparedQuery("missing-query")
+		require.NoError(t, err)
+		defer d.Stop()
+
+		_, _, err = d.Fetch(testClients, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		d, err := NewHealthPreparedQuery("consul-query")
+		require.NoError(t, err)
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: 1})
+			errCh <- err
+		}()
+
+		d.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestHealthPreparedQuery_String(t *testing.T) {
+	d, err := NewHealthPreparedQuery("name@dc1~_agent")
+	require.NoError(t, err)
+	assert.Equal(t, "health.service.query(name@dc1~_agent)", d.String())
+}
@@ -7,9 +7,12 @@ import (
 	"encoding/gob"
 	"fmt"
 	"log"
+	"net/netip"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/consul/api"
@@ -24,9 +27,22 @@ const (
 	HealthMaint    = "maintenance"
 
 	QueryNamespace     = "ns"
+	QueryDatacenter    = "dc"
 	QueryPartition     = "partition"
 	QueryPeer          = "peer"
 	QuerySamenessGroup = "sameness-group"
+	QueryConnect       = "connect"
+	QueryMinInstances  = "min_instances"
+	QueryAddress       = "address"
+	QueryNodeMeta      = "node-meta"
+	QueryNodeCIDR      = "node-cidr"
+	QueryStale         = "stale"
+	QueryDebug         = "debug"
+	QueryDepth         = "depth"
+
+	// WildcardNamespace is the namespace which queries services across every
+	// namespace of the partition.
+	WildcardNamespace = "*"
 
 	NodeMaint    = "_node_maintenance"
 	ServiceMaint = "_service_maintenance:"
@@ -37,7 +53,7 @@ var (
 	_ Dependency = (*HealthServiceQuery)(nil)
 
 	// HealthServiceQueryRe is the regular expression to use.
-	HealthServiceQueryRe = regexp.MustCompile(`\A` + tagRe + serviceNameRe + queryRe + dcRe + nearRe + filterRe + `\z`)
+	HealthServiceQueryRe = regexp.MustCompile(`\A` + tagRe + serviceNameRe + queryRe + dcListRe + nearRe + filterRe + `\z`)
 )
 
 func init() {
@@ -61,6 +77,15 @@ type HealthService struct {
 	Status                 string
 	Port                   int
 	Weights                api.AgentWeights
+	ConnectNative          bool
+
+	// Datacenter is the datacenter the service was found in. It is only set
+	// by queries with failover datacenters.
+	Datacenter string
+
+	// Namespace is the namespace the service was found in. It is only set by
+	// queries across every namespace, with the ns=* query parameter.
+	Namespace string
 }
 
 // HealthServiceQuery is the representation of all a service query in Consul.
@@ -77,6 +102,38 @@ type HealthServiceQuery struct {
 	peer          string
 	namespace     string
 	samenessGroup string
+	connectNative bool
+	minInstances  int
+
+	// address is the tagged address, e.g. "wan", whose address and port are
+	// used as the Address and Port of each service, when it has one.
+	address string
+
+	// nodeCIDR restricts the results to services on nodes with an address in
+	// the network, when it is valid.
+	nodeCIDR netip.Prefix
+
+	// stale allows any server to answer the query, rather than only the
+	// leader.
+	stale bool
+
+	// debug logs the fetches and changes of this dependency at INFO rather
+	// than TRACE.
+	debug bool
+
+	// lastGood is the last result which met minInstances. It is returned in
+	// place of results which do not.
+	lastGood []*HealthService
+
+	// failover is the list of datacenters tried in order when dc has no
+	// services. active is the position in the chain of the datacenter which
+	// produced the current result, and activeIndex its index, which is
+	// blocked on. failoverIndex is the index returned, since the indexes of
+	// datacenters are unrelated.
+	failover      []string
+	active        int
+	activeIndex   uint64
+	failoverIndex uint64
 }
 
 // NewHealthServiceQuery processes the strings to build a service dependency.
@@ -96,41 +153,64 @@ func healthServiceQuery(s string, connect bool) (*HealthServiceQuery, error) {
 
 	m := regexpMatch(HealthServiceQueryRe, s)
 
-	var filters []string
-	if filter := m["filter"]; filter != "" {
-		split := strings.Split(filter, ",")
-		for _, f := range split {
-			f = strings.TrimSpace(f)
-			switch f {
-			case HealthAny,
-				HealthPassing,
-				HealthWarning,
-				HealthCritical,
-				HealthMaint:
-				filters = append(filters, f)
-			case "":
-			default:
-				return nil, fmt.Errorf(
-					"health.service: invalid filter: %q in %q", f, s)
-			}
-		}
-		sort.Strings(filters)
-	} else {
-		filters = []string{HealthPassing}
+	filters, err := parseHealthFilters(m["filter"])
+	if err != nil {
+		return nil, fmt.Errorf("health.service: %s in %q", err, s)
 	}
 
-	queryParams, err := GetConsulQueryOpts(m, "health.service")
+	queryParams, err := GetConsulQueryOpts(m, "health.service", QueryConnect, QueryMinInstances, QueryAddress, QueryNodeCIDR, QueryStale, QueryDebug)
 	if err != nil {
 		return nil, err
 	}
 
+	stale, err := parseStale(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("health.service: %s", err)
+	}
+
+	debug, err := parseDebug(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("health.service: %s", err)
+	}
+
+	nodeCIDR, err := parseNodeCIDR(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("health.service: %s", err)
+	}
+
+	var connectNative bool
+	if v := queryParams.Get(QueryConnect); v != "" {
+		connectNative, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("health.service: invalid %s value: %q", QueryConnect, v)
+		}
+	}
+
+	var minInstances int
+	if v := queryParams.Get(QueryMinInstances); v != "" {
+		minInstances, err = strconv.Atoi(v)
+		if err != nil || minInstances < 1 {
+			return nil, fmt.Errorf("health.service: invalid %s value: %q", QueryMinInstances, v)
+		}
+	}
+
+	if queryParams.Has(QueryAddress) && queryParams.Get(QueryAddress) == "" {
+		return nil, fmt.Errorf("health.service: empty %s value", QueryAddress)
+	}
+
 	if queryParams.Get(QuerySamenessGroup) != "" && queryParams.Get(QueryPeer) != "" {
 		return nil, fmt.Errorf("health.service: cannot specify both %s and %s", QueryPeer, QuerySamenessGroup)
 	}
 
+	// The first datacenter is queried, and any others are failed over to.
+	dcs := strings.Split(m["dc"], ",")
+	if len(dcs) > 1 && minInstances > 0 {
+		return nil, fmt.Errorf("health.service: cannot specify both %s and failover datacenters", QueryMinInstances)
+	}
+
 	qry := &HealthServiceQuery{
 		stopCh:        make(chan struct{}, 1),
-		dc:            m["dc"],
+		dc:            dcs[0],
 		filters:       filters,
 		name:          m["name"],
 		near:          m["near"],
@@ -140,6 +220,15 @@ func healthServiceQuery(s string, connect bool) (*HealthServiceQuery, error) {
 		peer:          queryParams.Get(QueryPeer),
 		partition:     queryParams.Get(QueryPartition),
 		samenessGroup: queryParams.Get(QuerySamenessGroup),
+		connectNative: connectNative,
+		minInstances:  minInstances,
+		address:       queryParams.Get(QueryAddress),
+		nodeCIDR:      nodeCIDR,
+		stale:         stale,
+		debug:         debug,
+	}
+	if len(dcs) > 1 {
+		qry.failover = dcs[1:]
 	}
 
 	return qry, nil
@@ -161,8 +250,61 @@ func (d *HealthServiceQuery) Fetch(clients *ClientSet, opts *QueryOptions) (inte
 		ConsulPartition:     d.partition,
 		ConsulPeer:          d.peer,
 		ConsulSamenessGroup: d.samenessGroup,
+		AllowStale:          d.stale,
 	})
 
+	if len(d.failover) > 0 {
+		return d.fetchFailover(clients, opts)
+	}
+
+	// Hold on to the last result with enough passing instances, so a pool
+	// which drops below the minimum is not rendered. While there is nothing to
+	// fall back to yet, wait for the next change before returning anything.
+	var list []*HealthService
+	var qm *api.QueryMeta
+	for {
+		var err error
+		list, qm, err = d.fetch(clients, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if d.minInstances == 0 {
+			break
+		}
+
+		passing := countPassing(list)
+		if passing >= d.minInstances {
+			d.lastGood = list
+			break
+		}
+		if d.lastGood != nil {
+			log.Printf("[WARN] %s: %d of %d required instances passing, "+
+				"withholding change", d, passing, d.minInstances)
+			list = d.lastGood
+			break
+		}
+		log.Printf("[WARN] %s: %d of %d required instances passing, "+
+			"waiting for more", d, passing, d.minInstances)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		default:
+		}
+		opts = opts.Merge(&QueryOptions{WaitIndex: qm.LastIndex})
+	}
+
+	rm := &ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	return list, rm, nil
+}
+
+// fetch queries the services with the given options, which select the
+// datacenter, and filters them.
+func (d *HealthServiceQuery) fetch(clients *ClientSet, opts *QueryOptions) ([]*HealthService, *api.QueryMeta, error) {
 	u := &url.URL{
 		Path:     "/v1/health/service/" + d.name,
 		RawQuery: opts.String(),
@@ -201,12 +343,44 @@ func (d *HealthServiceQuery) Fetch(clients *ClientSet, opts *QueryOptions) (inte
 			continue
 		}
 
+		// If a node CIDR was given, filter out services on nodes outside of
+		// it.
+		if !nodeInCIDR(d.nodeCIDR, entry.Node.Address) {
+			continue
+		}
+
+		// If only connect-native services were asked for, filter out the
+		// others.
+		connectNative := entry.Service.Connect != nil && entry.Service.Connect.Native
+		if d.connectNative && !connectNative {
+			continue
+		}
+
 		// Get the address of the service, falling back to the address of the
 		// node.
 		address := entry.Service.Address
 		if address == "" {
 			address = entry.Node.Address
 		}
+		port := entry.Service.Port
+
+		// Prefer the requested tagged address of the service, then that of
+		// its node, which has no port of its own.
+		if d.address != "" {
+			if ta, ok := entry.Service.TaggedAddresses[d.address]; ok && ta.Address != "" {
+				address = ta.Address
+				if ta.Port != 0 {
+					port = ta.Port
+				}
+			} else if ta, ok := entry.Node.TaggedAddresses[d.address]; ok && ta != "" {
+				address = ta
+			}
+		}
+
+		var namespace string
+		if d.namespace == WildcardNamespace {
+			namespace = entry.Service.Namespace
+		}
 
 		list = append(list, &HealthService{
 			Node:                   entry.Node.Node,
@@ -221,10 +395,12 @@ func (d *HealthServiceQuery) Fetch(clients *ClientSet, opts *QueryOptions) (inte
 			Name:                   entry.Service.Service,
 			Tags: ServiceTags(
 				deepCopyAndSortTags(entry.Service.Tags)),
-			Status:  status,
-			Checks:  entry.Checks,
-			Port:    entry.Service.Port,
-			Weights: entry.Service.Weights,
+			Status:        status,
+			Checks:        entry.Checks,
+			Port:          port,
+			Weights:       entry.Service.Weights,
+			ConnectNative: connectNative,
+			Namespace:     namespace,
 		})
 	}
 
@@ -235,12 +411,69 @@ func (d *HealthServiceQuery) Fetch(clients *ClientSet, opts *QueryOptions) (inte
 		sort.Stable(ByNodeThenID(list))
 	}
 
-	rm := &ResponseMetadata{
-		LastIndex:   qm.LastIndex,
-		LastContact: qm.LastContact,
+	return list, qm, nil
+}
+
+// fetchFailover returns the services of the first datacenter in the chain
+// which has any. Later queries block on the datacenter which produced the
+// current result, and the chain is only walked again once it has none.
+func (d *HealthServiceQuery) fetchFailover(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	dcs := append([]string{d.dc}, d.failover...)
+
+	if opts.WaitIndex != 0 && d.failoverIndex != 0 {
+		o := *opts
+		o.Datacenter = dcs[d.active]
+		o.WaitIndex = d.activeIndex
+		list, qm, err := d.fetch(clients, &o)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(list) > 0 {
+			d.activeIndex = qm.LastIndex
+			return d.failoverResp(list, dcs[d.active], qm)
+		}
+		log.Printf("[INFO] %s: no services left in %s, failing over", d, dcs[d.active])
 	}
 
-	return list, rm, nil
+	var primary *api.QueryMeta
+	for i, dc := range dcs {
+		o := *opts
+		o.Datacenter = dc
+		o.WaitIndex = 0
+		list, qm, err := d.fetch(clients, &o)
+		if err != nil {
+			return nil, nil, err
+		}
+		if primary == nil {
+			primary = qm
+		}
+		if len(list) > 0 {
+			log.Printf("[TRACE] %s: using services from %s", d, dc)
+			d.active = i
+			d.activeIndex = qm.LastIndex
+			return d.failoverResp(list, dc, qm)
+		}
+	}
+
+	// No datacenter has any services, so block on the first one until it
+	// does, or until the wait time elapses and the chain is walked again.
+	log.Printf("[WARN] %s: no services in any datacenter", d)
+	d.active = 0
+	d.activeIndex = primary.LastIndex
+	return d.failoverResp([]*HealthService{}, d.dc, primary)
+}
+
+// failoverResp annotates the services with the datacenter they were found in,
+// and returns them with a new index.
+func (d *HealthServiceQuery) failoverResp(list []*HealthService, dc string, qm *api.QueryMeta) (interface{}, *ResponseMetadata, error) {
+	for _, s := range list {
+		s.Datacenter = dc
+	}
+	d.failoverIndex++
+	return list, &ResponseMetadata{
+		LastIndex:   d.failoverIndex,
+		LastContact: qm.LastContact,
+	}, nil
 }
 
 // CanShare returns a boolean if this dependency is shareable.
@@ -248,6 +481,11 @@ func (d *HealthServiceQuery) CanShare() bool {
 	return true
 }
 
+// Debug returns whether this dependency was tagged for verbose logging.
+func (d *HealthServiceQuery) Debug() bool {
+	return d.debug
+}
+
 // Stop halts the dependency's fetch function.
 func (d *HealthServiceQuery) Stop() {
 	close(d.stopCh)
@@ -262,6 +500,9 @@ func (d *HealthServiceQuery) String() string {
 	if d.dc != "" {
 		name = name + "@" + d.dc
 	}
+	if len(d.failover) > 0 {
+		name = name + "," + strings.Join(d.failover, ",")
+	}
 	if d.partition != "" {
 		name = name + "@partition=" + d.partition
 	}
@@ -274,6 +515,24 @@ func (d *HealthServiceQuery) String() string {
 	if d.samenessGroup != "" {
 		name = name + "@sameness-group=" + d.samenessGroup
 	}
+	if d.connectNative {
+		name = name + "@connect=true"
+	}
+	if d.minInstances > 0 {
+		name = name + "@min_instances=" + strconv.Itoa(d.minInstances)
+	}
+	if d.address != "" {
+		name = name + "@address=" + d.address
+	}
+	if d.nodeCIDR.IsValid() {
+		name = name + "@node-cidr=" + d.nodeCIDR.String()
+	}
+	if d.stale {
+		name = name + "@stale"
+	}
+	if d.debug {
+		name = name + "@debug"
+	}
 	if d.near != "" {
 		name = name + "~" + d.near
 	}
@@ -291,6 +550,51 @@ func (d *HealthServiceQuery) Type() Type {
 	return TypeConsul
 }
 
+// countPassing returns the number of the given services which are passing all
+// of their checks.
+func countPassing(list []*HealthService) int {
+	var n int
+	for _, s := range list {
+		if s.Status == HealthPassing {
+			n++
+		}
+	}
+	return n
+}
+
+// parseHealthFilters parses a comma-separated list of statuses into a sorted
+// list without duplicates. An empty filter only accepts passing services, and
+// any supersedes every other status.
+func parseHealthFilters(filter string) ([]string, error) {
+	if filter == "" {
+		return []string{HealthPassing}, nil
+	}
+
+	var filters []string
+	for _, f := range strings.Split(filter, ",") {
+		f = strings.TrimSpace(f)
+		switch f {
+		case HealthAny:
+			return []string{HealthAny}, nil
+		case HealthPassing,
+			HealthWarning,
+			HealthCritical,
+			HealthMaint:
+			if !slices.Contains(filters, f) {
+				filters = append(filters, f)
+			}
+		case "":
+		default:
+			return nil, fmt.Errorf("invalid filter: %q", f)
+		}
+	}
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("empty filter: %q", filter)
+	}
+	sort.Strings(filters)
+	return filters, nil
+}
+
 // acceptStatus allows us to check if a slice of health checks pass this filter.
 func acceptStatus(list []string, s string) bool {
 	for _, status := range list {
@@ -311,6 +615,9 @@ func (s ByNodeThenID) Less(i, j int) bool {
 	if s[i].Node < s[j].Node {
 		return true
 	} else if s[i].Node == s[j].Node {
+		if s[i].ID == s[j].ID {
+			return s[i].Namespace < s[j].Namespace
+		}
 		return s[i].ID < s[j].ID
 	}
 	return false
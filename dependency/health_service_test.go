@@ -4,9 +4,14 @@
 package dependency
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 	"unsafe"
@@ -60,7 +65,49 @@ func TestNewHealthServiceQuery(t *testing.T) {
 				tenancyHelper.AppendTenancyInfo("invalid query param (unsupported key)", tenancy),
 				"name?unsupported=test",
 				nil,
-				fmt.Errorf(`health.service: invalid query parameter key "unsupported" in query "unsupported=test": supported keys: ns,peer,partition,sameness-group`),
+				fmt.Errorf(`health.service: invalid query parameter key "unsupported" in query "unsupported=test": supported keys: ns,peer,partition,sameness-group,connect,min_instances,address,node-cidr,stale,debug`),
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale", tenancy),
+				"tag.name?stale@dc1~near",
+				&HealthServiceQuery{
+					dc:      "dc1",
+					filters: []string{"passing"},
+					name:    "name",
+					near:    "near",
+					tag:     "tag",
+					stale:   true,
+				},
+				nil,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("failover", tenancy),
+				"name@dc1,dc2,dc3|passing",
+				&HealthServiceQuery{
+					dc:       "dc1",
+					failover: []string{"dc2", "dc3"},
+					filters:  []string{"passing"},
+					name:     "name",
+				},
+				nil,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("failover_empty_dc", tenancy),
+				"name@dc1,",
+				nil,
+				fmt.Errorf(`health.service: invalid format: "name@dc1,"`),
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("failover_min_instances", tenancy),
+				"name?min_instances=2@dc1,dc2",
+				nil,
+				fmt.Errorf(`health.service: cannot specify both min_instances and failover datacenters`),
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale_invalid", tenancy),
+				"name?stale=maybe",
+				nil,
+				fmt.Errorf(`health.service: invalid stale value: "maybe"`),
 			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("name", tenancy),
@@ -156,6 +203,28 @@ func TestNewHealthServiceQuery(t *testing.T) {
 				},
 				nil,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_partition_dc", tenancy),
+				fmt.Sprintf("name?partition=%s@dc1", tenancy.Partition),
+				&HealthServiceQuery{
+					dc:        "dc1",
+					filters:   []string{"passing"},
+					name:      "name",
+					partition: tenancy.Partition,
+				},
+				nil,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("tag_name_partition", tenancy),
+				fmt.Sprintf("tag.name?partition=%s", tenancy.Partition),
+				&HealthServiceQuery{
+					filters:   []string{"passing"},
+					name:      "name",
+					tag:       "tag",
+					partition: tenancy.Partition,
+				},
+				nil,
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("name_peer", tenancy),
 				"name?peer=foo",
@@ -176,6 +245,16 @@ func TestNewHealthServiceQuery(t *testing.T) {
 				},
 				nil,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_ns_wildcard", tenancy),
+				"name?ns=*",
+				&HealthServiceQuery{
+					filters:   []string{"passing"},
+					name:      "name",
+					namespace: "*",
+				},
+				nil,
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("name_ns_peer_partition", tenancy),
 				fmt.Sprintf("name?ns=%s&peer=bar&partition=%s", tenancy.Namespace, tenancy.Partition),
@@ -241,6 +320,54 @@ func TestNewHealthServiceQuery(t *testing.T) {
 				},
 				nil,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("connect_native", tenancy),
+				"name?connect=true",
+				&HealthServiceQuery{
+					filters:       []string{"passing"},
+					name:          "name",
+					connectNative: true,
+				},
+				nil,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("connect_native_invalid", tenancy),
+				"name?connect=maybe",
+				nil,
+				fmt.Errorf(`health.service: invalid connect value: "maybe"`),
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("min_instances", tenancy),
+				"name?min_instances=2",
+				&HealthServiceQuery{
+					filters:      []string{"passing"},
+					name:         "name",
+					minInstances: 2,
+				},
+				nil,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("min_instances_invalid", tenancy),
+				"name?min_instances=0",
+				nil,
+				fmt.Errorf(`health.service: invalid min_instances value: "0"`),
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("address", tenancy),
+				"name?address=wan",
+				&HealthServiceQuery{
+					filters: []string{"passing"},
+					name:    "name",
+					address: "wan",
+				},
+				nil,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("address_empty", tenancy),
+				"name?address=",
+				nil,
+				fmt.Errorf(`health.service: empty address value`),
+			},
 		}
 	})
 
@@ -275,6 +402,121 @@ func TestNewHealthServiceQuery(t *testing.T) {
 
 		assert.Equal(t, exp, act)
 	})
+	t.Run("connect_query_tag_dc", func(t *testing.T) {
+		act, err := NewHealthConnectQuery("tag.name@dc1|passing,warning")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if act != nil {
+			act.stopCh = nil
+		}
+		exp := &HealthServiceQuery{
+			dc:      "dc1",
+			filters: []string{"passing", "warning"},
+			name:    "name",
+			tag:     "tag",
+			connect: true,
+		}
+
+		assert.Equal(t, exp, act)
+		assert.Equal(t, "health.connect(tag.name@dc1|passing,warning)", act.String())
+	})
+}
+
+func TestNewHealthServiceQuery_Filters(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  []string
+		err  string
+	}{
+		{"default", "name", []string{"passing"}, ""},
+		{"passing", "name|passing", []string{"passing"}, ""},
+		{"warning", "name|warning", []string{"warning"}, ""},
+		{"critical", "name|critical", []string{"critical"}, ""},
+		{"maintenance", "name|maintenance", []string{"maintenance"}, ""},
+		{"passing_warning", "name|passing,warning", []string{"passing", "warning"}, ""},
+		{"sorted", "name|warning,passing", []string{"passing", "warning"}, ""},
+		{
+			"every_status",
+			"name|maintenance,critical,warning,passing",
+			[]string{"critical", "maintenance", "passing", "warning"},
+			"",
+		},
+		{"deduped", "name|warning,passing,warning", []string{"passing", "warning"}, ""},
+		{"empty_items", "name|passing,,warning,", []string{"passing", "warning"}, ""},
+		{"any", "name|any", []string{"any"}, ""},
+		{"any_supersedes", "name|passing,any,warning", []string{"any"}, ""},
+		{"with_dc", "tag.name@dc1|passing,warning", []string{"passing", "warning"}, ""},
+		{
+			"invalid",
+			"name|passing,healthy",
+			nil,
+			`health.service: invalid filter: "healthy" in "name|passing,healthy"`,
+		},
+		{"empty", "name|,", nil, `health.service: empty filter: "," in "name|,"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewHealthServiceQuery(tc.i)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act.filters)
+		})
+	}
+}
+
+func TestNewHealthServiceQuery_NodeCIDR(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  netip.Prefix
+		str  string
+		err  bool
+	}{
+		{"none", "name", netip.Prefix{}, "health.service(name|passing)", false},
+		{
+			"ipv4",
+			"name?node-cidr=10.0.0.0/8",
+			netip.MustParsePrefix("10.0.0.0/8"),
+			"health.service(name@node-cidr=10.0.0.0/8|passing)",
+			false,
+		},
+		{
+			"masked",
+			"tag.name?node-cidr=10.1.2.3/16@dc1|passing,warning",
+			netip.MustParsePrefix("10.1.0.0/16"),
+			"health.service(tag.name@dc1@node-cidr=10.1.0.0/16|passing,warning)",
+			false,
+		},
+		{
+			"ipv6",
+			"name?node-cidr=2001:db8::/32",
+			netip.MustParsePrefix("2001:db8::/32"),
+			"health.service(name@node-cidr=2001:db8::/32|passing)",
+			false,
+		},
+		{"empty", "name?node-cidr=", netip.Prefix{}, "", true},
+		{"malformed", "name?node-cidr=10.0.0/8", netip.Prefix{}, "", true},
+		{"bits", "name?node-cidr=2001:db8::/129", netip.Prefix{}, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewHealthServiceQuery(tc.i)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act.nodeCIDR)
+			assert.Equal(t, tc.str, act.String())
+		})
+	}
 }
 
 func TestHealthConnectServiceQuery_Fetch(t *testing.T) {
@@ -691,6 +933,581 @@ func TestHealthServiceQuery_Fetch(t *testing.T) {
 	}
 }
 
+// TestHealthServiceQuery_Fetch_ConnectNative ensures that only connect-native services are returned when asked for.
+func TestHealthServiceQuery_Fetch_ConnectNative(t *testing.T) {
+	catalog := testClients.Consul().Catalog()
+	for _, svc := range []*api.AgentService{
+		{
+			ID:      "connect-mixed-native",
+			Service: "connect-mixed",
+			Port:    8080,
+			Connect: &api.AgentServiceConnect{Native: true},
+		},
+		{
+			ID:      "connect-mixed-plain",
+			Service: "connect-mixed",
+			Port:    8081,
+		},
+	} {
+		if _, err := catalog.Register(&api.CatalogRegistration{
+			Service: svc,
+			Node:    "connect-mixed-node",
+			Address: "127.0.0.1",
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		i    string
+		exp  []string
+	}{
+		{
+			"all",
+			"connect-mixed",
+			[]string{"connect-mixed-native", "connect-mixed-plain"},
+		},
+		{
+			"connect_native",
+			"connect-mixed?connect=true",
+			[]string{"connect-mixed-native"},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewHealthServiceQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Stop()
+
+			res, _, err := d.Fetch(testClients, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var act []string
+			for _, s := range res.([]*HealthService) {
+				act = append(act, s.ID)
+				assert.Equal(t, s.ID == "connect-mixed-native", s.ConnectNative)
+			}
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestHealthServiceQuery_Fetch_MinInstances(t *testing.T) {
+	catalog := testClients.Consul().Catalog()
+	register := func(id, status string) {
+		checkName := "min-instances:" + id
+		if _, err := catalog.Register(&api.CatalogRegistration{
+			Service: &api.AgentService{
+				ID:      id,
+				Service: "min-instances",
+				Port:    8080,
+			},
+			Node:    "min-instances-node",
+			Address: "127.0.0.1",
+			Checks: api.HealthChecks{
+				&api.HealthCheck{
+					Node:      "min-instances-node",
+					CheckID:   checkName,
+					Name:      checkName,
+					Status:    status,
+					ServiceID: id,
+				},
+			},
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(res interface{}) []string {
+		var act []string
+		for _, s := range res.([]*HealthService) {
+			act = append(act, s.ID)
+		}
+		return act
+	}
+
+	register("min-instances-1", api.HealthPassing)
+	register("min-instances-2", api.HealthPassing)
+	defer catalog.Deregister(&api.CatalogDeregistration{
+		Node: "min-instances-node",
+	}, nil)
+
+	d, err := NewHealthServiceQuery("min-instances?min_instances=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	res, qm, err := d.Fetch(testClients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"min-instances-1", "min-instances-2"}
+	assert.Equal(t, exp, ids(res))
+
+	// Dropping below the threshold keeps the last good value
+	register("min-instances-2", api.HealthCritical)
+
+	res, _, err = d.Fetch(testClients, &QueryOptions{WaitIndex: qm.LastIndex})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, exp, ids(res))
+	for _, s := range res.([]*HealthService) {
+		assert.Equal(t, HealthPassing, s.Status)
+	}
+
+	// A query which has never met the threshold waits for it to be met
+	d2, err := NewHealthServiceQuery("min-instances?min_instances=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Stop()
+
+	dataCh := make(chan interface{}, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		res, _, err := d2.Fetch(testClients, nil)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		dataCh <- res
+	}()
+
+	select {
+	case res := <-dataCh:
+		t.Fatalf("expected fetch to wait, got %v", ids(res))
+	case err := <-errCh:
+		t.Fatal(err)
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	register("min-instances-2", api.HealthPassing)
+
+	select {
+	case res := <-dataCh:
+		assert.Equal(t, exp, ids(res))
+	case err := <-errCh:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch did not return after the threshold was met")
+	}
+
+	// A stopped query gives up waiting once the services change
+	register("min-instances-2", api.HealthCritical)
+	d3, err := NewHealthServiceQuery("min-instances?min_instances=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		res, _, err := d3.Fetch(testClients, nil)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		dataCh <- res
+	}()
+
+	time.Sleep(250 * time.Millisecond)
+	d3.Stop()
+	register("min-instances-2", api.HealthWarning)
+
+	select {
+	case res := <-dataCh:
+		t.Fatalf("expected fetch to stop, got %v", ids(res))
+	case err := <-errCh:
+		assert.Equal(t, ErrStopped, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch did not stop")
+	}
+}
+
+func TestHealthServiceQuery_Fetch_CheckOutput(t *testing.T) {
+	catalog := testClients.Consul().Catalog()
+	if _, err := catalog.Register(&api.CatalogRegistration{
+		Service: &api.AgentService{
+			ID:      "check-output",
+			Service: "check-output",
+			Port:    8080,
+		},
+		Node:    "check-output-node",
+		Address: "127.0.0.1",
+		Checks: api.HealthChecks{
+			&api.HealthCheck{
+				Node:      "check-output-node",
+				CheckID:   "check-output:http",
+				Name:      "HTTP probe",
+				Status:    api.HealthCritical,
+				Notes:     "Pages the on-call engineer",
+				Output:    "HTTP GET http://127.0.0.1:8080/health: 503 Service Unavailable",
+				ServiceID: "check-output",
+			},
+		},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Deregister(&api.CatalogDeregistration{
+		Node: "check-output-node",
+	}, nil)
+
+	d, err := NewHealthServiceQuery("check-output|critical")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	res, _, err := d.Fetch(testClients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := res.([]*HealthService)
+	if len(services) != 1 {
+		t.Fatalf("expected 1 service, got %d", len(services))
+	}
+	assert.Equal(t, HealthCritical, services[0].Status)
+
+	var check *api.HealthCheck
+	for _, c := range services[0].Checks {
+		if c.CheckID == "check-output:http" {
+			check = c
+		}
+	}
+	if check == nil {
+		t.Fatalf("check not returned: %#v", services[0].Checks)
+	}
+	assert.Equal(t, api.HealthCritical, check.Status)
+	assert.Equal(t, "Pages the on-call engineer", check.Notes)
+	assert.Equal(t, "HTTP GET http://127.0.0.1:8080/health: 503 Service Unavailable", check.Output)
+}
+
+func TestHealthServiceQuery_Fetch_Address(t *testing.T) {
+	catalog := testClients.Consul().Catalog()
+	if _, err := catalog.Register(&api.CatalogRegistration{
+		Service: &api.AgentService{
+			ID:      "tagged-address",
+			Service: "tagged-address",
+			Address: "10.0.0.1",
+			Port:    8080,
+			TaggedAddresses: map[string]api.ServiceAddress{
+				"lan": {Address: "10.0.0.1", Port: 8080},
+				"wan": {Address: "203.0.113.1", Port: 18080},
+			},
+		},
+		Node:    "tagged-address-node",
+		Address: "10.0.0.1",
+		TaggedAddresses: map[string]string{
+			"wan_ipv4": "203.0.113.2",
+		},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer catalog.Deregister(&api.CatalogDeregistration{
+		Node: "tagged-address-node",
+	}, nil)
+
+	cases := []struct {
+		name    string
+		i       string
+		address string
+		port    int
+	}{
+		{
+			"default",
+			"tagged-address",
+			"10.0.0.1",
+			8080,
+		},
+		{
+			"lan",
+			"tagged-address?address=lan",
+			"10.0.0.1",
+			8080,
+		},
+		{
+			"wan",
+			"tagged-address?address=wan",
+			"203.0.113.1",
+			18080,
+		},
+		{
+			"node_tagged_address",
+			"tagged-address?address=wan_ipv4",
+			"203.0.113.2",
+			8080,
+		},
+		{
+			"missing",
+			"tagged-address?address=nope",
+			"10.0.0.1",
+			8080,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewHealthServiceQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Stop()
+
+			act, _, err := d.Fetch(testClients, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			services := act.([]*HealthService)
+			if len(services) != 1 {
+				t.Fatalf("expected 1 service, got %d", len(services))
+			}
+			assert.Equal(t, tc.address, services[0].Address)
+			assert.Equal(t, tc.port, services[0].Port)
+			assert.Equal(t, 18080, services[0].ServiceTaggedAddresses["wan"].Port)
+		})
+	}
+}
+
+func TestHealthServiceQuery_Fetch_NodeCIDR(t *testing.T) {
+	catalog := testClients.Consul().Catalog()
+	for node, address := range map[string]string{
+		"cidr-service-v4": "10.1.2.3",
+		"cidr-service-v6": "2001:db8::1",
+	} {
+		if _, err := catalog.Register(&api.CatalogRegistration{
+			Service: &api.AgentService{
+				ID:      "cidr-service",
+				Service: "cidr-service",
+				Port:    8080,
+			},
+			Node:    node,
+			Address: address,
+		}, nil); err != nil {
+			t.Fatal(err)
+		}
+		defer catalog.Deregister(&api.CatalogDeregistration{Node: node}, nil)
+	}
+
+	cases := []struct {
+		name string
+		i    string
+		exp  []string
+	}{
+		{"all", "cidr-service", []string{"10.1.2.3", "2001:db8::1"}},
+		{"ipv4", "cidr-service?node-cidr=10.0.0.0/8", []string{"10.1.2.3"}},
+		{"ipv6", "cidr-service?node-cidr=2001:db8::/32", []string{"2001:db8::1"}},
+		{"none", "cidr-service?node-cidr=192.0.2.0/24", []string{}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewHealthServiceQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Stop()
+
+			act, _, err := d.Fetch(testClients, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addresses := []string{}
+			for _, s := range act.([]*HealthService) {
+				addresses = append(addresses, s.Address)
+			}
+			assert.Equal(t, tc.exp, addresses)
+		})
+	}
+}
+
+func TestHealthServiceQuery_Fetch_Failover(t *testing.T) {
+	// A fake Consul serves each datacenter, so services can be registered in
+	// and removed from the secondary datacenters.
+	var mu sync.Mutex
+	nodes := map[string]string{}
+	indexes := map[string]uint64{}
+	var requests []string
+	register := func(dc, node string) {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes[dc] = node
+		indexes[dc]++
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		dc := r.URL.Query().Get("dc")
+		requests = append(requests, dc+"@"+r.URL.Query().Get("index"))
+
+		entries := []*api.ServiceEntry{}
+		if node := nodes[dc]; node != "" {
+			entries = append(entries, &api.ServiceEntry{
+				Node:    &api.Node{Node: node, Address: "127.0.0.1"},
+				Service: &api.AgentService{ID: "web", Service: "web", Port: 80},
+				Checks: api.HealthChecks{
+					{CheckID: "web", Status: api.HealthPassing},
+				},
+			})
+		}
+		w.Header().Set("X-Consul-Index", fmt.Sprint(indexes[dc]+1))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer srv.Close()
+
+	clients := NewClientSet()
+	require.NoError(t, clients.CreateConsulClient(&CreateConsulClientInput{
+		Address: srv.URL,
+	}))
+
+	d, err := NewHealthServiceQuery("web@dc1,dc2,dc3")
+	require.NoError(t, err)
+	defer d.Stop()
+
+	var index uint64
+	fetch := func() (string, string) {
+		mu.Lock()
+		requests = nil
+		mu.Unlock()
+
+		act, rm, err := d.Fetch(clients, &QueryOptions{WaitIndex: index})
+		require.NoError(t, err)
+		require.Greater(t, rm.LastIndex, index)
+		index = rm.LastIndex
+
+		list := act.([]*HealthService)
+		if len(list) == 0 {
+			return "", ""
+		}
+		require.Len(t, list, 1)
+		return list[0].Node, list[0].Datacenter
+	}
+	lastRequests := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	t.Run("first_with_services", func(t *testing.T) {
+		register("dc2", "node-dc2")
+		register("dc3", "node-dc3")
+
+		node, dc := fetch()
+		assert.Equal(t, "node-dc2", node)
+		assert.Equal(t, "dc2", dc)
+		assert.Equal(t, []string{"dc1@", "dc2@"}, lastRequests())
+	})
+
+	t.Run("blocks_on_active", func(t *testing.T) {
+		node, dc := fetch()
+		assert.Equal(t, "node-dc2", node)
+		assert.Equal(t, "dc2", dc)
+		assert.Equal(t, []string{"dc2@2"}, lastRequests())
+	})
+
+	t.Run("fails_over_when_empty", func(t *testing.T) {
+		register("dc2", "")
+
+		node, dc := fetch()
+		assert.Equal(t, "node-dc3", node)
+		assert.Equal(t, "dc3", dc)
+		assert.Equal(t, []string{"dc2@2", "dc1@", "dc2@", "dc3@"}, lastRequests())
+	})
+
+	t.Run("keeps_active_over_primary", func(t *testing.T) {
+		// The chain is only walked again once the active set empties.
+		register("dc1", "node-dc1")
+
+		node, dc := fetch()
+		assert.Equal(t, "node-dc3", node)
+		assert.Equal(t, "dc3", dc)
+		assert.Equal(t, []string{"dc3@2"}, lastRequests())
+	})
+
+	t.Run("none", func(t *testing.T) {
+		register("dc1", "")
+		register("dc3", "")
+
+		node, _ := fetch()
+		assert.Equal(t, "", node)
+
+		// With no services anywhere, the first datacenter is blocked on.
+		register("dc1", "node-dc1")
+		node, dc := fetch()
+		assert.Equal(t, "node-dc1", node)
+		assert.Equal(t, "dc1", dc)
+		assert.Equal(t, []string{"dc1@3"}, lastRequests())
+	})
+}
+
+func TestHealthServiceQuery_Fetch_WildcardNamespace(t *testing.T) {
+	if !tenancyHelper.IsConsulEnterprise() {
+		t.Skip("Enterprise only test")
+	}
+
+	catalog := testClients.Consul().Catalog()
+	svcName := "wildcard-ns-service"
+	namespaces := []string{"wildcard-ns-1", "wildcard-ns-2"}
+	for _, ns := range namespaces {
+		_, _, err := testClients.Consul().Namespaces().Create(&api.Namespace{Name: ns}, nil)
+		require.NoError(t, err)
+
+		_, err = catalog.Register(&api.CatalogRegistration{
+			Node:    "wildcard-ns-node",
+			Address: "127.0.0.1",
+			Service: &api.AgentService{
+				ID:        svcName,
+				Service:   svcName,
+				Port:      12345,
+				Namespace: ns,
+			},
+		}, nil)
+		require.NoError(t, err)
+	}
+	defer func() {
+		for _, ns := range namespaces {
+			catalog.Deregister(&api.CatalogDeregistration{
+				Node:      "wildcard-ns-node",
+				ServiceID: svcName,
+				Namespace: ns,
+			}, nil)
+			testClients.Consul().Namespaces().Delete(ns, nil)
+		}
+	}()
+
+	d, err := NewHealthServiceQuery(svcName + "?ns=*")
+	require.NoError(t, err)
+	defer d.Stop()
+
+	act, _, err := d.Fetch(testClients, nil)
+	require.NoError(t, err)
+
+	services := act.([]*HealthService)
+	require.Len(t, services, 2)
+	for i, ns := range namespaces {
+		assert.Equal(t, svcName, services[i].Name)
+		assert.Equal(t, ns, services[i].Namespace)
+	}
+
+	// Queries of a single namespace do not annotate their services.
+	d, err = NewHealthServiceQuery(svcName + "?ns=" + namespaces[0])
+	require.NoError(t, err)
+	defer d.Stop()
+
+	act, _, err = d.Fetch(testClients, nil)
+	require.NoError(t, err)
+
+	services = act.([]*HealthService)
+	require.Len(t, services, 1)
+	assert.Equal(t, "", services[0].Namespace)
+}
+
 // TestHealthServiceQuery_Fetch_SamenessGroup ensures that consul-template re-runs when the blocking query updates.
 // The different behaviors of the blocking query, e.g. "when a service becomes unhealthy it should failover,
 // when it becomes healthy again it should fail back", are tested in the Consul codebase.
@@ -846,6 +1663,16 @@ func TestHealthServiceQuery_String(t *testing.T) {
 				"name@dc",
 				"health.service(name@dc|passing)",
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_failover", tenancy),
+				"name@dc1,dc2~near",
+				"health.service(name@dc1,dc2~near|passing)",
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("name_dc_near_stale", tenancy),
+				"name?stale@dc~near",
+				"health.service(name@dc@stale~near|passing)",
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("name_filter", tenancy),
 				"name|any",
@@ -911,11 +1738,31 @@ func TestHealthServiceQuery_String(t *testing.T) {
 				fmt.Sprintf("tag.name?partition=%s&ns=%s", tenancy.Partition, tenancy.Namespace),
 				fmt.Sprintf("health.service(tag.name@partition=%s@ns=%s|passing)", tenancy.Partition, tenancy.Namespace),
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("ns_wildcard", tenancy),
+				"tag.name?ns=*",
+				"health.service(tag.name@ns=*|passing)",
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("peer", tenancy),
 				"tag.name?peer=peer-name",
 				"health.service(tag.name@peer=peer-name|passing)",
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("connect_native", tenancy),
+				"name?connect=true",
+				"health.service(name@connect=true|passing)",
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("min_instances", tenancy),
+				"name?min_instances=2",
+				"health.service(name@min_instances=2|passing)",
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("address", tenancy),
+				"name?address=wan",
+				"health.service(name@address=wan|passing)",
+			},
 		}
 	})
 
@@ -0,0 +1,148 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log"
+	"net/url"
+	"sort"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+// Ensure implements
+var _ Dependency = (*KVTreeChecksumQuery)(nil)
+
+// KVTreeChecksumQuery queries the KV store for all keys under a prefix and
+// returns a single checksum over them, which changes whenever any key or value
+// under the prefix does.
+type KVTreeChecksumQuery struct {
+	stopCh chan struct{}
+
+	dc        string
+	prefix    string
+	namespace string
+	partition string
+}
+
+// NewKVTreeChecksumQuery parses a string into a dependency.
+func NewKVTreeChecksumQuery(s string) (*KVTreeChecksumQuery, error) {
+	if s != "" && !KVListQueryRe.MatchString(s) {
+		return nil, fmt.Errorf("kv.treeChecksum: invalid format: %q", s)
+	}
+
+	m := regexpMatch(KVListQueryRe, s)
+	queryParams, err := GetConsulQueryOpts(m, "kv.treeChecksum")
+	if err != nil {
+		return nil, err
+	}
+
+	return &KVTreeChecksumQuery{
+		stopCh:    make(chan struct{}, 1),
+		dc:        m["dc"],
+		prefix:    m["prefix"],
+		namespace: queryParams.Get(QueryNamespace),
+		partition: queryParams.Get(QueryPartition),
+	}, nil
+}
+
+// Fetch queries the Consul API defined by the given client.
+func (d *KVTreeChecksumQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{
+		Datacenter:      d.dc,
+		ConsulPartition: d.partition,
+		ConsulNamespace: d.namespace,
+	})
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/kv/" + d.prefix,
+		RawQuery: opts.String(),
+	})
+
+	list, qm, err := clients.Consul().KV().List(d.prefix, opts.ToConsulOpts())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	sum := kvChecksum(list)
+	log.Printf("[TRACE] %s: returned checksum %s over %d pairs", d, sum, len(list))
+
+	// The checksum is the same when a write does not change any value, and
+	// the watcher does not fire for the same data again.
+	rm := &ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	return sum, rm, nil
+}
+
+// kvChecksum returns the hex encoded SHA256 checksum over the keys and values
+// of the given pairs, sorted by key so the order they are given in does not
+// matter.
+func kvChecksum(pairs api.KVPairs) string {
+	sorted := make(api.KVPairs, len(pairs))
+	copy(sorted, pairs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	h := sha256.New()
+	for _, pair := range sorted {
+		writeLenPrefixed(h, []byte(pair.Key))
+		writeLenPrefixed(h, pair.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeLenPrefixed writes the length of b followed by b, so that adjacent
+// fields cannot be confused with each other.
+func writeLenPrefixed(h hash.Hash, b []byte) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+	h.Write(n[:])
+	h.Write(b)
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *KVTreeChecksumQuery) CanShare() bool {
+	return true
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *KVTreeChecksumQuery) String() string {
+	prefix := d.prefix
+	if d.dc != "" {
+		prefix = prefix + "@" + d.dc
+	}
+	if d.partition != "" {
+		prefix = prefix + "@partition=" + d.partition
+	}
+	if d.namespace != "" {
+		prefix = prefix + "@ns=" + d.namespace
+	}
+	return fmt.Sprintf("kv.treeChecksum(%s)", prefix)
+}
+
+// Stop halts the dependency's fetch function.
+func (d *KVTreeChecksumQuery) Stop() {
+	close(d.stopCh)
+}
+
+// Type returns the type of this dependency.
+func (d *KVTreeChecksumQuery) Type() Type {
+	return TypeConsul
+}
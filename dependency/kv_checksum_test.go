@@ -0,0 +1,189 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKVTreeChecksumQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  *KVTreeChecksumQuery
+		err  bool
+	}{
+		{
+			"empty",
+			"",
+			&KVTreeChecksumQuery{},
+			false,
+		},
+		{
+			"dc_only",
+			"@dc1",
+			nil,
+			true,
+		},
+		{
+			"unsupported_key",
+			"prefix?unsupported=foo",
+			nil,
+			true,
+		},
+		{
+			"prefix",
+			"prefix/",
+			&KVTreeChecksumQuery{
+				prefix: "prefix/",
+			},
+			false,
+		},
+		{
+			"dc_namespace_and_partition",
+			"prefix?ns=ns1&partition=part1@dc1",
+			&KVTreeChecksumQuery{
+				prefix:    "prefix",
+				namespace: "ns1",
+				partition: "part1",
+				dc:        "dc1",
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewKVTreeChecksumQuery(tc.i)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestKVChecksum(t *testing.T) {
+	pairs := api.KVPairs{
+		{Key: "tree/a", Value: []byte("1")},
+		{Key: "tree/b", Value: []byte("2")},
+		{Key: "tree/c/d", Value: []byte("3")},
+	}
+	base := kvChecksum(pairs)
+
+	t.Run("stable_across_reorderings", func(t *testing.T) {
+		reordered := api.KVPairs{pairs[2], pairs[0], pairs[1]}
+		assert.Equal(t, base, kvChecksum(reordered))
+		assert.Equal(t, base, kvChecksum(pairs))
+		assert.Equal(t, "tree/a", pairs[0].Key, "input must not be sorted in place")
+	})
+
+	t.Run("changes_on_edit", func(t *testing.T) {
+		cases := map[string]api.KVPairs{
+			"value": {
+				{Key: "tree/a", Value: []byte("1")},
+				{Key: "tree/b", Value: []byte("changed")},
+				{Key: "tree/c/d", Value: []byte("3")},
+			},
+			"key": {
+				{Key: "tree/a", Value: []byte("1")},
+				{Key: "tree/b2", Value: []byte("2")},
+				{Key: "tree/c/d", Value: []byte("3")},
+			},
+			"added": append(append(api.KVPairs{}, pairs...),
+				&api.KVPair{Key: "tree/e", Value: []byte("")}),
+			"removed": pairs[:2],
+			"boundary": {
+				{Key: "tree/a", Value: []byte("1tree/b")},
+				{Key: "", Value: []byte("2")},
+				{Key: "tree/c/d", Value: []byte("3")},
+			},
+		}
+		for name, edited := range cases {
+			t.Run(name, func(t *testing.T) {
+				assert.NotEqual(t, base, kvChecksum(edited))
+			})
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		assert.Equal(t, kvChecksum(nil), kvChecksum(api.KVPairs{}))
+	})
+}
+
+func TestKVTreeChecksumQuery_Fetch(t *testing.T) {
+	testConsul.SetKVString(t, "test-kv-checksum/prefix/foo", "bar")
+	testConsul.SetKVString(t, "test-kv-checksum/prefix/wave/ocean", "sleek")
+
+	d, err := NewKVTreeChecksumQuery("test-kv-checksum/prefix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	first, qm, err := d.Fetch(testClients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing the same value does not change the checksum
+	testConsul.SetKVString(t, "test-kv-checksum/prefix/foo", "bar")
+	same, qm, err := d.Fetch(testClients, &QueryOptions{WaitIndex: qm.LastIndex})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, first, same)
+
+	// Any edit under the prefix changes it
+	testConsul.SetKVString(t, "test-kv-checksum/prefix/wave/ocean", "choppy")
+	changed, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: qm.LastIndex})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEqual(t, first, changed)
+	assert.Len(t, changed, 64)
+}
+
+func TestKVTreeChecksumQuery_String(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  string
+	}{
+		{
+			"prefix",
+			"prefix",
+			"kv.treeChecksum(prefix)",
+		},
+		{
+			"dc",
+			"prefix@dc1",
+			"kv.treeChecksum(prefix@dc1)",
+		},
+		{
+			"partition_namespace",
+			"prefix?ns=ns1&partition=part1",
+			"kv.treeChecksum(prefix@partition=part1@ns=ns1)",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewKVTreeChecksumQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.exp, d.String())
+		})
+	}
+}
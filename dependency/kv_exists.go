@@ -0,0 +1,116 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// Ensure implements
+var _ Dependency = (*KVExistsQuery)(nil)
+
+// KVExistsQuery queries the KV store for whether a single key exists. Only the
+// keys are listed, so the value of the key is never fetched.
+type KVExistsQuery struct {
+	stopCh chan struct{}
+
+	dc        string
+	key       string
+	namespace string
+	partition string
+}
+
+// NewKVExistsQuery parses a string into a dependency. The format is the same
+// as for NewKVGetQuery.
+func NewKVExistsQuery(s string) (*KVExistsQuery, error) {
+	if s != "" && !KVGetQueryRe.MatchString(s) {
+		return nil, fmt.Errorf("kv.exists: invalid format: %q", s)
+	}
+
+	m := regexpMatch(KVGetQueryRe, s)
+	queryParams, err := GetConsulQueryOpts(m, "kv.exists")
+	if err != nil {
+		return nil, err
+	}
+	return &KVExistsQuery{
+		stopCh:    make(chan struct{}, 1),
+		dc:        m["dc"],
+		key:       m["key"],
+		namespace: queryParams.Get(QueryNamespace),
+		partition: queryParams.Get(QueryPartition),
+	}, nil
+}
+
+// Fetch queries the Consul API defined by the given client.
+func (d *KVExistsQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{
+		Datacenter:      d.dc,
+		ConsulPartition: d.partition,
+		ConsulNamespace: d.namespace,
+	})
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/kv/" + d.key,
+		RawQuery: "keys&separator=/&" + opts.String(),
+	})
+
+	// The keys are listed by prefix, so other keys starting with the same
+	// prefix may be returned too. The separator stops the listing at the next
+	// level, rather than listing the whole subtree of the key.
+	list, qm, err := clients.Consul().KV().Keys(d.key, "/", opts.ToConsulOpts())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	exists := slices.Contains(list, d.key)
+	log.Printf("[TRACE] %s: returned %t", d, exists)
+
+	rm := &ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	return exists, rm, nil
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *KVExistsQuery) CanShare() bool {
+	return true
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *KVExistsQuery) String() string {
+	key := d.key
+	if d.dc != "" {
+		key = key + "@" + d.dc
+	}
+	if d.partition != "" {
+		key = key + "@partition=" + d.partition
+	}
+	if d.namespace != "" {
+		key = key + "@ns=" + d.namespace
+	}
+	return fmt.Sprintf("kv.exists(%s)", key)
+}
+
+// Stop halts the dependency's fetch function.
+func (d *KVExistsQuery) Stop() {
+	close(d.stopCh)
+}
+
+// Type returns the type of this dependency.
+func (d *KVExistsQuery) Type() Type {
+	return TypeConsul
+}
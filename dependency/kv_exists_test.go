@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKVExistsQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  *KVExistsQuery
+		err  bool
+	}{
+		{
+			"key",
+			"key",
+			&KVExistsQuery{
+				key: "key",
+			},
+			false,
+		},
+		{
+			"dc",
+			"key@dc1",
+			&KVExistsQuery{
+				key: "key",
+				dc:  "dc1",
+			},
+			false,
+		},
+		{
+			"namespace",
+			"key?ns=foo",
+			&KVExistsQuery{
+				key:       "key",
+				namespace: "foo",
+			},
+			false,
+		},
+		{
+			"invalid",
+			"key?unknown=foo",
+			nil,
+			true,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewKVExistsQuery(tc.i)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestKVExistsQuery_Fetch(t *testing.T) {
+	key := "test-kv-exists/key"
+	// A key sharing the prefix must not be mistaken for the key
+	testConsul.SetKVString(t, key+"-other", "value")
+	// Nor a key under it
+	testConsul.SetKVString(t, key+"/child", "value")
+
+	d, err := NewKVExistsQuery(key)
+	require.NoError(t, err)
+
+	fetch := func() bool {
+		act, _, err := d.Fetch(testClients, nil)
+		require.NoError(t, err)
+		return act.(bool)
+	}
+
+	assert.False(t, fetch())
+
+	testConsul.SetKVString(t, key, "")
+	assert.True(t, fetch())
+
+	_, err = testClients.Consul().KV().Delete(key, nil)
+	require.NoError(t, err)
+	assert.False(t, fetch())
+}
+
+func TestKVExistsQuery_String(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  string
+	}{
+		{
+			"key",
+			"key",
+			"kv.exists(key)",
+		},
+		{
+			"dc_and_ns",
+			"key?ns=foo@dc1",
+			"kv.exists(key@dc1@ns=foo)",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewKVExistsQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.exp, d.String())
+		})
+	}
+}
@@ -29,6 +29,14 @@ type KVGetQuery struct {
 	blockOnNil bool
 	namespace  string
 	partition  string
+
+	// stale allows any server to answer the query, rather than only the
+	// leader.
+	stale bool
+
+	// debug logs the fetches and changes of this dependency at INFO rather
+	// than TRACE.
+	debug bool
 }
 
 // NewKVGetQuery parses a string into a dependency.
@@ -38,16 +46,27 @@ func NewKVGetQuery(s string) (*KVGetQuery, error) {
 	}
 
 	m := regexpMatch(KVGetQueryRe, s)
-	queryParams, err := GetConsulQueryOpts(m, "kv.get")
+	queryParams, err := GetConsulQueryOpts(m, "kv.get", QueryStale, QueryDebug)
 	if err != nil {
 		return nil, err
 	}
+	stale, err := parseStale(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("kv.get: %s", err)
+	}
+
+	debug, err := parseDebug(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("kv.get: %s", err)
+	}
 	return &KVGetQuery{
 		stopCh:    make(chan struct{}, 1),
 		dc:        m["dc"],
 		key:       m["key"],
 		namespace: queryParams.Get(QueryNamespace),
 		partition: queryParams.Get(QueryPartition),
+		stale:     stale,
+		debug:     debug,
 	}, nil
 }
 
@@ -63,6 +82,7 @@ func (d *KVGetQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{},
 		Datacenter:      d.dc,
 		ConsulPartition: d.partition,
 		ConsulNamespace: d.namespace,
+		AllowStale:      d.stale,
 	})
 
 	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
@@ -104,6 +124,11 @@ func (d *KVGetQuery) CanShare() bool {
 	return true
 }
 
+// Debug returns whether this dependency was tagged for verbose logging.
+func (d *KVGetQuery) Debug() bool {
+	return d.debug
+}
+
 // String returns the human-friendly version of this dependency.
 func (d *KVGetQuery) String() string {
 	key := d.key
@@ -116,6 +141,12 @@ func (d *KVGetQuery) String() string {
 	if d.namespace != "" {
 		key = key + "@ns=" + d.namespace
 	}
+	if d.stale {
+		key = key + "@stale"
+	}
+	if d.debug {
+		key = key + "@debug"
+	}
 
 	if d.blockOnNil {
 		return fmt.Sprintf("kv.block(%s)", key)
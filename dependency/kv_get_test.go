@@ -46,6 +46,39 @@ func TestNewKVGetQuery(t *testing.T) {
 				nil,
 				true,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale", tenancy),
+				"key?stale@dc1",
+				&KVGetQuery{
+					dc:    "dc1",
+					key:   "key",
+					stale: true,
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale_true", tenancy),
+				"key?stale=true",
+				&KVGetQuery{
+					key:   "key",
+					stale: true,
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale_false", tenancy),
+				"key?stale=false",
+				&KVGetQuery{
+					key: "key",
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale_invalid", tenancy),
+				"key?stale=maybe",
+				nil,
+				true,
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("key", tenancy),
 				"key",
@@ -371,6 +404,11 @@ func TestKVGetQuery_String(t *testing.T) {
 				"key@dc1",
 				"kv.get(key@dc1)",
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale", tenancy),
+				"key?stale@dc1",
+				"kv.get(key@dc1@stale)",
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("dc_and_partition", tenancy),
 				fmt.Sprintf("key?partition=%s@dc1", tenancy.Partition),
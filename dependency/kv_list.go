@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -48,6 +49,18 @@ type KVListQuery struct {
 	prefix    string
 	namespace string
 	partition string
+
+	// stale allows any server to answer the query, rather than only the
+	// leader.
+	stale bool
+
+	// debug logs the fetches and changes of this dependency at INFO rather
+	// than TRACE.
+	debug bool
+
+	// depth is the number of levels of keys below the prefix to return, or
+	// zero for every level.
+	depth int
 }
 
 // NewKVListQuery parses a string into a dependency.
@@ -57,10 +70,28 @@ func NewKVListQuery(s string) (*KVListQuery, error) {
 	}
 
 	m := regexpMatch(KVListQueryRe, s)
-	queryParams, err := GetConsulQueryOpts(m, "kv.list")
+	queryParams, err := GetConsulQueryOpts(m, "kv.list", QueryStale, QueryDebug, QueryDepth)
 	if err != nil {
 		return nil, err
 	}
+	stale, err := parseStale(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("kv.list: %s", err)
+	}
+
+	debug, err := parseDebug(queryParams)
+	if err != nil {
+		return nil, fmt.Errorf("kv.list: %s", err)
+	}
+
+	var depth int
+	if queryParams.Has(QueryDepth) {
+		v := queryParams.Get(QueryDepth)
+		depth, err = strconv.Atoi(v)
+		if err != nil || depth < 1 {
+			return nil, fmt.Errorf("kv.list: invalid %s value: %q", QueryDepth, v)
+		}
+	}
 
 	return &KVListQuery{
 		stopCh:    make(chan struct{}, 1),
@@ -68,6 +99,9 @@ func NewKVListQuery(s string) (*KVListQuery, error) {
 		prefix:    m["prefix"],
 		namespace: queryParams.Get(QueryNamespace),
 		partition: queryParams.Get(QueryPartition),
+		stale:     stale,
+		debug:     debug,
+		depth:     depth,
 	}, nil
 }
 
@@ -83,6 +117,7 @@ func (d *KVListQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}
 		Datacenter:      d.dc,
 		ConsulPartition: d.partition,
 		ConsulNamespace: d.namespace,
+		AllowStale:      d.stale,
 	})
 
 	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
@@ -102,6 +137,10 @@ func (d *KVListQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}
 		key := strings.TrimPrefix(pair.Key, d.prefix)
 		key = strings.TrimLeft(key, "/")
 
+		if d.depth > 0 && keyDepth(key) > d.depth {
+			continue
+		}
+
 		pairs = append(pairs, &KeyPair{
 			Path:        pair.Key,
 			Key:         key,
@@ -114,6 +153,10 @@ func (d *KVListQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}
 		})
 	}
 
+	if d.depth > 0 {
+		log.Printf("[TRACE] %s: returned %d pairs within depth", d, len(pairs))
+	}
+
 	rm := &ResponseMetadata{
 		LastIndex:   qm.LastIndex,
 		LastContact: qm.LastContact,
@@ -122,11 +165,26 @@ func (d *KVListQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}
 	return pairs, rm, nil
 }
 
+// keyDepth returns the number of levels of a key relative to the prefix, so
+// "a" and the folder "a/" are one level deep and "a/b" is two.
+func keyDepth(key string) int {
+	key = strings.TrimSuffix(key, "/")
+	if key == "" {
+		return 0
+	}
+	return strings.Count(key, "/") + 1
+}
+
 // CanShare returns a boolean if this dependency is shareable.
 func (d *KVListQuery) CanShare() bool {
 	return true
 }
 
+// Debug returns whether this dependency was tagged for verbose logging.
+func (d *KVListQuery) Debug() bool {
+	return d.debug
+}
+
 // String returns the human-friendly version of this dependency.
 func (d *KVListQuery) String() string {
 	prefix := d.prefix
@@ -139,6 +197,15 @@ func (d *KVListQuery) String() string {
 	if d.namespace != "" {
 		prefix = prefix + "@ns=" + d.namespace
 	}
+	if d.stale {
+		prefix = prefix + "@stale"
+	}
+	if d.debug {
+		prefix = prefix + "@debug"
+	}
+	if d.depth > 0 {
+		prefix = prefix + "@depth=" + strconv.Itoa(d.depth)
+	}
 	return fmt.Sprintf("kv.list(%s)", prefix)
 }
 
@@ -45,6 +45,44 @@ func TestNewKVListQuery(t *testing.T) {
 				nil,
 				true,
 			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale", tenancy),
+				"prefix?stale@dc1",
+				&KVListQuery{
+					dc:     "dc1",
+					prefix: "prefix",
+					stale:  true,
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("stale_invalid", tenancy),
+				"prefix?stale=maybe",
+				nil,
+				true,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("depth", tenancy),
+				"prefix?depth=2@dc1",
+				&KVListQuery{
+					dc:     "dc1",
+					prefix: "prefix",
+					depth:  2,
+				},
+				false,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("depth_zero", tenancy),
+				"prefix?depth=0",
+				nil,
+				true,
+			},
+			testCase{
+				tenancyHelper.AppendTenancyInfo("depth_invalid", tenancy),
+				"prefix?depth=deep",
+				nil,
+				true,
+			},
 			testCase{
 				tenancyHelper.AppendTenancyInfo("prefix", tenancy),
 				"prefix",
@@ -461,6 +499,70 @@ func TestKVListQuery_Fetch(t *testing.T) {
 	}, t, "fires_changes")
 }
 
+func TestKVListQuery_Fetch_Depth(t *testing.T) {
+	for _, k := range []string{
+		"test-kv-list-depth/a",
+		"test-kv-list-depth/b/",
+		"test-kv-list-depth/b/c",
+		"test-kv-list-depth/b/d/e",
+		"test-kv-list-depth/b/d/f/g",
+	} {
+		testConsul.SetKVString(t, k, "v")
+	}
+
+	cases := []struct {
+		name string
+		i    string
+		exp  []string
+	}{
+		{"all", "test-kv-list-depth", []string{"a", "b/", "b/c", "b/d/e", "b/d/f/g"}},
+		{"depth_1", "test-kv-list-depth?depth=1", []string{"a", "b/"}},
+		{"depth_2", "test-kv-list-depth?depth=2", []string{"a", "b/", "b/c"}},
+		{"depth_3", "test-kv-list-depth/?depth=3", []string{"a", "b/", "b/c", "b/d/e"}},
+		{"nested_prefix", "test-kv-list-depth/b?depth=1", []string{"", "c"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := NewKVListQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			act, _, err := d.Fetch(testClients, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			keys := []string{}
+			for _, p := range act.([]*KeyPair) {
+				keys = append(keys, p.Key)
+			}
+			assert.Equal(t, tc.exp, keys)
+		})
+	}
+}
+
+func TestKeyDepth(t *testing.T) {
+	cases := []struct {
+		key string
+		exp int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"a/", 1},
+		{"a/b", 2},
+		{"a/b/", 2},
+		{"a/b/c", 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.key, func(t *testing.T) {
+			assert.Equal(t, tc.exp, keyDepth(tc.key))
+		})
+	}
+}
+
 func TestKVListQuery_String(t *testing.T) {
 	type testCase struct {
 		name string
@@ -479,6 +581,16 @@ func TestKVListQuery_String(t *testing.T) {
 				"prefix@dc1",
 				"kv.list(prefix@dc1)",
 			},
+			testCase{
+				"stale",
+				"prefix?stale@dc1",
+				"kv.list(prefix@dc1@stale)",
+			},
+			testCase{
+				"depth",
+				"prefix?depth=2@dc1",
+				"kv.list(prefix@dc1@depth=2)",
+			},
 			testCase{
 				"dc_partition",
 				fmt.Sprintf("prefix?partition=%s@dc1", tenancy.Partition),
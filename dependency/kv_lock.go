@@ -0,0 +1,188 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*KVLockQuery)(nil)
+
+	// KVLockQueryRe is the regular expression to use.
+	KVLockQueryRe = regexp.MustCompile(`\A` + keyRe + queryRe + dcRe + `\z`)
+)
+
+func init() {
+	gob.Register(&KVLock{})
+}
+
+// KVLock is the state of a lock on a key in the KV store, and the session
+// holding it, if any.
+type KVLock struct {
+	Key string
+
+	// Held is true when a session holds the lock. The session fields are
+	// empty otherwise.
+	Held bool
+
+	// Value is the value of the key, which holders commonly set to identify
+	// themselves.
+	Value string
+
+	// LockIndex is the number of times the lock has been acquired.
+	LockIndex uint64
+
+	// Session is the ID of the session holding the lock, and Node and Name
+	// those of the session.
+	Session string
+	Node    string
+	Name    string
+
+	// Behavior is what happens to the key when the session is invalidated,
+	// either "release" or "delete".
+	Behavior  string
+	TTL       string
+	LockDelay time.Duration
+}
+
+// KVLockQuery is the dependency to Consul for the holder of a lock on a key.
+// It only observes the lock, and never acquires it.
+type KVLockQuery struct {
+	stopCh chan struct{}
+
+	dc        string
+	key       string
+	namespace string
+	partition string
+}
+
+// NewKVLockQuery parses a string of the form "<key>?<query>@<dc>" into a
+// dependency.
+func NewKVLockQuery(s string) (*KVLockQuery, error) {
+	if !KVLockQueryRe.MatchString(s) {
+		return nil, fmt.Errorf("kv.lock: invalid format: %q", s)
+	}
+
+	m := regexpMatch(KVLockQueryRe, s)
+	queryParams, err := GetConsulQueryOpts(m, "kv.lock")
+	if err != nil {
+		return nil, err
+	}
+	return &KVLockQuery{
+		stopCh:    make(chan struct{}, 1),
+		dc:        m["dc"],
+		key:       m["key"],
+		namespace: queryParams.Get(QueryNamespace),
+		partition: queryParams.Get(QueryPartition),
+	}, nil
+}
+
+// Fetch queries the Consul API defined by the given client. It blocks on
+// changes to the key, which include the lock being acquired or released.
+func (d *KVLockQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{
+		Datacenter:      d.dc,
+		ConsulPartition: d.partition,
+		ConsulNamespace: d.namespace,
+	})
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/kv/" + d.key,
+		RawQuery: opts.String(),
+	})
+
+	pair, qm, err := clients.Consul().KV().Get(d.key, opts.ToConsulOpts())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	rm := &ResponseMetadata{
+		LastIndex:   qm.LastIndex,
+		LastContact: qm.LastContact,
+	}
+
+	lock := &KVLock{Key: d.key}
+	if pair != nil {
+		lock.Value = string(pair.Value)
+		lock.LockIndex = pair.LockIndex
+	}
+	if pair == nil || pair.Session == "" {
+		log.Printf("[TRACE] %s: not held", d)
+		return lock, rm, nil
+	}
+	lock.Held = true
+	lock.Session = pair.Session
+
+	// The session is read without blocking, since invalidating it releases
+	// the lock, which changes the key.
+	sessionOpts := opts.ToConsulOpts()
+	sessionOpts.WaitIndex = 0
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/session/info/" + pair.Session,
+		RawQuery: opts.String(),
+	})
+	session, _, err := clients.Consul().Session().Info(pair.Session, sessionOpts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	// The session may have been invalidated between the two reads, in which
+	// case the key changes again shortly.
+	if session != nil {
+		lock.Node = session.Node
+		lock.Name = session.Name
+		lock.Behavior = session.Behavior
+		lock.TTL = session.TTL
+		lock.LockDelay = session.LockDelay
+	}
+
+	log.Printf("[TRACE] %s: held by session %q on node %q", d, lock.Session, lock.Node)
+
+	return lock, rm, nil
+}
+
+// CanShare returns a boolean if this dependency is shareable.
+func (d *KVLockQuery) CanShare() bool {
+	return true
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *KVLockQuery) String() string {
+	key := d.key
+	if d.dc != "" {
+		key = key + "@" + d.dc
+	}
+	if d.partition != "" {
+		key = key + "@partition=" + d.partition
+	}
+	if d.namespace != "" {
+		key = key + "@ns=" + d.namespace
+	}
+	return fmt.Sprintf("kv.lock(%s)", key)
+}
+
+// Stop halts the dependency's fetch function.
+func (d *KVLockQuery) Stop() {
+	close(d.stopCh)
+}
+
+// Type returns the type of this dependency.
+func (d *KVLockQuery) Type() Type {
+	return TypeConsul
+}
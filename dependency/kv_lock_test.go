@@ -0,0 +1,137 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKVLockQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  *KVLockQuery
+		err  bool
+	}{
+		{"empty", "", nil, true},
+		{"dc_only", "@dc1", nil, true},
+		{"key", "service/leader", &KVLockQuery{key: "service/leader"}, false},
+		{"dc", "service/leader@dc1", &KVLockQuery{key: "service/leader", dc: "dc1"}, false},
+		{
+			"query",
+			"service/leader?ns=foo&partition=bar@dc1",
+			&KVLockQuery{key: "service/leader", dc: "dc1", namespace: "foo", partition: "bar"},
+			false,
+		},
+		{"unsupported_query", "service/leader?stale", nil, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewKVLockQuery(tc.i)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if act != nil {
+				act.stopCh = nil
+			}
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestKVLockQuery_Fetch(t *testing.T) {
+	kv := testClients.Consul().KV()
+	sessions := testClients.Consul().Session()
+
+	d, err := NewKVLockQuery("test-kv-lock/leader")
+	require.NoError(t, err)
+	defer d.Stop()
+
+	t.Run("not_held", func(t *testing.T) {
+		act, _, err := d.Fetch(testClients, nil)
+		require.NoError(t, err)
+		assert.Equal(t, &KVLock{Key: "test-kv-lock/leader"}, act)
+	})
+
+	id, _, err := sessions.Create(&api.SessionEntry{
+		Name:      "leader-election",
+		Behavior:  api.SessionBehaviorDelete,
+		TTL:       "30s",
+		LockDelay: time.Second,
+	}, nil)
+	require.NoError(t, err)
+	defer sessions.Destroy(id, nil)
+
+	acquired, _, err := kv.Acquire(&api.KVPair{
+		Key:     "test-kv-lock/leader",
+		Value:   []byte("10.0.0.1:8080"),
+		Session: id,
+	}, nil)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	t.Run("held", func(t *testing.T) {
+		act, _, err := d.Fetch(testClients, nil)
+		require.NoError(t, err)
+		assert.Equal(t, &KVLock{
+			Key:       "test-kv-lock/leader",
+			Held:      true,
+			Value:     "10.0.0.1:8080",
+			LockIndex: 1,
+			Session:   id,
+			Node:      testConsul.Config.NodeName,
+			Name:      "leader-election",
+			Behavior:  api.SessionBehaviorDelete,
+			TTL:       "30s",
+			LockDelay: time.Second,
+		}, act)
+	})
+
+	t.Run("fires_on_release", func(t *testing.T) {
+		_, rm, err := d.Fetch(testClients, nil)
+		require.NoError(t, err)
+
+		dataCh := make(chan interface{}, 1)
+		errCh := make(chan error, 1)
+		go func() {
+			data, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: rm.LastIndex})
+			if err != nil {
+				errCh <- err
+				return
+			}
+			dataCh <- data
+		}()
+
+		released, _, err := kv.Release(&api.KVPair{
+			Key:     "test-kv-lock/leader",
+			Session: id,
+		}, nil)
+		require.NoError(t, err)
+		require.True(t, released)
+
+		select {
+		case data := <-dataCh:
+			lock := data.(*KVLock)
+			assert.False(t, lock.Held)
+			assert.Equal(t, "", lock.Session)
+			assert.Equal(t, "10.0.0.1:8080", lock.Value)
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("release was not observed")
+		}
+	})
+}
+
+func TestKVLockQuery_String(t *testing.T) {
+	d, err := NewKVLockQuery("service/leader?ns=foo@dc1")
+	require.NoError(t, err)
+	assert.Equal(t, "kv.lock(service/leader@dc1@ns=foo)", d.String())
+}
@@ -9,7 +9,9 @@ import (
 	"log"
 	"net/url"
 	"regexp"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -21,8 +23,8 @@ var (
 	// NomadServiceQueryRe is the regex that is used to understand a service
 	// specific Nomad query.
 	//
-	// e.g. "<tag=value>.<name>@<region>"
-	NomadServiceQueryRe = regexp.MustCompile(`\A` + tagRe + serviceNameRe + regionRe + `\z`)
+	// e.g. "<tag=value>.<name>?dc=<dc>&ns=<namespace>@<region>"
+	NomadServiceQueryRe = regexp.MustCompile(`\A` + tagRe + serviceNameRe + queryRe + regionRe + `\z`)
 )
 
 func init() {
@@ -48,10 +50,12 @@ type NomadService struct {
 type NomadServiceQuery struct {
 	stopCh chan struct{}
 
-	region string
-	name   string
-	tag    string
-	choose string
+	region    string
+	name      string
+	tag       string
+	choose    string
+	dc        string
+	namespace string
 }
 
 // NewNomadServiceQuery parses a string into a NomadServiceQuery which is
@@ -62,15 +66,44 @@ func NewNomadServiceQuery(s string) (*NomadServiceQuery, error) {
 	}
 
 	m := regexpMatch(NomadServiceQueryRe, s)
+	queryParams, err := getNomadServiceQueryOpts(m["query"])
+	if err != nil {
+		return nil, err
+	}
 
 	return &NomadServiceQuery{
-		stopCh: make(chan struct{}, 1),
-		region: m["region"],
-		name:   m["name"],
-		tag:    m["tag"],
+		stopCh:    make(chan struct{}, 1),
+		region:    m["region"],
+		name:      m["name"],
+		tag:       m["tag"],
+		dc:        queryParams.Get(QueryDatacenter),
+		namespace: queryParams.Get(QueryNamespace),
 	}, nil
 }
 
+// getNomadServiceQueryOpts parses the optional query of a Nomad service
+// query, which may only filter by datacenter and namespace.
+func getNomadServiceQueryOpts(queryRaw string) (url.Values, error) {
+	if queryRaw == "" {
+		return url.Values{}, nil
+	}
+
+	queryParams, err := url.ParseQuery(queryRaw)
+	if err != nil {
+		return nil, fmt.Errorf("nomad.service: invalid query: %q: %s", queryRaw, err)
+	}
+
+	supported := []string{QueryDatacenter, QueryNamespace}
+	for key := range queryParams {
+		if !slices.Contains(supported, key) {
+			return nil, fmt.Errorf("nomad.service: invalid query parameter key %q "+
+				"in query %q: supported keys: %s", key, queryRaw, strings.Join(supported, ","))
+		}
+	}
+
+	return queryParams, nil
+}
+
 // NewNomadServiceChooseQuery parses s using NewNomadServiceQuery, and then also
 // configures the resulting query with the choose parameter set according to the
 // count and key arguments.
@@ -96,8 +129,9 @@ func (d *NomadServiceQuery) Fetch(client *ClientSet, opts *QueryOptions) (interf
 	}
 
 	opts = opts.Merge(&QueryOptions{
-		Region: d.region,
-		Choose: d.choose,
+		Region:         d.region,
+		Choose:         d.choose,
+		NomadNamespace: d.namespace,
 	})
 
 	u := &url.URL{
@@ -116,6 +150,11 @@ func (d *NomadServiceQuery) Fetch(client *ClientSet, opts *QueryOptions) (interf
 
 	services := make([]*NomadService, 0, len(entries))
 	for _, s := range entries {
+		// Filter by datacenter
+		if d.dc != "" && s.Datacenter != d.dc {
+			continue
+		}
+
 		// Filter by tag
 		if d.tag != "" {
 			found := false
@@ -158,6 +197,16 @@ func (d *NomadServiceQuery) String() string {
 	if d.tag != "" {
 		name = d.tag + "." + name
 	}
+	if d.dc != "" || d.namespace != "" {
+		query := url.Values{}
+		if d.dc != "" {
+			query.Set(QueryDatacenter, d.dc)
+		}
+		if d.namespace != "" {
+			query.Set(QueryNamespace, d.namespace)
+		}
+		name = name + "?" + query.Encode()
+	}
 	if d.region != "" {
 		name = name + "@" + d.region
 	}
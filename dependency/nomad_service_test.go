@@ -81,6 +81,33 @@ func TestNewNomadServiceQuery(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"name_query",
+			"name?dc=dc1&ns=prod",
+			&NomadServiceQuery{
+				name:      "name",
+				dc:        "dc1",
+				namespace: "prod",
+			},
+			false,
+		},
+		{
+			"tag_name_query_region",
+			"tag.name?ns=prod@us-east-1",
+			&NomadServiceQuery{
+				region:    "us-east-1",
+				name:      "name",
+				tag:       "tag",
+				namespace: "prod",
+			},
+			false,
+		},
+		{
+			"invalid_query",
+			"name?peer=foo",
+			nil,
+			true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -145,6 +172,28 @@ func TestNomadServiceQuery_Fetch(t *testing.T) {
 			"nope.example-cache",
 			[]*NomadService{},
 		},
+		{
+			"wrong_dc",
+			"example-cache?dc=dc2",
+			[]*NomadService{},
+		},
+		{
+			"right_dc_namespace",
+			"example-cache?dc=dc1&ns=default",
+			[]*NomadService{
+				{
+					// ID is randomized so manually checked below
+					Name: "example-cache",
+					// Node is randomized so manually checked below
+					Address: "127.0.0.1",
+					// Port is randomized so manually checked below
+					Datacenter: "dc1",
+					Tags:       ServiceTags([]string{"tag1", "tag2"}),
+					JobID:      "example",
+					// AllocID is randomized so manually checked below
+				},
+			},
+		},
 		{
 			"right_tag",
 			"tag2.example-cache",
@@ -275,6 +324,11 @@ func TestNomadServiceQuery_String(t *testing.T) {
 			"tag.name@us-east-1",
 			"nomad.service(tag.name@us-east-1)",
 		},
+		{
+			"tag_name_query_region",
+			"tag.name?ns=prod&dc=dc1@us-east-1",
+			"nomad.service(tag.name?dc=dc1&ns=prod@us-east-1)",
+		},
 	}
 
 	for i, tc := range cases {
@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"log"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*VaultAuditDevicesQuery)(nil)
+
+	// VaultAuditDevicesQuerySleepTime is the amount of time to sleep between
+	// queries, since the endpoint does not support blocking queries.
+	VaultAuditDevicesQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+func init() {
+	gob.Register([]*VaultAuditDevice{})
+}
+
+// VaultAuditDevice is an audit device enabled in Vault.
+type VaultAuditDevice struct {
+	// Path is the path the device is enabled at, with a trailing slash.
+	Path        string
+	Type        string
+	Description string
+	Options     map[string]string
+	Local       bool
+}
+
+// VaultAuditDevicesQuery is the dependency to Vault for the enabled audit
+// devices. The token must be able to read sys/audit, which usually requires a
+// privileged token.
+type VaultAuditDevicesQuery struct {
+	stopCh chan struct{}
+}
+
+// NewVaultAuditDevicesQuery creates a new audit devices query.
+func NewVaultAuditDevicesQuery() (*VaultAuditDevicesQuery, error) {
+	return &VaultAuditDevicesQuery{
+		stopCh: make(chan struct{}, 1),
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultAuditDevicesQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		log.Printf("[TRACE] %s: long polling for %s", d, VaultAuditDevicesQuerySleepTime)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(VaultAuditDevicesQuerySleepTime):
+		}
+	}
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/sys/audit",
+		RawQuery: opts.String(),
+	})
+	audits, err := clients.Vault().Sys().ListAudit()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	log.Printf("[TRACE] %s: returned %d results", d, len(audits))
+
+	list := make([]*VaultAuditDevice, 0, len(audits))
+	for path, a := range audits {
+		// Older versions of Vault do not include the path in the device
+		if a.Path != "" {
+			path = a.Path
+		}
+		list = append(list, &VaultAuditDevice{
+			Path:        path,
+			Type:        a.Type,
+			Description: a.Description,
+			Options:     a.Options,
+			Local:       a.Local,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	return respWithMetadata(list)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultAuditDevicesQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultAuditDevicesQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultAuditDevicesQuery) String() string {
+	return "vault.auditDevices"
+}
+
+// Type returns the type of this dependency.
+func (d *VaultAuditDevicesQuery) Type() Type {
+	return TypeVault
+}
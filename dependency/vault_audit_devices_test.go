@@ -0,0 +1,66 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	VaultAuditDevicesQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestVaultAuditDevicesQuery_Fetch(t *testing.T) {
+	sys := testClients.Vault().Sys()
+	require.NoError(t, sys.EnableAuditWithOptions("audit-devices-test", &api.EnableAuditOptions{
+		Type:        "file",
+		Description: "test audit device",
+		Options: map[string]string{
+			"file_path": "discard",
+		},
+	}))
+	defer sys.DisableAudit("audit-devices-test")
+
+	d, err := NewVaultAuditDevicesQuery()
+	require.NoError(t, err)
+
+	act, _, err := d.Fetch(testClients, nil)
+	require.NoError(t, err)
+
+	var found *VaultAuditDevice
+	for _, device := range act.([]*VaultAuditDevice) {
+		if device.Path == "audit-devices-test/" {
+			found = device
+		}
+	}
+	require.NotNil(t, found, "audit device not listed")
+	assert.Equal(t, "file", found.Type)
+	assert.Equal(t, "test audit device", found.Description)
+	assert.Equal(t, "discard", found.Options["file_path"])
+
+	t.Run("stops", func(t *testing.T) {
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: 1})
+			errCh <- err
+		}()
+
+		d.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestVaultAuditDevicesQuery_String(t *testing.T) {
+	d, err := NewVaultAuditDevicesQuery()
+	require.NoError(t, err)
+	assert.Equal(t, "vault.auditDevices", d.String())
+}
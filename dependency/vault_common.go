@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +21,21 @@ var (
 	onceVaultDefaultLeaseDuration  sync.Once
 	VaultLeaseRenewalThreshold     float64
 	onceVaultLeaseRenewalThreshold sync.Once
+
+	// VaultLeaseRenewalJitter is the width of the random stagger applied
+	// around VaultLeaseRenewalThreshold for non-renewable secrets.
+	VaultLeaseRenewalJitter     = 0.1
+	onceVaultLeaseRenewalJitter sync.Once
+
+	// VaultLeaseRenewalMinSleep is the minimum amount of time to sleep before
+	// refreshing a non-renewable secret.
+	VaultLeaseRenewalMinSleep     time.Duration
+	onceVaultLeaseRenewalMinSleep sync.Once
+
+	// VaultLeaseRenewalGrace is the fraction of the original lease duration
+	// below which a renewed secret is read again instead.
+	VaultLeaseRenewalGrace     float64
+	onceVaultLeaseRenewalGrace sync.Once
 )
 
 // Secret is the structure returned for every secret within Vault.
@@ -77,11 +93,14 @@ type renewer interface {
 	secrets() (*Secret, *api.Secret)
 }
 
-func renewSecret(clients *ClientSet, d renewer) error {
+// renewSecret keeps the lease of the secret of the dependency renewed until it
+// can no longer be renewed. Renewal failures are reported to the OnRenewError
+// hook of the client of the named Vault cluster.
+func renewSecret(clients *ClientSet, client *api.Client, cluster string, d renewer) error {
 	log.Printf("[TRACE] %s: starting renewer", d)
 
 	secret, vaultSecret := d.secrets()
-	renewer, err := clients.Vault().NewLifetimeWatcher(&api.LifetimeWatcherInput{
+	renewer, err := client.NewLifetimeWatcher(&api.LifetimeWatcherInput{
 		Secret:        vaultSecret,
 		RenewBehavior: api.RenewBehaviorErrorOnErrors,
 	})
@@ -96,6 +115,7 @@ func renewSecret(clients *ClientSet, d renewer) error {
 		case err := <-renewer.DoneCh():
 			if err != nil {
 				log.Printf("[WARN] %s: failed to renew: %s", d, err)
+				clients.vaultRenewError(cluster, d.String(), leaseError(vaultSecret, err))
 			}
 			log.Printf("[WARN] %s: renewer done (maybe the lease expired)", d)
 			return nil
@@ -103,12 +123,92 @@ func renewSecret(clients *ClientSet, d renewer) error {
 			log.Printf("[TRACE] %s: successfully renewed", d)
 			printVaultWarnings(d, renewal.Secret.Warnings)
 			updateSecret(secret, renewal.Secret)
+			if withinRenewalGrace(vaultSecret, renewal.Secret) {
+				log.Printf("[DEBUG] %s: lease duration %ds is within the renewal "+
+					"grace window, reading fresh secret", d, renewal.Secret.LeaseDuration)
+				return nil
+			}
 		case <-d.stopChan():
 			return ErrStopped
 		}
 	}
 }
 
+// leaseError annotates a renewal error with the lease ID of the secret, if it
+// has one.
+func leaseError(secret *api.Secret, err error) error {
+	if secret == nil || secret.LeaseID == "" {
+		return err
+	}
+	return fmt.Errorf("lease %s: %w", secret.LeaseID, err)
+}
+
+// withinRenewalGrace returns whether a renewal of the original secret left a
+// lease shorter than VaultLeaseRenewalGrace of the original lease duration.
+func withinRenewalGrace(original, renewed *api.Secret) bool {
+	if VaultLeaseRenewalGrace <= 0 || original == nil || renewed == nil {
+		return false
+	}
+	origDuration, newDuration := original.LeaseDuration, renewed.LeaseDuration
+	if original.Auth != nil && renewed.Auth != nil {
+		origDuration, newDuration = original.Auth.LeaseDuration, renewed.Auth.LeaseDuration
+	}
+	if origDuration <= 0 {
+		return false
+	}
+	return float64(newDuration) < VaultLeaseRenewalGrace*float64(origDuration)
+}
+
+// splitVaultNamespace splits the optional namespace prefix, separated by "::",
+// from the path of a Vault query, e.g. "ns1/ns2::secret/foo".
+func splitVaultNamespace(s string) (string, string) {
+	namespace, path, ok := strings.Cut(s, "::")
+	if !ok {
+		return "", s
+	}
+	return strings.Trim(strings.TrimSpace(namespace), "/"), path
+}
+
+// splitVaultCluster splits the optional cluster prefix, "@<name>:", from the
+// path of a Vault query, e.g. "@regional:secret/foo".
+func splitVaultCluster(s string) (string, string) {
+	if !strings.HasPrefix(s, "@") {
+		return "", s
+	}
+	cluster, path, ok := strings.Cut(s[1:], ":")
+	if !ok {
+		return "", s
+	}
+	return strings.TrimSpace(cluster), path
+}
+
+// vaultClusterClient returns the Vault client of the named cluster of the set,
+// or of the default cluster if no name is given, sending requests to the
+// given namespace like namespacedVaultClient.
+func vaultClusterClient(clients *ClientSet, cluster, namespace string) (*api.Client, error) {
+	if cluster == "" {
+		return namespacedVaultClient(clients, namespace), nil
+	}
+	client, err := clients.VaultCluster(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		return client, nil
+	}
+	return client.WithNamespace(namespace), nil
+}
+
+// namespacedVaultClient returns the Vault client of the set, sending requests
+// to the given namespace instead of the namespace of the client when one is
+// given. The shared client is not modified.
+func namespacedVaultClient(clients *ClientSet, namespace string) *api.Client {
+	if namespace == "" {
+		return clients.Vault()
+	}
+	return clients.Vault().WithNamespace(namespace)
+}
+
 // leaseCheckWait accepts a secret and returns the recommended amount of
 // time to sleep.
 func leaseCheckWait(s *Secret) time.Duration {
@@ -174,7 +274,7 @@ func leaseCheckWait(s *Secret) time.Duration {
 		// lease as possible. Use a stagger over the configured threshold
 		// fraction of the lease duration so that many clients do not hit
 		// Vault simultaneously.
-		finalFraction := VaultLeaseRenewalThreshold + (rand.Float64()-0.5)*0.1
+		finalFraction := VaultLeaseRenewalThreshold + (rand.Float64()-0.5)*VaultLeaseRenewalJitter
 		if finalFraction >= 1.0 || finalFraction <= 0.0 {
 			// If the fraction randomly winds up outside of (0.0-1.0), clamp
 			// back down to the VaultLeaseRenewalThreshold provided by the user,
@@ -184,6 +284,12 @@ func leaseCheckWait(s *Secret) time.Duration {
 			finalFraction = VaultLeaseRenewalThreshold
 		}
 		sleep = sleep * finalFraction
+
+		// Never refresh more often than the configured floor, so short or
+		// missing leases do not result in a hot loop against Vault.
+		if floor := float64(VaultLeaseRenewalMinSleep); sleep < floor {
+			sleep = floor
+		}
 	}
 
 	return time.Duration(sleep)
@@ -373,3 +479,27 @@ func SetVaultLeaseRenewalThreshold(f float64) {
 	}
 	onceVaultLeaseRenewalThreshold.Do(set)
 }
+
+// Make sure to only set VaultLeaseRenewalJitter once
+func SetVaultLeaseRenewalJitter(f float64) {
+	set := func() {
+		VaultLeaseRenewalJitter = f
+	}
+	onceVaultLeaseRenewalJitter.Do(set)
+}
+
+// Make sure to only set VaultLeaseRenewalMinSleep once
+func SetVaultLeaseRenewalMinSleep(t time.Duration) {
+	set := func() {
+		VaultLeaseRenewalMinSleep = t
+	}
+	onceVaultLeaseRenewalMinSleep.Do(set)
+}
+
+// Make sure to only set VaultLeaseRenewalGrace once
+func SetVaultLeaseRenewalGrace(f float64) {
+	set := func() {
+		VaultLeaseRenewalGrace = f
+	}
+	onceVaultLeaseRenewalGrace.Do(set)
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -120,6 +121,193 @@ func TestVaultRenewDuration(t *testing.T) {
 	})
 }
 
+func TestVaultRenewDuration_jitterAndMinSleep(t *testing.T) {
+	defer func(j float64, m time.Duration) {
+		VaultLeaseRenewalJitter, VaultLeaseRenewalMinSleep = j, m
+	}(VaultLeaseRenewalJitter, VaultLeaseRenewalMinSleep)
+
+	t.Run("no jitter", func(t *testing.T) {
+		VaultLeaseRenewalJitter = 0
+		dur := leaseCheckWait(&Secret{LeaseDuration: 100})
+		if dur != 90*time.Second {
+			t.Fatalf("expected exactly 90%% of lease duration: %s", dur)
+		}
+	})
+
+	t.Run("wide jitter", func(t *testing.T) {
+		VaultLeaseRenewalJitter = 0.4
+		for i := 0; i < 100; i++ {
+			dur := leaseCheckWait(&Secret{LeaseDuration: 100}).Seconds()
+			if dur < 70 || dur >= 100 {
+				t.Fatalf("duration is not within 70%% to 100%% of lease duration: %f", dur)
+			}
+		}
+	})
+
+	t.Run("min sleep", func(t *testing.T) {
+		VaultLeaseRenewalJitter = 0.1
+		VaultLeaseRenewalMinSleep = 30 * time.Second
+
+		if dur := leaseCheckWait(&Secret{LeaseDuration: 10}); dur != 30*time.Second {
+			t.Fatalf("expected the minimum sleep to apply: %s", dur)
+		}
+		if dur := leaseCheckWait(&Secret{}); dur != 30*time.Second {
+			t.Fatalf("expected the minimum sleep to apply without a lease: %s", dur)
+		}
+		if dur := leaseCheckWait(&Secret{LeaseDuration: 100}).Seconds(); dur < 85 || dur > 95 {
+			t.Fatalf("expected longer leases to be unaffected: %f", dur)
+		}
+
+		renewable := leaseCheckWait(&Secret{LeaseDuration: 10, Renewable: true})
+		if renewable >= 30*time.Second {
+			t.Fatalf("expected renewable secrets to be unaffected: %s", renewable)
+		}
+	})
+}
+
+func TestWithinRenewalGrace(t *testing.T) {
+	defer func(g float64) { VaultLeaseRenewalGrace = g }(VaultLeaseRenewalGrace)
+
+	lease := func(d int) *api.Secret { return &api.Secret{LeaseDuration: d} }
+	auth := func(d int) *api.Secret {
+		return &api.Secret{Auth: &api.SecretAuth{LeaseDuration: d}}
+	}
+
+	cases := []struct {
+		name     string
+		grace    float64
+		original *api.Secret
+		renewed  *api.Secret
+		exp      bool
+	}{
+		{"disabled", 0, lease(100), lease(1), false},
+		{"above", 0.2, lease(100), lease(50), false},
+		{"at", 0.2, lease(100), lease(20), false},
+		{"below", 0.2, lease(100), lease(19), true},
+		{"auth_below", 0.2, auth(100), auth(10), true},
+		{"auth_above", 0.2, auth(100), auth(90), false},
+		{"no_lease", 0.2, lease(0), lease(0), false},
+		{"nil", 0.2, nil, lease(10), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			VaultLeaseRenewalGrace = tc.grace
+			if act := withinRenewalGrace(tc.original, tc.renewed); act != tc.exp {
+				t.Errorf("expected %t, got %t", tc.exp, act)
+			}
+		})
+	}
+}
+
+func TestRenewSecret_grace(t *testing.T) {
+	defer func(g float64) { VaultLeaseRenewalGrace = g }(VaultLeaseRenewalGrace)
+	VaultLeaseRenewalGrace = 0.5
+
+	// A renewable lease which can only be renewed up to its maximum TTL
+	d, err := NewVaultWriteQuery("auth/token/create", map[string]interface{}{
+		"ttl":              "6s",
+		"explicit_max_ttl": "10s",
+		"policies":         "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	first, _, err := d.Fetch(testClients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken := first.(*Secret).Auth.ClientToken
+
+	dataCh := make(chan interface{}, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		data, _, err := d.Fetch(testClients, nil)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		dataCh <- data
+	}()
+
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	case data := <-dataCh:
+		if data.(*Secret).Auth.ClientToken == oldToken {
+			t.Fatal("expected a fresh token")
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("renewal did not give up within the grace window")
+	}
+
+	// The fresh token is in hand before the old one expires
+	lookup, err := testClients.Vault().Auth().Token().Lookup(oldToken)
+	if err != nil {
+		t.Fatalf("old token expired before the fresh one was read: %s", err)
+	}
+	if ttl, _ := lookup.TokenTTL(); ttl <= 0 {
+		t.Errorf("old token expired before the fresh one was read: %s", ttl)
+	}
+}
+
+func TestRenewSecret_onRenewError(t *testing.T) {
+	token, err := testClients.Vault().Auth().Token().Create(&api.TokenCreateRequest{
+		TTL:      "30s",
+		Policies: []string{"default"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientToken := token.Auth.ClientToken
+
+	var mu sync.Mutex
+	var paths []string
+	var errs []error
+	clients := NewClientSet()
+	if err := clients.CreateVaultClient(&CreateVaultClientInput{
+		Address: vaultAddr,
+		Token:   clientToken,
+		OnRenewError: func(path string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			paths = append(paths, path)
+			errs = append(errs, err)
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renewing a revoked token fails
+	if err := testClients.Vault().Auth().Token().RevokeTree(clientToken); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewVaultTokenQuery(clientToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	if _, _, err := d.Fetch(clients, nil); err != ErrLeaseExpired {
+		t.Fatalf("expected %q, got %v", ErrLeaseExpired, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != 1 {
+		t.Fatalf("expected the hook to fire once, fired %d times: %v", len(paths), errs)
+	}
+	if paths[0] != d.String() {
+		t.Errorf("expected path %q, got %q", d.String(), paths[0])
+	}
+	if errs[0] == nil {
+		t.Error("expected an error")
+	}
+}
+
 func setupVaultPKI(clients *ClientSet) {
 	err := clients.Vault().Sys().Mount("pki", &api.MountInput{
 		Type: "pki",
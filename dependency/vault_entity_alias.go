@@ -0,0 +1,143 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*VaultEntityAliasQuery)(nil)
+
+	// VaultEntityAliasQuerySleepTime is the amount of time to sleep between
+	// queries, since the endpoint does not support blocking queries.
+	VaultEntityAliasQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+func init() {
+	gob.Register(&VaultEntity{})
+}
+
+// VaultEntity is the Vault identity entity an auth identity maps to.
+type VaultEntity struct {
+	ID       string
+	Name     string
+	Policies []string
+}
+
+// VaultEntityAliasQuery is the dependency to Vault for the entity an alias of
+// an auth mount maps to. The token must be able to update
+// identity/lookup/entity, which is usually only granted to privileged tokens.
+type VaultEntityAliasQuery struct {
+	stopCh chan struct{}
+
+	// mountAccessor is the accessor of the auth mount the alias belongs to,
+	// such as auth_userpass_1a2b3c4d.
+	mountAccessor string
+	name          string
+}
+
+// NewVaultEntityAliasQuery creates a new dependency looking up the entity of
+// the alias with the given name on the auth mount with the given accessor.
+func NewVaultEntityAliasQuery(mountAccessor, name string) (*VaultEntityAliasQuery, error) {
+	mountAccessor = strings.TrimSpace(mountAccessor)
+	if mountAccessor == "" {
+		return nil, fmt.Errorf("vault.entityAlias: missing mount accessor")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("vault.entityAlias: missing alias name")
+	}
+
+	return &VaultEntityAliasQuery{
+		stopCh:        make(chan struct{}, 1),
+		mountAccessor: mountAccessor,
+		name:          name,
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultEntityAliasQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		log.Printf("[TRACE] %s: long polling for %s", d, VaultEntityAliasQuerySleepTime)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(VaultEntityAliasQuerySleepTime):
+		}
+	}
+
+	log.Printf("[TRACE] %s: PUT %s", d, &url.URL{
+		Path:     "/v1/identity/lookup/entity",
+		RawQuery: opts.String(),
+	})
+	secret, err := clients.Vault().Logical().Write("identity/lookup/entity", map[string]interface{}{
+		"alias_name":           d.name,
+		"alias_mount_accessor": d.mountAccessor,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	// Vault responds without a body when no entity has the alias.
+	if secret == nil || secret.Data == nil {
+		log.Printf("[TRACE] %s: no entity", d)
+		return respWithMetadata((*VaultEntity)(nil))
+	}
+
+	entity := &VaultEntity{
+		Policies: []string{},
+	}
+	entity.ID, _ = secret.Data["id"].(string)
+	entity.Name, _ = secret.Data["name"].(string)
+	if policies, ok := secret.Data["policies"].([]interface{}); ok {
+		for _, p := range policies {
+			if s, ok := p.(string); ok {
+				entity.Policies = append(entity.Policies, s)
+			}
+		}
+	}
+
+	log.Printf("[TRACE] %s: returned entity %s", d, entity.ID)
+
+	return respWithMetadata(entity)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultEntityAliasQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultEntityAliasQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultEntityAliasQuery) String() string {
+	return fmt.Sprintf("vault.entityAlias(%s,%s)", d.mountAccessor, d.name)
+}
+
+// Type returns the type of this dependency.
+func (d *VaultEntityAliasQuery) Type() Type {
+	return TypeVault
+}
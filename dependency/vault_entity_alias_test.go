@@ -0,0 +1,182 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	VaultEntityAliasQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestNewVaultEntityAliasQuery(t *testing.T) {
+	cases := []struct {
+		name     string
+		accessor string
+		alias    string
+		exp      *VaultEntityAliasQuery
+		err      bool
+	}{
+		{"empty", "", "", nil, true},
+		{"no_accessor", " ", "alice", nil, true},
+		{"no_alias", "auth_userpass_1234", "", nil, true},
+		{
+			"alias",
+			" auth_userpass_1234 ",
+			"alice",
+			&VaultEntityAliasQuery{mountAccessor: "auth_userpass_1234", name: "alice"},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewVaultEntityAliasQuery(tc.accessor, tc.alias)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if act != nil {
+				act.stopCh = nil
+			}
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestVaultEntityAliasQuery_Fetch(t *testing.T) {
+	vc := testClients.Vault()
+
+	err := vc.Sys().EnableAuth("userpass", "userpass", "")
+	if err != nil && !strings.Contains(err.Error(), "path is already in use") {
+		t.Fatal(err)
+	}
+	auths, err := vc.Sys().ListAuth()
+	require.NoError(t, err)
+	accessor := auths["userpass/"].Accessor
+
+	entity, err := vc.Logical().Write("identity/entity", map[string]interface{}{
+		"name":     "entity-alias-test",
+		"policies": []string{"default", "reader"},
+	})
+	require.NoError(t, err)
+	entityID := entity.Data["id"].(string)
+	defer vc.Logical().Delete("identity/entity/id/" + entityID)
+
+	_, err = vc.Logical().Write("identity/entity-alias", map[string]interface{}{
+		"name":           "alice",
+		"canonical_id":   entityID,
+		"mount_accessor": accessor,
+	})
+	require.NoError(t, err)
+
+	t.Run("alias", func(t *testing.T) {
+		d, err := NewVaultEntityAliasQuery(accessor, "alice")
+		require.NoError(t, err)
+		defer d.Stop()
+
+		act, _, err := d.Fetch(testClients, nil)
+		require.NoError(t, err)
+		assert.Equal(t, &VaultEntity{
+			ID:       entityID,
+			Name:     "entity-alias-test",
+			Policies: []string{"default", "reader"},
+		}, act)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		d, err := NewVaultEntityAliasQuery(accessor, "bob")
+		require.NoError(t, err)
+		defer d.Stop()
+
+		act, _, err := d.Fetch(testClients, nil)
+		require.NoError(t, err)
+		assert.Nil(t, act.(*VaultEntity))
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		d, err := NewVaultEntityAliasQuery(accessor, "alice")
+		require.NoError(t, err)
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: 1})
+			errCh <- err
+		}()
+
+		d.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestVaultEntityAliasQuery_Fetch_Lookup(t *testing.T) {
+	// The lookup is also checked against a fake Vault, to assert the request
+	// made for the alias.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/identity/lookup/entity" {
+			http.NotFound(w, r)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if body["alias_mount_accessor"] != "auth_userpass_1234" || body["alias_name"] != "alice" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {
+			"id": "8d6a45e5-572f-8f13-d226-cd0d1ec57297",
+			"name": "entity_alice",
+			"policies": ["admin", "default"],
+			"aliases": [{"name": "alice", "mount_accessor": "auth_userpass_1234"}]
+		}}`))
+	}))
+	defer srv.Close()
+
+	clients := NewClientSet()
+	require.NoError(t, clients.CreateVaultClient(&CreateVaultClientInput{
+		Address: srv.URL,
+		Token:   "token",
+	}))
+
+	d, err := NewVaultEntityAliasQuery("auth_userpass_1234", "alice")
+	require.NoError(t, err)
+	defer d.Stop()
+
+	act, _, err := d.Fetch(clients, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &VaultEntity{
+		ID:       "8d6a45e5-572f-8f13-d226-cd0d1ec57297",
+		Name:     "entity_alice",
+		Policies: []string{"admin", "default"},
+	}, act)
+
+	d, err = NewVaultEntityAliasQuery("auth_userpass_1234", "bob")
+	require.NoError(t, err)
+	defer d.Stop()
+
+	act, _, err = d.Fetch(clients, nil)
+	require.NoError(t, err)
+	assert.Nil(t, act.(*VaultEntity))
+}
+
+func TestVaultEntityAliasQuery_String(t *testing.T) {
+	d, err := NewVaultEntityAliasQuery("auth_userpass_1234", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "vault.entityAlias(auth_userpass_1234,alice)", d.String())
+}
@@ -0,0 +1,160 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*VaultHostInfoQuery)(nil)
+
+	// VaultHostInfoQuerySleepTime is the amount of time to sleep between
+	// queries, since the endpoint does not support blocking queries.
+	VaultHostInfoQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+func init() {
+	gob.Register(&VaultHostInfo{})
+}
+
+// VaultHostInfo is the CPU, memory and disk information of the host of the
+// Vault node being queried. The CPU times and timestamp are omitted, since
+// they change on every query and would trigger a render each time.
+type VaultHostInfo struct {
+	CPU    []*VaultHostCPU  `json:"cpu"`
+	Memory *VaultHostMemory `json:"memory"`
+	Disk   []*VaultHostDisk `json:"disk"`
+	Host   *VaultHost       `json:"host"`
+}
+
+// VaultHostCPU is a CPU of the host of a Vault node.
+type VaultHostCPU struct {
+	CPU       int32   `json:"cpu"`
+	VendorID  string  `json:"vendorId"`
+	ModelName string  `json:"modelName"`
+	Cores     int32   `json:"cores"`
+	Mhz       float64 `json:"mhz"`
+	CacheSize int32   `json:"cacheSize"`
+}
+
+// VaultHostMemory is the memory usage of the host of a Vault node, in bytes.
+type VaultHostMemory struct {
+	Total       uint64  `json:"total"`
+	Available   uint64  `json:"available"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	UsedPercent float64 `json:"usedPercent"`
+}
+
+// VaultHostDisk is the usage of a disk of the host of a Vault node, in bytes.
+type VaultHostDisk struct {
+	Path        string  `json:"path"`
+	Fstype      string  `json:"fstype"`
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"usedPercent"`
+}
+
+// VaultHost is the operating system of the host of a Vault node.
+type VaultHost struct {
+	Hostname        string `json:"hostname"`
+	OS              string `json:"os"`
+	Platform        string `json:"platform"`
+	PlatformVersion string `json:"platformVersion"`
+	KernelVersion   string `json:"kernelVersion"`
+	BootTime        uint64 `json:"bootTime"`
+}
+
+// VaultHostInfoQuery is the dependency to Vault for the host information of
+// the node being queried. The token must be able to read sys/host-info, which
+// requires a privileged token with the sudo capability.
+type VaultHostInfoQuery struct {
+	stopCh chan struct{}
+}
+
+// NewVaultHostInfoQuery creates a new host info query.
+func NewVaultHostInfoQuery() (*VaultHostInfoQuery, error) {
+	return &VaultHostInfoQuery{
+		stopCh: make(chan struct{}, 1),
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultHostInfoQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		log.Printf("[TRACE] %s: long polling for %s", d, VaultHostInfoQuerySleepTime)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(VaultHostInfoQuerySleepTime):
+		}
+	}
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/sys/host-info",
+		RawQuery: opts.String(),
+	})
+	secret, err := clients.Vault().Logical().Read("sys/host-info")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil, fmt.Errorf("%s: no host information returned", d)
+	}
+
+	// The data is decoded generically, so it is re-encoded to decode it into
+	// the typed host information.
+	b, err := json.Marshal(secret.Data)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+	var info VaultHostInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	log.Printf("[TRACE] %s: returned %d cpus and %d disks", d, len(info.CPU), len(info.Disk))
+
+	return respWithMetadata(&info)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultHostInfoQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultHostInfoQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultHostInfoQuery) String() string {
+	return "vault.hostInfo"
+}
+
+// Type returns the type of this dependency.
+func (d *VaultHostInfoQuery) Type() Type {
+	return TypeVault
+}
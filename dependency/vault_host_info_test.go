@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	VaultHostInfoQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestVaultHostInfoQuery_Fetch(t *testing.T) {
+	d, err := NewVaultHostInfoQuery()
+	require.NoError(t, err)
+
+	act, _, err := d.Fetch(testClients, nil)
+	require.NoError(t, err)
+
+	info := act.(*VaultHostInfo)
+	require.NotEmpty(t, info.CPU)
+	assert.NotZero(t, info.CPU[0].Cores)
+	require.NotNil(t, info.Memory)
+	assert.NotZero(t, info.Memory.Total)
+	require.NotNil(t, info.Host)
+	assert.NotEmpty(t, info.Host.Hostname)
+
+	t.Run("stops", func(t *testing.T) {
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: 1})
+			errCh <- err
+		}()
+
+		d.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestVaultHostInfoQuery_Fetch_Fields(t *testing.T) {
+	// The fields are checked against a fake Vault, since the host of the test
+	// server varies.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/host-info" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {
+			"cpu": [{"cpu": 0, "vendorId": "GenuineIntel", "modelName": "Xeon", "cores": 4, "mhz": 2400.5, "cacheSize": 512}],
+			"cpu_times": [{"cpu": "cpu0", "user": 12.5}],
+			"memory": {"total": 8589934592, "available": 4294967296, "used": 3221225472, "free": 1073741824, "usedPercent": 37.5},
+			"disk": [{"path": "/", "fstype": "ext4", "total": 1000, "free": 400, "used": 600, "usedPercent": 60}],
+			"host": {"hostname": "vault-1", "os": "linux", "platform": "ubuntu", "platformVersion": "22.04", "kernelVersion": "5.15.0", "bootTime": 1700000000},
+			"timestamp": "2024-01-02T03:04:05Z"
+		}}`))
+	}))
+	defer srv.Close()
+
+	clients := NewClientSet()
+	require.NoError(t, clients.CreateVaultClient(&CreateVaultClientInput{
+		Address: srv.URL,
+		Token:   "token",
+	}))
+
+	d, err := NewVaultHostInfoQuery()
+	require.NoError(t, err)
+	defer d.Stop()
+
+	act, _, err := d.Fetch(clients, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, &VaultHostInfo{
+		CPU: []*VaultHostCPU{{
+			VendorID:  "GenuineIntel",
+			ModelName: "Xeon",
+			Cores:     4,
+			Mhz:       2400.5,
+			CacheSize: 512,
+		}},
+		Memory: &VaultHostMemory{
+			Total:       8589934592,
+			Available:   4294967296,
+			Used:        3221225472,
+			Free:        1073741824,
+			UsedPercent: 37.5,
+		},
+		Disk: []*VaultHostDisk{{
+			Path:        "/",
+			Fstype:      "ext4",
+			Total:       1000,
+			Free:        400,
+			Used:        600,
+			UsedPercent: 60,
+		}},
+		Host: &VaultHost{
+			Hostname:        "vault-1",
+			OS:              "linux",
+			Platform:        "ubuntu",
+			PlatformVersion: "22.04",
+			KernelVersion:   "5.15.0",
+			BootTime:        1700000000,
+		},
+	}, act)
+}
+
+func TestVaultHostInfoQuery_String(t *testing.T) {
+	d, err := NewVaultHostInfoQuery()
+	require.NoError(t, err)
+	assert.Equal(t, "vault.hostInfo", d.String())
+}
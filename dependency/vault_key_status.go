@@ -0,0 +1,108 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*VaultKeyStatusQuery)(nil)
+
+	// VaultKeyStatusQuerySleepTime is the amount of time to sleep between
+	// queries, since the endpoint does not support blocking queries.
+	VaultKeyStatusQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+func init() {
+	gob.Register(&VaultKeyStatus{})
+}
+
+// VaultKeyStatus is the status of the Vault barrier encryption key. The
+// number of encryptions performed with the key is not included, as it changes
+// with nearly every request.
+type VaultKeyStatus struct {
+	// Term is the sequential key number, incremented on each rotation.
+	Term int
+
+	// InstallTime is the time the key was installed, in RFC3339 format.
+	InstallTime string
+}
+
+// VaultKeyStatusQuery is the dependency to Vault for the status of the barrier
+// encryption key. The token must be able to read sys/key-status.
+type VaultKeyStatusQuery struct {
+	stopCh chan struct{}
+}
+
+// NewVaultKeyStatusQuery creates a new key status query.
+func NewVaultKeyStatusQuery() (*VaultKeyStatusQuery, error) {
+	return &VaultKeyStatusQuery{
+		stopCh: make(chan struct{}, 1),
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultKeyStatusQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		log.Printf("[TRACE] %s: long polling for %s", d, VaultKeyStatusQuerySleepTime)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(VaultKeyStatusQuerySleepTime):
+		}
+	}
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/sys/key-status",
+		RawQuery: opts.String(),
+	})
+	status, err := clients.Vault().Sys().KeyStatus()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	log.Printf("[TRACE] %s: returned term %d", d, status.Term)
+
+	return respWithMetadata(&VaultKeyStatus{
+		Term:        status.Term,
+		InstallTime: status.InstallTime.UTC().Format(time.RFC3339),
+	})
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultKeyStatusQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultKeyStatusQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultKeyStatusQuery) String() string {
+	return "vault.keyStatus"
+}
+
+// Type returns the type of this dependency.
+func (d *VaultKeyStatusQuery) Type() Type {
+	return TypeVault
+}
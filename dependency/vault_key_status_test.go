@@ -0,0 +1,49 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	VaultKeyStatusQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestVaultKeyStatusQuery_Fetch(t *testing.T) {
+	d, err := NewVaultKeyStatusQuery()
+	require.NoError(t, err)
+
+	act, _, err := d.Fetch(testClients, nil)
+	require.NoError(t, err)
+
+	status := act.(*VaultKeyStatus)
+	assert.Positive(t, status.Term)
+	_, err = time.Parse(time.RFC3339, status.InstallTime)
+	assert.NoError(t, err)
+
+	t.Run("stops", func(t *testing.T) {
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := d.Fetch(testClients, &QueryOptions{WaitIndex: 1})
+			errCh <- err
+		}()
+
+		d.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestVaultKeyStatusQuery_String(t *testing.T) {
+	d, err := NewVaultKeyStatusQuery()
+	require.NoError(t, err)
+	assert.Equal(t, "vault.keyStatus", d.String())
+}
@@ -0,0 +1,116 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*VaultLeaderQuery)(nil)
+
+	// VaultLeaderQuerySleepTime is the amount of time to sleep between
+	// queries, since the endpoint does not support blocking queries.
+	VaultLeaderQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+func init() {
+	gob.Register(&VaultLeader{})
+}
+
+// VaultLeader is the high availability status of the Vault cluster as seen by
+// the node being queried. Fields which change without a leadership change,
+// such as the active time, are omitted.
+type VaultLeader struct {
+	// HAEnabled is true when the storage backend supports high availability.
+	HAEnabled bool
+
+	// IsSelf is true when the queried node is the active node.
+	IsSelf bool
+
+	// LeaderAddress is the API address of the active node.
+	LeaderAddress string
+
+	// LeaderClusterAddress is the cluster address of the active node.
+	LeaderClusterAddress string
+}
+
+// VaultLeaderQuery is the dependency to Vault for the active node of the
+// cluster. The sys/leader endpoint is unauthenticated.
+type VaultLeaderQuery struct {
+	stopCh chan struct{}
+}
+
+// NewVaultLeaderQuery creates a new leader query.
+func NewVaultLeaderQuery() (*VaultLeaderQuery, error) {
+	return &VaultLeaderQuery{
+		stopCh: make(chan struct{}, 1),
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultLeaderQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		log.Printf("[TRACE] %s: long polling for %s", d, VaultLeaderQuerySleepTime)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(VaultLeaderQuerySleepTime):
+		}
+	}
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/sys/leader",
+		RawQuery: opts.String(),
+	})
+	leader, err := clients.Vault().Sys().Leader()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	log.Printf("[TRACE] %s: returned leader %q", d, leader.LeaderAddress)
+
+	return respWithMetadata(&VaultLeader{
+		HAEnabled:            leader.HAEnabled,
+		IsSelf:               leader.IsSelf,
+		LeaderAddress:        leader.LeaderAddress,
+		LeaderClusterAddress: leader.LeaderClusterAddress,
+	})
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultLeaderQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultLeaderQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultLeaderQuery) String() string {
+	return "vault.leader"
+}
+
+// Type returns the type of this dependency.
+func (d *VaultLeaderQuery) Type() Type {
+	return TypeVault
+}
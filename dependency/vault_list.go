@@ -8,35 +8,71 @@ import (
 	"log"
 	"net/url"
 	"path"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-// Ensure implements
-var _ Dependency = (*VaultListQuery)(nil)
+var (
+	// Ensure implements
+	_ Dependency = (*VaultListQuery)(nil)
+
+	// VaultListMaxDepth is the maximum number of nested paths a recursive list
+	// descends into before giving up.
+	VaultListMaxDepth = 32
+)
 
 // VaultListQuery is the dependency to Vault for a secret
 type VaultListQuery struct {
 	stopCh chan struct{}
 
-	path string
+	path      string
+	namespace string
+	recursive bool
 }
 
-// NewVaultListQuery creates a new datacenter dependency.
+// NewVaultListQuery creates a new datacenter dependency. A "recursive=true"
+// query parameter walks the entire tree under the path and lists the leaves.
 func NewVaultListQuery(s string) (*VaultListQuery, error) {
+	namespace, s := splitVaultNamespace(strings.TrimSpace(s))
 	s = strings.TrimSpace(s)
+	s, rawQuery, _ := strings.Cut(s, "?")
 	s = strings.Trim(s, "/")
 	if s == "" {
 		return nil, fmt.Errorf("vault.list: invalid format: %q", s)
 	}
 
-	return &VaultListQuery{
-		stopCh: make(chan struct{}, 1),
-		path:   s,
-	}, nil
+	d := &VaultListQuery{
+		stopCh:    make(chan struct{}, 1),
+		path:      s,
+		namespace: namespace,
+	}
+
+	if rawQuery != "" {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, fmt.Errorf("vault.list: invalid query: %q: %s", rawQuery, err)
+		}
+		supported := []string{"recursive"}
+		for key := range query {
+			if !slices.Contains(supported, key) {
+				return nil, fmt.Errorf("vault.list: invalid query parameter key %q "+
+					"in query %q: supported keys: %s", key, rawQuery, strings.Join(supported, ","))
+			}
+		}
+		if v := query.Get("recursive"); v != "" {
+			d.recursive, err = strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("vault.list: invalid recursive value: %q", v)
+			}
+		}
+	}
+
+	return d, nil
 }
 
 // Fetch queries the Vault API
@@ -65,20 +101,40 @@ func (d *VaultListQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interfac
 
 	// Checking secret engine version. If it's v2, we should shim /metadata/
 	// to secret path if necessary.
-	mountPath, isV2, _ := isKVv2(clients.Vault(), secretsPath)
+	mountPath, isV2, _ := isKVv2(namespacedVaultClient(clients, d.namespace), secretsPath)
 	if isV2 {
 		secretsPath = shimKvV2ListPath(secretsPath, mountPath)
 	}
 
+	var result []string
+	var err error
+	if d.recursive {
+		result, err = d.walk(clients, secretsPath, opts)
+	} else {
+		result, err = d.list(clients, secretsPath, opts)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(result)
+
+	log.Printf("[TRACE] %s: returned %d results", d, len(result))
+
+	return respWithMetadata(result)
+}
+
+// list returns the keys directly under the given path, with a trailing slash
+// on keys which have children of their own.
+func (d *VaultListQuery) list(clients *ClientSet, secretsPath string, opts *QueryOptions) ([]string, error) {
 	// If we got this far, we either didn't have a secret to renew, the secret was
 	// not renewable, or the renewal failed, so attempt a fresh list.
 	log.Printf("[TRACE] %s: LIST %s", d, &url.URL{
 		Path:     "/v1/" + secretsPath,
 		RawQuery: opts.String(),
 	})
-	secret, err := clients.Vault().Logical().List(secretsPath)
+	secret, err := namespacedVaultClient(clients, d.namespace).Logical().List(secretsPath)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, d.String())
+		return nil, errors.Wrap(err, d.String())
 	}
 
 	var result []string
@@ -86,34 +142,84 @@ func (d *VaultListQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interfac
 	// The secret could be nil if it does not exist.
 	if secret == nil || secret.Data == nil {
 		log.Printf("[TRACE] %s: no data", d)
-		return respWithMetadata(result)
+		return result, nil
 	}
 
 	// This is a weird thing that happened once...
 	keys, ok := secret.Data["keys"]
 	if !ok {
 		log.Printf("[TRACE] %s: no keys", d)
-		return respWithMetadata(result)
+		return result, nil
 	}
 
 	list, ok := keys.([]interface{})
 	if !ok {
 		log.Printf("[TRACE] %s: not list", d)
-		return nil, nil, fmt.Errorf("%s: unexpected response", d)
+		return nil, fmt.Errorf("%s: unexpected response", d)
 	}
 
 	for _, v := range list {
 		typed, ok := v.(string)
 		if !ok {
-			return nil, nil, fmt.Errorf("%s: non-string in list", d)
+			return nil, fmt.Errorf("%s: non-string in list", d)
 		}
 		result = append(result, typed)
 	}
-	sort.Strings(result)
 
-	log.Printf("[TRACE] %s: returned %d results", d, len(result))
+	return result, nil
+}
 
-	return respWithMetadata(result)
+// walk lists the tree under the given path depth-first and returns the leaf
+// keys relative to it. The walk is abandoned if the dependency is stopped.
+func (d *VaultListQuery) walk(clients *ClientSet, root string, opts *QueryOptions) ([]string, error) {
+	type entry struct {
+		prefix string
+		depth  int
+	}
+
+	var result []string
+	seen := make(map[string]struct{})
+	stack := []entry{{}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		select {
+		case <-d.stopCh:
+			return nil, ErrStopped
+		default:
+		}
+
+		if e.depth > VaultListMaxDepth {
+			return nil, fmt.Errorf("%s: exceeded maximum depth of %d at %q",
+				d, VaultListMaxDepth, e.prefix)
+		}
+
+		listPath := path.Join(root, e.prefix)
+		if _, ok := seen[listPath]; ok {
+			log.Printf("[WARN] %s: skipping %q, already listed", d, listPath)
+			continue
+		}
+		seen[listPath] = struct{}{}
+
+		keys, err := d.list(clients, listPath, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		// Push in reverse so the keys are visited in the order Vault returned
+		// them.
+		for i := len(keys) - 1; i >= 0; i-- {
+			key := e.prefix + keys[i]
+			if strings.HasSuffix(key, "/") {
+				stack = append(stack, entry{prefix: key, depth: e.depth + 1})
+				continue
+			}
+			result = append(result, key)
+		}
+	}
+
+	return result, nil
 }
 
 // CanShare returns if this dependency is shareable.
@@ -128,7 +234,14 @@ func (d *VaultListQuery) Stop() {
 
 // String returns the human-friendly version of this dependency.
 func (d *VaultListQuery) String() string {
-	return fmt.Sprintf("vault.list(%s)", d.path)
+	path := d.path
+	if d.namespace != "" {
+		path = d.namespace + "::" + path
+	}
+	if d.recursive {
+		return fmt.Sprintf("vault.listRecursive(%s)", path)
+	}
+	return fmt.Sprintf("vault.list(%s)", path)
 }
 
 // Type returns the type of this dependency.
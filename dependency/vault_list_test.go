@@ -5,6 +5,7 @@ package dependency
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,6 +49,45 @@ func TestNewVaultListQuery(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"recursive",
+			"path/?recursive=true",
+			&VaultListQuery{
+				path:      "path",
+				recursive: true,
+			},
+			false,
+		},
+		{
+			"recursive_false",
+			"path?recursive=false",
+			&VaultListQuery{
+				path: "path",
+			},
+			false,
+		},
+		{
+			"namespace",
+			"ns1::path/?recursive=true",
+			&VaultListQuery{
+				path:      "path",
+				namespace: "ns1",
+				recursive: true,
+			},
+			false,
+		},
+		{
+			"recursive_invalid",
+			"path?recursive=yes please",
+			nil,
+			true,
+		},
+		{
+			"unknown_parameter",
+			"path?recursive=true&recusive=true",
+			nil,
+			true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -89,6 +129,12 @@ func TestVaultListQuery_Fetch(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	for _, v := range []*vaultServer{vault, vaultKvV2} {
+		if err := v.CreateSecret("foo/baz/qux", map[string]interface{}{"zip": "zap"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
 	cases := []struct {
 		name    string
 		i       string
@@ -119,6 +165,30 @@ func TestVaultListQuery_Fetch(t *testing.T) {
 			nil,
 			clientsKvV2,
 		},
+		{
+			"recursive",
+			secretsPath + "?recursive=true",
+			[]string{"foo/bar", "foo/baz/qux"},
+			clients,
+		},
+		{
+			"recursive subtree",
+			secretsPath + "/foo/baz?recursive=true",
+			[]string{"qux"},
+			clients,
+		},
+		{
+			"recursive kv-v2",
+			secretsPathV2 + "?recursive=true",
+			[]string{"foo/bar", "foo/baz/qux"},
+			clientsKvV2,
+		},
+		{
+			"recursive no_exist",
+			"not/a/real/path/like/ever?recursive=true",
+			nil,
+			clients,
+		},
 	}
 
 	for i, tc := range cases {
@@ -174,6 +244,33 @@ func TestVaultListQuery_Fetch(t *testing.T) {
 		}
 	})
 
+	t.Run("recursive_max_depth", func(t *testing.T) {
+		defer func(depth int) { VaultListMaxDepth = depth }(VaultListMaxDepth)
+		VaultListMaxDepth = 1
+
+		d, err := NewVaultListQuery(secretsPath + "?recursive=true")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = d.Fetch(clients, nil)
+		if err == nil || !strings.Contains(err.Error(), "exceeded maximum depth") {
+			t.Fatalf("expected maximum depth error, got %v", err)
+		}
+	})
+
+	t.Run("recursive_stops", func(t *testing.T) {
+		d, err := NewVaultListQuery(secretsPath + "?recursive=true")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Stop()
+
+		if _, err := d.walk(clients, secretsPath, &QueryOptions{}); err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+
 	t.Run("fires_changes", func(t *testing.T) {
 		d, err := NewVaultListQuery(secretsPath)
 		if err != nil {
@@ -215,6 +312,16 @@ func TestVaultListQuery_String(t *testing.T) {
 			"path",
 			"vault.list(path)",
 		},
+		{
+			"recursive",
+			"path?recursive=true",
+			"vault.listRecursive(path)",
+		},
+		{
+			"namespace",
+			"ns1::path",
+			"vault.list(ns1::path)",
+		},
 	}
 
 	for i, tc := range cases {
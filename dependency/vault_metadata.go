@@ -0,0 +1,198 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Ensure implements
+var _ Dependency = (*VaultMetadataWatchQuery)(nil)
+
+func init() {
+	gob.Register(&VaultMetadata{})
+}
+
+// VaultMetadata is the version state of a KVv2 secret. Only the state of each
+// version is kept, so that the data changes when a version is added,
+// deleted, undeleted or destroyed, but not when unrelated metadata such as
+// the update time changes.
+type VaultMetadata struct {
+	CurrentVersion int
+	OldestVersion  int
+	Versions       []*VaultMetadataVersion
+}
+
+// VaultMetadataVersion is the deletion and destruction state of a single
+// version of a KVv2 secret.
+type VaultMetadataVersion struct {
+	Version      int
+	Deleted      bool
+	DeletionTime string
+	Destroyed    bool
+}
+
+// VaultMetadataWatchQuery is the dependency to Vault for the version state of
+// a KVv2 secret, read from the metadata endpoint.
+type VaultMetadataWatchQuery struct {
+	stopCh chan struct{}
+
+	path string
+}
+
+// NewVaultMetadataWatchQuery creates a new KVv2 metadata dependency.
+func NewVaultMetadataWatchQuery(s string) (*VaultMetadataWatchQuery, error) {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return nil, fmt.Errorf("vault.metadata: invalid format: %q", s)
+	}
+
+	return &VaultMetadataWatchQuery{
+		stopCh: make(chan struct{}, 1),
+		path:   s,
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultMetadataWatchQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		dur := VaultDefaultLeaseDuration
+		log.Printf("[TRACE] %s: long polling for %s", d, dur)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(dur):
+		}
+	}
+
+	mountPath, isV2, err := isKVv2(clients.Vault(), d.path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+	if !isV2 {
+		return nil, nil, fmt.Errorf("%s: not a KVv2 secrets engine", d)
+	}
+	metadataPath := shimKvV2ListPath(d.path, mountPath)
+
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/" + metadataPath,
+		RawQuery: opts.String(),
+	})
+	secret, err := clients.Vault().Logical().Read(metadataPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	// The secret could be nil if it does not exist.
+	if secret == nil || secret.Data == nil {
+		log.Printf("[TRACE] %s: no data", d)
+		return respWithMetadata(&VaultMetadata{Versions: []*VaultMetadataVersion{}})
+	}
+
+	result, err := parseVaultMetadata(secret.Data)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	log.Printf("[TRACE] %s: returned %d versions", d, len(result.Versions))
+
+	return respWithMetadata(result)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultMetadataWatchQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultMetadataWatchQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultMetadataWatchQuery) String() string {
+	return fmt.Sprintf("vault.metadata(%s)", d.path)
+}
+
+// Type returns the type of this dependency.
+func (d *VaultMetadataWatchQuery) Type() Type {
+	return TypeVault
+}
+
+// parseVaultMetadata converts the response of the KVv2 metadata endpoint into
+// the version state of the secret, sorted by version.
+func parseVaultMetadata(data map[string]interface{}) (*VaultMetadata, error) {
+	var err error
+	result := &VaultMetadata{}
+
+	if result.CurrentVersion, err = vaultInt(data["current_version"]); err != nil {
+		return nil, fmt.Errorf("invalid current_version: %w", err)
+	}
+	if result.OldestVersion, err = vaultInt(data["oldest_version"]); err != nil {
+		return nil, fmt.Errorf("invalid oldest_version: %w", err)
+	}
+
+	versions, _ := data["versions"].(map[string]interface{})
+	result.Versions = make([]*VaultMetadataVersion, 0, len(versions))
+	for k, raw := range versions {
+		version, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", k, err)
+		}
+		v := &VaultMetadataVersion{Version: version}
+		if m, ok := raw.(map[string]interface{}); ok {
+			v.DeletionTime, _ = m["deletion_time"].(string)
+			v.Destroyed, _ = m["destroyed"].(bool)
+		}
+		// Deletion may be scheduled in the future by delete_version_after
+		if t, err := time.Parse(time.RFC3339, v.DeletionTime); err == nil {
+			v.Deleted = time.Now().After(t)
+		}
+		result.Versions = append(result.Versions, v)
+	}
+	sort.Slice(result.Versions, func(i, j int) bool {
+		return result.Versions[i].Version < result.Versions[j].Version
+	})
+
+	return result, nil
+}
+
+// vaultInt converts a number in a Vault response to an int. Missing values
+// are zero.
+func vaultInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err
+	case float64:
+		return int(n), nil
+	case int:
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
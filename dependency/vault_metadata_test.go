@@ -0,0 +1,150 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVaultMetadataWatchQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  *VaultMetadataWatchQuery
+		err  bool
+	}{
+		{
+			"empty",
+			"",
+			nil,
+			true,
+		},
+		{
+			"path",
+			"/secret/foo/",
+			&VaultMetadataWatchQuery{
+				path: "secret/foo",
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewVaultMetadataWatchQuery(tc.i)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestParseVaultMetadata(t *testing.T) {
+	act, err := parseVaultMetadata(map[string]interface{}{
+		"current_version": json.Number("3"),
+		"oldest_version":  json.Number("1"),
+		"updated_time":    "2018-03-22T02:36:43.986212308Z",
+		"versions": map[string]interface{}{
+			"3": map[string]interface{}{
+				"created_time":  "2018-03-22T02:36:43.986212308Z",
+				"deletion_time": "",
+				"destroyed":     false,
+			},
+			"1": map[string]interface{}{
+				"created_time":  "2018-03-22T02:24:06.945319214Z",
+				"deletion_time": "2018-03-22T02:36:33.986212308Z",
+				"destroyed":     false,
+			},
+			"2": map[string]interface{}{
+				"created_time":  "2018-03-22T02:36:33.954880664Z",
+				"deletion_time": "",
+				"destroyed":     true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &VaultMetadata{
+		CurrentVersion: 3,
+		OldestVersion:  1,
+		Versions: []*VaultMetadataVersion{
+			{Version: 1, Deleted: true, DeletionTime: "2018-03-22T02:36:33.986212308Z"},
+			{Version: 2, Destroyed: true},
+			{Version: 3},
+		},
+	}
+	assert.Equal(t, exp, act)
+}
+
+func TestVaultMetadataWatchQuery_Fetch(t *testing.T) {
+	clients, vault := testVaultServer(t, "metadata_watch_fetch", "2")
+	secretsPath := vault.secretsPath
+
+	for _, v := range []string{"bar", "baz"} {
+		if err := vault.CreateSecret("foo", map[string]interface{}{"value": v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := NewVaultMetadataWatchQuery(secretsPath + "/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := func() *VaultMetadata {
+		act, _, err := d.Fetch(clients, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return act.(*VaultMetadata)
+	}
+
+	initial := fetch()
+	assert.Equal(t, 2, initial.CurrentVersion)
+	assert.Len(t, initial.Versions, 2)
+
+	// Fetching again without changes returns the same data
+	assert.Equal(t, initial, fetch())
+
+	vc := clients.Vault()
+	if _, err := vc.Logical().Write(secretsPath+"/delete/foo", map[string]interface{}{
+		"versions": []int{1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	deleted := fetch()
+	assert.NotEqual(t, initial, deleted)
+	assert.True(t, deleted.Versions[0].Deleted)
+	assert.False(t, deleted.Versions[0].Destroyed)
+
+	if _, err := vc.Logical().Write(secretsPath+"/destroy/foo", map[string]interface{}{
+		"versions": []int{1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	destroyed := fetch()
+	assert.NotEqual(t, deleted, destroyed)
+	assert.True(t, destroyed.Versions[0].Destroyed)
+	assert.Equal(t, 2, destroyed.CurrentVersion)
+}
+
+func TestVaultMetadataWatchQuery_String(t *testing.T) {
+	d, err := NewVaultMetadataWatchQuery("secret/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "vault.metadata(secret/foo)", d.String())
+}
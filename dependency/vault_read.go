@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,17 +25,34 @@ type VaultReadQuery struct {
 	sleepCh chan time.Duration
 
 	rawPath     string
+	namespace   string
+	cluster     string
 	queryValues url.Values
 	secret      *Secret
 	isKVv2      *bool
+	mountPath   string
 	secretPath  string
 
+	// field is the key of the secret data to return instead of the whole
+	// secret, from the "field" query parameter.
+	field string
+
+	// relativeVersion is the negative version requested for a KVv2 secret,
+	// relative to its current version, e.g. -1 for the previous version.
+	relativeVersion int
+
+	// allowDeleted returns the metadata of a soft-deleted KVv2 secret instead
+	// of an error, from the "allow_deleted" query parameter.
+	allowDeleted bool
+
 	// vaultSecret is the actual Vault secret which we are renewing
 	vaultSecret *api.Secret
 }
 
 // NewVaultReadQuery creates a new datacenter dependency.
 func NewVaultReadQuery(s string) (*VaultReadQuery, error) {
+	cluster, s := splitVaultCluster(strings.TrimSpace(s))
+	namespace, s := splitVaultNamespace(strings.TrimSpace(s))
 	s = strings.TrimSpace(s)
 	s = strings.Trim(s, "/")
 	if s == "" {
@@ -46,12 +64,33 @@ func NewVaultReadQuery(s string) (*VaultReadQuery, error) {
 		return nil, err
 	}
 
-	return &VaultReadQuery{
+	d := &VaultReadQuery{
 		stopCh:      make(chan struct{}, 1),
 		sleepCh:     make(chan time.Duration, 1),
 		rawPath:     secretURL.Path,
+		namespace:   namespace,
+		cluster:     cluster,
 		queryValues: secretURL.Query(),
-	}, nil
+	}
+	if v, err := strconv.Atoi(d.queryValues.Get("version")); err == nil && v < 0 {
+		d.relativeVersion = v
+	}
+	// The field is selected from the response rather than sent to Vault
+	if d.queryValues.Has("field") {
+		d.field = d.queryValues.Get("field")
+		d.queryValues.Del("field")
+		if d.field == "" {
+			return nil, fmt.Errorf("vault.read: empty field in %q", s)
+		}
+	}
+	if d.queryValues.Has("allow_deleted") {
+		d.allowDeleted, err = strconv.ParseBool(d.queryValues.Get("allow_deleted"))
+		if err != nil {
+			return nil, fmt.Errorf("vault.read: invalid allow_deleted value in %q", s)
+		}
+		d.queryValues.Del("allow_deleted")
+	}
+	return d, nil
 }
 
 // Fetch queries the Vault API
@@ -76,7 +115,10 @@ func (d *VaultReadQuery) Fetch(clients *ClientSet, opts *QueryOptions,
 	firstRun := d.secret == nil
 
 	if !firstRun && vaultSecretRenewable(d.secret) {
-		err := renewSecret(clients, d)
+		vaultClient, err := vaultClusterClient(clients, d.cluster, d.namespace)
+		if err == nil {
+			err = renewSecret(clients, vaultClient, d.cluster, d)
+		}
 		if err != nil {
 			return nil, nil, errors.Wrap(err, d.String())
 		}
@@ -93,9 +135,37 @@ func (d *VaultReadQuery) Fetch(clients *ClientSet, opts *QueryOptions,
 		d.sleepCh <- dur
 	}
 
+	if d.field != "" {
+		value, err := d.selectField()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, d.String())
+		}
+		return respWithMetadata(value)
+	}
+
 	return respWithMetadata(d.secret)
 }
 
+// selectField returns the value of the requested field of the secret as a
+// string. The data of KVv2 secrets is nested, so it is unwrapped first.
+func (d *VaultReadQuery) selectField() (string, error) {
+	data := d.secret.Data
+	if d.isKVv2 != nil && *d.isKVv2 {
+		if nested, ok := data["data"].(map[string]interface{}); ok {
+			data = nested
+		}
+	}
+
+	value, ok := data[d.field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found in secret at %s", d.field, d.rawPath)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
 func (d *VaultReadQuery) fetchSecret(clients *ClientSet) error {
 	vaultSecret, err := d.readSecret(clients)
 	if err == nil {
@@ -103,10 +173,42 @@ func (d *VaultReadQuery) fetchSecret(clients *ClientSet) error {
 		d.vaultSecret = vaultSecret
 		// the cloned secret which will be exposed to the template
 		d.secret = transformSecret(vaultSecret)
+		// Responses from the KVv2 subkeys endpoint expose the structure of
+		// the secret directly, the same way KVv1 secrets expose their data.
+		if subkeys, ok := kvV2Subkeys(vaultSecret); ok && *d.isKVv2 {
+			d.secret.Data = subkeys
+		} else if custom, ok := kvV2CustomMetadata(vaultSecret); ok && *d.isKVv2 {
+			d.secret.Data = make(map[string]interface{}, len(vaultSecret.Data)+1)
+			for k, v := range vaultSecret.Data {
+				d.secret.Data[k] = v
+			}
+			d.secret.Data["custom_metadata"] = custom
+		}
 	}
 	return err
 }
 
+// kvV2CustomMetadata returns the custom metadata of a KVv2 secret, which is
+// nested within its metadata, if it has any.
+func kvV2CustomMetadata(s *api.Secret) (map[string]interface{}, bool) {
+	md, ok := s.Data["metadata"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	custom, ok := md["custom_metadata"].(map[string]interface{})
+	return custom, ok && len(custom) > 0
+}
+
+// kvV2Subkeys returns the subkeys of a response from the KVv2 subkeys
+// endpoint, which have a nil value for each leaf key of the secret.
+func kvV2Subkeys(s *api.Secret) (map[string]interface{}, bool) {
+	if _, ok := s.Data["data"]; ok {
+		return nil, false
+	}
+	subkeys, ok := s.Data["subkeys"].(map[string]interface{})
+	return subkeys, ok
+}
+
 func (d *VaultReadQuery) stopChan() chan struct{} {
 	return d.stopCh
 }
@@ -127,10 +229,23 @@ func (d *VaultReadQuery) Stop() {
 
 // String returns the human-friendly version of this dependency.
 func (d *VaultReadQuery) String() string {
+	s := d.rawPath
 	if v := d.queryValues["version"]; len(v) > 0 {
-		return fmt.Sprintf("vault.read(%s.v%s)", d.rawPath, v[0])
+		s = fmt.Sprintf("%s.v%s", s, v[0])
+	}
+	if d.field != "" {
+		s = s + "#" + d.field
+	}
+	if d.allowDeleted {
+		s = s + "@allow_deleted"
+	}
+	if d.namespace != "" {
+		s = d.namespace + "::" + s
+	}
+	if d.cluster != "" {
+		s = "@" + d.cluster + ":" + s
 	}
-	return fmt.Sprintf("vault.read(%s)", d.rawPath)
+	return fmt.Sprintf("vault.read(%s)", s)
 }
 
 // Type returns the type of this dependency.
@@ -139,7 +254,10 @@ func (d *VaultReadQuery) Type() Type {
 }
 
 func (d *VaultReadQuery) readSecret(clients *ClientSet) (*api.Secret, error) {
-	vaultClient := clients.Vault()
+	vaultClient, err := vaultClusterClient(clients, d.cluster, d.namespace)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check whether this secret refers to a KV v2 entry if we haven't yet.
 	if d.isKVv2 == nil {
@@ -150,30 +268,102 @@ func (d *VaultReadQuery) readSecret(clients *ClientSet) (*api.Secret, error) {
 			isKVv2 = false
 			d.secretPath = d.rawPath
 		} else if isKVv2 {
-			d.secretPath = shimKVv2Path(d.rawPath, mountPath, clients.Vault().Namespace())
+			d.mountPath = mountPath
+			d.secretPath = shimKVv2Path(d.rawPath, mountPath, vaultClient.Namespace())
 		} else {
 			d.secretPath = d.rawPath
 		}
 		d.isKVv2 = &isKVv2
 	}
 
-	queryString := d.queryValues.Encode()
+	queryValues := d.queryValues
+	if d.relativeVersion < 0 {
+		version, err := d.resolveVersion(clients)
+		if err != nil {
+			return nil, err
+		}
+		queryValues = make(url.Values, len(d.queryValues))
+		for k, v := range d.queryValues {
+			queryValues[k] = v
+		}
+		queryValues.Set("version", strconv.Itoa(version))
+	}
+
+	queryString := queryValues.Encode()
 
 	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
 		Path:     "/v1/" + d.secretPath,
 		RawQuery: queryString,
 	})
 	vaultSecret, err := vaultClient.Logical().ReadWithData(d.secretPath,
-		d.queryValues)
+		queryValues)
 	if err != nil {
 		return nil, errors.Wrap(err, d.String())
 	}
+	if vaultSecret != nil && deletedKVv2(vaultSecret) && d.allowDeleted {
+		return d.readDeleted(vaultClient)
+	}
 	if vaultSecret == nil || deletedKVv2(vaultSecret) {
 		return nil, fmt.Errorf("no secret exists at %s", d.secretPath)
 	}
 	return vaultSecret, nil
 }
 
+// readDeleted returns the metadata of a soft-deleted KVv2 secret, including
+// its version history, marked with "is_deleted".
+func (d *VaultReadQuery) readDeleted(vaultClient *api.Client) (*api.Secret, error) {
+	metadataPath := shimKvV2ListPath(d.rawPath, d.mountPath)
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path: "/v1/" + metadataPath,
+	})
+	metadata, err := vaultClient.Logical().Read(metadataPath)
+	if err != nil {
+		return nil, errors.Wrap(err, d.String())
+	}
+	if metadata == nil || metadata.Data == nil {
+		return nil, fmt.Errorf("no secret exists at %s", d.secretPath)
+	}
+	metadata.Data["is_deleted"] = true
+	return metadata, nil
+}
+
+// resolveVersion returns the absolute version of a KVv2 secret requested
+// relative to its current version, which is read from the metadata endpoint.
+func (d *VaultReadQuery) resolveVersion(clients *ClientSet) (int, error) {
+	if !*d.isKVv2 {
+		return 0, fmt.Errorf("relative version %d requires a KVv2 secrets engine",
+			d.relativeVersion)
+	}
+
+	metadataPath := shimKvV2ListPath(d.rawPath, d.mountPath)
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path: "/v1/" + metadataPath,
+	})
+	vaultClient, err := vaultClusterClient(clients, d.cluster, d.namespace)
+	if err != nil {
+		return 0, err
+	}
+	metadata, err := vaultClient.Logical().Read(metadataPath)
+	if err != nil {
+		return 0, errors.Wrap(err, d.String())
+	}
+	if metadata == nil || metadata.Data == nil {
+		return 0, fmt.Errorf("no secret exists at %s", d.secretPath)
+	}
+
+	current, err := vaultInt(metadata.Data["current_version"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid current_version: %w", err)
+	}
+
+	version := current + d.relativeVersion
+	if version < 1 {
+		return 0, fmt.Errorf("relative version %d of current version %d is "+
+			"less than 1", d.relativeVersion, current)
+	}
+	return version, nil
+}
+
 func deletedKVv2(s *api.Secret) bool {
 	switch md := s.Data["metadata"].(type) {
 	case map[string]interface{}:
@@ -0,0 +1,186 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Ensure implements
+var _ Dependency = (*VaultReadMultiQuery)(nil)
+
+func init() {
+	gob.Register(&VaultReadMultiResult{})
+}
+
+// VaultReadMultiResult is the result of reading a batch of secrets. Secrets
+// that could not be read are absent from Secrets and have their error in
+// Errors, keyed by the same path.
+type VaultReadMultiResult struct {
+	Secrets map[string]*Secret
+	Errors  map[string]string
+}
+
+// VaultReadMultiQuery is the dependency to Vault for a batch of secrets which
+// are read concurrently and refreshed together.
+type VaultReadMultiQuery struct {
+	stopCh  chan struct{}
+	sleepCh chan time.Duration
+
+	// paths are the paths as given, which key the result, and queries are
+	// the reads of each path.
+	paths   []string
+	queries []*VaultReadQuery
+}
+
+// NewVaultReadMultiQuery creates a new dependency reading each of the given
+// paths. Paths accept the same syntax as vault.read except for the field
+// query parameter.
+func NewVaultReadMultiQuery(paths []string) (*VaultReadMultiQuery, error) {
+	d := &VaultReadMultiQuery{
+		stopCh:  make(chan struct{}, 1),
+		sleepCh: make(chan time.Duration, 1),
+	}
+
+	seen := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+
+		q, err := NewVaultReadQuery(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "vault.readMulti")
+		}
+		if q.field != "" {
+			return nil, fmt.Errorf("vault.readMulti: field is not supported in %q", p)
+		}
+		d.paths = append(d.paths, p)
+		d.queries = append(d.queries, q)
+	}
+
+	if len(d.queries) == 0 {
+		return nil, fmt.Errorf("vault.readMulti: no paths given")
+	}
+	return d, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultReadMultiQuery) Fetch(clients *ClientSet, opts *QueryOptions,
+) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+	select {
+	case dur := <-d.sleepCh:
+		select {
+		case <-time.After(dur):
+			break
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		}
+	default:
+	}
+
+	errs := make([]error, len(d.queries))
+	var wg sync.WaitGroup
+	for i, q := range d.queries {
+		wg.Add(1)
+		go func(i int, q *VaultReadQuery) {
+			defer wg.Done()
+			errs[i] = d.refresh(clients, q)
+		}(i, q)
+	}
+	wg.Wait()
+
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	result := &VaultReadMultiResult{
+		Secrets: make(map[string]*Secret, len(d.queries)),
+		Errors:  make(map[string]string),
+	}
+
+	// The whole batch is refreshed when its earliest secret needs to be
+	// renewed or read again.
+	var sleep time.Duration
+	for i, q := range d.queries {
+		if errs[i] != nil {
+			log.Printf("[WARN] %s: failed to read %s: %s", d, d.paths[i], errs[i])
+			result.Errors[d.paths[i]] = errs[i].Error()
+			continue
+		}
+		result.Secrets[d.paths[i]] = q.secret
+		if dur := leaseCheckWait(q.secret); sleep == 0 || dur < sleep {
+			sleep = dur
+		}
+	}
+
+	if len(result.Secrets) == 0 {
+		return nil, nil, errors.Wrap(errs[0], d.String())
+	}
+
+	log.Printf("[TRACE] %s: read %d of %d secrets, set sleep for %s",
+		d, len(result.Secrets), len(d.queries), sleep)
+	d.sleepCh <- sleep
+
+	return respWithMetadata(result)
+}
+
+// refresh renews the lease of a previously read secret of the batch when it
+// is renewable, or reads it again otherwise or if the renewal fails.
+func (d *VaultReadMultiQuery) refresh(clients *ClientSet, q *VaultReadQuery) error {
+	if q.secret != nil && vaultSecretRenewable(q.secret) && q.secret.LeaseID != "" {
+		log.Printf("[TRACE] %s: PUT /v1/sys/leases/renew (%s)", q, q.secret.LeaseID)
+		client, err := vaultClusterClient(clients, q.cluster, q.namespace)
+		if err != nil {
+			return err
+		}
+		renewal, err := client.Sys().Renew(q.secret.LeaseID, 0)
+		if err == nil && renewal != nil {
+			printVaultWarnings(q, renewal.Warnings)
+			updateSecret(q.secret, renewal)
+			return nil
+		}
+		if err != nil {
+			clients.vaultRenewError(q.cluster, q.String(), leaseError(q.vaultSecret, err))
+		}
+		log.Printf("[WARN] %s: failed to renew, reading again: %v", q, err)
+	}
+	return q.fetchSecret(clients)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultReadMultiQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultReadMultiQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultReadMultiQuery) String() string {
+	return fmt.Sprintf("vault.readMulti(%s)", strings.Join(d.paths, ","))
+}
+
+// Type returns the type of this dependency.
+func (d *VaultReadMultiQuery) Type() Type {
+	return TypeVault
+}
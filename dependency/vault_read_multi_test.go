@@ -0,0 +1,218 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVaultReadMultiQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    []string
+		exp  []string
+		err  bool
+	}{
+		{
+			"empty",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"empty_path",
+			[]string{"secret/foo", ""},
+			nil,
+			true,
+		},
+		{
+			"field",
+			[]string{"secret/foo?field=bar"},
+			nil,
+			true,
+		},
+		{
+			"paths",
+			[]string{"secret/foo", " secret/bar "},
+			[]string{"secret/foo", "secret/bar"},
+			false,
+		},
+		{
+			"duplicates",
+			[]string{"secret/foo", "secret/foo"},
+			[]string{"secret/foo"},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewVaultReadMultiQuery(tc.i)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.exp, act.paths)
+			assert.Len(t, act.queries, len(tc.exp))
+		})
+	}
+}
+
+func TestVaultReadMultiQuery_Fetch(t *testing.T) {
+	clients, vault := testVaultServer(t, "read_multi_fetch", "1")
+	secretsPath := vault.secretsPath
+	if err := clients.Vault().Sys().TuneMount(secretsPath, api.MountConfigInput{
+		Options: map[string]string{
+			"version": "1",
+		},
+	}); err != nil {
+		t.Fatalf("Error tuning secrets engine: %s", err)
+	}
+
+	for _, k := range []string{"foo", "bar"} {
+		if err := vault.CreateSecret(k, map[string]interface{}{
+			"ttl":   "1h",
+			"value": k,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("all", func(t *testing.T) {
+		d, err := NewVaultReadMultiQuery([]string{
+			secretsPath + "/foo",
+			secretsPath + "/bar",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		act, _, err := d.Fetch(clients, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := act.(*VaultReadMultiResult)
+		assert.Empty(t, result.Errors)
+		assert.Len(t, result.Secrets, 2)
+		for _, k := range []string{"foo", "bar"} {
+			s := result.Secrets[secretsPath+"/"+k]
+			if s == nil {
+				t.Fatalf("missing secret %q: %#v", k, result.Secrets)
+			}
+			assert.Equal(t, k, s.Data["value"])
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		d, err := NewVaultReadMultiQuery([]string{
+			secretsPath + "/foo",
+			secretsPath + "/nope",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		act, _, err := d.Fetch(clients, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := act.(*VaultReadMultiResult)
+		assert.Len(t, result.Secrets, 1)
+		assert.Contains(t, result.Secrets, secretsPath+"/foo")
+		assert.Len(t, result.Errors, 1)
+		assert.Contains(t, result.Errors[secretsPath+"/nope"], "no secret exists")
+	})
+
+	t.Run("none", func(t *testing.T) {
+		d, err := NewVaultReadMultiQuery([]string{
+			secretsPath + "/nope",
+			secretsPath + "/nada",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := d.Fetch(clients, nil); err == nil {
+			t.Fatal("expected an error when no secret can be read")
+		}
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		d, err := NewVaultReadMultiQuery([]string{secretsPath + "/foo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dataCh := make(chan interface{}, 1)
+		errCh := make(chan error, 1)
+		go func() {
+			for {
+				data, _, err := d.Fetch(clients, nil)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				select {
+				case dataCh <- data:
+				case <-d.stopCh:
+				}
+			}
+		}()
+
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-dataCh:
+		}
+
+		d.Stop()
+
+		select {
+		case err := <-errCh:
+			if err != ErrStopped {
+				t.Fatal(err)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Errorf("did not stop")
+		}
+	})
+}
+
+func TestVaultReadMultiQuery_String(t *testing.T) {
+	cases := []struct {
+		name string
+		i    []string
+		exp  string
+	}{
+		{
+			"path",
+			[]string{"path"},
+			"vault.readMulti(path)",
+		},
+		{
+			"paths",
+			[]string{"foo?version=2", "ns1::bar"},
+			"vault.readMulti(foo?version=2,ns1::bar)",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewVaultReadMultiQuery(tc.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.exp, d.String())
+		})
+	}
+}
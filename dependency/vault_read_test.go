@@ -4,7 +4,10 @@
 package dependency
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
@@ -57,6 +60,48 @@ func TestNewVaultReadQuery(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"namespace",
+			"ns1/ns2/::secret/foo?version=3",
+			&VaultReadQuery{
+				rawPath:   "secret/foo",
+				namespace: "ns1/ns2",
+				queryValues: url.Values{
+					"version": []string{"3"},
+				},
+			},
+			false,
+		},
+		{
+			"cluster",
+			"@regional:secret/foo",
+			&VaultReadQuery{
+				rawPath:     "secret/foo",
+				cluster:     "regional",
+				queryValues: url.Values{},
+			},
+			false,
+		},
+		{
+			"cluster_namespace",
+			"@regional:ns1::secret/foo",
+			&VaultReadQuery{
+				rawPath:     "secret/foo",
+				namespace:   "ns1",
+				cluster:     "regional",
+				queryValues: url.Values{},
+			},
+			false,
+		},
+		{
+			"empty_namespace",
+			"::secret/foo",
+			&VaultReadQuery{
+				rawPath:     "secret/foo",
+				queryValues: url.Values{},
+			},
+			false,
+		},
 		{
 			"query_param",
 			"path?version=3",
@@ -68,6 +113,52 @@ func TestNewVaultReadQuery(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"relative_version",
+			"path?version=-1",
+			&VaultReadQuery{
+				rawPath: "path",
+				queryValues: url.Values{
+					"version": []string{"-1"},
+				},
+				relativeVersion: -1,
+			},
+			false,
+		},
+		{
+			"field",
+			"path?version=3&field=password",
+			&VaultReadQuery{
+				rawPath: "path",
+				queryValues: url.Values{
+					"version": []string{"3"},
+				},
+				field: "password",
+			},
+			false,
+		},
+		{
+			"empty_field",
+			"path?field=",
+			nil,
+			true,
+		},
+		{
+			"allow_deleted",
+			"path?allow_deleted=true",
+			&VaultReadQuery{
+				rawPath:      "path",
+				queryValues:  url.Values{},
+				allowDeleted: true,
+			},
+			false,
+		},
+		{
+			"invalid_allow_deleted",
+			"path?allow_deleted=maybe",
+			nil,
+			true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -125,6 +216,24 @@ func TestVaultReadQuery_Fetch_KVv1(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"relative_version",
+			secretsPath + "/foo/bar?version=-1",
+			nil,
+			true,
+		},
+		{
+			"field",
+			secretsPath + "/foo/bar?field=zip",
+			"zap",
+			false,
+		},
+		{
+			"missing_field",
+			secretsPath + "/foo/bar?field=nope",
+			nil,
+			true,
+		},
 		{
 			"no_exist",
 			"not/a/real/path/like/ever",
@@ -145,17 +254,67 @@ func TestVaultReadQuery_Fetch_KVv1(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			if act != nil {
-				act.(*Secret).RequestID = ""
-				act.(*Secret).LeaseID = ""
-				act.(*Secret).LeaseDuration = 0
-				act.(*Secret).Renewable = false
+			if act, ok := act.(*Secret); ok {
+				act.RequestID = ""
+				act.LeaseID = ""
+				act.LeaseDuration = 0
+				act.Renewable = false
 			}
 
 			assert.Equal(t, tc.exp, act)
 		})
 	}
 
+	t.Run("read_deleted_allowed", func(t *testing.T) {
+		path := "data/foo/zed-allowed"
+		err = vault.CreateSecret(path, map[string]interface{}{
+			"zip": "zap",
+		})
+		require.NoError(t, err)
+		err = vault.CreateSecret(path, map[string]interface{}{
+			"zip": "zop",
+		})
+		require.NoError(t, err)
+		err = vault.deleteSecret(path)
+		require.NoError(t, err)
+
+		d, err := NewVaultReadQuery(vault.secretsPath + "/" + path + "?allow_deleted=true")
+		require.NoError(t, err)
+
+		act, _, err := d.Fetch(clients, nil)
+		require.NoError(t, err)
+
+		data := act.(*Secret).Data
+		assert.Equal(t, true, data["is_deleted"])
+		assert.Equal(t, "2", fmt.Sprint(data["current_version"]))
+		versions := data["versions"].(map[string]interface{})
+		assert.Len(t, versions, 2)
+		latest := versions["2"].(map[string]interface{})
+		assert.NotEmpty(t, latest["deletion_time"])
+
+		t.Run("field", func(t *testing.T) {
+			d, err := NewVaultReadQuery(vault.secretsPath + "/" + path +
+				"?allow_deleted=true&field=current_version")
+			require.NoError(t, err)
+
+			act, _, err := d.Fetch(clients, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "2", act)
+		})
+
+		t.Run("not_deleted", func(t *testing.T) {
+			d, err := NewVaultReadQuery(secretsPath + "/foo/bar?allow_deleted=true")
+			require.NoError(t, err)
+
+			act, _, err := d.Fetch(clients, nil)
+			require.NoError(t, err)
+
+			data := act.(*Secret).Data
+			assert.NotContains(t, data, "is_deleted")
+			assert.Equal(t, "zop", data["data"].(map[string]interface{})["zip"])
+		})
+	})
+
 	t.Run("stops", func(t *testing.T) {
 		d, err := NewVaultReadQuery(secretsPath + "/foo/bar")
 		if err != nil {
@@ -257,6 +416,38 @@ func TestVaultReadQuery_Fetch_KVv1(t *testing.T) {
 			t.Fatalf("duration of sleep should be > 0")
 		}
 	})
+
+	t.Run("nonrenewable-sleeper-min-sleep", func(t *testing.T) {
+		const floor = 50 * time.Millisecond
+		VaultLeaseRenewalMinSleep = floor
+		defer func() { VaultLeaseRenewalMinSleep = 0 }()
+
+		d, err := NewVaultReadQuery(secretsPath + "/foo/bar")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, qm, err := d.Fetch(clients, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		if _, _, err := d.Fetch(clients,
+			&QueryOptions{WaitIndex: qm.LastIndex}); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < floor {
+			t.Fatalf("expected fetch to sleep at least %s, slept %s", floor, elapsed)
+		}
+
+		if len(d.sleepCh) != 1 {
+			t.Fatalf("sleep channel has len %v, expected 1", len(d.sleepCh))
+		}
+		if dur := <-d.sleepCh; dur < floor {
+			t.Fatalf("duration of sleep %s should be at least %s", dur, floor)
+		}
+	})
 }
 
 func TestVaultReadQuery_Fetch_KVv2(t *testing.T) {
@@ -335,6 +526,43 @@ func TestVaultReadQuery_Fetch_KVv2(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"version=-1",
+			secretsPath + "/foo/bar?version=-1",
+			&Secret{
+				Data: map[string]interface{}{
+					"data": map[string]interface{}{
+						"ttl": "100ms", // explicitly make this a short duration for testing
+						"zip": "zap",
+					},
+				},
+			},
+			false,
+		},
+		{
+			"version=-2",
+			secretsPath + "/foo/bar?version=-2",
+			nil,
+			true,
+		},
+		{
+			"field",
+			secretsPath + "/foo/bar?field=zip",
+			"zop",
+			false,
+		},
+		{
+			"field_version",
+			secretsPath + "/foo/bar?version=1&field=zip",
+			"zap",
+			false,
+		},
+		{
+			"missing_field",
+			secretsPath + "/foo/bar?field=nope",
+			nil,
+			true,
+		},
 		{
 			"/data in path and in prefix",
 			secretsPath + "/data/datafoo/bar",
@@ -381,12 +609,12 @@ func TestVaultReadQuery_Fetch_KVv2(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			if act != nil {
-				act.(*Secret).RequestID = ""
-				act.(*Secret).LeaseID = ""
-				act.(*Secret).LeaseDuration = 0
-				act.(*Secret).Renewable = false
-				tc.exp.(*Secret).Data["metadata"] = act.(*Secret).Data["metadata"]
+			if act, ok := act.(*Secret); ok {
+				act.RequestID = ""
+				act.LeaseID = ""
+				act.LeaseDuration = 0
+				act.Renewable = false
+				tc.exp.(*Secret).Data["metadata"] = act.Data["metadata"]
 			}
 
 			assert.Equal(t, tc.exp, act)
@@ -405,6 +633,79 @@ func TestVaultReadQuery_Fetch_KVv2(t *testing.T) {
 		assert.Len(t, versions, 2)
 	})
 
+	t.Run("read_custom_metadata", func(t *testing.T) {
+		err := vault.CreateSecret("data/foo/tagged", map[string]interface{}{
+			"zip": "zop",
+		})
+		require.NoError(t, err)
+		_, err = clients.Vault().Logical().Write(secretsPath+"/metadata/foo/tagged",
+			map[string]interface{}{
+				"custom_metadata": map[string]interface{}{
+					"owner":           "team-a",
+					"rotation-policy": "90d",
+				},
+			})
+		require.NoError(t, err)
+
+		d, err := NewVaultReadQuery(secretsPath + "/foo/tagged")
+		require.NoError(t, err)
+
+		act, _, err := d.Fetch(clients, nil)
+		require.NoError(t, err)
+
+		exp := map[string]interface{}{
+			"owner":           "team-a",
+			"rotation-policy": "90d",
+		}
+		data := act.(*Secret).Data
+		assert.Equal(t, exp, data["custom_metadata"])
+		assert.Equal(t, exp, data["metadata"].(map[string]interface{})["custom_metadata"])
+		assert.Equal(t, map[string]interface{}{"zip": "zop"}, data["data"])
+	})
+
+	t.Run("read_subkeys", func(t *testing.T) {
+		err := vault.CreateSecret("data/foo/multi", map[string]interface{}{
+			"username": "admin",
+			"password": "hunter2",
+			"tls": map[string]interface{}{
+				"cert": "CERT",
+				"key":  "KEY",
+			},
+		})
+		require.NoError(t, err)
+
+		d, err := NewVaultReadQuery(secretsPath + "/subkeys/foo/multi")
+		require.NoError(t, err)
+
+		act, _, err := d.Fetch(clients, nil)
+		require.NoError(t, err)
+
+		exp := map[string]interface{}{
+			"username": nil,
+			"password": nil,
+			"tls": map[string]interface{}{
+				"cert": nil,
+				"key":  nil,
+			},
+		}
+		assert.Equal(t, exp, act.(*Secret).Data)
+
+		t.Run("depth", func(t *testing.T) {
+			d, err := NewVaultReadQuery(secretsPath + "/subkeys/foo/multi?depth=1")
+			require.NoError(t, err)
+
+			act, _, err := d.Fetch(clients, nil)
+			require.NoError(t, err)
+
+			exp := map[string]interface{}{
+				"username": nil,
+				"password": nil,
+				"tls":      nil,
+			}
+			assert.Equal(t, exp, act.(*Secret).Data)
+		})
+	})
+
 	t.Run("read_deleted", func(t *testing.T) {
 		// only needed for KVv2 as KVv1 doesn't have metadata
 		path := "data/foo/zed"
@@ -637,6 +938,31 @@ func TestVaultReadQuery_String(t *testing.T) {
 			"path?version=3",
 			"vault.read(path.v3)",
 		},
+		{
+			"path_relative_version",
+			"path?version=-1",
+			"vault.read(path.v-1)",
+		},
+		{
+			"path_field",
+			"path?version=3&field=password",
+			"vault.read(path.v3#password)",
+		},
+		{
+			"namespace",
+			"ns1/ns2::path?version=3",
+			"vault.read(ns1/ns2::path.v3)",
+		},
+		{
+			"allow_deleted",
+			"path?allow_deleted=true&field=deletion_time",
+			"vault.read(path#deletion_time@allow_deleted)",
+		},
+		{
+			"cluster",
+			"@regional:ns1::path?version=3",
+			"vault.read(@regional:ns1::path.v3)",
+		},
 	}
 
 	for i, tc := range cases {
@@ -650,6 +976,65 @@ func TestVaultReadQuery_String(t *testing.T) {
 	}
 }
 
+func TestVaultReadQuery_Fetch_clusters(t *testing.T) {
+	// Each cluster answers reads with its own name
+	cluster := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/secret/foo" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"cluster": name},
+			})
+		}))
+	}
+	primary := cluster("primary")
+	defer primary.Close()
+	regional := cluster("regional")
+	defer regional.Close()
+
+	clients := NewClientSet()
+	require.NoError(t, clients.CreateVaultClient(&CreateVaultClientInput{
+		Address: primary.URL,
+		Token:   "token",
+	}))
+	require.NoError(t, clients.CreateVaultClient(&CreateVaultClientInput{
+		Name:    "regional",
+		Address: regional.URL,
+		Token:   "token",
+	}))
+
+	cases := []struct {
+		name string
+		i    string
+		exp  string
+	}{
+		{"default", "secret/foo", "primary"},
+		{"named", "@regional:secret/foo", "regional"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewVaultReadQuery(tc.i)
+			require.NoError(t, err)
+
+			act, _, err := d.Fetch(clients, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act.(*Secret).Data["cluster"])
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		d, err := NewVaultReadQuery("@missing:secret/foo")
+		require.NoError(t, err)
+
+		_, _, err = d.Fetch(clients, nil)
+		assert.ErrorContains(t, err, `unknown vault cluster "missing"`)
+	})
+}
+
 func TestShimKVv2Path(t *testing.T) {
 	cases := []struct {
 		name            string
@@ -0,0 +1,148 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Ensure implements
+var _ Dependency = (*VaultRequestQuery)(nil)
+
+// VaultRequestQuery is the dependency to Vault for an arbitrary logical
+// endpoint, requested with the given method. Unlike vault.read and vault.list,
+// the path is used as is, without any KVv2 path translation.
+type VaultRequestQuery struct {
+	stopCh chan struct{}
+
+	method   string
+	path     string
+	body     map[string]interface{}
+	bodyHash string
+}
+
+// NewVaultRequestQuery creates a new request dependency. The method is one of
+// GET, LIST or POST, and the body is only sent with POST.
+func NewVaultRequestQuery(method, s string, body map[string]interface{}) (*VaultRequestQuery, error) {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	switch method {
+	case "GET", "LIST":
+		if len(body) > 0 {
+			return nil, fmt.Errorf("vault.request: %s requests cannot have a body", method)
+		}
+	case "POST":
+	default:
+		return nil, fmt.Errorf("vault.request: unsupported method %q, "+
+			"expected GET, LIST or POST", method)
+	}
+
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return nil, fmt.Errorf("vault.request: invalid format: %q", s)
+	}
+
+	d := &VaultRequestQuery{
+		stopCh: make(chan struct{}, 1),
+		method: method,
+		path:   s,
+		body:   body,
+	}
+	if len(body) > 0 {
+		d.bodyHash = sha1Map(body)
+	}
+	return d, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultRequestQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		dur := VaultDefaultLeaseDuration
+		log.Printf("[TRACE] %s: long polling for %s", d, dur)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(dur):
+		}
+	}
+
+	log.Printf("[TRACE] %s: %s %s", d, d.method, &url.URL{
+		Path:     "/v1/" + d.path,
+		RawQuery: opts.String(),
+	})
+
+	var secret *api.Secret
+	var err error
+	logical := clients.Vault().Logical()
+	switch d.method {
+	case "GET":
+		secret, err = logical.Read(d.path)
+	case "LIST":
+		secret, err = logical.List(d.path)
+	case "POST":
+		// Vault treats PUT and POST requests identically
+		secret, err = logical.Write(d.path, d.body)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	result := map[string]interface{}{}
+
+	// The secret could be nil if the endpoint returned no content.
+	if secret == nil || secret.Data == nil {
+		log.Printf("[TRACE] %s: no data", d)
+		return respWithMetadata(result)
+	}
+
+	printVaultWarnings(d, secret.Warnings)
+	for k, v := range secret.Data {
+		result[k] = v
+	}
+
+	log.Printf("[TRACE] %s: returned %d keys", d, len(result))
+
+	return respWithMetadata(result)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultRequestQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultRequestQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency. The body is
+// hashed, since it could contain sensitive information.
+func (d *VaultRequestQuery) String() string {
+	if d.bodyHash != "" {
+		return fmt.Sprintf("vault.request(%s %s -> %s)", d.method, d.path, d.bodyHash)
+	}
+	return fmt.Sprintf("vault.request(%s %s)", d.method, d.path)
+}
+
+// Type returns the type of this dependency.
+func (d *VaultRequestQuery) Type() Type {
+	return TypeVault
+}
@@ -0,0 +1,171 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVaultRequestQuery(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   map[string]interface{}
+		exp    *VaultRequestQuery
+		err    bool
+	}{
+		{
+			"empty_path",
+			"GET",
+			"",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"bad_method",
+			"DELETE",
+			"secret/foo",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"body_with_get",
+			"GET",
+			"secret/foo",
+			map[string]interface{}{"foo": "bar"},
+			nil,
+			true,
+		},
+		{
+			"list",
+			"list",
+			"/secret/metadata/",
+			nil,
+			&VaultRequestQuery{
+				method: "LIST",
+				path:   "secret/metadata",
+			},
+			false,
+		},
+		{
+			"post",
+			"POST",
+			"sys/tools/hash",
+			map[string]interface{}{"input": "Zm9v"},
+			&VaultRequestQuery{
+				method:   "POST",
+				path:     "sys/tools/hash",
+				body:     map[string]interface{}{"input": "Zm9v"},
+				bodyHash: sha1Map(map[string]interface{}{"input": "Zm9v"}),
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewVaultRequestQuery(tc.method, tc.path, tc.body)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestVaultRequestQuery_Fetch(t *testing.T) {
+	clients, vault := testVaultServer(t, "request_fetch", "2")
+	secretsPath := vault.secretsPath
+
+	for _, k := range []string{"foo", "bar"} {
+		if err := vault.CreateSecret(k, map[string]interface{}{"value": k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("list", func(t *testing.T) {
+		d, err := NewVaultRequestQuery("LIST", secretsPath+"/metadata", nil)
+		require.NoError(t, err)
+
+		act, _, err := d.Fetch(clients, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []interface{}{"bar", "foo"},
+			act.(map[string]interface{})["keys"])
+	})
+
+	t.Run("get", func(t *testing.T) {
+		d, err := NewVaultRequestQuery("GET", secretsPath+"/data/foo", nil)
+		require.NoError(t, err)
+
+		act, _, err := d.Fetch(clients, nil)
+		require.NoError(t, err)
+		data := act.(map[string]interface{})["data"].(map[string]interface{})
+		assert.Equal(t, "foo", data["value"])
+	})
+
+	t.Run("post", func(t *testing.T) {
+		d, err := NewVaultRequestQuery("POST", "sys/tools/random/8", map[string]interface{}{
+			"format": "hex",
+		})
+		require.NoError(t, err)
+
+		act, _, err := d.Fetch(clients, nil)
+		require.NoError(t, err)
+		assert.Len(t, act.(map[string]interface{})["random_bytes"], 16)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		d, err := NewVaultRequestQuery("LIST", secretsPath+"/metadata/nope", nil)
+		require.NoError(t, err)
+
+		act, _, err := d.Fetch(clients, nil)
+		require.NoError(t, err)
+		assert.Empty(t, act)
+	})
+}
+
+func TestVaultRequestQuery_String(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   map[string]interface{}
+		exp    string
+	}{
+		{
+			"list",
+			"LIST",
+			"secret/metadata",
+			nil,
+			"vault.request(LIST secret/metadata)",
+		},
+		{
+			"post",
+			"POST",
+			"sys/tools/random",
+			map[string]interface{}{"format": "hex"},
+			"vault.request(POST sys/tools/random -> 1319c8ab)",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d, err := NewVaultRequestQuery(tc.method, tc.path, tc.body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, d.String())
+		})
+	}
+}
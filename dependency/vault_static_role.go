@@ -0,0 +1,186 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Ensure implements
+	_ Dependency = (*VaultStaticRoleQuery)(nil)
+
+	// VaultStaticRoleQuerySleepTime is the maximum amount of time to sleep
+	// between queries for a rotation, since the endpoint does not support
+	// blocking queries.
+	VaultStaticRoleQuerySleepTime = DefaultNonBlockingQuerySleepTime
+)
+
+// defaultVaultStaticRoleMount is the mount of the database secrets engine used
+// when none is given.
+const defaultVaultStaticRoleMount = "database"
+
+func init() {
+	gob.Register(&VaultStaticRole{})
+}
+
+// VaultStaticRole is the rotation state of a database static role.
+type VaultStaticRole struct {
+	// Username is the database user managed by the role.
+	Username string
+
+	// LastVaultRotation is the time the password was last rotated, in
+	// RFC3339 format.
+	LastVaultRotation string
+
+	// RotationPeriod is the number of seconds between rotations, zero for
+	// roles rotated on a schedule.
+	RotationPeriod int
+
+	// TTL is the number of seconds until the next rotation, as of when the
+	// rotation was observed.
+	TTL int
+
+	// NextVaultRotation is the time of the next rotation, in RFC3339 format.
+	NextVaultRotation string
+}
+
+// VaultStaticRoleQuery is the dependency to Vault for the rotation state of a
+// database static role. It only returns new data when the password has been
+// rotated.
+type VaultStaticRoleQuery struct {
+	stopCh chan struct{}
+
+	namespace string
+	mount     string
+	role      string
+
+	// lastRotation is the rotation time returned by the previous fetch.
+	lastRotation string
+}
+
+// NewVaultStaticRoleQuery creates a new static role dependency from a string
+// of the form "[<namespace>::][<mount>/]<role>". The mount defaults to
+// "database".
+func NewVaultStaticRoleQuery(s string) (*VaultStaticRoleQuery, error) {
+	namespace, s := splitVaultNamespace(strings.TrimSpace(s))
+	s = strings.Trim(s, "/")
+
+	mount, role := defaultVaultStaticRoleMount, s
+	if i := strings.LastIndex(s, "/"); i != -1 {
+		mount, role = s[:i], s[i+1:]
+	}
+	if mount == "" || role == "" {
+		return nil, fmt.Errorf("vault.staticRole: invalid format: %q", s)
+	}
+
+	return &VaultStaticRoleQuery{
+		stopCh:    make(chan struct{}, 1),
+		namespace: namespace,
+		mount:     mount,
+		role:      role,
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultStaticRoleQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	result, err := d.read(clients, opts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	// If this is not the first query, poll until the password is rotated to
+	// simulate blocking-queries.
+	for opts.WaitIndex != 0 && result.LastVaultRotation == d.lastRotation {
+		dur := VaultStaticRoleQuerySleepTime
+		if ttl := time.Duration(result.TTL+1) * time.Second; result.TTL > 0 && ttl < dur {
+			dur = ttl
+		}
+		log.Printf("[TRACE] %s: long polling for %s", d, dur)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(dur):
+		}
+
+		if result, err = d.read(clients, opts); err != nil {
+			return nil, nil, errors.Wrap(err, d.String())
+		}
+	}
+
+	log.Printf("[TRACE] %s: last rotated at %s", d, result.LastVaultRotation)
+	d.lastRotation = result.LastVaultRotation
+
+	return respWithMetadata(result)
+}
+
+// read reads the credentials of the role and returns their rotation state.
+func (d *VaultStaticRoleQuery) read(clients *ClientSet, opts *QueryOptions) (*VaultStaticRole, error) {
+	path := d.mount + "/static-creds/" + d.role
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/" + path,
+		RawQuery: opts.String(),
+	})
+	secret, err := namespacedVaultClient(clients, d.namespace).Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no static role found at %s", path)
+	}
+
+	result := &VaultStaticRole{}
+	result.Username, _ = secret.Data["username"].(string)
+	result.LastVaultRotation, _ = secret.Data["last_vault_rotation"].(string)
+	if result.RotationPeriod, err = vaultInt(secret.Data["rotation_period"]); err != nil {
+		return nil, fmt.Errorf("invalid rotation_period: %w", err)
+	}
+	if result.TTL, err = vaultInt(secret.Data["ttl"]); err != nil {
+		return nil, fmt.Errorf("invalid ttl: %w", err)
+	}
+	result.NextVaultRotation = time.Now().Add(time.Duration(result.TTL) * time.Second).
+		UTC().Format(time.RFC3339)
+
+	return result, nil
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultStaticRoleQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultStaticRoleQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultStaticRoleQuery) String() string {
+	path := d.mount + "/" + d.role
+	if d.namespace != "" {
+		path = d.namespace + "::" + path
+	}
+	return fmt.Sprintf("vault.staticRole(%s)", path)
+}
+
+// Type returns the type of this dependency.
+func (d *VaultStaticRoleQuery) Type() Type {
+	return TypeVault
+}
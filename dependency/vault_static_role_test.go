@@ -0,0 +1,157 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	VaultStaticRoleQuerySleepTime = 50 * time.Millisecond
+}
+
+func TestNewVaultStaticRoleQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		exp  *VaultStaticRoleQuery
+		err  bool
+	}{
+		{"empty", "", nil, true},
+		{"slashes", " / ", nil, true},
+		{"role", "app", &VaultStaticRoleQuery{mount: "database", role: "app"}, false},
+		{"mount_role", "db/app", &VaultStaticRoleQuery{mount: "db", role: "app"}, false},
+		{"nested_mount", "/dbs/pg/app/", &VaultStaticRoleQuery{mount: "dbs/pg", role: "app"}, false},
+		{
+			"namespace",
+			"ns1::app",
+			&VaultStaticRoleQuery{namespace: "ns1", mount: "database", role: "app"},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := NewVaultStaticRoleQuery(tc.i)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+			if act != nil {
+				act.stopCh = nil
+			}
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestVaultStaticRoleQuery_Fetch(t *testing.T) {
+	// The database secrets engine needs a database to manage, so the static
+	// role is served by a fake Vault which rotates on demand.
+	var mu sync.Mutex
+	rotation := "2024-01-02T03:04:05Z"
+	rotate := func(at string) {
+		mu.Lock()
+		defer mu.Unlock()
+		rotation = at
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/database/static-creds/app" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"username":            "app-user",
+				"password":            "s3cret",
+				"last_vault_rotation": rotation,
+				"rotation_period":     3600,
+				"ttl":                 1800,
+			},
+		})
+	}))
+	defer srv.Close()
+
+	clients := NewClientSet()
+	require.NoError(t, clients.CreateVaultClient(&CreateVaultClientInput{
+		Address: srv.URL,
+		Token:   "token",
+	}))
+
+	d, err := NewVaultStaticRoleQuery("app")
+	require.NoError(t, err)
+
+	act, _, err := d.Fetch(clients, nil)
+	require.NoError(t, err)
+	role := act.(*VaultStaticRole)
+	assert.Equal(t, "app-user", role.Username)
+	assert.Equal(t, "2024-01-02T03:04:05Z", role.LastVaultRotation)
+	assert.Equal(t, 3600, role.RotationPeriod)
+	assert.Equal(t, 1800, role.TTL)
+	_, err = time.Parse(time.RFC3339, role.NextVaultRotation)
+	assert.NoError(t, err)
+
+	t.Run("fires_on_rotation", func(t *testing.T) {
+		dataCh := make(chan interface{}, 1)
+		errCh := make(chan error, 1)
+		go func() {
+			data, _, err := d.Fetch(clients, &QueryOptions{WaitIndex: 1})
+			if err != nil {
+				errCh <- err
+				return
+			}
+			dataCh <- data
+		}()
+
+		// Nothing is returned until the password is rotated
+		select {
+		case data := <-dataCh:
+			t.Fatalf("returned without a rotation: %#v", data)
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(4 * VaultStaticRoleQuerySleepTime):
+		}
+
+		rotate("2024-01-02T04:04:05Z")
+
+		select {
+		case data := <-dataCh:
+			assert.Equal(t, "2024-01-02T04:04:05Z", data.(*VaultStaticRole).LastVaultRotation)
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(time.Second):
+			t.Fatal("rotation was not observed")
+		}
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := d.Fetch(clients, &QueryOptions{WaitIndex: 1})
+			errCh <- err
+		}()
+
+		d.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestVaultStaticRoleQuery_String(t *testing.T) {
+	d, err := NewVaultStaticRoleQuery("ns1::db/app")
+	require.NoError(t, err)
+	assert.Equal(t, "vault.staticRole(ns1::db/app)", d.String())
+}
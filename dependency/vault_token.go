@@ -4,6 +4,8 @@
 package dependency
 
 import (
+	"fmt"
+
 	"github.com/hashicorp/vault/api"
 	"github.com/pkg/errors"
 )
@@ -16,10 +18,20 @@ type VaultTokenQuery struct {
 	stopCh      chan struct{}
 	secret      *Secret
 	vaultSecret *api.Secret
+
+	// cluster is the name of the Vault cluster the token belongs to, empty
+	// for the default cluster.
+	cluster string
 }
 
 // NewVaultTokenQuery creates a new dependency.
 func NewVaultTokenQuery(token string) (*VaultTokenQuery, error) {
+	return NewVaultClusterTokenQuery("", token)
+}
+
+// NewVaultClusterTokenQuery creates a new dependency renewing the token of the
+// named Vault cluster.
+func NewVaultClusterTokenQuery(cluster, token string) (*VaultTokenQuery, error) {
 	vaultSecret := &api.Secret{
 		Auth: &api.SecretAuth{
 			ClientToken:   token,
@@ -31,6 +43,7 @@ func NewVaultTokenQuery(token string) (*VaultTokenQuery, error) {
 		stopCh:      make(chan struct{}, 1),
 		vaultSecret: vaultSecret,
 		secret:      transformSecret(vaultSecret),
+		cluster:     cluster,
 	}, nil
 }
 
@@ -44,7 +57,10 @@ func (d *VaultTokenQuery) Fetch(clients *ClientSet, opts *QueryOptions,
 	}
 
 	if vaultSecretRenewable(d.secret) {
-		err := renewSecret(clients, d)
+		vaultClient, err := clients.VaultCluster(d.cluster)
+		if err == nil {
+			err = renewSecret(clients, vaultClient, d.cluster, d)
+		}
 		if err != nil {
 			return nil, nil, errors.Wrap(err, d.String())
 		}
@@ -73,6 +89,9 @@ func (d *VaultTokenQuery) Stop() {
 
 // String returns the human-friendly version of this dependency.
 func (d *VaultTokenQuery) String() string {
+	if d.cluster != "" {
+		return fmt.Sprintf("vault.token(@%s)", d.cluster)
+	}
 	return "vault.token"
 }
 
@@ -0,0 +1,173 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Ensure implements
+var _ Dependency = (*VaultTransitQuery)(nil)
+
+const (
+	// VaultTransitEncrypt is the transit operation which encrypts plaintext.
+	VaultTransitEncrypt = "encrypt"
+
+	// VaultTransitDecrypt is the transit operation which decrypts ciphertext.
+	VaultTransitDecrypt = "decrypt"
+)
+
+// VaultTransitQuery is the dependency to the Vault transit secrets engine for
+// encrypting or decrypting a single value. Unlike most dependencies this is an
+// operation and not a watch; the result is computed exactly once for the given
+// inputs and is kept until the dependency is stopped.
+type VaultTransitQuery struct {
+	stopCh chan struct{}
+
+	mount     string
+	op        string
+	key       string
+	input     string
+	inputHash string
+	result    *string
+}
+
+// NewVaultTransitQuery creates a new transit dependency for the given
+// operation (encrypt or decrypt) using the named key. The key may be prefixed
+// with the mount path of the transit engine (e.g. "my-transit/my-key"); when
+// no mount is given, "transit" is used.
+func NewVaultTransitQuery(op, key, input string) (*VaultTransitQuery, error) {
+	switch op {
+	case VaultTransitEncrypt, VaultTransitDecrypt:
+	default:
+		return nil, fmt.Errorf("vault.transit: invalid operation: %q", op)
+	}
+
+	key = strings.Trim(strings.TrimSpace(key), "/")
+	if key == "" {
+		return nil, fmt.Errorf("vault.transit: invalid key: %q", key)
+	}
+
+	mount := "transit"
+	if i := strings.LastIndex(key, "/"); i != -1 {
+		mount, key = key[:i], key[i+1:]
+	}
+
+	h := sha1.New()
+	io.WriteString(h, input)
+
+	return &VaultTransitQuery{
+		stopCh:    make(chan struct{}, 1),
+		mount:     mount,
+		op:        op,
+		key:       key,
+		input:     input,
+		inputHash: fmt.Sprintf("%.4x", h.Sum(nil)),
+	}, nil
+}
+
+// Fetch performs the transit operation against the Vault API. The operation is
+// only performed on the first call; subsequent calls block until the
+// dependency is stopped because the result can never change for the same
+// inputs.
+func (d *VaultTransitQuery) Fetch(clients *ClientSet, opts *QueryOptions,
+) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	if d.result != nil {
+		<-d.stopCh
+		return nil, nil, ErrStopped
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	path := fmt.Sprintf("%s/%s/%s", d.mount, d.op, d.key)
+	log.Printf("[TRACE] %s: PUT %s", d, &url.URL{
+		Path:     "/v1/" + path,
+		RawQuery: opts.String(),
+	})
+
+	var data map[string]interface{}
+	switch d.op {
+	case VaultTransitEncrypt:
+		data = map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString([]byte(d.input)),
+		}
+	case VaultTransitDecrypt:
+		data = map[string]interface{}{
+			"ciphertext": d.input,
+		}
+	}
+
+	vaultSecret, err := clients.Vault().Logical().Write(path, data)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+	if vaultSecret == nil || vaultSecret.Data == nil {
+		return nil, nil, fmt.Errorf("%s: no data returned", d)
+	}
+	printVaultWarnings(d, vaultSecret.Warnings)
+
+	var result string
+	switch d.op {
+	case VaultTransitEncrypt:
+		ciphertext, ok := vaultSecret.Data["ciphertext"].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: missing ciphertext in response", d)
+		}
+		result = ciphertext
+	case VaultTransitDecrypt:
+		encoded, ok := vaultSecret.Data["plaintext"].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: missing plaintext in response", d)
+		}
+		plaintext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, d.String())
+		}
+		result = string(plaintext)
+	}
+
+	d.result = &result
+	return respWithMetadata(result)
+}
+
+// Redact returns true if the result of this dependency is sensitive and
+// should not appear in error output.
+func (d *VaultTransitQuery) Redact() bool {
+	return d.op == VaultTransitDecrypt
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultTransitQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultTransitQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency. The input is
+// hashed because it may contain sensitive information.
+func (d *VaultTransitQuery) String() string {
+	return fmt.Sprintf("vault.transit(%s/%s/%s -> %s)", d.mount, d.op, d.key, d.inputHash)
+}
+
+// Type returns the type of this dependency.
+func (d *VaultTransitQuery) Type() Type {
+	return TypeVault
+}
@@ -0,0 +1,134 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVaultTransitQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		op   string
+		key  string
+		exp  *VaultTransitQuery
+		err  bool
+	}{
+		{
+			"invalid_op",
+			"rewrap",
+			"my-key",
+			nil,
+			true,
+		},
+		{
+			"empty_key",
+			VaultTransitEncrypt,
+			"",
+			nil,
+			true,
+		},
+		{
+			"key",
+			VaultTransitEncrypt,
+			"my-key",
+			&VaultTransitQuery{
+				mount: "transit",
+				op:    VaultTransitEncrypt,
+				key:   "my-key",
+				input: "foo",
+			},
+			false,
+		},
+		{
+			"mount_key",
+			VaultTransitDecrypt,
+			"/other/transit/my-key/",
+			&VaultTransitQuery{
+				mount: "other/transit",
+				op:    VaultTransitDecrypt,
+				key:   "my-key",
+				input: "foo",
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewVaultTransitQuery(tc.op, tc.key, "foo")
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+
+			if act != nil {
+				act.stopCh = nil
+				act.inputHash = ""
+			}
+
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestVaultTransitQuery_Fetch(t *testing.T) {
+	vc := testClients.Vault()
+	if err := vc.Sys().Mount("transit", &api.MountInput{
+		Type: "transit",
+	}); err != nil {
+		t.Fatalf("Error creating transit engine: %s", err)
+	}
+	if _, err := vc.Logical().Write("transit/keys/test", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := NewVaultTransitQuery(VaultTransitEncrypt, "test", "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, _, err := enc.Fetch(testClients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ciphertext.(string), "vault:v1:") {
+		t.Fatalf("unexpected ciphertext: %q", ciphertext)
+	}
+
+	dec, err := NewVaultTransitQuery(VaultTransitDecrypt, "test", ciphertext.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, _, err := dec.Fetch(testClients, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "s3cr3t", plaintext)
+
+	t.Run("stops", func(t *testing.T) {
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := dec.Fetch(testClients, nil)
+			errCh <- err
+		}()
+
+		dec.Stop()
+
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+}
+
+func TestVaultTransitQuery_String(t *testing.T) {
+	d, err := NewVaultTransitQuery(VaultTransitDecrypt, "my-key", "vault:v1:abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "vault.transit(transit/decrypt/my-key -> 6f59b5a9)", d.String())
+}
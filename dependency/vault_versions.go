@@ -0,0 +1,180 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Ensure implements
+var _ Dependency = (*VaultAllVersionsQuery)(nil)
+
+// DefaultVaultAllVersionsMax is the number of versions read when no maximum
+// is given, which matches the default max_versions of a KVv2 secrets engine.
+const DefaultVaultAllVersionsMax = 10
+
+func init() {
+	gob.Register([]*VaultSecretVersion{})
+}
+
+// VaultSecretVersion is the data of a single version of a KVv2 secret. The
+// data of deleted and destroyed versions cannot be read, so it is nil and the
+// version is marked instead.
+type VaultSecretVersion struct {
+	Version   int
+	Data      map[string]interface{}
+	Deleted   bool
+	Destroyed bool
+}
+
+// VaultAllVersionsQuery is the dependency to Vault for the data of every
+// version of a KVv2 secret, up to a maximum number of the most recent
+// versions.
+type VaultAllVersionsQuery struct {
+	stopCh chan struct{}
+
+	path string
+	max  int
+}
+
+// NewVaultAllVersionsQuery creates a new dependency reading at most max of the
+// most recent versions of the KVv2 secret at the given path. A max of zero
+// reads DefaultVaultAllVersionsMax versions.
+func NewVaultAllVersionsQuery(s string, max int) (*VaultAllVersionsQuery, error) {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return nil, fmt.Errorf("vault.versions: invalid format: %q", s)
+	}
+	if max < 0 {
+		return nil, fmt.Errorf("vault.versions: invalid max versions: %d", max)
+	}
+	if max == 0 {
+		max = DefaultVaultAllVersionsMax
+	}
+
+	return &VaultAllVersionsQuery{
+		stopCh: make(chan struct{}, 1),
+		path:   s,
+		max:    max,
+	}, nil
+}
+
+// Fetch queries the Vault API
+func (d *VaultAllVersionsQuery) Fetch(clients *ClientSet, opts *QueryOptions) (interface{}, *ResponseMetadata, error) {
+	select {
+	case <-d.stopCh:
+		return nil, nil, ErrStopped
+	default:
+	}
+
+	opts = opts.Merge(&QueryOptions{})
+
+	// If this is not the first query, poll to simulate blocking-queries.
+	if opts.WaitIndex != 0 {
+		dur := VaultDefaultLeaseDuration
+		log.Printf("[TRACE] %s: long polling for %s", d, dur)
+
+		select {
+		case <-d.stopCh:
+			return nil, nil, ErrStopped
+		case <-time.After(dur):
+		}
+	}
+
+	vaultClient := clients.Vault()
+	mountPath, isV2, err := isKVv2(vaultClient, d.path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+	if !isV2 {
+		return nil, nil, fmt.Errorf("%s: not a KVv2 secrets engine", d)
+	}
+
+	metadataPath := shimKvV2ListPath(d.path, mountPath)
+	log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+		Path:     "/v1/" + metadataPath,
+		RawQuery: opts.String(),
+	})
+	secret, err := vaultClient.Logical().Read(metadataPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	// The secret could be nil if it does not exist.
+	if secret == nil || secret.Data == nil {
+		log.Printf("[TRACE] %s: no data", d)
+		return respWithMetadata([]*VaultSecretVersion{})
+	}
+
+	metadata, err := parseVaultMetadata(secret.Data)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, d.String())
+	}
+
+	// Only the most recent versions are read to bound the number of reads.
+	versions := metadata.Versions
+	if len(versions) > d.max {
+		versions = versions[len(versions)-d.max:]
+	}
+
+	dataPath := shimKVv2Path(d.path, mountPath, vaultClient.Namespace())
+	result := make([]*VaultSecretVersion, 0, len(versions))
+	for _, v := range versions {
+		version := &VaultSecretVersion{
+			Version:   v.Version,
+			Deleted:   v.Deleted,
+			Destroyed: v.Destroyed,
+		}
+		result = append(result, version)
+		if v.Deleted || v.Destroyed {
+			continue
+		}
+
+		query := url.Values{"version": {strconv.Itoa(v.Version)}}
+		log.Printf("[TRACE] %s: GET %s", d, &url.URL{
+			Path:     "/v1/" + dataPath,
+			RawQuery: query.Encode(),
+		})
+		secret, err := vaultClient.Logical().ReadWithData(dataPath, query)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, d.String())
+		}
+		if secret != nil {
+			version.Data, _ = secret.Data["data"].(map[string]interface{})
+		}
+	}
+
+	log.Printf("[TRACE] %s: returned %d versions", d, len(result))
+
+	return respWithMetadata(result)
+}
+
+// CanShare returns if this dependency is shareable.
+func (d *VaultAllVersionsQuery) CanShare() bool {
+	return false
+}
+
+// Stop halts the given dependency's fetch.
+func (d *VaultAllVersionsQuery) Stop() {
+	close(d.stopCh)
+}
+
+// String returns the human-friendly version of this dependency.
+func (d *VaultAllVersionsQuery) String() string {
+	return fmt.Sprintf("vault.versions(%s,%d)", d.path, d.max)
+}
+
+// Type returns the type of this dependency.
+func (d *VaultAllVersionsQuery) Type() Type {
+	return TypeVault
+}
@@ -0,0 +1,147 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package dependency
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVaultAllVersionsQuery(t *testing.T) {
+	cases := []struct {
+		name string
+		i    string
+		max  int
+		exp  *VaultAllVersionsQuery
+		err  bool
+	}{
+		{
+			"empty",
+			"",
+			0,
+			nil,
+			true,
+		},
+		{
+			"negative_max",
+			"secret/foo",
+			-1,
+			nil,
+			true,
+		},
+		{
+			"default_max",
+			"/secret/foo/",
+			0,
+			&VaultAllVersionsQuery{
+				path: "secret/foo",
+				max:  DefaultVaultAllVersionsMax,
+			},
+			false,
+		},
+		{
+			"max",
+			"secret/foo",
+			3,
+			&VaultAllVersionsQuery{
+				path: "secret/foo",
+				max:  3,
+			},
+			false,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			act, err := NewVaultAllVersionsQuery(tc.i, tc.max)
+			if (err != nil) != tc.err {
+				t.Fatal(err)
+			}
+
+			if act != nil {
+				act.stopCh = nil
+			}
+
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func TestVaultAllVersionsQuery_Fetch(t *testing.T) {
+	clients, vault := testVaultServer(t, "all_versions_fetch", "2")
+	secretsPath := vault.secretsPath
+
+	for _, v := range []string{"one", "two", "three"} {
+		if err := vault.CreateSecret("foo", map[string]interface{}{"value": v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetch := func(max int) []*VaultSecretVersion {
+		d, err := NewVaultAllVersionsQuery(secretsPath+"/foo", max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		act, _, err := d.Fetch(clients, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return act.([]*VaultSecretVersion)
+	}
+
+	assert.Equal(t, []*VaultSecretVersion{
+		{Version: 1, Data: map[string]interface{}{"value": "one"}},
+		{Version: 2, Data: map[string]interface{}{"value": "two"}},
+		{Version: 3, Data: map[string]interface{}{"value": "three"}},
+	}, fetch(0))
+
+	t.Run("max", func(t *testing.T) {
+		assert.Equal(t, []*VaultSecretVersion{
+			{Version: 2, Data: map[string]interface{}{"value": "two"}},
+			{Version: 3, Data: map[string]interface{}{"value": "three"}},
+		}, fetch(2))
+	})
+
+	t.Run("deleted_and_destroyed", func(t *testing.T) {
+		vc := clients.Vault()
+		if _, err := vc.Logical().Write(secretsPath+"/delete/foo", map[string]interface{}{
+			"versions": []int{1},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := vc.Logical().Write(secretsPath+"/destroy/foo", map[string]interface{}{
+			"versions": []int{2},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []*VaultSecretVersion{
+			{Version: 1, Deleted: true},
+			{Version: 2, Destroyed: true},
+			{Version: 3, Data: map[string]interface{}{"value": "three"}},
+		}, fetch(0))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		d, err := NewVaultAllVersionsQuery(secretsPath+"/missing", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		act, _, err := d.Fetch(clients, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []*VaultSecretVersion{}, act)
+	})
+}
+
+func TestVaultAllVersionsQuery_String(t *testing.T) {
+	d, err := NewVaultAllVersionsQuery("secret/foo", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "vault.versions(secret/foo,10)", d.String())
+}
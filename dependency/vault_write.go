@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,30 +26,75 @@ type VaultWriteQuery struct {
 	stopCh  chan struct{}
 	sleepCh chan time.Duration
 
-	path     string
-	data     map[string]interface{}
-	dataHash string
-	secret   *Secret
+	path      string
+	namespace string
+	rawQuery  string
+	data      map[string]interface{}
+	dataHash  string
+	secret    *Secret
+
+	// cache is set to only write again once the lease of the response
+	// expires, rather than on every fetch. written is set after the first
+	// successful write.
+	cache   bool
+	written bool
+
+	// cas is the check-and-set version sent with KVv2 writes. It is updated
+	// to the version created by each write.
+	cas *int
 
 	// vaultSecret is the actual Vault secret which we are renewing
 	vaultSecret *api.Secret
 }
 
-// NewVaultWriteQuery creates a new datacenter dependency.
+// NewVaultWriteQuery creates a new datacenter dependency. The path accepts the
+// "cache=true" and "cas=<version>" query parameters.
 func NewVaultWriteQuery(s string, d map[string]interface{}) (*VaultWriteQuery, error) {
+	namespace, s := splitVaultNamespace(strings.TrimSpace(s))
 	s = strings.TrimSpace(s)
+	s, rawQuery, _ := strings.Cut(s, "?")
 	s = strings.Trim(s, "/")
 	if s == "" {
 		return nil, fmt.Errorf("vault.write: invalid format: %q", s)
 	}
 
-	return &VaultWriteQuery{
-		stopCh:   make(chan struct{}, 1),
-		sleepCh:  make(chan time.Duration, 1),
-		path:     s,
-		data:     d,
-		dataHash: sha1Map(d),
-	}, nil
+	q := &VaultWriteQuery{
+		stopCh:    make(chan struct{}, 1),
+		sleepCh:   make(chan time.Duration, 1),
+		path:      s,
+		namespace: namespace,
+		data:      d,
+		dataHash:  sha1Map(d),
+	}
+
+	if rawQuery != "" {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, fmt.Errorf("vault.write: invalid query: %q: %s", rawQuery, err)
+		}
+		for key := range query {
+			switch key {
+			case "cache", "cas":
+			default:
+				return nil, fmt.Errorf("vault.write: invalid query parameter key %q in query %q: supported keys: cache,cas", key, rawQuery)
+			}
+		}
+		if v := query.Get("cache"); v != "" {
+			if q.cache, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("vault.write: invalid cache value: %q", v)
+			}
+		}
+		if v := query.Get("cas"); v != "" {
+			cas, err := strconv.Atoi(v)
+			if err != nil || cas < 0 {
+				return nil, fmt.Errorf("vault.write: invalid cas value: %q", v)
+			}
+			q.cas = &cas
+		}
+		q.rawQuery = query.Encode()
+	}
+
+	return q, nil
 }
 
 // Fetch queries the Vault API
@@ -65,10 +111,19 @@ func (d *VaultWriteQuery) Fetch(clients *ClientSet, opts *QueryOptions,
 	default:
 	}
 
+	// A cached response without a lease stays valid, so there is nothing to
+	// do until the dependency is stopped. Changes to the path or data result
+	// in a new dependency.
+	if d.cachedWithoutLease() {
+		log.Printf("[TRACE] %s: using cached response", d)
+		<-d.stopCh
+		return nil, nil, ErrStopped
+	}
+
 	firstRun := d.secret == nil
 
 	if !firstRun && vaultSecretRenewable(d.secret) {
-		err := renewSecret(clients, d)
+		err := renewSecret(clients, namespacedVaultClient(clients, d.namespace), "", d)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, d.String())
 		}
@@ -79,6 +134,7 @@ func (d *VaultWriteQuery) Fetch(clients *ClientSet, opts *QueryOptions,
 	if err != nil {
 		return nil, nil, errors.Wrap(err, d.String())
 	}
+	d.written = true
 
 	// vaultSecret == nil when writing to KVv1 engines
 	if vaultSecret == nil {
@@ -90,7 +146,7 @@ func (d *VaultWriteQuery) Fetch(clients *ClientSet, opts *QueryOptions,
 	// cloned secret which will be exposed to the template
 	d.secret = transformSecret(vaultSecret)
 
-	if !vaultSecretRenewable(d.secret) {
+	if !vaultSecretRenewable(d.secret) && !d.cachedWithoutLease() {
 		dur := leaseCheckWait(d.secret)
 		log.Printf("[TRACE] %s: non-renewable secret, set sleep for %s", d, dur)
 		d.sleepCh <- dur
@@ -99,6 +155,15 @@ func (d *VaultWriteQuery) Fetch(clients *ClientSet, opts *QueryOptions,
 	return respWithMetadata(d.secret)
 }
 
+// cachedWithoutLease returns true if caching is enabled and the response of the
+// last write does not have a lease which expires.
+func (d *VaultWriteQuery) cachedWithoutLease() bool {
+	if !d.cache || !d.written {
+		return false
+	}
+	return d.vaultSecret == nil || d.vaultSecret.LeaseID == ""
+}
+
 // meet renewer interface
 func (d *VaultWriteQuery) stopChan() chan struct{} {
 	return d.stopCh
@@ -120,7 +185,14 @@ func (d *VaultWriteQuery) Stop() {
 
 // String returns the human-friendly version of this dependency.
 func (d *VaultWriteQuery) String() string {
-	return fmt.Sprintf("vault.write(%s -> %s)", d.path, d.dataHash)
+	path := d.path
+	if d.namespace != "" {
+		path = d.namespace + "::" + path
+	}
+	if d.rawQuery != "" {
+		path = path + "?" + d.rawQuery
+	}
+	return fmt.Sprintf("vault.write(%s -> %s)", path, d.dataHash)
 }
 
 // Type returns the type of this dependency.
@@ -152,15 +224,21 @@ func (d *VaultWriteQuery) writeSecret(clients *ClientSet, opts *QueryOptions) (*
 		RawQuery: opts.String(),
 	})
 
+	vaultClient := namespacedVaultClient(clients, d.namespace)
 	path := d.path
 	data := d.data
-	mountPath, isv2, _ := isKVv2(clients.Vault(), path)
+	mountPath, isv2, _ := isKVv2(vaultClient, path)
 	if isv2 {
-		path = shimKVv2Path(path, mountPath, clients.Vault().Namespace())
+		path = shimKVv2Path(path, mountPath, vaultClient.Namespace())
 		data = map[string]interface{}{"data": d.data}
+		if d.cas != nil {
+			data["options"] = map[string]interface{}{"cas": *d.cas}
+		}
+	} else if d.cas != nil {
+		return nil, fmt.Errorf("cas requires a KVv2 secrets engine")
 	}
 
-	vaultSecret, err := clients.Vault().Logical().Write(path, data)
+	vaultSecret, err := vaultClient.Logical().Write(path, data)
 	if err != nil {
 		return nil, errors.Wrap(err, d.String())
 	}
@@ -169,5 +247,14 @@ func (d *VaultWriteQuery) writeSecret(clients *ClientSet, opts *QueryOptions) (*
 		return nil, fmt.Errorf("no secret exists at %s", d.path)
 	}
 
+	// Further writes must be made against the version just created.
+	if d.cas != nil {
+		version, err := vaultInt(vaultSecret.Data["version"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version: %w", err)
+		}
+		d.cas = &version
+	}
+
 	return vaultSecret, nil
 }
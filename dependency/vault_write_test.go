@@ -54,6 +54,58 @@ func TestNewVaultWriteQuery(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"cache",
+			"path?cache=true",
+			nil,
+			&VaultWriteQuery{
+				path:     "path",
+				rawQuery: "cache=true",
+				dataHash: "da39a3ee",
+				cache:    true,
+			},
+			false,
+		},
+		{
+			"cas",
+			"path?cas=0&cache=true",
+			nil,
+			&VaultWriteQuery{
+				path:     "path",
+				rawQuery: "cache=true&cas=0",
+				dataHash: "da39a3ee",
+				cache:    true,
+				cas:      new(int),
+			},
+			false,
+		},
+		{
+			"namespace",
+			"ns1/ns2::path?cache=true",
+			nil,
+			&VaultWriteQuery{
+				path:      "path",
+				namespace: "ns1/ns2",
+				rawQuery:  "cache=true",
+				dataHash:  "da39a3ee",
+				cache:     true,
+			},
+			false,
+		},
+		{
+			"invalid_cas",
+			"path?cas=-1",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"invalid_key",
+			"path?ttl=1h",
+			nil,
+			nil,
+			true,
+		},
 	}
 
 	for i, tc := range cases {
@@ -174,6 +226,87 @@ func TestVaultWriteSecretKV_Fetch(t *testing.T) {
 	})
 }
 
+func TestVaultWriteQuery_Fetch_Cache(t *testing.T) {
+	clients, vault := testVaultServer(t, "write_cache", "2")
+	secretsPath := vault.secretsPath
+
+	currentVersion := func(path string) int {
+		md, err := clients.Vault().Logical().Read(secretsPath + "/metadata/" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md == nil {
+			return 0
+		}
+		v, err := vaultInt(md.Data["current_version"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	t.Run("writes_once", func(t *testing.T) {
+		d, err := NewVaultWriteQuery(secretsPath+"/foo?cache=true",
+			map[string]interface{}{"zip": "zap"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, qm, err := d.Fetch(clients, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errCh := make(chan error, 1)
+		go func(index uint64) {
+			for {
+				_, qm, err := d.Fetch(clients, &QueryOptions{WaitIndex: index})
+				if err != nil {
+					errCh <- err
+					return
+				}
+				index = qm.LastIndex
+			}
+		}(qm.LastIndex)
+
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case <-time.After(250 * time.Millisecond):
+		}
+		assert.Equal(t, 1, currentVersion("foo"))
+
+		d.Stop()
+		if err := <-errCh; err != ErrStopped {
+			t.Fatalf("expected %q to be %q", err, ErrStopped)
+		}
+	})
+
+	t.Run("cas", func(t *testing.T) {
+		d, err := NewVaultWriteQuery(secretsPath+"/bar?cas=0",
+			map[string]interface{}{"zip": "zap"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := d.Fetch(clients, nil); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 1, *d.cas)
+
+		// Another writer with the same check-and-set version must not
+		// clobber the secret.
+		other, err := NewVaultWriteQuery(secretsPath+"/bar?cas=0",
+			map[string]interface{}{"zip": "zop"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := other.Fetch(clients, nil); err == nil {
+			t.Fatal("expected check-and-set error")
+		}
+		assert.Equal(t, 1, currentVersion("bar"))
+	})
+}
+
 func TestVaultWriteQuery_Fetch(t *testing.T) {
 	clients := testClients
 
@@ -379,6 +512,18 @@ func TestVaultWriteQuery_String(t *testing.T) {
 			},
 			"vault.write(path -> ab03a894)",
 		},
+		{
+			"path_query",
+			"path?cas=1&cache=true",
+			nil,
+			"vault.write(path?cache=true&cas=1 -> da39a3ee)",
+		},
+		{
+			"namespace",
+			"ns1::path",
+			nil,
+			"vault.write(ns1::path -> da39a3ee)",
+		},
 	}
 
 	for i, tc := range cases {
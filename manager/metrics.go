@@ -0,0 +1,149 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package manager
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	metricsprom "github.com/armon/go-metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/hashicorp/consul-template/config"
+)
+
+// newMetrics returns the metrics the runner and its watcher emit. Metrics are
+// discarded unless a statsd or Prometheus address is configured. When metrics
+// are served to Prometheus, the registry they are collected into is returned
+// as well.
+func newMetrics(c *config.TelemetryConfig) (*metrics.Metrics, *prometheus.Registry, error) {
+	var sinks metrics.FanoutSink
+	var registry *prometheus.Registry
+	prefix := config.DefaultMetricsPrefix
+	if c != nil {
+		prefix = config.StringVal(c.MetricsPrefix)
+		if addr := config.StringVal(c.StatsdAddress); addr != "" {
+			log.Printf("[INFO] (runner) sending metrics to statsd at %s", addr)
+			statsd, err := metrics.NewStatsdSink(addr)
+			if err != nil {
+				return nil, nil, err
+			}
+			sinks = append(sinks, statsd)
+		}
+		if config.StringVal(c.PrometheusAddress) != "" {
+			registry = prometheus.NewRegistry()
+			sink, err := metricsprom.NewPrometheusSinkFrom(metricsprom.PrometheusOpts{
+				Registerer: registry,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			sinks = append(sinks, sink)
+		}
+	}
+
+	var sink metrics.MetricSink = &metrics.BlackholeSink{}
+	if len(sinks) > 0 {
+		sink = sinks
+	}
+
+	conf := metrics.DefaultConfig(prefix)
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	m, err := metrics.New(conf, sink)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, registry, nil
+}
+
+// metricsServer serves the metrics gathered from a Prometheus registry over
+// HTTP.
+type metricsServer struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// newMetricsServer starts serving the metrics gathered from the registry at the
+// "/metrics" path of the given address.
+func newMetricsServer(addr string, g prometheus.Gatherer) (*metricsServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[INFO] (runner) serving Prometheus metrics at %s", ln.Addr())
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(g, promhttp.HandlerOpts{}))
+	s := &metricsServer{
+		listener: ln,
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+	go func() {
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("[ERR] (runner) metrics server: %s", err)
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address the metrics are served at.
+func (s *metricsServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Stop stops serving the metrics.
+func (s *metricsServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("[WARN] (runner) could not stop metrics server: %s", err)
+	}
+}
+
+// renderAgeCollector reports the time since each template was last rendered
+// successfully, that is since its destination last held its rendered
+// contents. It is computed when scraped, so it keeps growing between renders.
+type renderAgeCollector struct {
+	runner *Runner
+	desc   *prometheus.Desc
+}
+
+func newRenderAgeCollector(r *Runner, prefix string) *renderAgeCollector {
+	return &renderAgeCollector{
+		runner: r,
+		desc: prometheus.NewDesc(prefix+"_render_age_seconds",
+			"Seconds since the template was last rendered successfully.",
+			[]string{"template", "destination"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *renderAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *renderAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	for id, event := range c.runner.RenderEvents() {
+		if event.LastWouldRender.IsZero() {
+			continue
+		}
+		var dest string
+		if tc := c.runner.templateConfigFor(event.Template); tc != nil {
+			dest = config.StringVal(tc.Destination)
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue,
+			now.Sub(event.LastWouldRender).Seconds(), id, dest)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package manager
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	dep "github.com/hashicorp/consul-template/dependency"
+)
+
+// defaultRemoteField is the field of a Vault secret compared against when the
+// remote does not specify one.
+const defaultRemoteField = "value"
+
+// remoteContents is a remote copy of a template's rendered contents, as
+// configured by the skip_if_unchanged_remote template option. The remote is
+// watched like any other dependency of the template and, when its value is
+// identical to the newly rendered contents, the write and any command are
+// skipped.
+type remoteContents struct {
+	dependency dep.Dependency
+
+	// field is the key of the Vault secret data holding the contents. It is
+	// unused for Consul KV.
+	field string
+}
+
+// newRemoteContents parses the given remote address. Supported addresses are
+// "consul://kv/<key>" and "vault://<path>[#<field>]".
+func newRemoteContents(s string) (*remoteContents, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("skip_if_unchanged_remote: %w", err)
+	}
+
+	switch u.Scheme {
+	case "consul":
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host != "kv" || key == "" {
+			return nil, fmt.Errorf("skip_if_unchanged_remote: invalid consul remote "+
+				"%q, expected consul://kv/<key>", s)
+		}
+		d, err := dep.NewKVGetQuery(key)
+		if err != nil {
+			return nil, fmt.Errorf("skip_if_unchanged_remote: %w", err)
+		}
+		return &remoteContents{dependency: d}, nil
+	case "vault":
+		field := u.Fragment
+		if field == "" {
+			field = defaultRemoteField
+		}
+		d, err := dep.NewVaultReadQuery(u.Host + u.Path)
+		if err != nil {
+			return nil, fmt.Errorf("skip_if_unchanged_remote: %w", err)
+		}
+		return &remoteContents{dependency: d, field: field}, nil
+	default:
+		return nil, fmt.Errorf("skip_if_unchanged_remote: unsupported scheme %q "+
+			"in %q", u.Scheme, s)
+	}
+}
+
+// matches returns true if the given dependency data holds exactly the given
+// contents.
+func (rc *remoteContents) matches(data interface{}, contents []byte) bool {
+	switch v := data.(type) {
+	case string:
+		return v == string(contents)
+	case *dep.Secret:
+		if v == nil {
+			return false
+		}
+		values := v.Data
+		// KVv2 secrets nest the values under "data"
+		if nested, ok := values["data"].(map[string]interface{}); ok {
+			values = nested
+		}
+		s, ok := values[rc.field].(string)
+		return ok && s == string(contents)
+	default:
+		return false
+	}
+}
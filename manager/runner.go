@@ -4,17 +4,23 @@
 package manager
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/hashicorp/consul-template/child"
 	"github.com/hashicorp/consul-template/config"
@@ -24,6 +30,10 @@ import (
 	"github.com/hashicorp/consul-template/watch"
 
 	"github.com/hashicorp/go-multierror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -60,8 +70,10 @@ type Runner struct {
 	// templates is the list of calculated templates.
 	templates []*template.Template
 
-	// renderEvents is a mapping of a template ID to the render event.
-	renderEvents map[string]*RenderEvent
+	// renderEvents is a mapping of a template config to the render event. It
+	// is not keyed by template ID, which is shared by templates with the same
+	// contents.
+	renderEvents map[*config.TemplateConfig]*RenderEvent
 
 	// renderEventLock protects access into the renderEvents map
 	renderEventsLock sync.RWMutex
@@ -83,6 +95,11 @@ type Runner struct {
 
 	// token watcher
 	vaultTokenWatcher *watch.Watcher
+
+	// vaultClusterTokenWatchers watch the tokens of the named Vault clusters.
+	// Their errors are forwarded to vaultClusterTokenErrCh.
+	vaultClusterTokenWatchers []*watch.Watcher
+	vaultClusterTokenErrCh    chan error
 	// watcher is the watcher this runner is using.
 	watcher *watch.Watcher
 
@@ -102,13 +119,52 @@ type Runner struct {
 	// quiescenceRun is the template that was triggered to render via
 	// its respective timer. This flag is an optimization used to avoid infinite
 	// rendering when multiple templates exist.
-	quiescenceMap map[string]*quiescence
+	quiescenceMap map[*config.TemplateConfig]*quiescence
 	quiescenceCh  chan *template.Template
 	quiescenceRun *template.Template
 
+	// pendingCommands is the list of template commands queued while the exec
+	// debounce window is open, in the order they were queued.
+	// execDebounceTimer is the timer closing the window, if it is open.
+	// execDebounceCh is the channel where the timer reports the window closing.
+	pendingCommands   []*config.TemplateConfig
+	execDebounceTimer *time.Timer
+	execDebounceCh    chan struct{}
+
+	// execRetries is the map of template configs whose command failed to the
+	// retry waiting for its backoff, and execRetryCh is the channel where the
+	// timer of a retry reports that it is due. Retries are only handled by
+	// the run loop, so a backoff never holds up rendering.
+	execRetries map[*config.TemplateConfig]*execRetry
+	execRetryCh chan *execRetry
+
+	// refreshCh is the channel where ForceRefresh reports a dependency was
+	// invalidated, so the next run watches it anew.
+	refreshCh chan struct{}
+
 	// dedup is the deduplication manager if enabled
 	dedup *DedupManager
 
+	// remotes is the map of template configs to the remote contents they are
+	// compared against before writing (skip_if_unchanged_remote). It is not
+	// keyed by template ID, which is shared by templates with the same
+	// contents.
+	remotes map[*config.TemplateConfig]*remoteContents
+
+	// renderedHashes is the map of template configs to the hash of the
+	// contents last written (or found already written) to their destination.
+	// A render producing identical contents is not written again, nor does it
+	// trigger the template's command, even if its dependencies changed in
+	// between, as long as the destination still holds those contents.
+	renderedHashes     map[*config.TemplateConfig][sha256.Size]byte
+	renderedHashesLock sync.Mutex
+
+	// rollbacks is the map of template configs with rollback enabled to the
+	// contents their destination held before a render whose command has not
+	// yet succeeded.
+	rollbacks     map[*config.TemplateConfig]*previousContents
+	rollbacksLock sync.Mutex
+
 	// Env represents a custom set of environment variables to populate the
 	// template and command runtime with. These environment variables will be
 	// available in both the command's environment as well as the template's
@@ -142,6 +198,23 @@ type Runner struct {
 	// that the application is ready. This helps in managing application state and
 	// integration with systemd's readiness protocol.
 	readyCh chan struct{}
+
+	// tracer records a span tree for each render cycle. It is a no-op tracer
+	// unless tracing is enabled, and tracerShutdown flushes any spans that
+	// have not yet been exported.
+	tracer         trace.Tracer
+	tracerShutdown func(context.Context) error
+
+	// metrics records render counts and durations. Metrics are discarded
+	// unless a statsd or Prometheus address is configured.
+	metrics *metrics.Metrics
+
+	// metricsServer serves the metrics to Prometheus, if configured.
+	metricsServer *metricsServer
+
+	// webhook is notified of each render which changed a destination, if
+	// configured.
+	webhook *webhook
 }
 
 // RenderEvent captures the time and events that occurred for a template
@@ -207,26 +280,33 @@ type RenderEvent struct {
 // NewRunner accepts a slice of TemplateConfigs and returns a pointer to the new
 // Runner and any error that occurred during creation.
 func NewRunner(config *config.Config, dry bool) (*Runner, error) {
+	// Diff mode prints what would change, so it never writes.
+	if config.DiffMode {
+		dry = true
+	}
+
 	log.Printf("[INFO] (runner) creating new runner (dry: %v, once: %v)",
 		dry, config.Once)
 
 	runner := &Runner{
-		ErrCh:         make(chan error),
-		DoneCh:        make(chan struct{}),
-		ServerErrCh:   make(chan error, 1),
-		config:        config,
-		dry:           dry,
-		inStream:      os.Stdin,
-		outStream:     os.Stdout,
-		errStream:     os.Stderr,
-		renderedCh:    make(chan struct{}, 1),
-		renderEventCh: make(chan struct{}, 1),
-		dependencies:  make(map[string]dep.Dependency),
-		brain:         template.NewBrain(),
-		quiescenceMap: make(map[string]*quiescence),
-		quiescenceCh:  make(chan *template.Template),
-		rendererFn:    config.RendererFunc,
-		readerFn:      config.ReaderFunc,
+		ErrCh:          make(chan error),
+		DoneCh:         make(chan struct{}),
+		ServerErrCh:    make(chan error, 1),
+		config:         config,
+		dry:            dry,
+		inStream:       os.Stdin,
+		outStream:      os.Stdout,
+		errStream:      os.Stderr,
+		renderedCh:     make(chan struct{}, 1),
+		renderEventCh:  make(chan struct{}, 1),
+		dependencies:   make(map[string]dep.Dependency),
+		brain:          template.NewBrain(),
+		quiescenceCh:   make(chan *template.Template),
+		execDebounceCh: make(chan struct{}, 1),
+		execRetryCh:    make(chan *execRetry),
+		refreshCh:      make(chan struct{}, 1),
+		rendererFn:     config.RendererFunc,
+		readerFn:       config.ReaderFunc,
 	}
 
 	if runner.rendererFn == nil {
@@ -247,6 +327,20 @@ func NewRunner(config *config.Config, dry bool) (*Runner, error) {
 	if err != nil {
 		return nil, err
 	}
+	runner.vaultClusterTokenErrCh = make(chan error, 1)
+	if config.VaultClusters != nil {
+		for _, v := range *config.VaultClusters {
+			w, err := watch.VaultTokenWatcher(clients, v, runner.DoneCh)
+			if err != nil {
+				runner.stopWatchers()
+				return nil, err
+			}
+			if w != nil {
+				runner.vaultClusterTokenWatchers = append(runner.vaultClusterTokenWatchers, w)
+				go runner.forwardVaultClusterTokenErrs(w)
+			}
+		}
+	}
 	if err := runner.init(clients); err != nil {
 		return nil, err
 	}
@@ -329,29 +423,7 @@ func (r *Runner) Start() {
 
 			// Enable quiescence for all templates if we have specified wait
 			// intervals.
-		NEXT_Q:
-			for _, t := range r.templates {
-				if _, ok := r.quiescenceMap[t.ID()]; ok {
-					continue NEXT_Q
-				}
-
-				c := r.templateConfigFor(t)
-				if *c.Wait.Enabled {
-					log.Printf("[DEBUG] (runner) enabling template-specific "+
-						"quiescence for %q", t.ID())
-					r.quiescenceMap[t.ID()] = newQuiescence(
-						r.quiescenceCh, *c.Wait.Min, *c.Wait.Max, t)
-					continue NEXT_Q
-				}
-
-				if *r.config.Wait.Enabled {
-					log.Printf("[DEBUG] (runner) enabling global quiescence for %q",
-						t.ID())
-					r.quiescenceMap[t.ID()] = newQuiescence(
-						r.quiescenceCh, *r.config.Wait.Min, *r.config.Wait.Max, t)
-					continue NEXT_Q
-				}
-			}
+			r.enableQuiescence()
 
 			// If an exec command was given and a command is not currently running,
 			// spawn the child process for supervision.
@@ -474,12 +546,47 @@ func (r *Runner) Start() {
 			r.ErrCh <- err
 			return
 
+		case err := <-r.vaultClusterTokenErrCh:
+			// Push the error back up the stack
+			log.Printf("[ERR] (runner): %s", err)
+			r.ErrCh <- err
+			return
+
+		case <-r.execDebounceCh:
+			// The exec debounce window closed, so run the queued commands. There
+			// is nothing new to render.
+			if err := r.runPendingCommands(); err != nil {
+				r.ErrCh <- err
+				return
+			}
+			continue
+
+		case retry := <-r.execRetryCh:
+			// The backoff of a failed command elapsed, so run it again. There
+			// is nothing new to render.
+			if err := r.retryCommand(retry); err != nil {
+				r.ErrCh <- err
+				return
+			}
+			continue
+
+		case <-r.refreshCh:
+			// A dependency was invalidated, so run again to watch it anew.
+			log.Printf("[DEBUG] (runner) dependency refresh forced")
+
 		case tmpl := <-r.quiescenceCh:
 			// Remove the quiescence for this template from the map. This will force
 			// the upcoming Run call to actually evaluate and render the template.
 			log.Printf("[DEBUG] (runner) received template %q from quiescence", tmpl.ID())
 			r.quiescenceRun = tmpl
-			delete(r.quiescenceMap, tmpl.ID())
+			delete(r.quiescenceMap, r.templateConfigFor(tmpl))
+
+			// The templates of a render group are rendered together.
+			for _, t := range r.templates {
+				if r.sameRenderGroup(tmpl, t) {
+					delete(r.quiescenceMap, r.templateConfigFor(t))
+				}
+			}
 
 		case c := <-childExitCh:
 			log.Printf("[INFO] (runner) child process exited")
@@ -524,18 +631,38 @@ func (r *Runner) RenderEventCh() <-chan struct{} {
 }
 
 // RenderEvents returns the render events for each template was rendered. The
-// map is keyed by template ID.
+// map is keyed by template ID, so only one of the events of templates with the
+// same contents is returned.
 func (r *Runner) RenderEvents() map[string]*RenderEvent {
 	r.renderEventsLock.RLock()
 	defer r.renderEventsLock.RUnlock()
 
 	times := make(map[string]*RenderEvent, len(r.renderEvents))
-	for k, v := range r.renderEvents {
-		times[k] = v
+	for _, v := range r.renderEvents {
+		times[v.Template.ID()] = v
 	}
 	return times
 }
 
+// Changed returns the sorted destinations of the templates whose last render
+// changed them. In dry mode these are the destinations which would change.
+func (r *Runner) Changed() []string {
+	r.renderEventsLock.RLock()
+	defer r.renderEventsLock.RUnlock()
+
+	changed := []string{}
+	for _, tmpl := range r.templates {
+		tc := r.templateConfigFor(tmpl)
+		event, ok := r.renderEvents[tc]
+		if !ok || !event.DidRender {
+			continue
+		}
+		changed = append(changed, config.StringVal(tc.Destination))
+	}
+	sort.Strings(changed)
+	return changed
+}
+
 func (r *Runner) internalStop(immediately bool) {
 	r.stopLock.Lock()
 	defer r.stopLock.Unlock()
@@ -548,6 +675,8 @@ func (r *Runner) internalStop(immediately bool) {
 	r.stopDedup()
 	r.stopWatchers()
 	r.stopChild(immediately)
+	r.stopTracer()
+	r.stopMetrics()
 
 	if err := r.deletePid(); err != nil {
 		log.Printf("[WARN] (runner) could not remove pid at %q: %s",
@@ -559,6 +688,25 @@ func (r *Runner) internalStop(immediately bool) {
 	close(r.DoneCh)
 }
 
+func (r *Runner) stopTracer() {
+	if r.tracerShutdown != nil {
+		log.Printf("[DEBUG] (runner) flushing traces")
+		if err := r.tracerShutdown(context.Background()); err != nil {
+			log.Printf("[WARN] (runner) could not flush traces: %s", err)
+		}
+	}
+}
+
+func (r *Runner) stopMetrics() {
+	if r.metrics != nil {
+		log.Printf("[DEBUG] (runner) stopping metrics")
+		r.metrics.Shutdown()
+	}
+	if r.metricsServer != nil {
+		r.metricsServer.Stop()
+	}
+}
+
 func (r *Runner) stopDedup() {
 	if r.dedup != nil {
 		log.Printf("[DEBUG] (runner) stopping de-duplication manager")
@@ -575,6 +723,26 @@ func (r *Runner) stopWatchers() {
 		log.Printf("[DEBUG] (runner) stopping vault token watcher")
 		r.vaultTokenWatcher.Stop()
 	}
+	for _, w := range r.vaultClusterTokenWatchers {
+		w.Stop()
+	}
+}
+
+// forwardVaultClusterTokenErrs forwards the errors of the token watcher of a
+// named Vault cluster until the runner stops.
+func (r *Runner) forwardVaultClusterTokenErrs(w *watch.Watcher) {
+	for {
+		select {
+		case err := <-w.ErrCh():
+			select {
+			case r.vaultClusterTokenErrCh <- err:
+			case <-r.DoneCh:
+				return
+			}
+		case <-r.DoneCh:
+			return
+		}
+	}
 }
 
 func (r *Runner) stopChild(immediately bool) {
@@ -619,6 +787,35 @@ func (r *Runner) Receive(d dep.Dependency, data interface{}) {
 	}
 }
 
+// ForceRefresh invalidates the data for the given dependency and fetches it
+// again right away. Its view is stopped, which interrupts the query in flight,
+// and the next run watches the dependency anew; the templates using it wait
+// for the new data. This is intended for embedders which know out-of-band
+// that the data is stale. It returns false if the dependency is not being
+// watched.
+func (r *Runner) ForceRefresh(d dep.Dependency) bool {
+	if r.watcher == nil || !r.watcher.Remove(d) {
+		return false
+	}
+	r.brain.Forget(d)
+
+	select {
+	case r.refreshCh <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// WatcherSnapshot returns the status of each dependency being watched, sorted
+// by dependency. This is intended for embedders which want to show what is
+// being watched, for example at a debug endpoint.
+func (r *Runner) WatcherSnapshot() []watch.ViewStatus {
+	if r.watcher == nil {
+		return nil
+	}
+	return r.watcher.Snapshot()
+}
+
 // Signal sends a signal to the child process, if it exists. Any errors that
 // occur are returned.
 func (r *Runner) Signal(s os.Signal) error {
@@ -640,26 +837,69 @@ func (r *Runner) Signal(s os.Signal) error {
 func (r *Runner) Run() error {
 	log.Printf("[DEBUG] (runner) initiating run")
 
-	var newRenderEvent, wouldRenderAny, renderedAny bool
+	ctx, cycleSpan := r.tracer.Start(context.Background(), "render cycle")
+	defer cycleSpan.End()
+
+	var newRenderEvent, wouldRenderAny, renderedAny, reloadChild bool
 	runCtx := &templateRunCtx{
 		depsMap: make(map[string]dep.Dependency),
 	}
 
-	for _, tmpl := range r.templates {
-		event, err := r.runTemplate(tmpl, runCtx)
-		if err != nil {
-			return err
+	// commandCtxs maps each queued command to the span of the template which
+	// queued it, so its exec span is recorded beneath that template.
+	commandCtxs := make(map[*config.TemplateConfig]context.Context)
+
+	// The render groups are only written once no template failed, and a
+	// failure writing them fails the run just the same.
+	runs := r.renderTemplates(ctx)
+	if err := r.discardFailedRuns(runs); err != nil {
+		return err
+	}
+	r.writeRenderGroups(runs)
+	if err := r.discardFailedRuns(runs); err != nil {
+		return err
+	}
+
+	// The payloads for the webhook of the templates which changed their
+	// destination.
+	var notifications []*webhookPayload
+
+	// The templates may render concurrently, so their results are merged in
+	// the order of the templates to keep the order of their commands.
+	for i, run := range runs {
+		if run == nil {
+			break
+		}
+		tmpl := r.templates[i]
+
+		for k, d := range run.runCtx.depsMap {
+			if _, ok := runCtx.depsMap[k]; !ok {
+				runCtx.depsMap[k] = d
+			}
+		}
+		for _, t := range run.runCtx.commands {
+			if existing := findCommand(t, runCtx.commands); existing != nil {
+				log.Printf("[DEBUG] (runner) skipping command %q from %s (already appended from %s)",
+					t.Exec.Command, t.Display(), existing.Display())
+				continue
+			}
+			runCtx.commands = append(runCtx.commands, t)
+			commandCtxs[t] = run.ctx
 		}
 
 		// If there was a render event store it
-		if event != nil {
+		if event := run.event; event != nil {
 			r.renderEventsLock.Lock()
-			r.renderEvents[tmpl.ID()] = event
+			r.renderEvents[r.templateConfigFor(tmpl)] = event
 			r.renderEventsLock.Unlock()
 
 			// Record that there is at least one new render event
 			newRenderEvent = true
 
+			if event.Error != nil {
+				r.metrics.IncrCounter([]string{"render", "errors"}, 1)
+			}
+
 			// Record that at least one template would have been rendered.
 			if event.WouldRender {
 				wouldRenderAny = true
@@ -668,6 +908,18 @@ func (r *Runner) Run() error {
 			// Record that at least one template was rendered.
 			if event.DidRender {
 				renderedAny = true
+				r.metrics.IncrCounter([]string{"render", "count"}, 1)
+
+				if r.webhook != nil && !r.dry {
+					notifications = append(notifications,
+						newWebhookPayload(r.templateConfigFor(tmpl), event))
+				}
+
+				// The child process is the fallback command of templates which
+				// do not have their own.
+				if tc := r.templateConfigFor(tmpl); tc == nil || tc.Exec == nil || tc.Exec.Command.Empty() {
+					reloadChild = true
+				}
 			}
 		}
 	}
@@ -677,31 +929,21 @@ func (r *Runner) Run() error {
 
 	// Perform the diff and update the known dependencies.
 	r.diffAndUpdateDeps(runCtx.depsMap)
+	r.metrics.SetGauge([]string{"dependencies", "watched"}, float32(r.watcher.Size()))
 
 	// Execute each command in sequence, collecting any errors that occur - this
-	// ensures all commands execute at least once.
+	// ensures all commands execute at least once. With an exec debounce, the
+	// commands are instead queued until the debounce window closes.
 	var errs []error
-	for _, t := range runCtx.commands {
-		log.Printf("[INFO] (runner) executing command %q from %s",
-			fmt.Sprintf("%q", t.Exec.Command), t.Display())
-		env := t.Exec.Env.Copy()
-		env.Custom = append(r.childEnv(), env.Custom...)
-		if _, err := spawnChild(&spawnChildInput{
-			Stdin:        r.inStream,
-			Stdout:       r.outStream,
-			Stderr:       r.errStream,
-			Command:      t.Exec.Command,
-			Env:          env.Env(),
-			Timeout:      config.TimeDurationVal(t.Exec.Timeout),
-			ReloadSignal: config.SignalVal(t.Exec.ReloadSignal),
-			KillSignal:   config.SignalVal(t.Exec.KillSignal),
-			KillTimeout:  config.TimeDurationVal(t.Exec.KillTimeout),
-			Splay:        config.TimeDurationVal(t.Exec.Splay),
-		}); err != nil {
-			s := fmt.Sprintf("failed to execute command %q from %s",
-				fmt.Sprintf("%q", t.Exec.Command), t.Display())
-			errs = append(errs, errors.Wrap(err, s))
-		}
+	if d := config.TimeDurationVal(r.config.ExecDebounce); d > 0 && !r.config.Once {
+		r.debounceCommands(runCtx.commands, d)
+	} else {
+		errs = r.runCommands(runCtx.commands, commandCtxs)
+	}
+
+	// Notify the webhook without blocking the next render.
+	if len(notifications) > 0 {
+		go r.webhook.notify(notifications)
 	}
 
 	// Check if we need to deliver any rendered signals
@@ -722,8 +964,9 @@ func (r *Runner) Run() error {
 	}
 
 	// If we got this far and have a child process, we need to send the reload
-	// signal to the child process.
-	if renderedAny && r.child != nil {
+	// signal to the child process, unless each rendered template ran its own
+	// command instead.
+	if reloadChild && r.child != nil {
 		r.childLock.RLock()
 		if err := r.child.Reload(); err != nil {
 			errs = append(errs, err)
@@ -744,6 +987,313 @@ func (r *Runner) Run() error {
 	return nil
 }
 
+// runCommands executes each of the given template commands in sequence and
+// returns the errors of those which failed. The exec span of each command is
+// recorded beneath its context in ctxs, if any.
+func (r *Runner) runCommands(commands []*config.TemplateConfig,
+	ctxs map[*config.TemplateConfig]context.Context,
+) []error {
+	var errs []error
+	for _, t := range commands {
+		log.Printf("[INFO] (runner) executing command %q from %s",
+			fmt.Sprintf("%q", t.Exec.Command), t.Display())
+		ctx, ok := ctxs[t]
+		if !ok {
+			ctx = context.Background()
+		}
+		_, span := r.tracer.Start(ctx, "exec",
+			trace.WithAttributes(attribute.StringSlice("command", t.Exec.Command)))
+		if err := r.spawnCommand(t); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if !r.scheduleRetry(t, 0, err) {
+				s := fmt.Sprintf("failed to execute command %q from %s",
+					fmt.Sprintf("%q", t.Exec.Command), t.Display())
+				errs = append(errs, errors.Wrap(err, s))
+				r.rollback(t)
+			}
+		} else {
+			r.cancelRetry(t)
+			r.clearRollbacks(t)
+		}
+		span.End()
+	}
+	return errs
+}
+
+// commandInput returns the input to spawn the command of the template.
+func (r *Runner) commandInput(t *config.TemplateConfig) *spawnChildInput {
+	env := t.Exec.Env.Copy()
+	env.Custom = append(r.childEnv(), env.Custom...)
+	return &spawnChildInput{
+		Stdin:         r.inStream,
+		Stdout:        r.outStream,
+		Stderr:        r.errStream,
+		Command:       t.Exec.Command,
+		Env:           env.Env(),
+		Timeout:       config.TimeDurationVal(t.Exec.Timeout),
+		TimeoutSignal: config.SignalVal(t.Exec.TimeoutSignal),
+		TimeoutGrace:  config.TimeDurationVal(t.Exec.TimeoutGrace),
+		ReloadSignal:  config.SignalVal(t.Exec.ReloadSignal),
+		KillSignal:    config.SignalVal(t.Exec.KillSignal),
+		KillTimeout:   config.TimeDurationVal(t.Exec.KillTimeout),
+		Splay:         config.TimeDurationVal(t.Exec.Splay),
+	}
+}
+
+// spawnCommand spawns the command of the template. In once mode, there is no
+// run loop to retry the command later, so it is retried right away with
+// backoff per the retry configuration of the template while it fails. Only
+// commands with a timeout are waited for, so a command without one is never
+// retried.
+func (r *Runner) spawnCommand(t *config.TemplateConfig) error {
+	err := r.spawnCommandOnce(r.commandInput(t))
+	if !r.config.Once {
+		return err
+	}
+
+	retry := t.Exec.Retry
+	attempts := config.IntVal(retry.Attempts)
+	for n := 0; err != nil && n < attempts; n++ {
+		backoff := retry.RetryBackoff(n)
+		log.Printf("[WARN] (runner) command %q from %s failed, retrying in %s (%d/%d): %v",
+			t.Exec.Command, t.Display(), backoff, n+1, attempts, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-r.DoneCh:
+			return err
+		}
+		err = r.spawnCommandOnce(r.commandInput(t))
+	}
+
+	if err != nil && attempts > 0 {
+		log.Printf("[ERR] (runner) command %q from %s failed after %d retries",
+			t.Exec.Command, t.Display(), attempts)
+	}
+	return err
+}
+
+// execRetry is a retry of the failed command of a template, after the given
+// number of retries already made.
+type execRetry struct {
+	tc      *config.TemplateConfig
+	retries int
+	timer   *time.Timer
+}
+
+// scheduleRetry schedules a retry of the failed command of the template, after
+// the given number of retries already made, unless the command is run in once
+// mode or exhausted its retries. It returns true if a retry was scheduled, or
+// is already pending since the command failed again before its retry.
+func (r *Runner) scheduleRetry(t *config.TemplateConfig, retries int, err error) bool {
+	if r.config.Once {
+		return false
+	}
+	if pending, ok := r.execRetries[t]; ok && pending.timer != nil {
+		log.Printf("[WARN] (runner) command %q from %s failed, retry already pending: %v",
+			t.Exec.Command, t.Display(), err)
+		return true
+	}
+
+	attempts := config.IntVal(t.Exec.Retry.Attempts)
+	if retries >= attempts {
+		delete(r.execRetries, t)
+		if attempts > 0 {
+			log.Printf("[ERR] (runner) command %q from %s failed after %d retries",
+				t.Exec.Command, t.Display(), attempts)
+		}
+		return false
+	}
+
+	backoff := t.Exec.Retry.RetryBackoff(retries)
+	log.Printf("[WARN] (runner) command %q from %s failed, retrying in %s (%d/%d): %v",
+		t.Exec.Command, t.Display(), backoff, retries+1, attempts, err)
+
+	retry := &execRetry{tc: t, retries: retries + 1}
+	retry.timer = time.AfterFunc(backoff, func() {
+		select {
+		case r.execRetryCh <- retry:
+		case <-r.DoneCh:
+		}
+	})
+	r.execRetries[t] = retry
+	return true
+}
+
+// cancelRetry cancels the pending retry of the command of the template, if
+// any, since the command succeeded in the meantime.
+func (r *Runner) cancelRetry(t *config.TemplateConfig) {
+	if retry, ok := r.execRetries[t]; ok {
+		retry.timer.Stop()
+		delete(r.execRetries, t)
+	}
+}
+
+// retryCommand runs the command of a retry which is due. Once the command
+// exhausted its retries, the destinations sharing it are rolled back and the
+// error is returned.
+func (r *Runner) retryCommand(retry *execRetry) error {
+	t := retry.tc
+	if r.execRetries[t] != retry {
+		// The retry was canceled or superseded after its timer fired.
+		return nil
+	}
+	retry.timer = nil
+
+	log.Printf("[INFO] (runner) retrying command %q from %s (%d/%d)",
+		t.Exec.Command, t.Display(), retry.retries, config.IntVal(t.Exec.Retry.Attempts))
+	err := r.spawnCommandOnce(r.commandInput(t))
+	if err == nil {
+		delete(r.execRetries, t)
+		r.clearRollbacks(t)
+		return nil
+	}
+
+	if r.scheduleRetry(t, retry.retries, err) {
+		return nil
+	}
+	r.rollback(t)
+	return errors.Wrap(err, fmt.Sprintf("failed to execute command %q from %s",
+		t.Exec.Command, t.Display()))
+}
+
+// spawnCommandOnce spawns a template command, counting its invocation and
+// whether it failed.
+func (r *Runner) spawnCommandOnce(i *spawnChildInput) error {
+	r.metrics.IncrCounter([]string{"exec", "count"}, 1)
+	_, err := spawnChild(i)
+	if err != nil {
+		r.metrics.IncrCounter([]string{"exec", "errors"}, 1)
+	}
+	return err
+}
+
+// previousContents are the contents of a template destination before it was
+// rendered.
+type previousContents struct {
+	contents []byte
+	exists   bool
+}
+
+// readPreviousContents reads the contents of the destination at the given path
+// so they can be restored later. Named pipes and sockets cannot be restored,
+// so nil is returned for those.
+func readPreviousContents(path string) (*previousContents, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return &previousContents{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &previousContents{contents: b, exists: true}, nil
+}
+
+// restore writes the previous contents back to the destination of the template.
+// A destination which did not exist before is removed.
+func (p *previousContents) restore(tc *config.TemplateConfig) error {
+	dest := config.StringVal(tc.Destination)
+	if p.exists {
+		return renderer.AtomicWrite(dest, false, p.contents, config.FileModeVal(tc.Perms), false)
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// rollback restores the previous contents of the destinations of the templates
+// sharing the failed command of the given template. A destination which did
+// not exist before is removed.
+func (r *Runner) rollback(t *config.TemplateConfig) {
+	r.rollbacksLock.Lock()
+	defer r.rollbacksLock.Unlock()
+
+	for tc, previous := range r.rollbacks {
+		if !reflect.DeepEqual(tc.Exec.Command, t.Exec.Command) {
+			continue
+		}
+		delete(r.rollbacks, tc)
+
+		// The rolled back contents no longer match the last render, so the
+		// template must be rendered again rather than skipped as unchanged.
+		r.renderedHashesLock.Lock()
+		delete(r.renderedHashes, tc)
+		r.renderedHashesLock.Unlock()
+
+		log.Printf("[INFO] (runner) rolling back %s", tc.Display())
+		if err := previous.restore(tc); err != nil {
+			log.Printf("[ERR] (runner) failed to roll back %s: %v", tc.Display(), err)
+		}
+	}
+}
+
+// clearRollbacks forgets the previous contents of the destinations of the
+// templates sharing the successful command of the given template.
+func (r *Runner) clearRollbacks(t *config.TemplateConfig) {
+	r.rollbacksLock.Lock()
+	defer r.rollbacksLock.Unlock()
+
+	for tc := range r.rollbacks {
+		if reflect.DeepEqual(tc.Exec.Command, t.Exec.Command) {
+			delete(r.rollbacks, tc)
+		}
+	}
+}
+
+// debounceCommands queues the given template commands to be run when the exec
+// debounce window closes, skipping those already queued. The window opens with
+// the first queued command and is not extended by later ones, so a command
+// runs at most once per window.
+func (r *Runner) debounceCommands(commands []*config.TemplateConfig, d time.Duration) {
+	for _, t := range commands {
+		if existing := findCommand(t, r.pendingCommands); existing != nil {
+			log.Printf("[DEBUG] (runner) skipping command %q from %s (already debounced from %s)",
+				t.Exec.Command, t.Display(), existing.Display())
+			continue
+		}
+		log.Printf("[DEBUG] (runner) debouncing command %q from %s for %s",
+			t.Exec.Command, t.Display(), d)
+		r.pendingCommands = append(r.pendingCommands, t)
+	}
+
+	if len(r.pendingCommands) > 0 && r.execDebounceTimer == nil {
+		r.execDebounceTimer = time.AfterFunc(d, func() {
+			select {
+			case r.execDebounceCh <- struct{}{}:
+			default:
+			}
+		})
+	}
+}
+
+// runPendingCommands executes the commands queued during the exec debounce
+// window which just closed.
+func (r *Runner) runPendingCommands() error {
+	commands := r.pendingCommands
+	r.pendingCommands = nil
+	r.execDebounceTimer = nil
+
+	errs := r.runCommands(commands, nil)
+	if len(errs) != 0 {
+		var result *multierror.Error
+		for _, err := range errs {
+			result = multierror.Append(result, err)
+		}
+		return result.ErrorOrNil()
+	}
+	return nil
+}
+
 // SetReadyChannel sets the readyCh channel which is used to signal readiness to the systemd init system.
 // The channel should be a struct{} channel, and when an empty struct is sent on this channel,
 // it will trigger a notification to systemd that the application is ready.
@@ -751,6 +1301,84 @@ func (r *Runner) SetReadyChannel(ch chan struct{}) {
 	r.readyCh = ch
 }
 
+// templateRun is the result of running a single template.
+type templateRun struct {
+	event  *RenderEvent
+	err    error
+	runCtx *templateRunCtx
+
+	// ctx is the context of the span of the template.
+	ctx context.Context
+}
+
+// renderTemplates runs each template, at most RenderConcurrency of them at once,
+// and returns their results in the order of the templates. Each template runs
+// with its own run context, which the caller merges. Once a template fails, no
+// further templates are started and their results are nil. Dry runs stream
+// their output, so they always render one template at a time.
+func (r *Runner) renderTemplates(ctx context.Context) []*templateRun {
+	limit := config.IntVal(r.config.RenderConcurrency)
+	if limit < 1 || r.dry {
+		limit = 1
+	}
+
+	runs := make([]*templateRun, len(r.templates))
+	sem := make(chan struct{}, limit)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i, tmpl := range r.templates {
+		sem <- struct{}{}
+		if failed.Load() {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, tmpl *template.Template) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			runs[i] = r.renderTemplate(ctx, tmpl)
+			if runs[i].err != nil {
+				failed.Store(true)
+			}
+		}(i, tmpl)
+	}
+	wg.Wait()
+
+	return runs
+}
+
+// renderTemplate runs the template within its own span and run context.
+func (r *Runner) renderTemplate(ctx context.Context, tmpl *template.Template) *templateRun {
+	tmplCtx, span := r.tracer.Start(ctx, "render",
+		trace.WithAttributes(attribute.String("template", tmpl.ID())))
+	defer span.End()
+
+	run := &templateRun{
+		ctx: tmplCtx,
+		runCtx: &templateRunCtx{
+			depsMap: make(map[string]dep.Dependency),
+		},
+	}
+
+	start := time.Now()
+	run.event, run.err = r.runTemplate(tmpl, run.runCtx)
+	r.metrics.MeasureSince([]string{"render", "duration"}, start)
+	if run.err != nil {
+		span.RecordError(run.err)
+		span.SetStatus(codes.Error, run.err.Error())
+		return run
+	}
+
+	if run.event != nil {
+		span.SetAttributes(
+			attribute.Bool("would_render", run.event.WouldRender),
+			attribute.Bool("did_render", run.event.DidRender),
+		)
+	}
+	return run
+}
+
 type templateRunCtx struct {
 	// commands is the set of commands that will be executed after all templates
 	// have run. When adding to the commands, care should be taken not to
@@ -759,6 +1387,17 @@ type templateRunCtx struct {
 
 	// depsMap is the set of dependencies shared across all templates.
 	depsMap map[string]dep.Dependency
+
+	// pending is the rendered contents of a render group member which is yet
+	// to be written.
+	pending *pendingWrite
+}
+
+// pendingWrite is the rendered contents of a template which is yet to be
+// written to its destination.
+type pendingWrite struct {
+	contents []byte
+	hash     [sha256.Size]byte
 }
 
 // runTemplate is used to run a particular template. It takes as input the
@@ -772,7 +1411,7 @@ func (r *Runner) runTemplate(tmpl *template.Template, runCtx *templateRunCtx) (*
 
 	// Grab the last event
 	r.renderEventsLock.RLock()
-	lastEvent := r.renderEvents[tmpl.ID()]
+	lastEvent := r.renderEvents[r.templateConfigFor(tmpl)]
 	r.renderEventsLock.RUnlock()
 
 	// Create the event
@@ -797,7 +1436,7 @@ func (r *Runner) runTemplate(tmpl *template.Template, runCtx *templateRunCtx) (*
 	// in once mode, and we certainly do not want to re-run any commands.
 	if r.config.Once {
 		r.renderEventsLock.RLock()
-		onceEvent, ok := r.renderEvents[tmpl.ID()]
+		onceEvent, ok := r.renderEvents[r.templateConfigFor(tmpl)]
 		r.renderEventsLock.RUnlock()
 		if ok && (onceEvent.WouldRender || onceEvent.DidRender) {
 			log.Printf("[DEBUG] (runner) once mode and already rendered")
@@ -836,6 +1475,16 @@ func (r *Runner) runTemplate(tmpl *template.Template, runCtx *templateRunCtx) (*
 	// Grab the list of used and missing dependencies.
 	missing, used := result.Missing, result.Used
 
+	// The remote contents the template is compared against are a dependency
+	// of the template like any other.
+	remote := r.remotes[r.templateConfigFor(tmpl)]
+	if remote != nil {
+		used.Add(remote.dependency)
+		if _, ok := r.brain.Recall(remote.dependency); !ok {
+			missing.Add(remote.dependency)
+		}
+	}
+
 	if l := missing.Len(); l > 0 {
 		log.Printf("[DEBUG] (runner) missing data for %d dependencies", l)
 		for _, missingDependency := range missing.List() {
@@ -900,7 +1549,7 @@ func (r *Runner) runTemplate(tmpl *template.Template, runCtx *templateRunCtx) (*
 		}
 	}
 
-	if r.quiescenceRun != nil && r.quiescenceRun != tmpl {
+	if r.quiescenceRun != nil && r.quiescenceRun != tmpl && !r.sameRenderGroup(r.quiescenceRun, tmpl) {
 		// During a run triggered via quiescence, mark any template not corresponding to
 		// the quiescence timer as ForQuiescence, signaling it was purposefully skipped.
 		event.ForQuiescence = true
@@ -909,7 +1558,7 @@ func (r *Runner) runTemplate(tmpl *template.Template, runCtx *templateRunCtx) (*
 
 	// If quiescence is activated, start/update the timers and loop back around.
 	// We do not want to render the templates yet.
-	if q, ok := r.quiescenceMap[tmpl.ID()]; ok {
+	if q, ok := r.quiescenceMap[r.templateConfigFor(tmpl)]; ok {
 		q.tick()
 		// This event is being returned early for quiescence
 		event.ForQuiescence = true
@@ -919,81 +1568,289 @@ func (r *Runner) runTemplate(tmpl *template.Template, runCtx *templateRunCtx) (*
 	// For each template configuration that is tied to this template, attempt to
 	// render it to disk and accumulate commands for later use.
 	templateConfig := r.templateConfigFor(tmpl)
+	if templateConfig != nil && remote != nil {
+		if data, _ := r.brain.Recall(remote.dependency); remote.matches(data, result.Output) {
+			log.Printf("[DEBUG] (runner) skipping %s, contents match %s",
+				templateConfig.Display(), remote.dependency)
+			event.WouldRender = true
+			event.LastWouldRender = time.Now().UTC()
+			return event, nil
+		}
+	}
+	hash := sha256.Sum256(result.Output)
+	if templateConfig != nil && r.unchangedSinceRender(templateConfig, hash) {
+		log.Printf("[DEBUG] (runner) skipping %s, contents unchanged since last render",
+			templateConfig.Display())
+		event.WouldRender = true
+		event.LastWouldRender = time.Now().UTC()
+		return event, nil
+	}
 	if templateConfig != nil {
-		log.Printf("[DEBUG] (runner) rendering %s", templateConfig.Display())
-
-		// Render the template, taking dry mode into account
-		result, err := r.rendererFn(&renderer.RenderInput{
-			Backup:         config.BoolVal(templateConfig.Backup),
-			Contents:       result.Output,
-			CreateDestDirs: config.BoolVal(templateConfig.CreateDestDirs),
-			Dry:            r.dry,
-			DryStream:      r.outStream,
-			Path:           config.StringVal(templateConfig.Destination),
-			Perms:          config.FileModeVal(templateConfig.Perms),
-			User:           config.StringVal(templateConfig.User),
-			Group:          config.StringVal(templateConfig.Group),
-		})
-		if err != nil {
-			if tmpl.ErrFatal() {
-				return nil, errors.Wrap(err, "error rendering "+templateConfig.Display())
-			}
-			log.Printf("[ERR] (runner) error rendering: %s: %v", templateConfig.Display(), err)
-			event.Error = err
+		// The members of a render group are only written once all of them are
+		// ready, after all templates have run.
+		if config.StringVal(templateConfig.RenderGroup) != "" {
+			runCtx.pending = &pendingWrite{contents: result.Output, hash: hash}
 			return event, nil
 		}
 
-		renderTime := time.Now().UTC()
+		if err := r.writeTemplate(tmpl, event, result.Output, hash, runCtx); err != nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
 
-		// If we would have rendered this template (but we did not because the
-		// contents were the same or something), we should consider this template
-		// rendered even though the contents on disk have not been updated. We
-		// will not fire commands unless the template was _actually_ rendered to
-		// disk though.
-		if result.WouldRender {
-			// This event would have rendered
-			event.WouldRender = true
-			event.LastWouldRender = renderTime
+// discardFailedRuns returns the error of the first template which failed
+// fatally, if any. The commands of the templates rendered alongside it are
+// dropped with the run, so their hashes are forgotten as well; otherwise the
+// next run would skip them as unchanged.
+func (r *Runner) discardFailedRuns(runs []*templateRun) error {
+	var err error
+	for _, run := range runs {
+		if run != nil && run.err != nil {
+			err = run.err
+			break
 		}
+	}
+	if err == nil {
+		return nil
+	}
+	r.metrics.IncrCounter([]string{"render", "errors"}, 1)
 
-		// If we _actually_ rendered the template to disk, we want to run the
-		// appropriate commands.
-		if result.DidRender {
-			log.Printf("[INFO] (runner) rendered %s", templateConfig.Display())
+	r.renderedHashesLock.Lock()
+	defer r.renderedHashesLock.Unlock()
+	for i, run := range runs {
+		if run != nil && run.event != nil && run.event.DidRender {
+			delete(r.renderedHashes, r.templateConfigFor(r.templates[i]))
+		}
+	}
+	return err
+}
 
-			// This event did render
-			event.DidRender = true
-			event.LastDidRender = renderTime
+// writeRenderGroups writes the pending contents of the templates of each render
+// group once every template of the group is ready, that is it rendered with
+// all of its data and without errors. Should writing one of them fail, those
+// written before it are restored, so the destinations of a group change
+// together or not at all.
+func (r *Runner) writeRenderGroups(runs []*templateRun) {
+	var names []string
+	groups := make(map[string][]int)
+	for i, tmpl := range r.templates {
+		tc := r.templateConfigFor(tmpl)
+		if tc == nil || config.StringVal(tc.RenderGroup) == "" {
+			continue
+		}
+		name := config.StringVal(tc.RenderGroup)
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], i)
+	}
 
-			// Update the contents
-			event.Contents = result.Contents
+NEXT_GROUP:
+	for _, name := range names {
+		members := groups[name]
+		for _, i := range members {
+			if !renderGroupMemberReady(runs[i]) {
+				log.Printf("[DEBUG] (runner) render group %q is not ready, waiting on %s",
+					name, r.templateConfigFor(r.templates[i]).Display())
+				continue NEXT_GROUP
+			}
+		}
 
+		type written struct {
+			run      *templateRun
+			event    RenderEvent
+			previous *previousContents
+		}
+		var done []written
+		for _, i := range members {
+			run, tmpl := runs[i], r.templates[i]
+			pending := run.runCtx.pending
+			if pending == nil {
+				continue
+			}
+			run.runCtx.pending = nil
+
+			w := written{run: run, event: *run.event}
 			if !r.dry {
-				// If the template was rendered (changed) and we are not in dry-run mode,
-				// aggregate commands, ignoring previously known commands
-				//
-				// Future-self Q&A: Why not use a map for the commands instead of an
-				// array with an expensive lookup option? Well I'm glad you asked that
-				// future-self! One of the API promises is that commands are executed
-				// in the order in which they are provided in the TemplateConfig
-				// definitions. If we inserted commands into a map, we would lose that
-				// relative ordering and people would be unhappy.
-				if c := templateConfig.Exec.Command; !c.Empty() {
-					existing := findCommand(templateConfig, runCtx.commands)
-					if existing != nil {
-						log.Printf("[DEBUG] (runner) skipping command %q from %s (already appended from %s)",
-							c, templateConfig.Display(), existing.Display())
-					} else {
-						log.Printf("[DEBUG] (runner) appending command %q from %s",
-							c, templateConfig.Display())
-						runCtx.commands = append(runCtx.commands, templateConfig)
-					}
+				var err error
+				w.previous, err = readPreviousContents(config.StringVal(r.templateConfigFor(tmpl).Destination))
+				if err != nil {
+					log.Printf("[WARN] (runner) cannot restore %s: %v", tmpl.ID(), err)
 				}
 			}
+
+			run.err = r.writeTemplate(tmpl, run.event, pending.contents, pending.hash, run.runCtx)
+			if run.err == nil && run.event.Error == nil {
+				done = append(done, w)
+				continue
+			}
+
+			log.Printf("[ERR] (runner) failed to write render group %q, restoring %d templates",
+				name, len(done))
+			for _, w := range done {
+				r.restoreGroupMember(w.run, w.previous)
+				*w.run.event = w.event
+			}
+			break
 		}
 	}
+}
 
-	return event, nil
+// renderGroupMemberReady returns true if the template of a render group has its
+// contents ready to be written, or has nothing to write since it was already
+// rendered in once mode or its contents are unchanged.
+func renderGroupMemberReady(run *templateRun) bool {
+	if run == nil || run.err != nil {
+		return false
+	}
+	return run.event == nil || run.runCtx.pending != nil || run.event.WouldRender
+}
+
+// restoreGroupMember restores the destination of a template of a render group
+// written during this run, and drops its command.
+func (r *Runner) restoreGroupMember(run *templateRun, previous *previousContents) {
+	tmpl := run.event.Template
+	tc := r.templateConfigFor(tmpl)
+	run.runCtx.commands = nil
+
+	r.renderedHashesLock.Lock()
+	delete(r.renderedHashes, tc)
+	r.renderedHashesLock.Unlock()
+
+	r.rollbacksLock.Lock()
+	delete(r.rollbacks, tc)
+	r.rollbacksLock.Unlock()
+
+	if previous == nil {
+		return
+	}
+	if err := previous.restore(tc); err != nil {
+		log.Printf("[ERR] (runner) failed to restore %s: %v", tc.Display(), err)
+	}
+}
+
+// sameRenderGroup returns true if both templates belong to the same render
+// group.
+func (r *Runner) sameRenderGroup(a, b *template.Template) bool {
+	ac, bc := r.templateConfigFor(a), r.templateConfigFor(b)
+	if ac == nil || bc == nil {
+		return false
+	}
+	group := config.StringVal(ac.RenderGroup)
+	return group != "" && group == config.StringVal(bc.RenderGroup)
+}
+
+// writeTemplate writes the rendered contents of the template to its
+// destination, taking dry mode into account, records the outcome on the event
+// and queues the command of the template onto the run context. An error is
+// only returned when the errors of the template are fatal.
+func (r *Runner) writeTemplate(tmpl *template.Template, event *RenderEvent,
+	contents []byte, hash [sha256.Size]byte, runCtx *templateRunCtx,
+) error {
+	templateConfig := r.templateConfigFor(tmpl)
+	log.Printf("[DEBUG] (runner) rendering %s", templateConfig.Display())
+
+	// Keep the current contents of the destination, so they can be
+	// restored if the command fails.
+	var previous *previousContents
+	if !r.dry && config.BoolVal(templateConfig.Exec.Rollback) &&
+		!templateConfig.Exec.Command.Empty() {
+		var err error
+		if previous, err = readPreviousContents(config.StringVal(templateConfig.Destination)); err != nil {
+			log.Printf("[WARN] (runner) cannot roll back %s: %v", templateConfig.Display(), err)
+		}
+	}
+
+	// Render the template, taking dry mode into account
+	result, err := r.rendererFn(&renderer.RenderInput{
+		Backup:         config.BoolVal(templateConfig.Backup),
+		Contents:       contents,
+		CreateDestDirs: config.BoolVal(templateConfig.CreateDestDirs),
+		Dry:            r.dry,
+		DryStream:      r.outStream,
+		Diff:           r.config.DiffMode,
+		Path:           config.StringVal(templateConfig.Destination),
+		Perms:          config.FileModeVal(templateConfig.Perms),
+		User:           config.StringVal(templateConfig.User),
+		Group:          config.StringVal(templateConfig.Group),
+	})
+	if err != nil {
+		if tmpl.ErrFatal() {
+			return errors.Wrap(err, "error rendering "+templateConfig.Display())
+		}
+		log.Printf("[ERR] (runner) error rendering: %s: %v", templateConfig.Display(), err)
+		event.Error = err
+		return nil
+	}
+
+	renderTime := time.Now().UTC()
+
+	// Either way, the destination now holds these contents.
+	if result.WouldRender || result.DidRender {
+		r.renderedHashesLock.Lock()
+		r.renderedHashes[templateConfig] = hash
+		r.renderedHashesLock.Unlock()
+	}
+
+	// If we would have rendered this template (but we did not because the
+	// contents were the same or something), we should consider this template
+	// rendered even though the contents on disk have not been updated. We
+	// will not fire commands unless the template was _actually_ rendered to
+	// disk though.
+	if result.WouldRender {
+		// This event would have rendered
+		event.WouldRender = true
+		event.LastWouldRender = renderTime
+	}
+
+	// If we _actually_ rendered the template to disk, we want to run the
+	// appropriate commands.
+	if result.DidRender {
+		log.Printf("[INFO] (runner) rendered %s", templateConfig.Display())
+
+		// This event did render
+		event.DidRender = true
+		event.LastDidRender = renderTime
+
+		// Update the contents
+		event.Contents = result.Contents
+
+		if previous != nil {
+			r.rollbacksLock.Lock()
+			if _, ok := r.rollbacks[templateConfig]; !ok {
+				r.rollbacks[templateConfig] = previous
+			}
+			r.rollbacksLock.Unlock()
+		}
+
+		if !r.dry {
+			// If the template was rendered (changed) and we are not in dry-run mode,
+			// aggregate commands, ignoring previously known commands
+			//
+			// Future-self Q&A: Why not use a map for the commands instead of an
+			// array with an expensive lookup option? Well I'm glad you asked that
+			// future-self! One of the API promises is that commands are executed
+			// in the order in which they are provided in the TemplateConfig
+			// definitions. If we inserted commands into a map, we would lose that
+			// relative ordering and people would be unhappy.
+			if c := templateConfig.Exec.Command; !c.Empty() {
+				existing := findCommand(templateConfig, runCtx.commands)
+				if existing != nil {
+					log.Printf("[DEBUG] (runner) skipping command %q from %s (already appended from %s)",
+						c, templateConfig.Display(), existing.Display())
+				} else {
+					log.Printf("[DEBUG] (runner) appending command %q from %s",
+						c, templateConfig.Display())
+					runCtx.commands = append(runCtx.commands, templateConfig)
+				}
+			}
+		}
+	}
+
+	return nil
 }
 
 // init() creates the Runner's underlying data structures and returns an error
@@ -1012,12 +1869,40 @@ func (r *Runner) init(clients *dep.ClientSet) error {
 
 	dep.SetVaultDefaultLeaseDuration(config.TimeDurationVal(r.config.Vault.DefaultLeaseDuration))
 	dep.SetVaultLeaseRenewalThreshold(*r.config.Vault.LeaseRenewalThreshold)
+	dep.SetVaultLeaseRenewalJitter(*r.config.Vault.LeaseRenewalJitter)
+	dep.SetVaultLeaseRenewalMinSleep(config.TimeDurationVal(r.config.Vault.LeaseRenewalMinSleep))
+	dep.SetVaultLeaseRenewalGrace(*r.config.Vault.LeaseRenewalGrace)
 
-	// Create the watcher
-	r.watcher = newWatcher(r.config, clients)
+	// Create the tracer, the metrics and the watcher
+	r.tracer, r.tracerShutdown, err = newTracer(r.config.Tracing)
+	if err != nil {
+		return errors.Wrap(err, "runner")
+	}
+	var registry *prometheus.Registry
+	r.metrics, registry, err = newMetrics(r.config.Telemetry)
+	if err != nil {
+		return errors.Wrap(err, "runner")
+	}
+	if registry != nil {
+		prefix := config.StringVal(r.config.Telemetry.MetricsPrefix)
+		if err := registry.Register(newRenderAgeCollector(r, prefix)); err != nil {
+			return errors.Wrap(err, "runner")
+		}
+		addr := config.StringVal(r.config.Telemetry.PrometheusAddress)
+		if r.metricsServer, err = newMetricsServer(addr, registry); err != nil {
+			return errors.Wrap(err, "runner")
+		}
+	}
+	r.watcher = newWatcher(r.config, clients, r.tracer, r.metrics)
+	r.webhook = newWebhook(r.config.Webhook, r.DoneCh)
 
 	numTemplates := len(*r.config.Templates)
 	templates := make([]*template.Template, 0, numTemplates)
+	r.remotes = make(map[*config.TemplateConfig]*remoteContents)
+	r.renderedHashes = make(map[*config.TemplateConfig][sha256.Size]byte)
+	r.rollbacks = make(map[*config.TemplateConfig]*previousContents)
+	r.execRetries = make(map[*config.TemplateConfig]*execRetry)
+	r.quiescenceMap = make(map[*config.TemplateConfig]*quiescence)
 
 	// Iterate over each TemplateConfig, creating a new Template resource for each
 	// entry. Templates are parsed and saved, and a map of templates to their
@@ -1043,6 +1928,8 @@ func (r *Runner) init(clients *dep.ClientSet) error {
 			ExtFuncMap:       ctmpl.ExtFuncMap,
 			FunctionDenylist: ctmpl.FunctionDenylist,
 			SandboxPath:      config.StringVal(ctmpl.SandboxPath),
+			PluginTimeout:    config.TimeDurationVal(ctmpl.PluginTimeout),
+			PluginMaxOutput:  config.IntVal(ctmpl.PluginMaxOutputBytes),
 			Destination:      config.StringVal(ctmpl.Destination),
 			Config:           ctmpl,
 			ReaderFunc:       r.config.ReaderFunc,
@@ -1051,6 +1938,14 @@ func (r *Runner) init(clients *dep.ClientSet) error {
 			return err
 		}
 
+		if s := config.StringVal(ctmpl.SkipIfUnchangedRemote); s != "" {
+			remote, err := newRemoteContents(s)
+			if err != nil {
+				return err
+			}
+			r.remotes[ctmpl] = remote
+		}
+
 		templates = append(templates, tmpl)
 	}
 
@@ -1058,7 +1953,7 @@ func (r *Runner) init(clients *dep.ClientSet) error {
 	// back into an array of templates.
 	r.templates = templates
 
-	r.renderEvents = make(map[string]*RenderEvent, numTemplates)
+	r.renderEvents = make(map[*config.TemplateConfig]*RenderEvent, numTemplates)
 
 	if *r.config.Dedup.Enabled {
 		if r.config.Once {
@@ -1104,6 +1999,37 @@ func (r *Runner) templateConfigFor(tmpl *template.Template) *config.TemplateConf
 	return tmpl.Config()
 }
 
+// unchangedSinceRender returns true if the given hash of the rendered contents
+// matches the contents last rendered for the template, so the write and the
+// command can be skipped. If the destination was removed or modified since,
+// it is rendered again. Only regular files are compared: named pipes and
+// sockets are delivered to on every render, and a destination with an owner
+// to enforce is left to the renderer.
+func (r *Runner) unchangedSinceRender(tc *config.TemplateConfig, hash [sha256.Size]byte) bool {
+	r.renderedHashesLock.Lock()
+	last, ok := r.renderedHashes[tc]
+	r.renderedHashesLock.Unlock()
+	if !ok || last != hash {
+		return false
+	}
+	if r.dry {
+		return true
+	}
+	if config.StringVal(tc.User) != "" || config.StringVal(tc.Group) != "" {
+		return false
+	}
+
+	path := config.StringVal(tc.Destination)
+	if fi, err := os.Lstat(path); err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return sha256.Sum256(current) == hash
+}
+
 // TemplateConfigMapping returns a mapping between the template ID and the set
 // of TemplateConfig represented by the template ID
 func (r *Runner) TemplateConfigMapping() map[string][]*config.TemplateConfig {
@@ -1129,7 +2055,7 @@ func (r *Runner) allTemplatesRendered() bool {
 	defer r.renderEventsLock.RUnlock()
 
 	for _, tmpl := range r.templates {
-		event, rendered := r.renderEvents[tmpl.ID()]
+		event, rendered := r.renderEvents[r.templateConfigFor(tmpl)]
 		if !rendered {
 			return false
 		}
@@ -1278,16 +2204,18 @@ func (r *Runner) SetErrStream(err io.Writer) {
 
 // spawnChildInput is used as input to spawn a child process.
 type spawnChildInput struct {
-	Stdin        io.Reader
-	Stdout       io.Writer
-	Stderr       io.Writer
-	Command      []string
-	Timeout      time.Duration
-	Env          []string
-	ReloadSignal os.Signal
-	KillSignal   os.Signal
-	KillTimeout  time.Duration
-	Splay        time.Duration
+	Stdin         io.Reader
+	Stdout        io.Writer
+	Stderr        io.Writer
+	Command       []string
+	Timeout       time.Duration
+	TimeoutSignal os.Signal
+	TimeoutGrace  time.Duration
+	Env           []string
+	ReloadSignal  os.Signal
+	KillSignal    os.Signal
+	KillTimeout   time.Duration
+	Splay         time.Duration
 }
 
 // spawnChild spawns a child process with the given inputs and returns the
@@ -1298,18 +2226,20 @@ func spawnChild(i *spawnChildInput) (*child.Child, error) {
 		return nil, errors.Wrap(err, "failed parsing command")
 	}
 	child, err := child.New(&child.NewInput{
-		Stdin:        i.Stdin,
-		Stdout:       i.Stdout,
-		Stderr:       i.Stderr,
-		Command:      args[0],
-		Args:         args[1:],
-		Env:          i.Env,
-		Timeout:      i.Timeout,
-		ReloadSignal: i.ReloadSignal,
-		KillSignal:   i.KillSignal,
-		KillTimeout:  i.KillTimeout,
-		Splay:        i.Splay,
-		Setpgid:      subshell, // setpgid for subshells to propagate signals
+		Stdin:         i.Stdin,
+		Stdout:        i.Stdout,
+		Stderr:        i.Stderr,
+		Command:       args[0],
+		Args:          args[1:],
+		Env:           i.Env,
+		Timeout:       i.Timeout,
+		TimeoutSignal: i.TimeoutSignal,
+		TimeoutGrace:  i.TimeoutGrace,
+		ReloadSignal:  i.ReloadSignal,
+		KillSignal:    i.KillSignal,
+		KillTimeout:   i.KillTimeout,
+		Splay:         i.Splay,
+		Setpgid:       subshell, // setpgid for subshells to propagate signals
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating child")
@@ -1321,13 +2251,42 @@ func spawnChild(i *spawnChildInput) (*child.Child, error) {
 	return child, nil
 }
 
+// enableQuiescence sets up a quiescence timer for each template that does not
+// already have one. A template's own wait takes precedence over the global
+// wait, so each template is debounced independently of the others.
+func (r *Runner) enableQuiescence() {
+	for _, t := range r.templates {
+		c := r.templateConfigFor(t)
+		if _, ok := r.quiescenceMap[c]; ok {
+			continue
+		}
+
+		if *c.Wait.Enabled {
+			log.Printf("[DEBUG] (runner) enabling template-specific "+
+				"quiescence for %q", t.ID())
+			r.quiescenceMap[c] = newQuiescence(
+				r.quiescenceCh, *c.Wait.Min, *c.Wait.Max, t)
+			continue
+		}
+
+		if *r.config.Wait.Enabled {
+			log.Printf("[DEBUG] (runner) enabling global quiescence for %q",
+				t.ID())
+			r.quiescenceMap[c] = newQuiescence(
+				r.quiescenceCh, *r.config.Wait.Min, *r.config.Wait.Max, t)
+		}
+	}
+}
+
 // quiescence is an internal representation of a single template's quiescence
-// state.
+// state. Templates may render concurrently, so the timer is guarded by a lock.
 type quiescence struct {
 	template *template.Template
 	min      time.Duration
 	max      time.Duration
 	ch       chan *template.Template
+
+	lock     sync.Mutex
 	timer    *time.Timer
 	deadline time.Time
 }
@@ -1344,6 +2303,9 @@ func newQuiescence(ch chan *template.Template, min, max time.Duration, t *templa
 
 // tick updates the minimum quiescence timer.
 func (q *quiescence) tick() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
 	now := time.Now()
 
 	// If this is the first tick, set up the timer and calculate the max
@@ -1414,37 +2376,32 @@ func NewClientSet(c *config.Config) (*dep.ClientSet, error) {
 		return nil, fmt.Errorf("runner: %s", err)
 	}
 
-	if err := clients.CreateVaultClient(&dep.CreateVaultClientInput{
-		Address:                      config.StringVal(c.Vault.Address),
-		Namespace:                    config.StringVal(c.Vault.Namespace),
-		Token:                        config.StringVal(c.Vault.Token),
-		UnwrapToken:                  config.BoolVal(c.Vault.UnwrapToken),
-		SSLEnabled:                   config.BoolVal(c.Vault.SSL.Enabled),
-		SSLVerify:                    config.BoolVal(c.Vault.SSL.Verify),
-		SSLCert:                      config.StringVal(c.Vault.SSL.Cert),
-		SSLKey:                       config.StringVal(c.Vault.SSL.Key),
-		SSLCACert:                    config.StringVal(c.Vault.SSL.CaCert),
-		SSLCACertBytes:               config.StringVal(c.Vault.SSL.CaCertBytes),
-		SSLCAPath:                    config.StringVal(c.Vault.SSL.CaPath),
-		ServerName:                   config.StringVal(c.Vault.SSL.ServerName),
-		ClientUserAgent:              config.StringVal(c.Vault.ClientUserAgent),
-		TransportCustomDialer:        c.Vault.Transport.CustomDialer,
-		TransportDialKeepAlive:       config.TimeDurationVal(c.Vault.Transport.DialKeepAlive),
-		TransportDialTimeout:         config.TimeDurationVal(c.Vault.Transport.DialTimeout),
-		TransportDisableKeepAlives:   config.BoolVal(c.Vault.Transport.DisableKeepAlives),
-		TransportIdleConnTimeout:     config.TimeDurationVal(c.Vault.Transport.IdleConnTimeout),
-		TransportMaxIdleConns:        config.IntVal(c.Vault.Transport.MaxIdleConns),
-		TransportMaxIdleConnsPerHost: config.IntVal(c.Vault.Transport.MaxIdleConnsPerHost),
-		TransportMaxConnsPerHost:     config.IntVal(c.Vault.Transport.MaxConnsPerHost),
-		TransportTLSHandshakeTimeout: config.TimeDurationVal(c.Vault.Transport.TLSHandshakeTimeout),
-		K8SAuthRoleName:              config.StringVal(c.Vault.K8SAuthRoleName),
-		K8SServiceAccountTokenPath:   config.StringVal(c.Vault.K8SServiceAccountTokenPath),
-		K8SServiceAccountToken:       config.StringVal(c.Vault.K8SServiceAccountToken),
-		K8SServiceMountPath:          config.StringVal(c.Vault.K8SServiceMountPath),
-	}); err != nil {
+	// The vault block configures the default cluster, which has no name.
+	vaultInput := newVaultClientInput(c.Vault)
+	vaultInput.Name = ""
+	if err := clients.CreateVaultClient(vaultInput); err != nil {
 		return nil, fmt.Errorf("runner: %s", err)
 	}
 
+	// Create a client for each of the named Vault clusters
+	if c.VaultClusters != nil {
+		names := make(map[string]bool, len(*c.VaultClusters))
+		for _, v := range *c.VaultClusters {
+			name := config.StringVal(v.Name)
+			switch {
+			case name == "":
+				return nil, fmt.Errorf("runner: vault_cluster: missing name")
+			case names[name]:
+				return nil, fmt.Errorf("runner: vault_cluster: duplicate name %q", name)
+			}
+			names[name] = true
+
+			if err := clients.CreateVaultClient(newVaultClientInput(v)); err != nil {
+				return nil, fmt.Errorf("runner: vault_cluster %q: %s", name, err)
+			}
+		}
+	}
+
 	if err := clients.CreateNomadClient(&dep.CreateNomadClientInput{
 		Address:                      config.StringVal(c.Nomad.Address),
 		Namespace:                    config.StringVal(c.Nomad.Namespace),
@@ -1474,8 +2431,44 @@ func NewClientSet(c *config.Config) (*dep.ClientSet, error) {
 	return clients, nil
 }
 
+// newVaultClientInput returns the input to create the client of the Vault
+// cluster of the given configuration.
+func newVaultClientInput(v *config.VaultConfig) *dep.CreateVaultClientInput {
+	return &dep.CreateVaultClientInput{
+		Name:                         config.StringVal(v.Name),
+		Address:                      config.StringVal(v.Address),
+		Namespace:                    config.StringVal(v.Namespace),
+		Token:                        config.StringVal(v.Token),
+		UnwrapToken:                  config.BoolVal(v.UnwrapToken),
+		SSLEnabled:                   config.BoolVal(v.SSL.Enabled),
+		SSLVerify:                    config.BoolVal(v.SSL.Verify),
+		SSLCert:                      config.StringVal(v.SSL.Cert),
+		SSLKey:                       config.StringVal(v.SSL.Key),
+		SSLCACert:                    config.StringVal(v.SSL.CaCert),
+		SSLCACertBytes:               config.StringVal(v.SSL.CaCertBytes),
+		SSLCAPath:                    config.StringVal(v.SSL.CaPath),
+		ServerName:                   config.StringVal(v.SSL.ServerName),
+		ClientUserAgent:              config.StringVal(v.ClientUserAgent),
+		TransportCustomDialer:        v.Transport.CustomDialer,
+		TransportDialKeepAlive:       config.TimeDurationVal(v.Transport.DialKeepAlive),
+		TransportDialTimeout:         config.TimeDurationVal(v.Transport.DialTimeout),
+		TransportDisableKeepAlives:   config.BoolVal(v.Transport.DisableKeepAlives),
+		TransportIdleConnTimeout:     config.TimeDurationVal(v.Transport.IdleConnTimeout),
+		TransportMaxIdleConns:        config.IntVal(v.Transport.MaxIdleConns),
+		TransportMaxIdleConnsPerHost: config.IntVal(v.Transport.MaxIdleConnsPerHost),
+		TransportMaxConnsPerHost:     config.IntVal(v.Transport.MaxConnsPerHost),
+		TransportTLSHandshakeTimeout: config.TimeDurationVal(v.Transport.TLSHandshakeTimeout),
+		K8SAuthRoleName:              config.StringVal(v.K8SAuthRoleName),
+		K8SServiceAccountTokenPath:   config.StringVal(v.K8SServiceAccountTokenPath),
+		K8SServiceAccountToken:       config.StringVal(v.K8SServiceAccountToken),
+		K8SServiceMountPath:          config.StringVal(v.K8SServiceMountPath),
+	}
+}
+
 // newWatcher creates a new watcher.
-func newWatcher(c *config.Config, clients *dep.ClientSet) *watch.Watcher {
+func newWatcher(c *config.Config, clients *dep.ClientSet, tracer trace.Tracer,
+	metrics *metrics.Metrics,
+) *watch.Watcher {
 	log.Printf("[INFO] (runner) creating watcher")
 
 	return watch.NewWatcher(&watch.NewWatcherInput{
@@ -1493,5 +2486,36 @@ func newWatcher(c *config.Config, clients *dep.ClientSet) *watch.Watcher {
 		RetryFuncVault:   watch.RetryFunc(c.Vault.Retry.RetryFunc()),
 		VaultToken:       clients.Vault().Token(),
 		RetryFuncNomad:   watch.RetryFunc(c.Nomad.Retry.RetryFunc()),
+		RateLimiters:     newRateLimiters(c.RateLimit),
+		Tracer:           tracer,
+		Metrics:          metrics,
 	})
 }
+
+// newRateLimiters creates a rate limiter for each class of dependencies which
+// has its rate limit enabled.
+func newRateLimiters(c *config.RateLimitsConfig) map[watch.RateLimitClass]watch.RateLimiter {
+	limiters := make(map[watch.RateLimitClass]watch.RateLimiter)
+	for class, l := range map[watch.RateLimitClass]*config.RateLimitConfig{
+		watch.RateLimitCatalog: c.Catalog,
+		watch.RateLimitHealth:  c.Health,
+		watch.RateLimitKV:      c.KV,
+		watch.RateLimitVault:   c.Vault,
+	} {
+		// A limiter with no rate would never allow more than the burst.
+		if !config.BoolVal(l.Enabled) || *l.Rate <= 0 {
+			continue
+		}
+
+		// A limiter never allows a fetch with a burst below one.
+		burst := config.IntVal(l.Burst)
+		if burst < 1 {
+			burst = 1
+		}
+
+		log.Printf("[DEBUG] (runner) limiting %s requests to %g per second (burst %d)",
+			class, *l.Rate, burst)
+		limiters[class] = rate.NewLimiter(rate.Limit(*l.Rate), burst)
+	}
+	return limiters
+}
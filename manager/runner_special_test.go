@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+// +build !windows
+
+package manager
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-template/config"
+	dep "github.com/hashicorp/consul-template/dependency"
+)
+
+func TestRunner_unchangedContentsFifo(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(dest, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open the reader without blocking on a writer
+	pipe, err := os.OpenFile(dest, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Close()
+
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ if key "foo" }}same{{ end }}`),
+				Destination: config.String(dest),
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlocking()
+	r.watcher.ForceWatching(d, true)
+
+	// Identical contents are delivered to the pipe on each render, since the
+	// reader consumed the previous ones.
+	for _, v := range []string{"a", "b"} {
+		r.brain.Remember(d, v)
+
+		errCh := make(chan error, 1)
+		go func() { errCh <- r.Run() }()
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the run")
+		}
+
+		act, err := io.ReadAll(pipe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(act) != "same" {
+			t.Errorf("\nexp: %q\nact: %q", "same", act)
+		}
+	}
+}
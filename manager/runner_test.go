@@ -6,22 +6,34 @@ package manager
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/consul-template/child"
 	"github.com/hashicorp/consul-template/config"
 	dep "github.com/hashicorp/consul-template/dependency"
+	"github.com/hashicorp/consul-template/renderer"
 	"github.com/hashicorp/consul-template/template"
+	"github.com/hashicorp/consul-template/test"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestRunner_initTemplates(t *testing.T) {
@@ -55,6 +67,29 @@ func TestRunner_initTemplates(t *testing.T) {
 	}
 }
 
+func TestNewClientSet_vaultName(t *testing.T) {
+	// The vault block always configures the default cluster, even if it is
+	// given a name programmatically.
+	c := config.TestConfig(&config.Config{
+		Vault: &config.VaultConfig{
+			Name: config.String("primary"),
+		},
+	})
+
+	clients, err := NewClientSet(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clients.Stop()
+
+	if clients.Vault() == nil {
+		t.Error("expected the default cluster")
+	}
+	if _, err := clients.VaultCluster("primary"); err == nil {
+		t.Error("expected no named cluster")
+	}
+}
+
 func TestRunner_Receive(t *testing.T) {
 	c := config.TestConfig(&config.Config{Once: true})
 	r, err := NewRunner(c, true)
@@ -95,6 +130,73 @@ func TestRunner_Receive(t *testing.T) {
 	})
 }
 
+func TestRunner_ForceRefresh(t *testing.T) {
+	dir := t.TempDir()
+	path, dest := filepath.Join(dir, "data"), filepath.Join(dir, "out")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(fmt.Sprintf(`{{ file %q }}`, path)),
+				Destination: config.String(dest),
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	d, err := dep.NewFileQuery(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ForceRefresh(d) {
+		t.Error("expected ForceRefresh to return false before watching")
+	}
+
+	// receive runs the templates, which watches the file, and receives its
+	// data.
+	receive := func() {
+		t.Helper()
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case view := <-r.watcher.DataCh():
+			r.Receive(view.Dependency(), view.Data())
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for data")
+		}
+	}
+	receive()
+
+	// The file is unchanged, so its data only arrives again once the query
+	// in flight was interrupted and the file watched anew.
+	if !r.ForceRefresh(d) {
+		t.Fatal("expected ForceRefresh to return true")
+	}
+	if _, ok := r.brain.Recall(d); ok {
+		t.Error("expected the data to be forgotten")
+	}
+	select {
+	case <-r.refreshCh:
+	default:
+		t.Fatal("expected a run to be triggered")
+	}
+	receive()
+
+	if data, _ := r.brain.Recall(d); data != "data" {
+		t.Errorf("expected %q, got %q", "data", data)
+	}
+}
+
 func TestRunner_Run(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -416,6 +518,79 @@ func TestRunner_Run(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"skip_if_unchanged_remote",
+			func(t *testing.T, r *Runner) {
+				r.dry = false
+				d, err := dep.NewKVGetQuery("foo/rendered")
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.brain.Remember(d, "hello")
+				r.watcher.ForceWatching(d, true)
+			},
+			&config.Config{
+				Templates: &config.TemplateConfigs{
+					&config.TemplateConfig{
+						Contents:              config.String("hello"),
+						Command:               []string{"echo 123"},
+						Destination:           config.String("/tmp/ct-skip_if_unchanged_remote"),
+						SkipIfUnchangedRemote: config.String("consul://kv/foo/rendered"),
+					},
+				},
+			},
+			func(t *testing.T, r *Runner, out string) {
+				exp := ""
+				if out != exp {
+					t.Errorf("\nexp: %#v\nact: %#v", exp, out)
+				}
+				if _, err := os.Stat("/tmp/ct-skip_if_unchanged_remote"); !os.IsNotExist(err) {
+					os.Remove("/tmp/ct-skip_if_unchanged_remote")
+					t.Errorf("expected template not to be written: %v", err)
+				}
+			},
+			false,
+		},
+		{
+			"skip_if_unchanged_remote_same_contents",
+			func(t *testing.T, r *Runner) {
+				r.dry = false
+				d, err := dep.NewKVGetQuery("foo/rendered")
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.brain.Remember(d, "hello")
+				r.watcher.ForceWatching(d, true)
+			},
+			&config.Config{
+				Templates: &config.TemplateConfigs{
+					&config.TemplateConfig{
+						Contents:              config.String("hello"),
+						Destination:           config.String("/tmp/ct-skip_if_unchanged_remote_same_contents_a"),
+						SkipIfUnchangedRemote: config.String("consul://kv/foo/rendered"),
+					},
+					&config.TemplateConfig{
+						Contents:    config.String("hello"),
+						Destination: config.String("/tmp/ct-skip_if_unchanged_remote_same_contents_b"),
+					},
+				},
+			},
+			func(t *testing.T, r *Runner, out string) {
+				// Only the template with the remote is skipped, even though
+				// both templates have the same contents.
+				a := "/tmp/ct-skip_if_unchanged_remote_same_contents_a"
+				b := "/tmp/ct-skip_if_unchanged_remote_same_contents_b"
+				defer os.Remove(a)
+				defer os.Remove(b)
+				if _, err := os.Stat(a); !os.IsNotExist(err) {
+					t.Errorf("expected template not to be written: %v", err)
+				}
+				if _, err := os.Stat(b); err != nil {
+					t.Errorf("expected template to be written: %v", err)
+				}
+			},
+			false,
+		},
 		{
 			"no_duplicate_commands",
 			func(t *testing.T, r *Runner) {
@@ -1140,317 +1315,273 @@ func TestRunner_Start(t *testing.T) {
 
 }
 
-func TestRunner_quiescence(t *testing.T) {
-	tpl := &template.Template{}
-
-	t.Run("min", func(t *testing.T) {
-		ch := make(chan *template.Template, 1)
-		q := newQuiescence(ch,
-			50*time.Millisecond, 250*time.Millisecond, tpl)
+func TestRunner_unchangedContents(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out")
 
-		// Should not fire until we tick() it.
-		select {
-		case <-ch:
-			t.Fatalf("q should not have fired")
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ if key "foo" }}same{{ end }}`),
+				Destination: config.String(dest),
+			},
+		},
+	})
+	c.Finalize()
 
-		case <-time.After(2 * q.max):
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	// Count the writes to the destination, not the calls to the renderer,
+	// which skips identical contents on its own.
+	var writes int
+	r.rendererFn = func(i *renderer.RenderInput) (*renderer.RenderResult, error) {
+		result, err := renderer.Render(i)
+		if err == nil && result.DidRender {
+			writes++
 		}
+		return result, err
+	}
 
-		// Tick it once and make sure it fires after the min time.
-		start := time.Now()
-		q.tick()
-		select {
-		case <-ch:
-			dur := time.Since(start)
-			if dur < q.min || dur > 2*q.min {
-				t.Fatalf("bad duration %9.6f", dur.Seconds())
-			}
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlocking()
+	r.watcher.ForceWatching(d, true)
 
-		case <-time.After(2 * q.min):
-			t.Fatalf("q should have fired")
+	// Flap the dependency between values which render identical contents
+	for _, v := range []string{"a", "b", "a", "b"} {
+		r.brain.Remember(d, v)
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
 		}
-	})
+	}
 
-	// Single snooze case.
-	t.Run("snooze", func(t *testing.T) {
-		ch := make(chan *template.Template, 1)
-		q := newQuiescence(ch,
-			50*time.Millisecond, 250*time.Millisecond, tpl)
+	if writes != 1 {
+		t.Errorf("expected 1 write, got %d", writes)
+	}
+	if event := r.RenderEvents()[r.templates[0].ID()]; !event.WouldRender {
+		t.Errorf("expected template to be considered rendered: %#v", event)
+	}
 
-		// Tick once with a small delay to simulate an update coming
-		// in.
-		q.tick()
-		time.Sleep(q.min / 2)
+	// Removing the destination renders it again
+	if err := os.Remove(dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 2 {
+		t.Errorf("expected 2 writes, got %d", writes)
+	}
+	b, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "same" {
+		t.Errorf("\nexp: %q\nact: %q", "same", b)
+	}
 
-		// Tick again to make sure it waits the full min amount.
-		start := time.Now()
-		q.tick()
-		select {
-		case <-ch:
-			dur := time.Since(start)
-			if dur < q.min || dur > 2*q.min {
-				t.Fatalf("bad duration %9.6f", dur.Seconds())
-			}
+	// Editing the destination by hand renders it again
+	if err := os.WriteFile(dest, []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 3 {
+		t.Errorf("expected 3 writes, got %d", writes)
+	}
+	b, err = os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "same" {
+		t.Errorf("\nexp: %q\nact: %q", "same", b)
+	}
+}
 
-		case <-time.After(2 * q.min):
-			t.Fatalf("q should have fired")
-		}
+func TestRunner_unchangedContentsSharedTemplate(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+
+	// The second destination holds stale contents before the first render
+	if err := os.WriteFile(second, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	contents := `{{ if key "foo" }}same{{ end }}`
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(contents),
+				Destination: config.String(first),
+			},
+			&config.TemplateConfig{
+				Contents:    config.String(contents),
+				Destination: config.String(second),
+			},
+		},
 	})
+	c.Finalize()
 
-	// Max time case.
-	t.Run("max", func(t *testing.T) {
-		ch := make(chan *template.Template, 1)
-		q := newQuiescence(ch,
-			50*time.Millisecond, 250*time.Millisecond, tpl)
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
 
-		// Keep ticking to service the min timer and make sure we get
-		// cut off at the max time.
-		fired := false
-		start := time.Now()
-		for !fired && time.Since(start) < 2*q.max {
-			q.tick()
-			time.Sleep(q.min / 2)
-			select {
-			case <-ch:
-				fired = true
-			default:
-			}
-		}
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlocking()
+	r.watcher.ForceWatching(d, true)
+	r.brain.Remember(d, "a")
 
-		if !fired {
-			t.Fatalf("q should have fired")
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dest := range []string{first, second} {
+		b, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
 		}
-	})
+		if string(b) != "same" {
+			t.Errorf("%s\nexp: %q\nact: %q", dest, "same", b)
+		}
+	}
 }
 
-func TestRunner_command(t *testing.T) {
-	type testCase struct {
-		name, out     string
-		input, parsed []string
+func TestRunner_unchangedContentsExec(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "out")
+	execs := filepath.Join(dir, "execs")
+
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ if key "foo" }}same{{ end }}`),
+				Destination: config.String(dest),
+				Exec: &config.ExecConfig{
+					Command: []string{"sh", "-c", "echo run >> " + execs},
+				},
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
 	}
-	os.Setenv("FOO", "bar")
+	defer r.Stop()
 
-	parseTest := func(tc testCase) {
-		out, _, err := child.CommandPrep(tc.input)
-		mismatchErr := "bad command parse\n   got: '%#v'\nwanted: '%#v'"
-		switch {
-		case err != nil && len(tc.input) > 0 && tc.input[0] != "":
-			t.Error("unexpected error:", err)
-		case len(out) != len(tc.parsed):
-			t.Errorf(mismatchErr, out, tc.parsed)
-		case !reflect.DeepEqual(out, tc.parsed):
-			t.Errorf(mismatchErr, out, tc.parsed)
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlocking()
+	r.watcher.ForceWatching(d, true)
+
+	// Two consecutive renders of different values with identical contents
+	for _, v := range []string{"a", "b"} {
+		r.brain.Remember(d, v)
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
 		}
 	}
-	runTest := func(tc testCase) {
-		stdout := new(bytes.Buffer)
-		stderr := new(bytes.Buffer)
-		args, _, err := child.CommandPrep(tc.input)
-		switch {
-		case err == exec.ErrNotFound && len(args) == 0:
-			return // expected
-		case err != nil:
-			t.Fatal("unexpected error", err)
-		}
-		child, err := child.New(&child.NewInput{
-			Stdin:   os.Stdin,
-			Stdout:  stdout,
-			Stderr:  stderr,
-			Command: args[0],
-			Args:    args[1:],
-		})
-		if err != nil {
-			t.Fatal("error creating child process:", err)
-		}
-		child.Start()
-		defer child.Stop()
-		if err != nil {
-			t.Fatal("error starting child process:", err)
-		}
-		<-child.ExitCh()
-		switch {
-		case stderr.Len() > 0:
-			t.Errorf("unexpected error output: %s", stderr.String())
-		case tc.out != stdout.String():
-			t.Errorf("wrong command output: %s \n   got: '%#v'\nwanted: '%#v'",
-				tc.name, stdout.String(), tc.out)
-		}
-	}
-	for i, tc := range []testCase{
-		{
-			name:   "null",
-			input:  []string{""},
-			parsed: []string{},
-			out:    "",
-		},
-		{
-			name:   "single",
-			input:  []string{"echo"},
-			parsed: []string{"echo"},
-			out:    "\n",
-		},
-		{
-			name:   "simple",
-			input:  []string{"printf hi"},
-			parsed: []string{"sh", "-c", "printf hi"},
-			out:    "hi",
-		},
-		{
-			name:   "subshell-bash", // GH-1456 & GH-1463
-			input:  []string{"bash -c 'printf hi'"},
-			parsed: []string{"sh", "-c", "bash -c 'printf hi'"},
-			out:    "hi",
-		},
-		{
-			name:   "subshell-single-quoting", // GH-1456 & GH-1463
-			input:  []string{"sh -c 'printf hi'"},
-			parsed: []string{"sh", "-c", "sh -c 'printf hi'"},
-			out:    "hi",
-		},
-		{
-			name:   "subshell-double-quoting",
-			input:  []string{`sh -c "printf hi"`},
-			parsed: []string{"sh", "-c", `sh -c "printf hi"`},
-			out:    "hi",
-		},
-		{
-			name:   "subshell-call",
-			input:  []string{`printf $(printf foo)`},
-			parsed: []string{"sh", "-c", "printf $(printf foo)"},
-			out:    "foo",
-		},
-		{
-			name:   "pipe",
-			input:  []string{`seq 1 5 | grep 3`},
-			parsed: []string{"sh", "-c", "seq 1 5 | grep 3"},
-			out:    "3\n",
-		},
-		{
-			name:   "conditional",
-			input:  []string{`sh -c 'if true; then printf foo; fi'`},
-			parsed: []string{"sh", "-c", "sh -c 'if true; then printf foo; fi'"},
-			out:    "foo",
-		},
-		{
-			name:   "command-substition",
-			input:  []string{`sh -c 'printf $(which /bin/sh)'`},
-			parsed: []string{"sh", "-c", "sh -c 'printf $(which /bin/sh)'"},
-			out:    "/bin/sh",
-		},
-		{
-			name:   "curly-brackets",
-			input:  []string{"sh -c '{ if [ -f /bin/sh ]; then printf foo; else printf bar; fi }'"},
-			parsed: []string{"sh", "-c", "sh -c '{ if [ -f /bin/sh ]; then printf foo; else printf bar; fi }'"},
-			out:    "foo",
-		},
-		{
-			name:   "and",
-			input:  []string{"true && true && printf and"},
-			parsed: []string{"sh", "-c", "true && true && printf and"},
-			out:    "and",
-		},
-		{
-			name:   "or",
-			input:  []string{"false || false || printf or"},
-			parsed: []string{"sh", "-c", "false || false || printf or"},
-			out:    "or",
-		},
-		{
-			name:   "backgrounded",
-			input:  []string{"(sleep .1; printf hi) &"},
-			parsed: []string{"sh", "-c", "(sleep .1; printf hi) &"},
-			out:    "hi",
-		},
-		{
-			name:   "env",
-			input:  []string{"printf ${FOO}"},
-			parsed: []string{"sh", "-c", "printf ${FOO}"},
-			out:    "bar",
-		},
-	} {
-		t.Run(fmt.Sprintf("%d_%s", i, tc.name),
-			func(t *testing.T) {
-				parseTest(tc)
-				if len(tc.input) > 0 {
-					runTest(tc)
-				}
-			})
-	}
-}
 
-func TestRunner_commandPath(t *testing.T) {
-	PATH := os.Getenv("PATH")
-	defer os.Setenv("PATH", PATH)
-	os.Setenv("PATH", "")
-	cmd, _, err := child.CommandPrep([]string{"echo hi"})
-	if err != nil && err != exec.ErrNotFound {
+	b, err := os.ReadFile(execs)
+	if err != nil {
 		t.Fatal(err)
 	}
-	if len(cmd) != 3 {
-		t.Fatalf("unexpected command: %#v\n", cmd)
-	}
-	if filepath.Base(cmd[0]) != "sh" {
-		t.Fatalf("unexpected shell: %#v\n", cmd)
+	if exp, act := "run\n", string(b); exp != act {
+		t.Errorf("expected the command to run once\nexp: %q\nact: %q", exp, act)
 	}
 }
 
-// TestRunner_stoppedWatcher verifies that dependencies can't be added to a
-// watcher that's been stopped after the first template rendering
-func TestRunner_stoppedWatcher(t *testing.T) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	t.Cleanup(cancel)
-
-	stopCtx, stopNow := context.WithCancel(ctx)
-	t.Cleanup(stopNow)
-
-	// Test server to simulate Vault cluster responses.
-	reqNum := atomic.Uint64{}
-	vaultServer := httptest.NewServer(
-		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			t.Logf("GET %q", req.URL.Path)
-			if req.URL.Path == "/v1/secret/data/test1" {
-				if reqNum.Add(1) > 1 {
-					stopNow()
-				}
-
-				w.WriteHeader(http.StatusOK)
-
-				// We can't configure the default lease in tests because the
-				// field is global, so ensure there's a rotation_period and ttl
-				// that causes the runner to make multiple requests
-				w.Write([]byte(`{
-  "data": {
-    "data": {
-      "secret": "foo"
-    },
-    "rotation_period": "10ms",
-    "ttl": 1
-  }
-}`))
-			} else {
-				w.WriteHeader(http.StatusOK)
-			}
+func TestRunner_templateDelims(t *testing.T) {
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "custom")
+	standard := filepath.Join(dir, "standard")
 
-		}))
+	contents := `[[ key "foo" ]] {{ key "foo" }}`
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(contents),
+				Destination: config.String(custom),
+				LeftDelim:   config.String("[["),
+				RightDelim:  config.String("]]"),
+			},
+			&config.TemplateConfig{
+				Contents:    config.String(contents),
+				Destination: config.String(standard),
+			},
+		},
+	})
+	c.Finalize()
 
-	t.Cleanup(vaultServer.Close)
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
 
-	out, err := os.CreateTemp(t.TempDir(), "")
+	d, err := dep.NewKVGetQuery("foo")
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(out.Name())
+	d.EnableBlocking()
+	r.watcher.ForceWatching(d, true)
+	r.brain.Remember(d, "bar")
 
-	c := config.DefaultConfig().Merge(&config.Config{
-		Vault: &config.VaultConfig{
-			Address: &vaultServer.URL,
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for dest, exp := range map[string]string{
+		custom:   `bar {{ key "foo" }}`,
+		standard: `[[ key "foo" ]] bar`,
+	} {
+		act, err := os.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp != string(act) {
+			t.Errorf("\nexp: %#v\nact: %#v", exp, string(act))
+		}
+	}
+}
+
+func TestRunner_templateWait(t *testing.T) {
+	dir := t.TempDir()
+	fast := filepath.Join(dir, "fast")
+	slow := filepath.Join(dir, "slow")
+
+	c := config.TestConfig(&config.Config{
+		Wait: &config.WaitConfig{
+			Min: config.TimeDuration(400 * time.Millisecond),
+			Max: config.TimeDuration(2 * time.Second),
 		},
 		Templates: &config.TemplateConfigs{
 			&config.TemplateConfig{
-				Contents: config.String(
-					`{{with secret "secret/data/test1"}}{{ if .Data}}{{.Data.data.secret}}{{end}}{{end}}`),
-				Destination: config.String(out.Name()),
+				Contents:    config.String(`fast {{ key "foo" }}`),
+				Destination: config.String(fast),
+				Wait: &config.WaitConfig{
+					Min: config.TimeDuration(50 * time.Millisecond),
+					Max: config.TimeDuration(time.Second),
+				},
+			},
+			&config.TemplateConfig{
+				Contents:    config.String(`slow {{ key "foo" }}`),
+				Destination: config.String(slow),
 			},
 		},
 	})
@@ -1460,28 +1591,1499 @@ func TestRunner_stoppedWatcher(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Cleanup(r.Stop)
+	defer r.Stop()
 
-	go r.Start()
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlocking()
+	r.watcher.ForceWatching(d, true)
+	r.brain.Remember(d, "bar")
+
+	// Both templates are held back by their own quiescence timers
+	r.enableQuiescence()
+	start := time.Now()
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, dest := range []string{fast, slow} {
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Fatalf("expected %q to wait for quiescence, got %v", dest, err)
+		}
+	}
 
-	// the mock vault server controls the stopCtx so that we can be sure we've
-	// rendered the empty template, set up the watcher, and have started the
-	// next poll
-	select {
-	case <-stopCtx.Done():
-		r.Stop()
-	case <-ctx.Done():
-		t.Fatal("test timed out")
+	for _, exp := range []struct {
+		dest string
+		min  time.Duration
+		max  time.Duration
+	}{
+		{fast, 50 * time.Millisecond, 400 * time.Millisecond},
+		{slow, 400 * time.Millisecond, 2 * time.Second},
+	} {
+		select {
+		case tmpl := <-r.quiescenceCh:
+			dur := time.Since(start)
+			if act := config.StringVal(r.templateConfigFor(tmpl).Destination); act != exp.dest {
+				t.Fatalf("expected %q to fire, got %q", exp.dest, act)
+			}
+			if dur < exp.min || dur > exp.max {
+				t.Errorf("%q fired after %s, expected between %s and %s",
+					exp.dest, dur, exp.min, exp.max)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expected %q to fire", exp.dest)
+		}
 	}
+}
 
-	// there's no way for us to control whether the Start goroutine's select
-	// takes the watcher's DataCh or the runner's doneCh. So once the runner has
-	// been stopped, we fake that we've received on the DataCh so that we hit
-	// the code path that calls Run. This should never add a dependency to the
-	// watcher.
-	r.Run()
+func TestRunner_quiescence(t *testing.T) {
+	tpl := &template.Template{}
 
-	if r.watcher.Size() != 0 {
-		t.Fatal("watcher had dependencies added after stop")
-	}
+	t.Run("min", func(t *testing.T) {
+		ch := make(chan *template.Template, 1)
+		q := newQuiescence(ch,
+			50*time.Millisecond, 250*time.Millisecond, tpl)
+
+		// Should not fire until we tick() it.
+		select {
+		case <-ch:
+			t.Fatalf("q should not have fired")
+
+		case <-time.After(2 * q.max):
+		}
+
+		// Tick it once and make sure it fires after the min time.
+		start := time.Now()
+		q.tick()
+		select {
+		case <-ch:
+			dur := time.Since(start)
+			if dur < q.min || dur > 2*q.min {
+				t.Fatalf("bad duration %9.6f", dur.Seconds())
+			}
+
+		case <-time.After(2 * q.min):
+			t.Fatalf("q should have fired")
+		}
+	})
+
+	// Single snooze case.
+	t.Run("snooze", func(t *testing.T) {
+		ch := make(chan *template.Template, 1)
+		q := newQuiescence(ch,
+			50*time.Millisecond, 250*time.Millisecond, tpl)
+
+		// Tick once with a small delay to simulate an update coming
+		// in.
+		q.tick()
+		time.Sleep(q.min / 2)
+
+		// Tick again to make sure it waits the full min amount.
+		start := time.Now()
+		q.tick()
+		select {
+		case <-ch:
+			dur := time.Since(start)
+			if dur < q.min || dur > 2*q.min {
+				t.Fatalf("bad duration %9.6f", dur.Seconds())
+			}
+
+		case <-time.After(2 * q.min):
+			t.Fatalf("q should have fired")
+		}
+	})
+
+	// Max time case.
+	t.Run("max", func(t *testing.T) {
+		ch := make(chan *template.Template, 1)
+		q := newQuiescence(ch,
+			50*time.Millisecond, 250*time.Millisecond, tpl)
+
+		// Keep ticking to service the min timer and make sure we get
+		// cut off at the max time.
+		fired := false
+		start := time.Now()
+		for !fired && time.Since(start) < 2*q.max {
+			q.tick()
+			time.Sleep(q.min / 2)
+			select {
+			case <-ch:
+				fired = true
+			default:
+			}
+		}
+
+		if !fired {
+			t.Fatalf("q should have fired")
+		}
+	})
+}
+
+func TestRunner_execDebounce(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "counter")
+
+	// Three templates feed the same service, so they share its command.
+	keys := []string{"debounce-a", "debounce-b", "debounce-c"}
+	templates := make(config.TemplateConfigs, 0, len(keys))
+	for _, k := range keys {
+		templates = append(templates, &config.TemplateConfig{
+			Contents:    config.String(fmt.Sprintf(`{{ key %q }}`, k)),
+			Destination: config.String(filepath.Join(dir, k)),
+			Exec: &config.ExecConfig{
+				Command: []string{"echo run >> " + counter},
+			},
+		})
+	}
+
+	c := config.TestConfig(&config.Config{
+		ExecDebounce: config.TimeDuration(200 * time.Millisecond),
+		Templates:    &templates,
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each template changes in its own run, as if the data arrived in a burst.
+	for _, k := range keys {
+		d, err := dep.NewKVGetQuery(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.EnableBlocking()
+		r.Receive(d, "value")
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(counter); !os.IsNotExist(err) {
+		t.Fatalf("expected command to be debounced, got %v", err)
+	}
+	if l := len(r.pendingCommands); l != 1 {
+		t.Fatalf("expected 1 pending command, got %d", l)
+	}
+
+	select {
+	case <-r.execDebounceCh:
+	case <-time.After(time.Second):
+		t.Fatal("debounce window did not close")
+	}
+	if err := r.runPendingCommands(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := "run\n", string(b); exp != act {
+		t.Errorf("expected a single exec\nexp: %q\nact: %q", exp, act)
+	}
+	if r.execDebounceTimer != nil {
+		t.Error("expected debounce window to be reset")
+	}
+}
+
+func TestRunner_changedSharedTemplate(t *testing.T) {
+	// The templates have the same contents, and so the same ID, but only the
+	// destination of the second one changes.
+	dir := t.TempDir()
+	unchanged, changed := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, dest := range []string{unchanged, changed} {
+		contents := "hello\n"
+		if dest == changed {
+			contents = "bye\n"
+		}
+		if err := os.WriteFile(dest, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := config.TestConfig(&config.Config{
+		DiffMode: true,
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String("hello\n"),
+				Destination: config.String(unchanged),
+			},
+			&config.TemplateConfig{
+				Contents:    config.String("hello\n"),
+				Destination: config.String(changed),
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	r.outStream = &bytes.Buffer{}
+
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp, act := []string{changed}, r.Changed(); !reflect.DeepEqual(exp, act) {
+		t.Errorf("\nexp: %#v\nact: %#v", exp, act)
+	}
+}
+
+func TestRunner_diffMode(t *testing.T) {
+	cases := []struct {
+		name    string
+		dest    string
+		changed bool
+		exp     string
+	}{
+		{
+			"unchanged",
+			"hello\n",
+			false,
+			"",
+		},
+		{
+			"changed",
+			"bye\n",
+			true,
+			"@@ -1 +1 @@\n-bye\n+hello\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "dest")
+			if err := os.WriteFile(dest, []byte(tc.dest), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			counter := dest + ".exec"
+
+			c := config.TestConfig(&config.Config{
+				DiffMode: true,
+				Templates: &config.TemplateConfigs{
+					&config.TemplateConfig{
+						Contents:    config.String("hello\n"),
+						Destination: config.String(dest),
+						Exec: &config.ExecConfig{
+							Command: []string{"touch " + counter},
+						},
+					},
+				},
+			})
+			c.Finalize()
+
+			r, err := NewRunner(c, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			out := &bytes.Buffer{}
+			r.outStream = out
+
+			if err := r.Run(); err != nil {
+				t.Fatal(err)
+			}
+
+			var exp []string
+			if tc.changed {
+				exp = []string{dest}
+			}
+			if act := r.Changed(); len(act) != len(exp) || (len(exp) > 0 && act[0] != exp[0]) {
+				t.Errorf("\nexp: %#v\nact: %#v", exp, act)
+			}
+			if !strings.HasSuffix(out.String(), tc.exp) || (tc.exp == "") != (out.Len() == 0) {
+				t.Errorf("\nexp: %q\nact: %q", tc.exp, out.String())
+			}
+
+			b, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tc.dest {
+				t.Errorf("expected destination not to be written, got %q", b)
+			}
+			if _, err := os.Stat(counter); !os.IsNotExist(err) {
+				t.Errorf("expected command not to run, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunner_templateExec(t *testing.T) {
+	dir := t.TempDir()
+	logFile := func(name string) string { return filepath.Join(dir, name+".log") }
+	readLog := func(name string) string {
+		b, err := os.ReadFile(logFile(name))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// Templates a and b each have their own command, while c falls back to
+	// the child process.
+	templates := config.TemplateConfigs{}
+	for _, name := range []string{"a", "b", "c"} {
+		tc := &config.TemplateConfig{
+			Contents:    config.String(fmt.Sprintf(`{{ key "template-exec-%s" }}`, name)),
+			Destination: config.String(filepath.Join(dir, name)),
+		}
+		if name != "c" {
+			tc.Exec = &config.ExecConfig{
+				Command: []string{fmt.Sprintf("echo %s >> %s", name, logFile(name))},
+			}
+		}
+		templates = append(templates, tc)
+	}
+
+	c := config.TestConfig(&config.Config{Templates: &templates})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	r.child, err = spawnChild(&spawnChildInput{
+		Command: []string{fmt.Sprintf(
+			"trap 'echo reload >> %s' HUP; while :; do sleep 0.05; done", logFile("child"))},
+		ReloadSignal: syscall.SIGHUP,
+		KillSignal:   syscall.SIGTERM,
+		KillTimeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(name, value string) {
+		t.Helper()
+		d, err := dep.NewKVGetQuery("template-exec-" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.EnableBlocking()
+		r.Receive(d, value)
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	update("a", "1")
+	update("b", "1")
+	test.WaitForContents(t, 2*time.Second, logFile("a"), "a\n")
+	test.WaitForContents(t, 2*time.Second, logFile("b"), "b\n")
+
+	update("a", "2")
+	test.WaitForContents(t, 2*time.Second, logFile("a"), "a\na\n")
+
+	// Commands run asynchronously, so give any unexpected ones time to run.
+	time.Sleep(200 * time.Millisecond)
+	if exp, act := "b\n", readLog("b"); exp != act {
+		t.Errorf("b\nexp: %q\nact: %q", exp, act)
+	}
+	if act := readLog("child"); act != "" {
+		t.Errorf("expected the child not to reload for templates with a command, got %q", act)
+	}
+
+	update("c", "1")
+	test.WaitForContents(t, 2*time.Second, logFile("child"), "reload\n")
+}
+
+func TestRunner_errFatal(t *testing.T) {
+	dir := t.TempDir()
+	good, bad := filepath.Join(dir, "good"), filepath.Join(dir, "bad")
+
+	// Both templates are non-fatal, and the second one fails once the key
+	// it requires arrives empty.
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ key "errfatal-good" }}`),
+				Destination: config.String(good),
+				ErrFatal:    config.Bool(false),
+				Exec: &config.ExecConfig{
+					Command: []string{"echo ran > " + good + ".exec"},
+				},
+			},
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ key "errfatal-bad" | required "errfatal-bad is empty" }}`),
+				Destination: config.String(bad),
+				ErrFatal:    config.Bool(false),
+				Exec: &config.ExecConfig{
+					Command: []string{"echo ran > " + bad + ".exec"},
+				},
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]string{"errfatal-good": "value", "errfatal-bad": ""} {
+		d, err := dep.NewKVGetQuery(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.EnableBlocking()
+		r.Receive(d, v)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatalf("expected the failing template not to fail the run, got %v", err)
+	}
+
+	b, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, act := "value", string(b); exp != act {
+		t.Errorf("\nexp: %q\nact: %q", exp, act)
+	}
+	// Commands run asynchronously.
+	test.WaitForContents(t, 2*time.Second, good+".exec", "ran\n")
+
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Errorf("expected the failing template not to be rendered, got %v", err)
+	}
+	if _, err := os.Stat(bad + ".exec"); !os.IsNotExist(err) {
+		t.Errorf("expected the command of the failing template not to run, got %v", err)
+	}
+
+	var failed int
+	for _, e := range r.RenderEvents() {
+		if e.Error != nil {
+			failed++
+			if !strings.Contains(e.Error.Error(), "errfatal-bad is empty") {
+				t.Errorf("unexpected error: %v", e.Error)
+			}
+		}
+	}
+	if failed != 1 {
+		t.Errorf("expected 1 failed template, got %d", failed)
+	}
+}
+
+func TestRunner_errFatalDiscardsHashes(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good")
+
+	// The second template fails the run once the key it requires arrives
+	// empty, after the first one was rendered.
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String("good"),
+				Destination: config.String(good),
+				Exec: &config.ExecConfig{
+					Command: []string{"echo ran > " + good + ".exec"},
+				},
+			},
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ key "discard-bad" | required "discard-bad is empty" }}`),
+				Destination: config.String(filepath.Join(dir, "bad")),
+				ErrFatal:    config.Bool(true),
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	d, err := dep.NewKVGetQuery("discard-bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlocking()
+	r.dependencies[d.String()] = d
+	r.Receive(d, "")
+
+	if err := r.Run(); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	if _, err := os.Stat(good + ".exec"); !os.IsNotExist(err) {
+		t.Errorf("expected the command not to run, got %v", err)
+	}
+	if _, ok := r.renderedHashes[(*c.Templates)[0]]; ok {
+		t.Error("expected the hash of the discarded template to be forgotten")
+	}
+}
+
+func TestRunner_command(t *testing.T) {
+	type testCase struct {
+		name, out     string
+		input, parsed []string
+	}
+	os.Setenv("FOO", "bar")
+
+	parseTest := func(tc testCase) {
+		out, _, err := child.CommandPrep(tc.input)
+		mismatchErr := "bad command parse\n   got: '%#v'\nwanted: '%#v'"
+		switch {
+		case err != nil && len(tc.input) > 0 && tc.input[0] != "":
+			t.Error("unexpected error:", err)
+		case len(out) != len(tc.parsed):
+			t.Errorf(mismatchErr, out, tc.parsed)
+		case !reflect.DeepEqual(out, tc.parsed):
+			t.Errorf(mismatchErr, out, tc.parsed)
+		}
+	}
+	runTest := func(tc testCase) {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		args, _, err := child.CommandPrep(tc.input)
+		switch {
+		case err == exec.ErrNotFound && len(args) == 0:
+			return // expected
+		case err != nil:
+			t.Fatal("unexpected error", err)
+		}
+		child, err := child.New(&child.NewInput{
+			Stdin:   os.Stdin,
+			Stdout:  stdout,
+			Stderr:  stderr,
+			Command: args[0],
+			Args:    args[1:],
+		})
+		if err != nil {
+			t.Fatal("error creating child process:", err)
+		}
+		child.Start()
+		defer child.Stop()
+		if err != nil {
+			t.Fatal("error starting child process:", err)
+		}
+		<-child.ExitCh()
+		switch {
+		case stderr.Len() > 0:
+			t.Errorf("unexpected error output: %s", stderr.String())
+		case tc.out != stdout.String():
+			t.Errorf("wrong command output: %s \n   got: '%#v'\nwanted: '%#v'",
+				tc.name, stdout.String(), tc.out)
+		}
+	}
+	for i, tc := range []testCase{
+		{
+			name:   "null",
+			input:  []string{""},
+			parsed: []string{},
+			out:    "",
+		},
+		{
+			name:   "single",
+			input:  []string{"echo"},
+			parsed: []string{"echo"},
+			out:    "\n",
+		},
+		{
+			name:   "simple",
+			input:  []string{"printf hi"},
+			parsed: []string{"sh", "-c", "printf hi"},
+			out:    "hi",
+		},
+		{
+			name:   "subshell-bash", // GH-1456 & GH-1463
+			input:  []string{"bash -c 'printf hi'"},
+			parsed: []string{"sh", "-c", "bash -c 'printf hi'"},
+			out:    "hi",
+		},
+		{
+			name:   "subshell-single-quoting", // GH-1456 & GH-1463
+			input:  []string{"sh -c 'printf hi'"},
+			parsed: []string{"sh", "-c", "sh -c 'printf hi'"},
+			out:    "hi",
+		},
+		{
+			name:   "subshell-double-quoting",
+			input:  []string{`sh -c "printf hi"`},
+			parsed: []string{"sh", "-c", `sh -c "printf hi"`},
+			out:    "hi",
+		},
+		{
+			name:   "subshell-call",
+			input:  []string{`printf $(printf foo)`},
+			parsed: []string{"sh", "-c", "printf $(printf foo)"},
+			out:    "foo",
+		},
+		{
+			name:   "pipe",
+			input:  []string{`seq 1 5 | grep 3`},
+			parsed: []string{"sh", "-c", "seq 1 5 | grep 3"},
+			out:    "3\n",
+		},
+		{
+			name:   "conditional",
+			input:  []string{`sh -c 'if true; then printf foo; fi'`},
+			parsed: []string{"sh", "-c", "sh -c 'if true; then printf foo; fi'"},
+			out:    "foo",
+		},
+		{
+			name:   "command-substition",
+			input:  []string{`sh -c 'printf $(which /bin/sh)'`},
+			parsed: []string{"sh", "-c", "sh -c 'printf $(which /bin/sh)'"},
+			out:    "/bin/sh",
+		},
+		{
+			name:   "curly-brackets",
+			input:  []string{"sh -c '{ if [ -f /bin/sh ]; then printf foo; else printf bar; fi }'"},
+			parsed: []string{"sh", "-c", "sh -c '{ if [ -f /bin/sh ]; then printf foo; else printf bar; fi }'"},
+			out:    "foo",
+		},
+		{
+			name:   "and",
+			input:  []string{"true && true && printf and"},
+			parsed: []string{"sh", "-c", "true && true && printf and"},
+			out:    "and",
+		},
+		{
+			name:   "or",
+			input:  []string{"false || false || printf or"},
+			parsed: []string{"sh", "-c", "false || false || printf or"},
+			out:    "or",
+		},
+		{
+			name:   "backgrounded",
+			input:  []string{"(sleep .1; printf hi) &"},
+			parsed: []string{"sh", "-c", "(sleep .1; printf hi) &"},
+			out:    "hi",
+		},
+		{
+			name:   "env",
+			input:  []string{"printf ${FOO}"},
+			parsed: []string{"sh", "-c", "printf ${FOO}"},
+			out:    "bar",
+		},
+	} {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name),
+			func(t *testing.T) {
+				parseTest(tc)
+				if len(tc.input) > 0 {
+					runTest(tc)
+				}
+			})
+	}
+}
+
+func TestRunner_commandPath(t *testing.T) {
+	PATH := os.Getenv("PATH")
+	defer os.Setenv("PATH", PATH)
+	os.Setenv("PATH", "")
+	cmd, _, err := child.CommandPrep([]string{"echo hi"})
+	if err != nil && err != exec.ErrNotFound {
+		t.Fatal(err)
+	}
+	if len(cmd) != 3 {
+		t.Fatalf("unexpected command: %#v\n", cmd)
+	}
+	if filepath.Base(cmd[0]) != "sh" {
+		t.Fatalf("unexpected shell: %#v\n", cmd)
+	}
+}
+
+// TestRunner_stoppedWatcher verifies that dependencies can't be added to a
+// watcher that's been stopped after the first template rendering
+func TestRunner_stoppedWatcher(t *testing.T) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	stopCtx, stopNow := context.WithCancel(ctx)
+	t.Cleanup(stopNow)
+
+	// Test server to simulate Vault cluster responses.
+	reqNum := atomic.Uint64{}
+	vaultServer := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			t.Logf("GET %q", req.URL.Path)
+			if req.URL.Path == "/v1/secret/data/test1" {
+				if reqNum.Add(1) > 1 {
+					stopNow()
+				}
+
+				w.WriteHeader(http.StatusOK)
+
+				// We can't configure the default lease in tests because the
+				// field is global, so ensure there's a rotation_period and ttl
+				// that causes the runner to make multiple requests
+				w.Write([]byte(`{
+  "data": {
+    "data": {
+      "secret": "foo"
+    },
+    "rotation_period": "10ms",
+    "ttl": 1
+  }
+}`))
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+
+		}))
+
+	t.Cleanup(vaultServer.Close)
+
+	out, err := os.CreateTemp(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+
+	c := config.DefaultConfig().Merge(&config.Config{
+		Vault: &config.VaultConfig{
+			Address: &vaultServer.URL,
+		},
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents: config.String(
+					`{{with secret "secret/data/test1"}}{{ if .Data}}{{.Data.data.secret}}{{end}}{{end}}`),
+				Destination: config.String(out.Name()),
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Stop)
+
+	go r.Start()
+
+	// the mock vault server controls the stopCtx so that we can be sure we've
+	// rendered the empty template, set up the watcher, and have started the
+	// next poll
+	select {
+	case <-stopCtx.Done():
+		r.Stop()
+	case <-ctx.Done():
+		t.Fatal("test timed out")
+	}
+
+	// there's no way for us to control whether the Start goroutine's select
+	// takes the watcher's DataCh or the runner's doneCh. So once the runner has
+	// been stopped, we fake that we've received on the DataCh so that we hit
+	// the code path that calls Run. This should never add a dependency to the
+	// watcher.
+	r.Run()
+
+	if r.watcher.Size() != 0 {
+		t.Fatal("watcher had dependencies added after stop")
+	}
+}
+
+func TestRunner_tracing(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out")
+
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ key "foo" }}`),
+				Destination: config.String(dest),
+				Exec: &config.ExecConfig{
+					Command: []string{"true"},
+				},
+			},
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	exporter := tracetest.NewInMemoryExporter()
+	r.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	d, err := dep.NewKVGetQuery("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.EnableBlocking()
+	r.watcher.ForceWatching(d, true)
+	r.brain.Remember(d, "bar")
+
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, s := range exporter.GetSpans() {
+		spans[s.Name] = s
+	}
+	if len(spans) != 3 {
+		t.Fatalf("expected cycle, render and exec spans, got %#v", exporter.GetSpans().Snapshots())
+	}
+
+	cycle, render, exec := spans["render cycle"], spans["render"], spans["exec"]
+	if cycle.Parent.IsValid() {
+		t.Errorf("expected render cycle to be a root span: %s", cycle.Parent.SpanID())
+	}
+	if render.Parent.SpanID() != cycle.SpanContext.SpanID() {
+		t.Errorf("expected render to be a child of the render cycle")
+	}
+	if exec.Parent.SpanID() != render.SpanContext.SpanID() {
+		t.Errorf("expected exec to be a child of render")
+	}
+	if !reflect.DeepEqual(render.Attributes, []attribute.KeyValue{
+		attribute.String("template", r.templates[0].ID()),
+		attribute.Bool("would_render", true),
+		attribute.Bool("did_render", true),
+	}) {
+		t.Errorf("unexpected render attributes: %v", render.Attributes)
+	}
+}
+
+func TestRunner_statsd(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	dest := filepath.Join(t.TempDir(), "out")
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String("hello"),
+				Destination: config.String(dest),
+			},
+		},
+		Telemetry: &config.TelemetryConfig{
+			StatsdAddress: config.String(conn.LocalAddr().String()),
+			MetricsPrefix: config.String("test"),
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The statsd sink flushes its buffer periodically, so the counter and
+	// the timer may arrive in separate packets.
+	var received string
+	buf := make([]byte, 1500)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(received, "test.render.count:1") ||
+		!strings.Contains(received, "test.render.duration:") {
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected render metrics, got %q: %s", received, err)
+		}
+		received += string(buf[:n])
+	}
+}
+
+func TestRunner_prometheus(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "out")
+	c := config.TestConfig(&config.Config{
+		Templates: &config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String("hello"),
+				Destination: config.String(dest),
+				Exec: &config.ExecConfig{
+					Command: []string{"true"},
+				},
+			},
+		},
+		Telemetry: &config.TelemetryConfig{
+			MetricsPrefix:     config.String("test"),
+			PrometheusAddress: config.String("127.0.0.1:0"),
+		},
+	})
+	c.Finalize()
+
+	r, err := NewRunner(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	scrape := func() string {
+		resp, err := http.Get(fmt.Sprintf("http://%s/metrics", r.metricsServer.Addr()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	if body := scrape(); strings.Contains(body, "test_render_count") {
+		t.Fatalf("expected no renders before the first run, got:\n%s", body)
+	}
+
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := scrape()
+	for _, exp := range []string{
+		"test_render_count 1\n",
+		"test_exec_count 1\n",
+		"test_dependencies_watched 0\n",
+		fmt.Sprintf(`test_render_age_seconds{destination=%q,template=`, dest),
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("expected %q in:\n%s", exp, body)
+		}
+	}
+}
+
+func TestRunner_webhook(t *testing.T) {
+	cases := []struct {
+		name string
+		// failures is the number of requests the webhook fails first.
+		failures int
+		retry    *config.RetryConfig
+	}{
+		{
+			"delivered",
+			0,
+			nil,
+		},
+		{
+			"retried",
+			2,
+			&config.RetryConfig{
+				Attempts: config.Int(2),
+				Backoff:  config.TimeDuration(10 * time.Millisecond),
+			},
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			type request struct {
+				token   string
+				payload webhookPayload
+			}
+			requests := make(chan request, 10)
+			var failures int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if failures < tc.failures {
+					failures++
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				var p webhookPayload
+				if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+					t.Error(err)
+				}
+				requests <- request{token: req.Header.Get("X-Token"), payload: p}
+			}))
+			defer srv.Close()
+
+			dest := filepath.Join(t.TempDir(), "out")
+			c := config.TestConfig(&config.Config{
+				Templates: &config.TemplateConfigs{
+					&config.TemplateConfig{
+						Contents:    config.String("hello"),
+						Destination: config.String(dest),
+					},
+				},
+				Webhook: &config.WebhookConfig{
+					URL:     config.String(srv.URL),
+					Headers: map[string]string{"X-Token": "secret"},
+					Retry:   tc.retry,
+				},
+			})
+			c.Finalize()
+
+			r, err := NewRunner(c, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+
+			if err := r.Run(); err != nil {
+				t.Fatal(err)
+			}
+
+			var req request
+			select {
+			case req = <-requests:
+			case <-time.After(2 * time.Second):
+				t.Fatal("webhook was not notified")
+			}
+
+			sum := sha256.Sum256([]byte("hello"))
+			if exp, act := hex.EncodeToString(sum[:]), req.payload.Checksum; exp != act {
+				t.Errorf("checksum\nexp: %q\nact: %q", exp, act)
+			}
+			if exp, act := dest, req.payload.Destination; exp != act {
+				t.Errorf("destination\nexp: %q\nact: %q", exp, act)
+			}
+			if req.payload.TemplateID == "" || req.payload.Timestamp.IsZero() {
+				t.Errorf("expected a template ID and timestamp, got %#v", req.payload)
+			}
+			if exp, act := "secret", req.token; exp != act {
+				t.Errorf("header\nexp: %q\nact: %q", exp, act)
+			}
+
+			// An unchanged destination is not notified again.
+			if err := r.Run(); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case req := <-requests:
+				t.Errorf("unexpected notification %#v", req.payload)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestRunner_renderConcurrency(t *testing.T) {
+	// render runs the templates with the given concurrency and returns their
+	// contents and the commands they queued, in order.
+	render := func(t *testing.T, limit int) ([]string, []string) {
+		dir := t.TempDir()
+
+		const n = 6
+		templates := make(config.TemplateConfigs, 0, n)
+		for i := 0; i < n; i++ {
+			// The second and fifth templates share their command.
+			command := fmt.Sprintf("echo %d", i)
+			if i == 4 {
+				command = "echo 1"
+			}
+			templates = append(templates, &config.TemplateConfig{
+				Contents: config.String(fmt.Sprintf(
+					`{{ key "concurrency-%d" }} {{ key "concurrency-shared" }}`, i)),
+				Destination: config.String(filepath.Join(dir, strconv.Itoa(i))),
+				Exec: &config.ExecConfig{
+					Command: []string{command},
+				},
+			})
+		}
+
+		// The commands are debounced so that their order can be inspected.
+		c := config.TestConfig(&config.Config{
+			ExecDebounce:      config.TimeDuration(time.Hour),
+			RenderConcurrency: config.Int(limit),
+			Templates:         &templates,
+		})
+		c.Finalize()
+
+		r, err := NewRunner(c, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		data := map[string]string{"concurrency-shared": "shared"}
+		for i := 0; i < n; i++ {
+			data[fmt.Sprintf("concurrency-%d", i)] = fmt.Sprintf("value-%d", i)
+		}
+		for k, v := range data {
+			d, err := dep.NewKVGetQuery(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.EnableBlocking()
+			r.Receive(d, v)
+		}
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		contents := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			b, err := os.ReadFile(filepath.Join(dir, strconv.Itoa(i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents = append(contents, string(b))
+		}
+		commands := make([]string, 0, len(r.pendingCommands))
+		for _, tc := range r.pendingCommands {
+			commands = append(commands, tc.Exec.Command[0])
+		}
+		return contents, commands
+	}
+
+	expContents, expCommands := render(t, 1)
+	if exp, act := []string{"echo 0", "echo 1", "echo 2", "echo 3", "echo 5"}, expCommands; !reflect.DeepEqual(exp, act) {
+		t.Fatalf("\nexp: %#v\nact: %#v", exp, act)
+	}
+
+	for i := 0; i < 5; i++ {
+		contents, commands := render(t, 2)
+		if !reflect.DeepEqual(expContents, contents) {
+			t.Errorf("\nexp: %#v\nact: %#v", expContents, contents)
+		}
+		if !reflect.DeepEqual(expCommands, commands) {
+			t.Errorf("\nexp: %#v\nact: %#v", expCommands, commands)
+		}
+	}
+}
+
+func TestRunner_execRetry(t *testing.T) {
+	cases := []struct {
+		name string
+		// command fails while fewer than this many attempts were made.
+		failUntil int
+		rollback  bool
+		once      bool
+		err       bool
+		attempts  int
+		contents  string
+	}{
+		{
+			"succeeds_on_second_attempt",
+			2,
+			true,
+			false,
+			false,
+			2,
+			"new",
+		},
+		{
+			"exhausts_retries",
+			10,
+			false,
+			false,
+			true,
+			3,
+			"new",
+		},
+		{
+			"exhausts_retries_rollback",
+			10,
+			true,
+			false,
+			true,
+			3,
+			"old",
+		},
+		{
+			"once_exhausts_retries_rollback",
+			10,
+			true,
+			true,
+			true,
+			3,
+			"old",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			dir := t.TempDir()
+			dest, count := filepath.Join(dir, "dest"), filepath.Join(dir, "count")
+			if err := os.WriteFile(dest, []byte("old"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c := config.TestConfig(&config.Config{
+				Once: tc.once,
+				Templates: &config.TemplateConfigs{
+					&config.TemplateConfig{
+						Contents:    config.String("new"),
+						Destination: config.String(dest),
+						Exec: &config.ExecConfig{
+							Command: []string{fmt.Sprintf(
+								"echo x >> %s; test $(wc -l < %s) -ge %d", count, count, tc.failUntil)},
+							Retry: &config.ExecRetryConfig{
+								Attempts:   config.Int(2),
+								Backoff:    config.TimeDuration(10 * time.Millisecond),
+								Multiplier: config.Float64(2),
+							},
+							Rollback: config.Bool(tc.rollback),
+						},
+					},
+				},
+			})
+			c.Finalize()
+
+			r, err := NewRunner(c, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+
+			// Outside of once mode, the run returns after the first attempt
+			// and the retries are left to the run loop, driven here.
+			err = r.Run()
+			for len(r.execRetries) > 0 && err == nil {
+				select {
+				case retry := <-r.execRetryCh:
+					err = r.retryCommand(retry)
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for retry")
+				}
+			}
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+
+			b, err := os.ReadFile(count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp, act := tc.attempts, strings.Count(string(b), "x"); exp != act {
+				t.Errorf("expected %d attempts, got %d", exp, act)
+			}
+
+			b, err = os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp, act := tc.contents, string(b); exp != act {
+				t.Errorf("\nexp: %q\nact: %q", exp, act)
+			}
+
+			if !tc.rollback || tc.once {
+				return
+			}
+			if _, ok := r.renderedHashes[(*c.Templates)[0]]; ok != !tc.err {
+				t.Errorf("expected rendered hash %t, got %t", !tc.err, ok)
+			}
+			// The rolled back destination is rendered again on the next run.
+			r.Run()
+			b, err = os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp, act := "new", string(b); exp != act {
+				t.Errorf("\nexp: %q\nact: %q", exp, act)
+			}
+		})
+	}
+}
+
+func TestRunner_renderGroup(t *testing.T) {
+	// newRunner returns a runner for a render group of three templates with
+	// the given destinations. The last template fails while its key is empty.
+	newRunner := func(t *testing.T, dir string, dests []string) *Runner {
+		contents := []string{
+			`{{ key "group-config" }}`,
+			`{{ key "group-secrets" }}`,
+			`{{ key "group-map" | required "group-map is empty" }}`,
+		}
+		templates := make(config.TemplateConfigs, 0, len(dests))
+		for i, dest := range dests {
+			templates = append(templates, &config.TemplateConfig{
+				Contents:       config.String(contents[i]),
+				CreateDestDirs: config.Bool(false),
+				Destination:    config.String(dest),
+				ErrFatal:       config.Bool(false),
+				RenderGroup:    config.String("proxy"),
+				Exec: &config.ExecConfig{
+					Command: []string{"echo ran >> " + filepath.Join(dir, "exec")},
+				},
+			})
+		}
+		c := config.TestConfig(&config.Config{Templates: &templates})
+		c.Finalize()
+
+		r, err := NewRunner(c, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(r.Stop)
+
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	receive := func(t *testing.T, r *Runner, data map[string]string) {
+		for k, v := range data {
+			d, err := dep.NewKVGetQuery(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.EnableBlocking()
+			r.Receive(d, v)
+		}
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkContents := func(t *testing.T, dests []string, exp ...string) {
+		t.Helper()
+		for i, dest := range dests {
+			b, err := os.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if act := string(b); exp[i] != act {
+				t.Errorf("%s\nexp: %q\nact: %q", dest, exp[i], act)
+			}
+		}
+	}
+
+	t.Run("failed_member", func(t *testing.T) {
+		dir := t.TempDir()
+		dests := []string{
+			filepath.Join(dir, "config"),
+			filepath.Join(dir, "secrets"),
+			filepath.Join(dir, "map"),
+		}
+		for _, dest := range dests {
+			if err := os.WriteFile(dest, []byte("old"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := newRunner(t, dir, dests)
+
+		receive(t, r, map[string]string{
+			"group-config":  "new-config",
+			"group-secrets": "new-secrets",
+			"group-map":     "",
+		})
+		checkContents(t, dests, "old", "old", "old")
+		if _, err := os.Stat(filepath.Join(dir, "exec")); !os.IsNotExist(err) {
+			t.Errorf("expected the command not to run, got %v", err)
+		}
+
+		// Once the failing template is fixed, the group is written together
+		// and the shared command runs once.
+		receive(t, r, map[string]string{"group-map": "new-map"})
+		checkContents(t, dests, "new-config", "new-secrets", "new-map")
+
+		b, err := os.ReadFile(filepath.Join(dir, "exec"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp, act := "ran\n", string(b); exp != act {
+			t.Errorf("\nexp: %q\nact: %q", exp, act)
+		}
+	})
+
+	t.Run("failed_write", func(t *testing.T) {
+		dir := t.TempDir()
+		// The parent directory of the second destination is missing, so it
+		// fails to be written after the first one was.
+		dests := []string{
+			filepath.Join(dir, "config"),
+			filepath.Join(dir, "missing", "secrets"),
+			filepath.Join(dir, "map"),
+		}
+		if err := os.WriteFile(dests[0], []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r := newRunner(t, dir, dests)
+
+		receive(t, r, map[string]string{
+			"group-config":  "new-config",
+			"group-secrets": "new-secrets",
+			"group-map":     "new-map",
+		})
+		checkContents(t, dests[:1], "old")
+		for _, dest := range dests[1:] {
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("expected %s not to be written, got %v", dest, err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "exec")); !os.IsNotExist(err) {
+			t.Errorf("expected the command not to run, got %v", err)
+		}
+	})
+
+	t.Run("fatal_error", func(t *testing.T) {
+		dir := t.TempDir()
+		dests := []string{filepath.Join(dir, "config"), filepath.Join(dir, "secrets")}
+
+		// The group is ready, but a template outside of it fails the run.
+		templates := config.TemplateConfigs{
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ key "group-config" }}`),
+				Destination: config.String(dests[0]),
+				RenderGroup: config.String("proxy"),
+			},
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ key "group-secrets" }}`),
+				Destination: config.String(dests[1]),
+				RenderGroup: config.String("proxy"),
+			},
+			&config.TemplateConfig{
+				Contents:    config.String(`{{ key "group-fatal" | required "group-fatal is empty" }}`),
+				Destination: config.String(filepath.Join(dir, "fatal")),
+				ErrFatal:    config.Bool(true),
+			},
+		}
+		c := config.TestConfig(&config.Config{Templates: &templates})
+		c.Finalize()
+
+		r, err := NewRunner(c, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Stop()
+
+		if err := r.Run(); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range map[string]string{
+			"group-config":  "new-config",
+			"group-secrets": "new-secrets",
+			"group-fatal":   "",
+		} {
+			d, err := dep.NewKVGetQuery(k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.EnableBlocking()
+			r.Receive(d, v)
+		}
+		if err := r.Run(); err == nil {
+			t.Fatal("expected the run to fail")
+		}
+		for _, dest := range dests {
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("expected %s not to be written, got %v", dest, err)
+			}
+		}
+	})
 }
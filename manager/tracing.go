@@ -0,0 +1,47 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package manager
+
+import (
+	"context"
+	"log"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/hashicorp/consul-template/config"
+	"github.com/hashicorp/consul-template/version"
+)
+
+// tracerName is the instrumentation name reported on every span.
+const tracerName = "github.com/hashicorp/consul-template/manager"
+
+// newTracer returns the tracer used to record render cycles along with a
+// function to flush and stop it. When tracing is disabled the returned tracer
+// is a no-op.
+func newTracer(c *config.TracingConfig) (trace.Tracer, func(context.Context) error, error) {
+	if c == nil || !config.BoolVal(c.Enabled) {
+		return noop.NewTracerProvider().Tracer(tracerName), nil, nil
+	}
+
+	log.Printf("[INFO] (runner) exporting traces to %s", config.StringVal(c.Endpoint))
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(config.StringVal(c.Endpoint)),
+	}
+	if config.BoolVal(c.Insecure) {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	return tp.Tracer(tracerName, trace.WithInstrumentationVersion(version.Version)),
+		tp.Shutdown, nil
+}
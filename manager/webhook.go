@@ -0,0 +1,121 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/consul-template/config"
+)
+
+// webhook notifies an external system of each render which changed a
+// destination.
+type webhook struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	retry   config.RetryFunc
+
+	// doneCh stops retrying notifications once the runner stops.
+	doneCh <-chan struct{}
+}
+
+// webhookPayload is the JSON body POSTed to the webhook for each render.
+type webhookPayload struct {
+	TemplateID  string    `json:"template_id"`
+	Destination string    `json:"destination"`
+	Checksum    string    `json:"checksum"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// newWebhook returns the webhook for the given configuration, or nil if it is
+// not enabled.
+func newWebhook(c *config.WebhookConfig, doneCh <-chan struct{}) *webhook {
+	if c == nil || !config.BoolVal(c.Enabled) {
+		return nil
+	}
+	return &webhook{
+		url:     config.StringVal(c.URL),
+		headers: c.Headers,
+		client:  &http.Client{Timeout: config.TimeDurationVal(c.Timeout)},
+		retry:   c.Retry.RetryFunc(),
+		doneCh:  doneCh,
+	}
+}
+
+// newWebhookPayload returns the payload describing the render of the event.
+func newWebhookPayload(tc *config.TemplateConfig, event *RenderEvent) *webhookPayload {
+	sum := sha256.Sum256(event.Contents)
+	return &webhookPayload{
+		TemplateID:  event.Template.ID(),
+		Destination: config.StringVal(tc.Destination),
+		Checksum:    hex.EncodeToString(sum[:]),
+		Timestamp:   event.LastDidRender,
+	}
+}
+
+// notify delivers the payloads in order, retrying each per the retry
+// configuration. Failures are only logged, so it is meant to be called as a
+// goroutine.
+func (w *webhook) notify(payloads []*webhookPayload) {
+	for _, p := range payloads {
+		body, err := json.Marshal(p)
+		if err != nil {
+			log.Printf("[ERR] (runner) webhook: %s", err)
+			continue
+		}
+
+		for attempt := 0; ; attempt++ {
+			err := w.post(body)
+			if err == nil {
+				log.Printf("[DEBUG] (runner) webhook notified of %s", p.Destination)
+				break
+			}
+
+			retry, sleep := w.retry(attempt)
+			if !retry {
+				log.Printf("[ERR] (runner) webhook failed to notify of %s: %s", p.Destination, err)
+				break
+			}
+			log.Printf("[WARN] (runner) webhook failed to notify of %s, retrying in %s: %s",
+				p.Destination, sleep, err)
+
+			select {
+			case <-time.After(sleep):
+			case <-w.doneCh:
+				return
+			}
+		}
+	}
+}
+
+// post POSTs the body to the webhook, failing on any status but 2xx.
+func (w *webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
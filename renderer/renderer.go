@@ -10,8 +10,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
 )
 
 const (
@@ -27,6 +30,14 @@ var (
 
 	// ErrMissingDest is the error returned with the destination is empty.
 	ErrMissingDest = errors.New("missing destination")
+
+	// ErrNoReader is the error returned when the destination is a named pipe
+	// which no process has open for reading.
+	ErrNoReader = errors.New("named pipe has no reader")
+
+	// specialWriteTimeout is the maximum time to wait for the reader of a named
+	// pipe or Unix socket destination to accept the contents.
+	specialWriteTimeout = 5 * time.Second
 )
 
 // RenderInput is used as input to the render function.
@@ -39,6 +50,10 @@ type RenderInput struct {
 	Path           string
 	Perms          os.FileMode
 	User, Group    string
+
+	// Diff prints a unified diff between the destination and the contents to
+	// the DryStream in dry mode, instead of the contents.
+	Diff bool
 }
 
 // RenderResult is returned and stored. It contains the status of the render
@@ -64,6 +79,12 @@ type Renderer func(*RenderInput) (*RenderResult, error)
 // Render atomically renders a file contents to disk, returning a result of
 // whether it would have rendered and actually did render.
 func Render(i *RenderInput) (*RenderResult, error) {
+	// Named pipes and sockets are written to as they are, and cannot be read
+	// back to compare against.
+	if fi, err := os.Stat(i.Path); err == nil && isSpecialFile(fi) {
+		return renderSpecial(i, fi.Mode())
+	}
+
 	existing, err := os.ReadFile(i.Path)
 	fileExists := !os.IsNotExist(err)
 	if err != nil && fileExists {
@@ -97,7 +118,11 @@ func Render(i *RenderInput) (*RenderResult, error) {
 		}, nil
 	}
 
-	if i.Dry {
+	if i.Dry && i.Diff {
+		if err := writeDiff(i.DryStream, i.Path, fileExists, existing, i.Contents); err != nil {
+			return nil, errors.Wrap(err, "failed writing diff")
+		}
+	} else if i.Dry {
 		fmt.Fprintf(i.DryStream, "> %s\n%s", i.Path, i.Contents)
 	} else {
 		if err := AtomicWrite(i.Path, i.CreateDestDirs, i.Contents, i.Perms, i.Backup); err != nil {
@@ -116,6 +141,54 @@ func Render(i *RenderInput) (*RenderResult, error) {
 	}, nil
 }
 
+// renderSpecial writes the contents to the named pipe or Unix socket
+// destination. Every render is delivered, since the previous contents are not
+// known.
+func renderSpecial(i *RenderInput, mode os.FileMode) (*RenderResult, error) {
+	if i.Dry {
+		fmt.Fprintf(i.DryStream, "> %s\n%s", i.Path, i.Contents)
+	} else if err := writeSpecial(i.Path, mode, i.Contents); err != nil {
+		return nil, errors.Wrap(err, "failed writing to "+i.Path)
+	}
+
+	return &RenderResult{
+		DidRender:   true,
+		WouldRender: true,
+		Contents:    i.Contents,
+	}, nil
+}
+
+// writeDiff writes a unified diff between the existing contents of the file at
+// the given path and the new contents. A file which does not exist yet is
+// diffed against /dev/null. Only a change of ownership produces an empty diff.
+func writeDiff(w io.Writer, path string, exists bool, existing, contents []byte) error {
+	from := path
+	if !exists {
+		from = "/dev/null"
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(existing),
+		B:        diffLines(contents),
+		FromFile: from,
+		ToFile:   path,
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, diff)
+	return err
+}
+
+// diffLines splits the contents into lines for a diff, keeping their newlines.
+func diffLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
 // AtomicWrite accepts a destination path and the template contents. It writes
 // the template contents to a TempFile on disk, returning if any errors occur.
 //
@@ -320,6 +320,74 @@ func TestRender(t *testing.T) {
 	})
 }
 
+func TestRender_Diff(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	if err := os.WriteFile(existing, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		path     string
+		contents string
+		did      bool
+		exp      string
+	}{
+		{
+			"unchanged",
+			existing,
+			"a\nb\nc\n",
+			false,
+			"",
+		},
+		{
+			"changed",
+			existing,
+			"a\nB\nc\n",
+			true,
+			"--- " + existing + "\n+++ " + existing + "\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"new",
+			filepath.Join(dir, "new"),
+			"a\n",
+			true,
+			"--- /dev/null\n+++ " + filepath.Join(dir, "new") + "\n@@ -0,0 +1 @@\n+a\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			rr, err := Render(&RenderInput{
+				Path:      tc.path,
+				Contents:  []byte(tc.contents),
+				Dry:       true,
+				DryStream: out,
+				Diff:      true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rr.DidRender != tc.did {
+				t.Errorf("expected did render to be %v", tc.did)
+			}
+			if out.String() != tc.exp {
+				t.Errorf("\nexp: %q\nact: %q", tc.exp, out.String())
+			}
+
+			b, err := os.ReadFile(existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "a\nb\nc\n" {
+				t.Errorf("expected destination not to be written, got %q", b)
+			}
+		})
+	}
+}
+
 func TestRender_Chown(t *testing.T) {
 	// Can't change uid unless root, but can try changing the group id
 
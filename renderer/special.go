@@ -0,0 +1,60 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+// +build !windows
+
+package renderer
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// isSpecialFile returns true if the file is a named pipe or a Unix socket,
+// which are written to directly instead of being replaced.
+func isSpecialFile(fi os.FileInfo) bool {
+	return fi.Mode()&(os.ModeNamedPipe|os.ModeSocket) != 0
+}
+
+// writeSpecial writes the contents to the named pipe or Unix socket at the
+// given path. The pipe is opened without blocking, so a pipe with no reader
+// fails immediately with ErrNoReader rather than hanging the runner, and the
+// write fails if the reader does not consume the contents within
+// specialWriteTimeout.
+func writeSpecial(path string, mode os.FileMode, contents []byte) error {
+	deadline := time.Now().Add(specialWriteTimeout)
+
+	if mode&os.ModeSocket != 0 {
+		conn, err := net.DialTimeout("unix", path, specialWriteTimeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		_, err = conn.Write(contents)
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ENXIO) {
+			return ErrNoReader
+		}
+		return err
+	}
+	defer f.Close()
+
+	if err := f.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+	return err
+}
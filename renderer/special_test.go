@@ -0,0 +1,109 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+// +build !windows
+
+package renderer
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRender_Special(t *testing.T) {
+	t.Run("fifo", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "fifo")
+		if err := syscall.Mkfifo(path, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		// Open the reader without blocking on a writer
+		r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		rr, err := Render(&RenderInput{
+			Path:     path,
+			Contents: []byte("hello"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rr.DidRender || !rr.WouldRender {
+			t.Errorf("Bad render results; would: %v, did: %v",
+				rr.WouldRender, rr.DidRender)
+		}
+
+		act, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(act) != "hello" {
+			t.Errorf("\nexp: %q\nact: %q", "hello", act)
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&os.ModeNamedPipe == 0 {
+			t.Errorf("expected %s to still be a named pipe", path)
+		}
+	})
+
+	t.Run("fifo-no-reader", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "fifo")
+		if err := syscall.Mkfifo(path, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Render(&RenderInput{
+			Path:     path,
+			Contents: []byte("hello"),
+		})
+		if !errors.Is(err, ErrNoReader) {
+			t.Fatalf("expected %q to be %q", err, ErrNoReader)
+		}
+	})
+
+	t.Run("socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		ch := make(chan string, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				ch <- err.Error()
+				return
+			}
+			defer conn.Close()
+			b, _ := io.ReadAll(conn)
+			ch <- string(b)
+		}()
+
+		if _, err := Render(&RenderInput{
+			Path:     path,
+			Contents: []byte("hello"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if act := <-ch; act != "hello" {
+			t.Errorf("\nexp: %q\nact: %q", "hello", act)
+		}
+	})
+}
@@ -0,0 +1,22 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows
+// +build windows
+
+package renderer
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Named pipes and Unix sockets are not supported as destinations on Windows.
+func isSpecialFile(fi os.FileInfo) bool {
+	return false
+}
+
+func writeSpecial(path string, mode os.FileMode, contents []byte) error {
+	return errors.New("writing to named pipes and sockets is not supported")
+}
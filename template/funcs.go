@@ -7,21 +7,28 @@ import (
 	"bytes"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"os"
 	"os/exec"
 	"os/user"
+	"path"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -31,11 +38,13 @@ import (
 	"github.com/hashicorp/consul/api"
 	socktmpl "github.com/hashicorp/go-sockaddr/template"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	"gopkg.in/yaml.v2"
 
 	dep "github.com/hashicorp/consul-template/dependency"
+	"github.com/hashicorp/consul-template/renderer"
 )
 
 // now is function that represents the current time in UTC. This is here
@@ -97,6 +106,63 @@ func partitionsFunc(b *Brain, used, missing *dep.Set) func() ([]*dep.Partition,
 	}
 }
 
+// agentSelfFunc returns or accumulates local Consul agent dependencies. The
+// optional argument is the interval at which the agent is polled.
+func agentSelfFunc(b *Brain, used, missing *dep.Set) func(...string) (*dep.AgentSelf, error) {
+	return func(s ...string) (*dep.AgentSelf, error) {
+		result := &dep.AgentSelf{}
+
+		var interval time.Duration
+		switch len(s) {
+		case 0:
+		case 1:
+			var err error
+			if interval, err = time.ParseDuration(s[0]); err != nil {
+				return result, fmt.Errorf("agentSelf: %s", err)
+			}
+		default:
+			return result, fmt.Errorf("agentSelf: expected at most 1 argument, got %d", len(s))
+		}
+
+		d, err := dep.NewAgentSelfQuery(interval)
+		if err != nil {
+			return result, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.AgentSelf), nil
+		}
+
+		missing.Add(d)
+
+		return result, nil
+	}
+}
+
+// autopilotHealthFunc returns or accumulates autopilot health dependencies.
+func autopilotHealthFunc(b *Brain, used, missing *dep.Set) func() (*dep.AutopilotHealth, error) {
+	return func() (*dep.AutopilotHealth, error) {
+		result := &dep.AutopilotHealth{}
+
+		d, err := dep.NewAutopilotHealthQuery()
+		if err != nil {
+			return result, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.AutopilotHealth), nil
+		}
+
+		missing.Add(d)
+
+		return result, nil
+	}
+}
+
 // exportedServicesFunc returns or accumulates partition dependencies.
 func exportedServicesFunc(b *Brain, used, missing *dep.Set) func(...string) ([]dep.ExportedService, error) {
 	return func(s ...string) ([]dep.ExportedService, error) {
@@ -167,25 +233,79 @@ func mustEnvFunc(env []string) func(string) (string, error) {
 // envWithDefaultFunc returns a function which checks the value of an environment variable.
 // Invokers can specify their own environment, which takes precedences over any
 // real environment variables.
-// If an environment variable is found, the value of that variable will be used. This includes empty values.
-// Otherwise, the default will be used instead.
+// If an environment variable is found and not empty, the value of that variable
+// will be used. Otherwise, the default will be used instead, so an optional
+// variable which is set but empty does not render blank configuration.
 func envWithDefaultFunc(env []string) func(string, string) (string, error) {
 	return func(s string, def string) (string, error) {
 		for _, e := range env {
 			split := strings.SplitN(e, "=", 2)
 			k, v := split[0], split[1]
-			if k == s {
+			if k == s && v != "" {
 				return v, nil
 			}
 		}
-		val, isPresent := os.LookupEnv(s)
-		if isPresent {
+		if val := os.Getenv(s); val != "" {
 			return val, nil
 		}
 		return def, nil
 	}
 }
 
+// requiredFunc returns a function which returns the given value unchanged, or
+// fails the render with the given message when the value is missing: nil, an
+// empty string, or an empty list or map. Values are not checked while
+// dependencies are missing, since they are empty until their data arrives.
+func requiredFunc(missing *dep.Set) func(string, interface{}) (interface{}, error) {
+	return func(msg string, v interface{}) (interface{}, error) {
+		if missing.Len() > 0 {
+			return v, nil
+		}
+		if isMissing(v) {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	}
+}
+
+// isMissing returns whether the value is nil, or an empty string, list or map.
+// It is the emptiness of both required and coalesce, so zero numbers and false
+// are values like any other.
+func isMissing(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// coalesce returns the first of the given values which is not missing, as
+// required sees it. It returns nil if they all are.
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if isMissing(v) {
+			continue
+		}
+		return v
+	}
+	return nil
+}
+
+// ternary returns trueVal if the condition is true and falseVal otherwise.
+func ternary(trueVal, falseVal interface{}, cond bool) interface{} {
+	if cond {
+		return trueVal
+	}
+	return falseVal
+}
+
 // executeTemplateFunc executes the given template in the context of the
 // parent. If an argument is specified, it will be used as the context instead.
 // This can be used for nested template definitions.
@@ -239,6 +359,37 @@ func fileFunc(b *Brain, used, missing *dep.Set, sandboxPath string) func(string)
 	}
 }
 
+// readFileLinesFunc returns or accumulates file dependencies which are read
+// as a slice of lines.
+func readFileLinesFunc(b *Brain, used, missing *dep.Set, sandboxPath string) func(string) ([]string, error) {
+	return func(s string) ([]string, error) {
+		if len(s) == 0 {
+			return []string{}, nil
+		}
+		err := pathInSandbox(sandboxPath, s)
+		if err != nil {
+			return nil, err
+		}
+		d, err := dep.NewFileLinesQuery(s)
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			if value == nil {
+				return []string{}, nil
+			}
+			return value.([]string), nil
+		}
+
+		missing.Add(d)
+
+		return []string{}, nil
+	}
+}
+
 // keyFunc returns or accumulates key dependencies.
 func keyFunc(b *Brain, used, missing *dep.Set) func(string) (string, error) {
 	return func(s string) (string, error) {
@@ -291,6 +442,76 @@ func keyExistsFunc(b *Brain, used, missing *dep.Set) func(string) (bool, error)
 	}
 }
 
+// lockHolderFunc returns or accumulates the holder of a lock on a key.
+func lockHolderFunc(b *Brain, used, missing *dep.Set) func(string) (*dep.KVLock, error) {
+	return func(s string) (*dep.KVLock, error) {
+		if len(s) == 0 {
+			return nil, nil
+		}
+
+		d, err := dep.NewKVLockQuery(s)
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.KVLock), nil
+		}
+
+		missing.Add(d)
+
+		return nil, nil
+	}
+}
+
+// treeChecksumFunc returns or accumulates checksum dependencies over all keys
+// and values under a prefix.
+func treeChecksumFunc(b *Brain, used, missing *dep.Set) func(string) (string, error) {
+	return func(s string) (string, error) {
+		d, err := dep.NewKVTreeChecksumQuery(s)
+		if err != nil {
+			return "", err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(string), nil
+		}
+
+		missing.Add(d)
+
+		return "", nil
+	}
+}
+
+// kvExistsFunc returns or accumulates key existence dependencies. Unlike
+// keyExists, the value of the key is never fetched.
+func kvExistsFunc(b *Brain, used, missing *dep.Set) func(string) (bool, error) {
+	return func(s string) (bool, error) {
+		if len(s) == 0 {
+			return false, nil
+		}
+
+		d, err := dep.NewKVExistsQuery(s)
+		if err != nil {
+			return false, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(bool), nil
+		}
+
+		missing.Add(d)
+
+		return false, nil
+	}
+}
+
 // keyWithDefaultFunc returns or accumulates key dependencies that have a
 // default value.
 func keyWithDefaultFunc(b *Brain, used, missing *dep.Set) func(string, string) (string, error) {
@@ -442,18 +663,9 @@ func pkiCertFunc(b *Brain, used, missing *dep.Set, destPath string) func(...stri
 		}
 
 		path, rest := s[0], s[1:]
-		data := make(map[string]interface{})
-		for _, str := range rest {
-			if len(str) == 0 {
-				continue
-			}
-			parts := strings.SplitN(str, "=", 2)
-			if len(parts) != 2 {
-				return nil, fmt.Errorf("not k=v pair %q", str)
-			}
-
-			k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-			data[k] = v
+		data, err := parseKVPairs(rest)
+		if err != nil {
+			return nil, err
 		}
 
 		d, err := dep.NewVaultPKIQuery(path, destPath, data)
@@ -479,22 +691,12 @@ func secretFunc(b *Brain, used, missing *dep.Set) func(...string) (interface{},
 		}
 
 		path, rest := s[0], s[1:]
-		data := make(map[string]interface{})
-		for _, str := range rest {
-			if len(str) == 0 {
-				continue
-			}
-			parts := strings.SplitN(str, "=", 2)
-			if len(parts) != 2 {
-				return nil, fmt.Errorf("not k=v pair %q", str)
-			}
-
-			k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
-			data[k] = v
+		data, err := parseKVPairs(rest)
+		if err != nil {
+			return nil, err
 		}
 
 		var d dep.Dependency
-		var err error
 
 		isReadQuery := len(rest) == 0
 		if isReadQuery {
@@ -510,6 +712,10 @@ func secretFunc(b *Brain, used, missing *dep.Set) func(...string) (interface{},
 		used.Add(d)
 
 		if value, ok := b.Recall(d); ok {
+			// A single field of a read secret is returned as a string
+			if field, ok := value.(string); ok {
+				return field, nil
+			}
 			return value.(*dep.Secret), nil
 		}
 
@@ -519,16 +725,15 @@ func secretFunc(b *Brain, used, missing *dep.Set) func(...string) (interface{},
 	}
 }
 
-// secretsFunc returns or accumulates a list of secret dependencies from Vault.
-func secretsFunc(b *Brain, used, missing *dep.Set) func(string) ([]string, error) {
-	return func(s string) ([]string, error) {
-		var result []string
-
+// secretMultiFunc returns or accumulates a dependency reading a batch of
+// secrets from Vault at once.
+func secretMultiFunc(b *Brain, used, missing *dep.Set) func(...string) (*dep.VaultReadMultiResult, error) {
+	return func(s ...string) (*dep.VaultReadMultiResult, error) {
 		if len(s) == 0 {
-			return result, nil
+			return nil, nil
 		}
 
-		d, err := dep.NewVaultListQuery(s)
+		d, err := dep.NewVaultReadMultiQuery(s)
 		if err != nil {
 			return nil, err
 		}
@@ -536,69 +741,70 @@ func secretsFunc(b *Brain, used, missing *dep.Set) func(string) ([]string, error
 		used.Add(d)
 
 		if value, ok := b.Recall(d); ok {
-			result = value.([]string)
-			return result, nil
+			return value.(*dep.VaultReadMultiResult), nil
 		}
 
 		missing.Add(d)
 
-		return result, nil
+		return nil, nil
 	}
 }
 
-// byMeta returns Services grouped by one or many ServiceMeta fields.
-func byMeta(meta string, services []*dep.HealthService) (groups map[string][]*dep.HealthService, err error) {
-	re := regexp.MustCompile("[^a-zA-Z0-9_-]")
-	normalize := func(x string) string {
-		return re.ReplaceAllString(x, "_")
-	}
-	getOrDefault := func(m map[string]string, key string) string {
-		realKey := strings.TrimSuffix(key, "|int")
-		if val := m[realKey]; val != "" {
-			return val
+// parseKVPairs parses the given "k=v" arguments into a map, skipping empty
+// arguments.
+func parseKVPairs(pairs []string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for _, str := range pairs {
+		if len(str) == 0 {
+			continue
 		}
-		if strings.HasSuffix(key, "|int") {
-			return "0"
+		parts := strings.SplitN(str, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("not k=v pair %q", str)
 		}
-		return fmt.Sprintf("_no_%s_", realKey)
+
+		k, v := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		data[k] = v
 	}
+	return data, nil
+}
 
-	metas := strings.Split(meta, ",")
+// vaultRequestFunc returns or accumulates a request dependency from Vault,
+// for logical endpoints which vault.read and vault.list do not support.
+func vaultRequestFunc(b *Brain, used, missing *dep.Set) func(string, string, ...string) (map[string]interface{}, error) {
+	return func(method, path string, rest ...string) (map[string]interface{}, error) {
+		body, err := parseKVPairs(rest)
+		if err != nil {
+			return nil, err
+		}
 
-	groups = make(map[string][]*dep.HealthService)
+		d, err := dep.NewVaultRequestQuery(method, path, body)
+		if err != nil {
+			return nil, err
+		}
 
-	for _, s := range services {
-		sm := s.ServiceMeta
-		keyParts := []string{}
-		for _, meta := range metas {
-			value := getOrDefault(sm, meta)
-			if strings.HasSuffix(meta, "|int") {
-				value = getOrDefault(sm, meta)
-				i, err := strconv.Atoi(value)
-				if err != nil {
-					return nil, errors.Wrap(err, fmt.Sprintf("cannot parse %v as number ", value))
-				}
-				value = fmt.Sprintf("%05d", i)
-			}
-			keyParts = append(keyParts, normalize(value))
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(map[string]interface{}), nil
 		}
-		key := strings.Join(keyParts, "_")
-		groups[key] = append(groups[key], s)
-	}
 
-	return groups, nil
+		missing.Add(d)
+
+		return nil, nil
+	}
 }
 
-// serviceFunc returns or accumulates health service dependencies.
-func serviceFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.HealthService, error) {
-	return func(s ...string) ([]*dep.HealthService, error) {
-		result := []*dep.HealthService{}
+// secretsFunc returns or accumulates a list of secret dependencies from Vault.
+func secretsFunc(b *Brain, used, missing *dep.Set) func(string) ([]string, error) {
+	return func(s string) ([]string, error) {
+		var result []string
 
-		if len(s) == 0 || s[0] == "" {
+		if len(s) == 0 {
 			return result, nil
 		}
 
-		d, err := dep.NewHealthServiceQuery(strings.Join(s, "|"))
+		d, err := dep.NewVaultListQuery(s)
 		if err != nil {
 			return nil, err
 		}
@@ -606,7 +812,8 @@ func serviceFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.Healt
 		used.Add(d)
 
 		if value, ok := b.Recall(d); ok {
-			return value.([]*dep.HealthService), nil
+			result = value.([]string)
+			return result, nil
 		}
 
 		missing.Add(d)
@@ -615,20 +822,33 @@ func serviceFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.Healt
 	}
 }
 
-// servicesFunc returns or accumulates catalog services dependencies.
-func servicesFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.CatalogSnippet, error) {
-	return func(s ...string) ([]*dep.CatalogSnippet, error) {
-		result := []*dep.CatalogSnippet{}
+// secretVersionsFunc returns or accumulates dependencies on the data of each
+// version of a KVv2 secret from Vault. The optional argument limits the number
+// of most recent versions which are read.
+func secretVersionsFunc(b *Brain, used, missing *dep.Set) func(string, ...int) ([]*dep.VaultSecretVersion, error) {
+	return func(s string, max ...int) ([]*dep.VaultSecretVersion, error) {
+		result := []*dep.VaultSecretVersion{}
 
-		d, err := dep.NewCatalogServicesQuery(strings.Join(s, ""))
+		if len(s) == 0 {
+			return result, nil
+		}
+		if len(max) > 1 {
+			return result, fmt.Errorf("secretVersions: expected at most 2 arguments, got %d", len(max)+1)
+		}
+
+		var n int
+		if len(max) == 1 {
+			n = max[0]
+		}
+		d, err := dep.NewVaultAllVersionsQuery(s, n)
 		if err != nil {
-			return nil, err
+			return result, err
 		}
 
 		used.Add(d)
 
 		if value, ok := b.Recall(d); ok {
-			return value.([]*dep.CatalogSnippet), nil
+			return value.([]*dep.VaultSecretVersion), nil
 		}
 
 		missing.Add(d)
@@ -637,16 +857,15 @@ func servicesFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.Cata
 	}
 }
 
-// connectFunc returns or accumulates health connect dependencies.
-func connectFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.HealthService, error) {
-	return func(s ...string) ([]*dep.HealthService, error) {
-		result := []*dep.HealthService{}
-
-		if len(s) == 0 || s[0] == "" {
-			return result, nil
+// secretMetadataFunc returns or accumulates KVv2 metadata dependencies from
+// Vault.
+func secretMetadataFunc(b *Brain, used, missing *dep.Set) func(string) (*dep.VaultMetadata, error) {
+	return func(s string) (*dep.VaultMetadata, error) {
+		if len(s) == 0 {
+			return nil, nil
 		}
 
-		d, err := dep.NewHealthConnectQuery(strings.Join(s, "|"))
+		d, err := dep.NewVaultMetadataWatchQuery(s)
 		if err != nil {
 			return nil, err
 		}
@@ -654,12 +873,392 @@ func connectFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.Healt
 		used.Add(d)
 
 		if value, ok := b.Recall(d); ok {
-			return value.([]*dep.HealthService), nil
+			return value.(*dep.VaultMetadata), nil
 		}
 
 		missing.Add(d)
 
-		return result, nil
+		return nil, nil
+	}
+}
+
+// vaultKeyStatusFunc returns or accumulates the Vault barrier key status
+// dependency.
+func vaultKeyStatusFunc(b *Brain, used, missing *dep.Set) func() (*dep.VaultKeyStatus, error) {
+	return func() (*dep.VaultKeyStatus, error) {
+		d, err := dep.NewVaultKeyStatusQuery()
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.VaultKeyStatus), nil
+		}
+
+		missing.Add(d)
+
+		return nil, nil
+	}
+}
+
+// vaultAuditDevicesFunc returns or accumulates the Vault audit devices
+// dependency.
+func vaultAuditDevicesFunc(b *Brain, used, missing *dep.Set) func() ([]*dep.VaultAuditDevice, error) {
+	return func() ([]*dep.VaultAuditDevice, error) {
+		result := []*dep.VaultAuditDevice{}
+
+		d, err := dep.NewVaultAuditDevicesQuery()
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.([]*dep.VaultAuditDevice), nil
+		}
+
+		missing.Add(d)
+
+		return result, nil
+	}
+}
+
+// vaultEntityAliasFunc returns or accumulates the Vault entity an alias of an
+// auth mount maps to.
+func vaultEntityAliasFunc(b *Brain, used, missing *dep.Set) func(string, string) (*dep.VaultEntity, error) {
+	return func(mountAccessor, name string) (*dep.VaultEntity, error) {
+		d, err := dep.NewVaultEntityAliasQuery(mountAccessor, name)
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.VaultEntity), nil
+		}
+
+		missing.Add(d)
+
+		return nil, nil
+	}
+}
+
+// vaultHostInfoFunc returns or accumulates the Vault host information
+// dependency.
+func vaultHostInfoFunc(b *Brain, used, missing *dep.Set) func() (*dep.VaultHostInfo, error) {
+	return func() (*dep.VaultHostInfo, error) {
+		d, err := dep.NewVaultHostInfoQuery()
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.VaultHostInfo), nil
+		}
+
+		missing.Add(d)
+
+		return nil, nil
+	}
+}
+
+// vaultLeaderFunc returns or accumulates the Vault active node dependency.
+func vaultLeaderFunc(b *Brain, used, missing *dep.Set) func() (*dep.VaultLeader, error) {
+	return func() (*dep.VaultLeader, error) {
+		d, err := dep.NewVaultLeaderQuery()
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.VaultLeader), nil
+		}
+
+		missing.Add(d)
+
+		return nil, nil
+	}
+}
+
+// vaultStaticRoleFunc returns or accumulates the rotation state of a Vault
+// database static role.
+func vaultStaticRoleFunc(b *Brain, used, missing *dep.Set) func(string) (*dep.VaultStaticRole, error) {
+	return func(s string) (*dep.VaultStaticRole, error) {
+		d, err := dep.NewVaultStaticRoleQuery(s)
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(*dep.VaultStaticRole), nil
+		}
+
+		missing.Add(d)
+
+		return nil, nil
+	}
+}
+
+// vaultTransitFunc returns or accumulates transit encrypt or decrypt
+// dependencies from Vault.
+func vaultTransitFunc(b *Brain, used, missing *dep.Set, op string) func(string, string) (string, error) {
+	return func(key, input string) (string, error) {
+		d, err := dep.NewVaultTransitQuery(op, key, input)
+		if err != nil {
+			return "", err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.(string), nil
+		}
+
+		missing.Add(d)
+
+		return "", nil
+	}
+}
+
+// byMeta returns Services grouped by one or many ServiceMeta fields.
+func byMeta(meta string, services []*dep.HealthService) (groups map[string][]*dep.HealthService, err error) {
+	re := regexp.MustCompile("[^a-zA-Z0-9_-]")
+	normalize := func(x string) string {
+		return re.ReplaceAllString(x, "_")
+	}
+	getOrDefault := func(m map[string]string, key string) string {
+		realKey := strings.TrimSuffix(key, "|int")
+		if val := m[realKey]; val != "" {
+			return val
+		}
+		if strings.HasSuffix(key, "|int") {
+			return "0"
+		}
+		return fmt.Sprintf("_no_%s_", realKey)
+	}
+
+	metas := strings.Split(meta, ",")
+
+	groups = make(map[string][]*dep.HealthService)
+
+	for _, s := range services {
+		sm := s.ServiceMeta
+		keyParts := []string{}
+		for _, meta := range metas {
+			value := getOrDefault(sm, meta)
+			if strings.HasSuffix(meta, "|int") {
+				value = getOrDefault(sm, meta)
+				i, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("cannot parse %v as number ", value))
+				}
+				value = fmt.Sprintf("%05d", i)
+			}
+			keyParts = append(keyParts, normalize(value))
+		}
+		key := strings.Join(keyParts, "_")
+		groups[key] = append(groups[key], s)
+	}
+
+	return groups, nil
+}
+
+// preparedQueryFunc returns or accumulates the services of a Consul prepared
+// query.
+func preparedQueryFunc(b *Brain, used, missing *dep.Set) func(string) ([]*dep.HealthService, error) {
+	return func(s string) ([]*dep.HealthService, error) {
+		result := []*dep.HealthService{}
+
+		if len(s) == 0 {
+			return result, nil
+		}
+
+		d, err := dep.NewHealthPreparedQuery(s)
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.([]*dep.HealthService), nil
+		}
+
+		missing.Add(d)
+
+		return result, nil
+	}
+}
+
+// serviceFunc returns or accumulates health service dependencies.
+func serviceFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.HealthService, error) {
+	return func(s ...string) ([]*dep.HealthService, error) {
+		result := []*dep.HealthService{}
+
+		if len(s) == 0 || s[0] == "" {
+			return result, nil
+		}
+
+		d, err := dep.NewHealthServiceQuery(strings.Join(s, "|"))
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.([]*dep.HealthService), nil
+		}
+
+		missing.Add(d)
+
+		return result, nil
+	}
+}
+
+// servicesFunc returns or accumulates catalog services dependencies.
+func servicesFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.CatalogSnippet, error) {
+	return func(s ...string) ([]*dep.CatalogSnippet, error) {
+		result := []*dep.CatalogSnippet{}
+
+		d, err := dep.NewCatalogServicesQuery(strings.Join(s, ""))
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.([]*dep.CatalogSnippet), nil
+		}
+
+		missing.Add(d)
+
+		return result, nil
+	}
+}
+
+// serviceExistsFunc returns or accumulates catalog services dependencies to
+// determine whether the named service exists. The name may be followed by the
+// query and datacenter supported by services, e.g. "web?ns=foo@dc1".
+func serviceExistsFunc(b *Brain, used, missing *dep.Set) func(string) (bool, error) {
+	return func(s string) (bool, error) {
+		name, query := s, ""
+		if i := strings.IndexAny(s, "?@"); i >= 0 {
+			name, query = s[:i], s[i:]
+		}
+		if name == "" {
+			return false, nil
+		}
+
+		d, err := dep.NewCatalogServicesQuery(query)
+		if err != nil {
+			return false, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			for _, svc := range value.([]*dep.CatalogSnippet) {
+				if svc.Name == name {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+
+		missing.Add(d)
+
+		return false, nil
+	}
+}
+
+// servicesByDCFunc returns or accumulates the catalog services
+// dependencies of the given datacenters, or of all datacenters if none are
+// given, and groups the service names by datacenter. Each datacenter is
+// watched separately, so a change in any of them triggers a render.
+func servicesByDCFunc(b *Brain, used, missing *dep.Set) func(...string) (map[string][]string, error) {
+	return func(dcs ...string) (map[string][]string, error) {
+		result := map[string][]string{}
+
+		if len(dcs) == 0 {
+			d, err := dep.NewCatalogDatacentersQuery(false)
+			if err != nil {
+				return nil, err
+			}
+
+			used.Add(d)
+
+			value, ok := b.Recall(d)
+			if !ok {
+				missing.Add(d)
+				return result, nil
+			}
+			dcs = value.([]string)
+		}
+
+		for _, dc := range dcs {
+			if dc == "" {
+				return nil, errors.New("servicesByDC: empty datacenter name")
+			}
+
+			d, err := dep.NewCatalogServicesQuery("@" + dc)
+			if err != nil {
+				return nil, err
+			}
+
+			used.Add(d)
+
+			value, ok := b.Recall(d)
+			if !ok {
+				missing.Add(d)
+				continue
+			}
+
+			names := []string{}
+			for _, s := range value.([]*dep.CatalogSnippet) {
+				names = append(names, s.Name)
+			}
+			result[dc] = names
+		}
+
+		return result, nil
+	}
+}
+
+// connectFunc returns or accumulates health connect dependencies.
+func connectFunc(b *Brain, used, missing *dep.Set) func(...string) ([]*dep.HealthService, error) {
+	return func(s ...string) ([]*dep.HealthService, error) {
+		result := []*dep.HealthService{}
+
+		if len(s) == 0 || s[0] == "" {
+			return result, nil
+		}
+
+		d, err := dep.NewHealthConnectQuery(strings.Join(s, "|"))
+		if err != nil {
+			return nil, err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			return value.([]*dep.HealthService), nil
+		}
+
+		missing.Add(d)
+
+		return result, nil
 	}
 }
 
@@ -745,9 +1344,9 @@ func treeFunc(b *Brain, used, missing *dep.Set, emptyIsSafe bool) func(string) (
 }
 
 // base64Decode decodes the given string as a base64 string, returning an error
-// if it fails.
+// if it fails. Both padded and unpadded strings are accepted.
 func base64Decode(s string) (string, error) {
-	v, err := base64.StdEncoding.DecodeString(s)
+	v, err := decodeBase64(base64.StdEncoding, s)
 	if err != nil {
 		return "", errors.Wrap(err, "base64Decode")
 	}
@@ -759,15 +1358,26 @@ func base64Encode(s string) (string, error) {
 	return base64.StdEncoding.EncodeToString([]byte(s)), nil
 }
 
-// base64URLDecode decodes the given string as a URL-safe base64 string.
+// base64URLDecode decodes the given string as a URL-safe base64 string. Both
+// padded and unpadded strings are accepted, since the padding is often dropped
+// from URLs and JWTs.
 func base64URLDecode(s string) (string, error) {
-	v, err := base64.URLEncoding.DecodeString(s)
+	v, err := decodeBase64(base64.URLEncoding, s)
 	if err != nil {
 		return "", errors.Wrap(err, "base64URLDecode")
 	}
 	return string(v), nil
 }
 
+// decodeBase64 decodes the string with the padded encoding if it is padded,
+// and without padding otherwise.
+func decodeBase64(enc *base64.Encoding, s string) ([]byte, error) {
+	if !strings.HasSuffix(s, string(base64.StdPadding)) {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	return enc.DecodeString(s)
+}
+
 // base64URLEncode encodes the given string to be URL-safe.
 func base64URLEncode(s string) (string, error) {
 	return base64.URLEncoding.EncodeToString([]byte(s)), nil
@@ -796,21 +1406,156 @@ func byKey(pairs []*dep.KeyPair) (map[string]map[string]*dep.KeyPair, error) {
 		top := parts[0]
 		key := strings.Join(parts[1:], "/")
 
-		if key == "" {
-			// Do not add a key if it has no prefix after stripping.
-			continue
+		if key == "" {
+			// Do not add a key if it has no prefix after stripping.
+			continue
+		}
+
+		if _, ok := m[top]; !ok {
+			m[top] = make(map[string]*dep.KeyPair)
+		}
+
+		newPair := *pair
+		newPair.Key = key
+		m[top][key] = &newPair
+	}
+
+	return m, nil
+}
+
+// sortStrings returns a sorted copy of the given list of strings.
+func sortStrings(v interface{}) ([]string, error) {
+	if v == nil {
+		return []string{}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("sort: expected a list, got %T", v)
+	}
+
+	result := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if item.Kind() == reflect.Interface {
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.String {
+			return nil, fmt.Errorf("sort: element %d is not a string: %s", i, item.Type())
+		}
+		result = append(result, item.String())
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// sortBy returns a copy of the given list of structs or maps, stably sorted by
+// the named field. The field may be nested, such as "ServiceMeta.version".
+// Numbers are compared numerically and strings lexically, numbers sort before
+// strings, and missing values sort last.
+func sortBy(field string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return []interface{}{}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("sortBy: expected a list, got %T", v)
+	}
+
+	keys := make([]reflect.Value, rv.Len())
+	for i := range keys {
+		key, err := fieldValue(rv.Index(i), strings.Split(field, "."))
+		if err != nil {
+			return nil, fmt.Errorf("sortBy: element %d: %w", i, err)
+		}
+		keys[i] = key
+	}
+
+	order := make([]int, rv.Len())
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return lessValue(keys[order[i]], keys[order[j]])
+	})
+
+	result := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), 0, rv.Len())
+	for _, i := range order {
+		result = reflect.Append(result, rv.Index(i))
+	}
+	return result.Interface(), nil
+}
+
+// fieldValue returns the value of the nested field of a struct or map, or the
+// zero value if a map does not have it.
+func fieldValue(v reflect.Value, path []string) (reflect.Value, error) {
+	for _, name := range path {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, nil
+			}
+			v = v.Elem()
 		}
 
-		if _, ok := m[top]; !ok {
-			m[top] = make(map[string]*dep.KeyPair)
+		switch v.Kind() {
+		case reflect.Struct:
+			f := v.FieldByName(name)
+			if !f.IsValid() {
+				return reflect.Value{}, fmt.Errorf("no field %q in %s", name, v.Type())
+			}
+			v = f
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, fmt.Errorf("map keys of %s are not strings", v.Type())
+			}
+			v = v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return reflect.Value{}, nil
+			}
+		default:
+			return reflect.Value{}, fmt.Errorf("cannot get field %q of %s", name, v.Type())
 		}
+	}
 
-		newPair := *pair
-		newPair.Key = key
-		m[top][key] = &newPair
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, nil
+		}
+		v = v.Elem()
 	}
+	return v, nil
+}
 
-	return m, nil
+// lessValue orders the values of the field sorted by sortBy.
+func lessValue(a, b reflect.Value) bool {
+	// Missing values sort last.
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() && !b.IsValid()
+	}
+
+	af, aNum := numberValue(a)
+	bf, bNum := numberValue(b)
+	switch {
+	case aNum && bNum:
+		return af < bf
+	case aNum != bNum:
+		return aNum
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+// numberValue returns the value as a float, and whether it is a number.
+func numberValue(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
 }
 
 // byPort is a template func that takes the provided services and
@@ -930,6 +1675,67 @@ func mergeMapWithOverride(dstMap map[string]interface{}, srcMap map[string]inter
 	return mergeMap(dstMap, srcMap, mergo.WithOverride)
 }
 
+// mergeAppend is used to deep merge two maps like mergeMapWithOverride, except
+// that slices in srcMap are appended to the slices in dstMap instead of
+// replacing them.
+func mergeAppend(dstMap map[string]interface{}, srcMap map[string]interface{}) (map[string]interface{}, error) {
+	return mergeMap(dstMap, srcMap, mergo.WithOverride, mergo.WithAppendSlice)
+}
+
+// dict builds a map from alternating keys and values.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: expected an even number of arguments, got %d", len(pairs))
+	}
+
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		k, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %d must be a string, got %T", i/2, pairs[i])
+		}
+		m[k] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// list builds a list from the given values.
+func list(items ...interface{}) []interface{} {
+	result := make([]interface{}, 0, len(items))
+	return append(result, items...)
+}
+
+// merge deep merges the given maps into a new map. Where the maps have a value
+// under the same key, the later map wins, unless both values are maps, which
+// are merged in turn. The given maps are not modified.
+func merge(maps ...map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, m := range maps {
+		mergeInto(result, m)
+	}
+	return result
+}
+
+// mergeInto deep merges src into dst, which must only hold maps owned by the
+// merge. The maps of src are copied rather than shared, so later merges into
+// them do not modify src.
+func mergeInto(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sm, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		dm, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dm = make(map[string]interface{}, len(sm))
+			dst[k] = dm
+		}
+		mergeInto(dm, sm)
+	}
+}
+
 // explode is used to expand a list of keypairs into a deeply-nested hash.
 func explode(pairs []*dep.KeyPair) (map[string]interface{}, error) {
 	m := make(map[string]interface{})
@@ -1057,6 +1863,236 @@ func indent(spaces int, s string) (string, error) {
 	return string(output[:size]), nil
 }
 
+// nindent prefixes each line of a string with the specified number of spaces,
+// like indent, and prepends a newline. It is used to start an indented block on
+// its own line after a key, such as a PEM certificate under a YAML key.
+func nindent(spaces int, s string) (string, error) {
+	result, err := indent(spaces, s)
+	if err != nil {
+		return "", errors.Wrap(err, "nindent")
+	}
+	return "\n" + result, nil
+}
+
+// bulletList formats each element of the given slice as an item of a markdown
+// bullet list, one per line.
+func bulletList(v interface{}) (string, error) {
+	return markdownList("bulletList", v, func(int) string { return "- " })
+}
+
+// numberedList formats each element of the given slice as an item of a
+// markdown numbered list, one per line, starting at 1.
+func numberedList(v interface{}) (string, error) {
+	return markdownList("numberedList", v, func(i int) string {
+		return strconv.Itoa(i+1) + ". "
+	})
+}
+
+// markdownList formats each element of the given slice on its own line,
+// prefixed by the marker for its position. Continuation lines of multi-line
+// elements are indented to stay within the list item. An empty or nil slice
+// results in an empty string.
+func markdownList(name string, v interface{}, marker func(int) string) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("%s: expected a slice, got %T", name, v)
+	}
+
+	lines := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		m := marker(i)
+		item := fmt.Sprint(rv.Index(i).Interface())
+		item = strings.ReplaceAll(item, "\n", "\n"+strings.Repeat(" ", len(m)))
+		lines = append(lines, m+item)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// compact returns a copy of the given slice without its nil and empty string
+// elements, preserving the order of the others.
+func compact(v interface{}) (interface{}, error) {
+	if v == nil {
+		return []interface{}{}, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("compact: expected a slice, got %T", v)
+	}
+
+	result := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if isEmptyElem(item) {
+			continue
+		}
+		result = reflect.Append(result, item)
+	}
+	return result.Interface(), nil
+}
+
+// isEmptyElem reports whether the slice element is nil or an empty string.
+func isEmptyElem(v reflect.Value) bool {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.String && v.Len() == 0
+}
+
+// trimEach returns a copy of the given slice with the leading and trailing
+// white space removed from each element. Elements which are not strings are
+// formatted first.
+func trimEach(v interface{}) ([]string, error) {
+	if v == nil {
+		return []string{}, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("trimEach: expected a slice, got %T", v)
+	}
+
+	result := make([]string, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		result = append(result, strings.TrimSpace(fmt.Sprint(rv.Index(i).Interface())))
+	}
+	return result, nil
+}
+
+// uniq returns a copy of the given slice without its duplicate elements,
+// keeping the first occurrence of each.
+func uniq(v interface{}) (interface{}, error) {
+	if v == nil {
+		return []interface{}{}, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("uniq: expected a slice, got %T", v)
+	}
+
+	seen := make(map[interface{}]struct{}, rv.Len())
+	result := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		key := item.Interface()
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("uniq: element %d cannot be compared: %T", i, key)
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = reflect.Append(result, item)
+	}
+	return result.Interface(), nil
+}
+
+// keys returns the keys of the given map, sorted so the output is stable.
+// Keys which are not strings are formatted first.
+func keys(m interface{}) ([]string, error) {
+	rv, err := sortedMapKeys("keys", m)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(rv))
+	for _, k := range rv {
+		result = append(result, fmt.Sprint(k.Interface()))
+	}
+	return result, nil
+}
+
+// values returns the values of the given map, in the order of its sorted keys.
+func values(m interface{}) ([]interface{}, error) {
+	rv, err := sortedMapKeys("values", m)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, 0, len(rv))
+	mv := reflect.ValueOf(m)
+	for _, k := range rv {
+		result = append(result, mv.MapIndex(k).Interface())
+	}
+	return result, nil
+}
+
+// sortedMapKeys returns the keys of the map sorted by their formatted value.
+func sortedMapKeys(name string, m interface{}) ([]reflect.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("%s: expected a map, got %T", name, m)
+	}
+
+	keys := rv.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		return lessValue(keys[i], keys[j])
+	})
+	return keys, nil
+}
+
+var (
+	// templateEscaper and templateUnescaper escape template delimiters as
+	// actions which print them.
+	templateEscaper   = strings.NewReplacer("{{", `{{"{{"}}`, "}}", `{{"}}"}}`)
+	templateUnescaper = strings.NewReplacer(`{{"{{"}}`, "{{", `{{"}}"}}`, "}}")
+
+	// htmlDelimEscaper and htmlDelimUnescaper escape template delimiters as
+	// HTML character references.
+	htmlDelimEscaper   = strings.NewReplacer("{{", "&#123;&#123;", "}}", "&#125;&#125;")
+	htmlDelimUnescaper = strings.NewReplacer("&#123;&#123;", "{{", "&#125;&#125;", "}}")
+)
+
+// delimReplacer returns the replacer for the escaping mode given before the
+// string in args, and the string itself. The mode is either "template", the
+// default, or "html".
+func delimReplacer(name string, args []string, tmpl, html *strings.Replacer) (*strings.Replacer, string, error) {
+	switch len(args) {
+	case 1:
+		return tmpl, args[0], nil
+	case 2:
+		switch args[0] {
+		case "template":
+			return tmpl, args[1], nil
+		case "html":
+			return html, args[1], nil
+		default:
+			return nil, "", fmt.Errorf("%s: unknown mode %q", name, args[0])
+		}
+	default:
+		return nil, "", fmt.Errorf("%s: wrong number of arguments, expected 1 or 2"+
+			", but got %d", name, len(args))
+	}
+}
+
+// escapeTemplate escapes the template delimiters in the given string, so it
+// can be read by another Go template without being evaluated. By default each
+// delimiter is replaced by an action printing it, e.g. {{"{{"}}, and with the
+// "html" mode by HTML character references.
+func escapeTemplate(args ...string) (string, error) {
+	r, s, err := delimReplacer("escapeTemplate", args, templateEscaper, htmlDelimEscaper)
+	if err != nil {
+		return "", err
+	}
+	return r.Replace(s), nil
+}
+
+// unescapeTemplate reverses escapeTemplate with the same mode.
+func unescapeTemplate(args ...string) (string, error) {
+	r, s, err := delimReplacer("unescapeTemplate", args, templateUnescaper, htmlDelimUnescaper)
+	if err != nil {
+		return "", err
+	}
+	return r.Replace(s), nil
+}
+
 // loop accepts varying parameters and differs its behavior. If given one
 // parameter, loop will return a goroutine that begins at 0 and loops until the
 // given int, increasing the index by 1 each iteration. If given two parameters,
@@ -1223,15 +2259,98 @@ func parseYAML(s string) (interface{}, error) {
 	return data, nil
 }
 
+// parseTOML returns a structure for valid TOML. The top level of a TOML
+// document is always a table, so the result is a map.
+func parseTOML(s string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	if s == "" {
+		return data, nil
+	}
+
+	if _, err := toml.Decode(s, &data); err != nil {
+		return nil, errors.Wrap(err, "parseTOML")
+	}
+	return data, nil
+}
+
+// csvToMaps parses CSV whose first row is a header into a map per record, keyed
+// by the header. Every record must have as many fields as the header.
+func csvToMaps(s string) ([]map[string]string, error) {
+	result := []map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return result, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(s)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "csvToMaps")
+	}
+
+	header := records[0]
+	seen := make(map[string]struct{}, len(header))
+	for _, h := range header {
+		if _, ok := seen[h]; ok {
+			return nil, fmt.Errorf("csvToMaps: duplicate header %q", h)
+		}
+		seen[h] = struct{}{}
+	}
+
+	for _, record := range records[1:] {
+		m := make(map[string]string, len(header))
+		for i, h := range header {
+			m[h] = record[i]
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// pluginOutput buffers the output of a plugin, and signals when the plugin
+// writes more than limit bytes, where 0 means there is no limit. The buffer is
+// not embedded, so that io.Copy cannot bypass Write through its ReadFrom.
+type pluginOutput struct {
+	buf      bytes.Buffer
+	limit    int
+	exceeded chan struct{}
+}
+
+func newPluginOutput(limit int) *pluginOutput {
+	return &pluginOutput{limit: limit, exceeded: make(chan struct{})}
+}
+
+// Write implements io.Writer. Output past the limit is discarded and fails the
+// write, which stops the copy from the plugin.
+func (o *pluginOutput) Write(p []byte) (int, error) {
+	if o.limit > 0 && o.buf.Len()+len(p) > o.limit {
+		select {
+		case <-o.exceeded:
+		default:
+			o.buf.Write(p[:o.limit-o.buf.Len()])
+			close(o.exceeded)
+		}
+		return 0, fmt.Errorf("output exceeded %d bytes", o.limit)
+	}
+	return o.buf.Write(p)
+}
+
+// pluginFunc returns the plugin function, which kills the plugin when it does
+// not finish within the timeout or writes more than maxOutput bytes to either
+// stdout or stderr. A maxOutput of 0 means there is no limit.
+func pluginFunc(timeout time.Duration, maxOutput int) func(string, ...string) (string, error) {
+	return func(name string, args ...string) (string, error) {
+		return plugin(timeout, maxOutput, name, args...)
+	}
+}
+
 // plugin executes a subprocess as the given command string. It is assumed the
 // resulting command returns JSON which is then parsed and returned as the
 // value for use in the template.
-func plugin(name string, args ...string) (string, error) {
+func plugin(timeout time.Duration, maxOutput int, name string, args ...string) (string, error) {
 	if name == "" {
 		return "", nil
 	}
 
-	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	stdout, stderr := newPluginOutput(maxOutput), newPluginOutput(maxOutput)
 
 	// Strip and trim each arg or else some plugins get confused with the newline
 	// characters
@@ -1247,57 +2366,246 @@ func plugin(name string, args ...string) (string, error) {
 	cmd.Stderr = stderr
 	if err := cmd.Start(); err != nil {
 		return "", fmt.Errorf("exec %q: %s\n\nstdout:\n\n%s\n\nstderr:\n\n%s",
-			name, err, stdout.Bytes(), stderr.Bytes())
+			name, err, stdout.buf.Bytes(), stderr.buf.Bytes())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	// exceeded returns the error for an output which exceeded the limit, if any
+	exceeded := func() error {
+		select {
+		case <-stdout.exceeded:
+			return fmt.Errorf("exec %q: stdout exceeded %d bytes", name, maxOutput)
+		case <-stderr.exceeded:
+			return fmt.Errorf("exec %q: stderr exceeded %d bytes", name, maxOutput)
+		default:
+			return nil
+		}
+	}
+
+	kill := func() error {
+		if cmd.Process != nil {
+			// The plugin may have exited already, for example when its output
+			// was cut off by the limit.
+			if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				return fmt.Errorf("exec %q: failed to kill", name)
+			}
+		}
+		<-done // Allow the goroutine to exit
+		return nil
+	}
+
+	select {
+	case <-time.After(timeout):
+		if err := kill(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("exec %q: did not finish in %s", name, timeout)
+	case <-stdout.exceeded:
+		if err := kill(); err != nil {
+			return "", err
+		}
+		return "", exceeded()
+	case <-stderr.exceeded:
+		if err := kill(); err != nil {
+			return "", err
+		}
+		return "", exceeded()
+	case err := <-done:
+		if exceededErr := exceeded(); exceededErr != nil {
+			return "", exceededErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("exec %q: %s\n\nstdout:\n\n%s\n\nstderr:\n\n%s",
+				name, err, stdout.buf.Bytes(), stderr.buf.Bytes())
+		}
+	}
+
+	return strings.TrimSpace(stdout.buf.String()), nil
+}
+
+// replaceAll replaces all occurrences of a value in a string with the given
+// replacement value.
+func replaceAll(f, t, s string) (string, error) {
+	return strings.ReplaceAll(s, f, t), nil
+}
+
+// regexReplaceAll replaces all occurrences of a regular expression with
+// the given replacement value.
+func regexReplaceAll(re, pl, s string) (string, error) {
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return compiled.ReplaceAllString(s, pl), nil
+}
+
+// regexMatch returns true or false if the string matches
+// the given regular expression
+func regexMatch(re, s string) (bool, error) {
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return false, err
+	}
+	return compiled.MatchString(s), nil
+}
+
+// regexFindSubmatch returns the leftmost match of the regular expression in the
+// string followed by the text of each of its capture groups, or an empty list
+// if it does not match.
+func regexFindSubmatch(re, s string) ([]string, error) {
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+	if m := compiled.FindStringSubmatch(s); m != nil {
+		return m, nil
+	}
+	return []string{}, nil
+}
+
+// regexFindNamed returns the text of each named capture group of the leftmost
+// match of the regular expression in the string, or an empty map if it does
+// not match.
+func regexFindNamed(re, s string) (map[string]string, error) {
+	compiled, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	m := compiled.FindStringSubmatch(s)
+	if m == nil {
+		return result, nil
+	}
+	for i, name := range compiled.SubexpNames() {
+		if name != "" {
+			result[name] = m[i]
+		}
+	}
+	return result, nil
+}
+
+// globMatch returns whether the string matches the shell pattern, with the
+// syntax of path.Match.
+func globMatch(pattern, s string) (bool, error) {
+	matched, err := path.Match(pattern, s)
+	if err != nil {
+		return false, fmt.Errorf("glob: %q: %w", pattern, err)
+	}
+	return matched, nil
+}
+
+// globFilter returns the elements of the slice which match the shell pattern.
+// Strings are matched directly, while KV pairs and services are matched by
+// their Key or Name.
+func globFilter(pattern string, v interface{}) (interface{}, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("globFilter: %q: %w", pattern, err)
+	}
+	if v == nil {
+		return []interface{}{}, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("globFilter: expected a slice, got %T", v)
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	select {
-	case <-time.After(30 * time.Second):
-		if cmd.Process != nil {
-			if err := cmd.Process.Kill(); err != nil {
-				return "", fmt.Errorf("exec %q: failed to kill", name)
-			}
+	result := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		s, ok := globSubject(item)
+		if !ok {
+			return nil, fmt.Errorf("globFilter: cannot match %s", item.Type())
 		}
-		<-done // Allow the goroutine to exit
-		return "", fmt.Errorf("exec %q: did not finish in 30s", name)
-	case err := <-done:
-		if err != nil {
-			return "", fmt.Errorf("exec %q: %s\n\nstdout:\n\n%s\n\nstderr:\n\n%s",
-				name, err, stdout.Bytes(), stderr.Bytes())
+		if matched, _ := path.Match(pattern, s); matched {
+			result = reflect.Append(result, item)
 		}
 	}
-
-	return strings.TrimSpace(stdout.String()), nil
+	return result.Interface(), nil
 }
 
-// replaceAll replaces all occurrences of a value in a string with the given
-// replacement value.
-func replaceAll(f, t, s string) (string, error) {
-	return strings.ReplaceAll(s, f, t), nil
+// globSubject returns the string a slice element is matched by: the element
+// itself if it is a string, or else its Key or Name field.
+func globSubject(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Struct:
+		for _, name := range []string{"Key", "Name"} {
+			if f := v.FieldByName(name); f.IsValid() && f.Kind() == reflect.String {
+				return f.String(), true
+			}
+		}
+	}
+	return "", false
 }
 
-// regexReplaceAll replaces all occurrences of a regular expression with
-// the given replacement value.
-func regexReplaceAll(re, pl, s string) (string, error) {
-	compiled, err := regexp.Compile(re)
+// keysMatching returns the sorted keys of the map which match the shell
+// pattern, with the same syntax as glob.
+func keysMatching(pattern string, m interface{}) ([]string, error) {
+	rv, err := globMap("keysMatching", pattern, m)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return compiled.ReplaceAllString(s, pl), nil
+
+	keys := []string{}
+	if !rv.IsValid() {
+		return keys, nil
+	}
+	for _, k := range rv.MapKeys() {
+		if matched, _ := path.Match(pattern, k.String()); matched {
+			keys = append(keys, k.String())
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
 }
 
-// regexMatch returns true or false if the string matches
-// the given regular expression
-func regexMatch(re, s string) (bool, error) {
-	compiled, err := regexp.Compile(re)
+// pickMatching returns a map of the same type with only the entries of the map
+// whose keys match the shell pattern, with the same syntax as glob.
+func pickMatching(pattern string, m interface{}) (interface{}, error) {
+	rv, err := globMap("pickMatching", pattern, m)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return compiled.MatchString(s), nil
+	if !rv.IsValid() {
+		return map[string]interface{}{}, nil
+	}
+
+	result := reflect.MakeMap(rv.Type())
+	iter := rv.MapRange()
+	for iter.Next() {
+		if matched, _ := path.Match(pattern, iter.Key().String()); matched {
+			result.SetMapIndex(iter.Key(), iter.Value())
+		}
+	}
+	return result.Interface(), nil
+}
+
+// globMap validates the pattern and the map with string keys given to the
+// named function. A nil map is returned as the zero value.
+func globMap(name, pattern string, m interface{}) (reflect.Value, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return reflect.Value{}, fmt.Errorf("%s: %q: %w", name, pattern, err)
+	}
+	if m == nil {
+		return reflect.Value{}, nil
+	}
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return reflect.Value{}, fmt.Errorf("%s: expected a map with string keys, got %T", name, m)
+	}
+	return rv, nil
 }
 
 // split is a version of strings.Split that can be piped
@@ -1309,6 +2617,33 @@ func split(sep, s string) ([]string, error) {
 	return strings.Split(s, sep), nil
 }
 
+// splitN is a version of strings.SplitN that can be piped
+func splitN(sep string, n int, s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return []string{}, nil
+	}
+	return strings.SplitN(s, sep, n), nil
+}
+
+// cutResult is the result of cut. Templates cannot receive multiple return
+// values, so the values returned by strings.Cut are held in its fields.
+type cutResult struct {
+	Before string
+	After  string
+	Found  bool
+}
+
+// cut is a version of strings.Cut that can be piped
+func cut(sep, s string) (*cutResult, error) {
+	before, after, found := strings.Cut(s, sep)
+	return &cutResult{
+		Before: before,
+		After:  after,
+		Found:  found,
+	}, nil
+}
+
 // splitToMap is a version of strings.Split which splits a second time for each
 // item in the slice generated from the first split, building a map
 func splitToMap(sep1, sep2, s string) (map[string]string, error) {
@@ -1346,6 +2681,26 @@ func timestamp(s ...string) (string, error) {
 	}
 }
 
+// nowTime returns the current time in UTC, for use with the methods of
+// time.Time and the date helpers.
+func nowTime() time.Time {
+	return now()
+}
+
+// numCPU returns the number of CPUs usable by the process.
+func numCPU() int {
+	return runtime.NumCPU()
+}
+
+// hostname returns the host name reported by the kernel.
+func hostname() (string, error) {
+	name, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "hostname")
+	}
+	return name, nil
+}
+
 // toLower converts the given string (usually by a pipe) to lowercase.
 func toLower(s string) (string, error) {
 	return strings.ToLower(s), nil
@@ -1427,10 +2782,38 @@ func toTOML(m interface{}) (string, error) {
 	return string(bytes.TrimSpace(result)), nil
 }
 
+// mathValue returns the value of an argument of a math function. Strings are
+// parsed as an integer, or else as a float, the same way as parseInt and
+// parseFloat, so the values of keys can be used directly.
+func mathValue(v interface{}) reflect.Value {
+	if s, ok := v.(string); ok {
+		s = strings.TrimSpace(s)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return reflect.ValueOf(i)
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return reflect.ValueOf(f)
+		}
+	}
+	return reflect.ValueOf(v)
+}
+
+// isZeroNumber returns whether the value is a number equal to zero.
+func isZeroNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+	return false
+}
+
 // add returns the sum of a and b.
 func add(b, a interface{}) (interface{}, error) {
-	av := reflect.ValueOf(a)
-	bv := reflect.ValueOf(b)
+	av, bv := mathValue(a), mathValue(b)
 
 	switch av.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -1473,8 +2856,7 @@ func add(b, a interface{}) (interface{}, error) {
 
 // subtract returns the difference of b from a.
 func subtract(b, a interface{}) (interface{}, error) {
-	av := reflect.ValueOf(a)
-	bv := reflect.ValueOf(b)
+	av, bv := mathValue(a), mathValue(b)
 
 	switch av.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -1517,8 +2899,7 @@ func subtract(b, a interface{}) (interface{}, error) {
 
 // multiply returns the product of a and b.
 func multiply(b, a interface{}) (interface{}, error) {
-	av := reflect.ValueOf(a)
-	bv := reflect.ValueOf(b)
+	av, bv := mathValue(a), mathValue(b)
 
 	switch av.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -1561,8 +2942,10 @@ func multiply(b, a interface{}) (interface{}, error) {
 
 // divide returns the division of b from a.
 func divide(b, a interface{}) (interface{}, error) {
-	av := reflect.ValueOf(a)
-	bv := reflect.ValueOf(b)
+	av, bv := mathValue(a), mathValue(b)
+	if isZeroNumber(bv) {
+		return nil, fmt.Errorf("divide: division by zero")
+	}
 
 	switch av.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -1603,10 +2986,13 @@ func divide(b, a interface{}) (interface{}, error) {
 	}
 }
 
-// modulo returns the modulo of b from a.
+// modulo returns the modulo of b from a. The result is a float if either value
+// is a float.
 func modulo(b, a interface{}) (interface{}, error) {
-	av := reflect.ValueOf(a)
-	bv := reflect.ValueOf(b)
+	av, bv := mathValue(a), mathValue(b)
+	if isZeroNumber(bv) {
+		return nil, fmt.Errorf("modulo: division by zero")
+	}
 
 	switch av.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -1615,6 +3001,8 @@ func modulo(b, a interface{}) (interface{}, error) {
 			return av.Int() % bv.Int(), nil
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 			return av.Int() % int64(bv.Uint()), nil
+		case reflect.Float32, reflect.Float64:
+			return math.Mod(float64(av.Int()), bv.Float()), nil
 		default:
 			return nil, fmt.Errorf("modulo: unknown type for %q (%T)", bv, b)
 		}
@@ -1624,6 +3012,19 @@ func modulo(b, a interface{}) (interface{}, error) {
 			return int64(av.Uint()) % bv.Int(), nil
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 			return av.Uint() % bv.Uint(), nil
+		case reflect.Float32, reflect.Float64:
+			return math.Mod(float64(av.Uint()), bv.Float()), nil
+		default:
+			return nil, fmt.Errorf("modulo: unknown type for %q (%T)", bv, b)
+		}
+	case reflect.Float32, reflect.Float64:
+		switch bv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return math.Mod(av.Float(), float64(bv.Int())), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return math.Mod(av.Float(), float64(bv.Uint())), nil
+		case reflect.Float32, reflect.Float64:
+			return math.Mod(av.Float(), bv.Float()), nil
 		default:
 			return nil, fmt.Errorf("modulo: unknown type for %q (%T)", bv, b)
 		}
@@ -1634,8 +3035,7 @@ func modulo(b, a interface{}) (interface{}, error) {
 
 // minimum returns the minimum between a and b.
 func minimum(b, a interface{}) (interface{}, error) {
-	av := reflect.ValueOf(a)
-	bv := reflect.ValueOf(b)
+	av, bv := mathValue(a), mathValue(b)
 
 	switch av.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -1705,8 +3105,7 @@ func minimum(b, a interface{}) (interface{}, error) {
 
 // maximum returns the maximum between a and b.
 func maximum(b, a interface{}) (interface{}, error) {
-	av := reflect.ValueOf(a)
-	bv := reflect.ValueOf(b)
+	av, bv := mathValue(a), mathValue(b)
 
 	switch av.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -1808,6 +3207,98 @@ func sockaddr(args ...string) (string, error) {
 	return k, nil
 }
 
+// hostInterface is a network interface of the host and its addresses.
+type hostInterface struct {
+	Name  string
+	Flags net.Flags
+	Addrs []net.IP
+}
+
+// hostInterfaces returns the network interfaces of the host. This is here so
+// it can be stubbed in tests.
+var hostInterfaces = func() ([]hostInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]hostInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		hi := hostInterface{Name: iface.Name, Flags: iface.Flags}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				hi.Addrs = append(hi.Addrs, ipnet.IP)
+			}
+		}
+		result = append(result, hi)
+	}
+	return result, nil
+}
+
+// privateIP returns the first RFC1918 IPv4 address of the interfaces of the
+// host which are up, skipping loopback interfaces.
+func privateIP() (string, error) {
+	ifaces, err := hostInterfaces()
+	if err != nil {
+		return "", fmt.Errorf("privateIP: %w", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		for _, ip := range iface.Addrs {
+			if ip.To4() != nil && ip.IsPrivate() {
+				return ip.String(), nil
+			}
+		}
+	}
+	return "", errors.New("privateIP: no private IPv4 address found")
+}
+
+// interfaceIP returns the addresses of the named interface of the host. The
+// addresses may optionally be restricted to the "ipv4" or "ipv6" family.
+func interfaceIP(name string, family ...string) ([]string, error) {
+	if len(family) > 1 {
+		return nil, errors.New("interfaceIP: wrong number of arguments, expected 1 or 2")
+	}
+
+	var keep func(net.IP) bool
+	switch f := strings.Join(family, ""); f {
+	case "":
+		keep = func(net.IP) bool { return true }
+	case "ipv4":
+		keep = func(ip net.IP) bool { return ip.To4() != nil }
+	case "ipv6":
+		keep = func(ip net.IP) bool { return ip.To4() == nil }
+	default:
+		return nil, fmt.Errorf("interfaceIP: unknown address family %q, expected ipv4 or ipv6", f)
+	}
+
+	ifaces, err := hostInterfaces()
+	if err != nil {
+		return nil, fmt.Errorf("interfaceIP: %w", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Name != name {
+			continue
+		}
+		result := []string{}
+		for _, ip := range iface.Addrs {
+			if keep(ip) {
+				result = append(result, ip.String())
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("interfaceIP: no interface named %q", name)
+}
+
 // sha256Hex return the sha256 hex of a string
 func sha256Hex(item string) (string, error) {
 	h := sha256.New()
@@ -1816,9 +3307,147 @@ func sha256Hex(item string) (string, error) {
 	return output, nil
 }
 
-// md5sum returns the md5 hash of a string
-func md5sum(item string) (string, error) {
-	return fmt.Sprintf("%x", md5.Sum([]byte(item))), nil
+// md5sum returns the hex-encoded md5 hash of the given value.
+func md5sum(item interface{}) (string, error) {
+	b, err := digestInput("md5sum", item)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", md5.Sum(b)), nil
+}
+
+// sha1sum returns the hex-encoded sha1 hash of the given value.
+func sha1sum(item interface{}) (string, error) {
+	b, err := digestInput("sha1sum", item)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha1.Sum(b)), nil
+}
+
+// sha256sum returns the hex-encoded sha256 hash of the given value.
+func sha256sum(item interface{}) (string, error) {
+	b, err := digestInput("sha256sum", item)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// digestInput converts the value given to a digest function to the bytes to
+// hash. Strings, byte slices, stringers and scalars are converted, but nil is
+// an error rather than the digest of an empty string, since it usually means
+// the data was not loaded.
+func digestInput(name string, item interface{}) ([]byte, error) {
+	switch v := item.(type) {
+	case nil:
+		return nil, fmt.Errorf("%s: cannot hash nil", name)
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	}
+
+	rv := reflect.ValueOf(item)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%s: cannot hash nil", name)
+		}
+	}
+
+	if s, ok := item.(fmt.Stringer); ok {
+		return []byte(s.String()), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return []byte(fmt.Sprint(item)), nil
+	}
+	return nil, fmt.Errorf("%s: cannot convert %T to a string", name, item)
+}
+
+// bcryptCache remembers the bcrypt hashes generated for a template. Hashing
+// is salted, so without it every render would produce a different output and
+// the template would be written (and its command run) over and over. Only the
+// hashes used by the last complete render are kept, so the cache does not grow
+// as the passwords change. The zero value is ready to use.
+type bcryptCache struct {
+	sync.Mutex
+
+	// hashes are the hashes used by the last complete render, and used are
+	// the hashes used since.
+	hashes map[string]string
+	used   map[string]string
+}
+
+// hash returns the bcrypt hash of the password at the given cost, reusing a
+// previously generated one when there is one. Entries are keyed by a digest
+// so the cache does not hold the passwords themselves.
+func (c *bcryptCache) hash(password string, cost int) (string, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return "", fmt.Errorf("cost %d is out of range [%d, %d]",
+			cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	sum := sha256.Sum256([]byte(strconv.Itoa(cost) + "\x00" + password))
+	key := hex.EncodeToString(sum[:])
+
+	c.Lock()
+	defer c.Unlock()
+	h, ok := c.used[key]
+	if !ok {
+		h, ok = c.hashes[key]
+	}
+	if !ok {
+		b, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+		if err != nil {
+			return "", err
+		}
+		h = string(b)
+	}
+	if c.used == nil {
+		c.used = make(map[string]string)
+	}
+	c.used[key] = h
+	return h, nil
+}
+
+// sweep forgets the hashes which were not used since the last sweep. It is
+// called after each complete render.
+func (c *bcryptCache) sweep() {
+	c.Lock()
+	defer c.Unlock()
+	c.hashes, c.used = c.used, nil
+}
+
+// bcryptFunc returns the bcrypt hash of a password with the given cost.
+func bcryptFunc(c *bcryptCache) func(string, int) (string, error) {
+	return func(password string, cost int) (string, error) {
+		h, err := c.hash(password, cost)
+		if err != nil {
+			return "", errors.Wrap(err, "bcrypt")
+		}
+		return h, nil
+	}
+}
+
+// htpasswdFunc returns an htpasswd line for the user with the bcrypt hash of
+// the password, at the default cost.
+func htpasswdFunc(c *bcryptCache) func(string, string) (string, error) {
+	return func(user, password string) (string, error) {
+		if user == "" || strings.Contains(user, ":") {
+			return "", fmt.Errorf("htpasswd: invalid user %q", user)
+		}
+		h, err := c.hash(password, bcrypt.DefaultCost)
+		if err != nil {
+			return "", errors.Wrap(err, "htpasswd")
+		}
+		return user + ":" + h, nil
+	}
 }
 
 // hmacSHA256Hex returns the HMAC-SHA256 hash in hexadecimal format of the
@@ -1829,8 +3458,11 @@ func hmacSHA256Hex(message, key string) (string, error) {
 	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// writeToFile writes the content to a file with permissions, username (or UID), group name (or GID),
-// and optional flags to select appending mode or add a newline.
+// writeToFileFunc returns a function which writes the content to a file with
+// permissions, username (or UID), group name (or GID), and optional flags to
+// select appending mode or add a newline. Unless appending, the file is replaced
+// atomically, so readers never see partially written content. The path must be
+// within the sandbox, if one is set.
 //
 // The username and group name fields can be left blank to default to the current user and group.
 //
@@ -1841,7 +3473,22 @@ func hmacSHA256Hex(message, key string) (string, error) {
 //	key "my/key/path" | writeToFile "/my/file/path.txt" "my-user" "my-group" "0644"
 //	key "my/key/path" | writeToFile "/my/file/path.txt" "my-user" "my-group" "0644" "append"
 //	key "my/key/path" | writeToFile "/my/file/path.txt" "my-user" "my-group" "0644" "append,newline"
+func writeToFileFunc(sandboxPath string) func(string, string, string, string, ...string) (string, error) {
+	return func(path, username, groupName, permissions string, args ...string) (string, error) {
+		if err := writePathInSandbox(sandboxPath, path); err != nil {
+			return "", fmt.Errorf("writeToFile: %w", err)
+		}
+		return writeToFile(path, username, groupName, permissions, args...)
+	}
+}
+
+// writeToFile implements writeToFileFunc without the sandbox.
 func writeToFile(path, username, groupName, permissions string, args ...string) (string, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return "", fmt.Errorf("writeToFile: wrong number of arguments, expected 5 or 6"+
+			", but got %d", len(args)+4)
+	}
+
 	// Parse arguments
 	flags := ""
 	if len(args) == 2 {
@@ -1855,46 +3502,33 @@ func writeToFile(path, username, groupName, permissions string, args ...string)
 	}
 	perm := os.FileMode(p_u)
 
+	writingContent := []byte(content)
+	shouldAddNewLine := strings.Contains(flags, "newline")
+	if shouldAddNewLine {
+		writingContent = append(writingContent, []byte("\n")...)
+	}
+
 	// Write to file
-	var f *os.File
 	shouldAppend := strings.Contains(flags, "append")
 	if shouldAppend {
-		f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, perm)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, perm)
 		if err != nil {
 			return "", err
 		}
-	} else {
-		dirPath := filepath.Dir(path)
+		defer f.Close()
 
-		if _, err := os.Stat(dirPath); err != nil {
-			err := os.MkdirAll(dirPath, os.ModePerm)
-			if err != nil {
-				return "", err
-			}
+		if _, err = f.Write(writingContent); err != nil {
+			return "", err
 		}
-
-		f, err = os.Create(path)
-		if err != nil {
+	} else {
+		if err := renderer.AtomicWrite(path, true, writingContent, perm, false); err != nil {
 			return "", err
 		}
 	}
-	defer f.Close()
-
-	writingContent := []byte(content)
-	shouldAddNewLine := strings.Contains(flags, "newline")
-	if shouldAddNewLine {
-		writingContent = append(writingContent, []byte("\n")...)
-	}
-	if _, err = f.Write(writingContent); err != nil {
-		return "", err
-	}
 
 	// Change ownership and permissions
 	var uid int
 	var gid int
-	if err != nil {
-		return "", err
-	}
 
 	if username == "" {
 		uid = os.Getuid()
@@ -1943,6 +3577,49 @@ func writeToFile(path, username, groupName, permissions string, args ...string)
 	return "", nil
 }
 
+// writePathInSandbox returns an error if the path a file is written to doesn't
+// fall within the sandbox. Unlike pathInSandbox, the file and its parent
+// directories do not need to exist yet, so the symlinks of the deepest existing
+// directory are evaluated instead.
+func writePathInSandbox(sandbox, path string) error {
+	if sandbox == "" {
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// Walk up to the deepest existing path, so a symlink pointing outside of
+	// the sandbox cannot be used to escape it.
+	existing, rest := abs, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+
+	s, err := filepath.Rel(sandbox, filepath.Join(resolved, rest))
+	if err != nil {
+		return err
+	}
+	if s == ".." || strings.HasPrefix(s, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("'%s' is outside of sandbox", path)
+	}
+	return nil
+}
+
 func spewSdump(args ...interface{}) (string, error) {
 	return spewLib.Sdump(args...), nil
 }
@@ -2006,3 +3683,133 @@ func traverseJSONKey(data map[string]interface{}, keyPath []string) bool {
 
 	return true
 }
+
+// pureFuncs are the functions which always return the same result for the
+// same arguments and have no side effects, so their results are memoized for
+// the duration of a render pass. Only add functions which do not depend on the
+// time, the environment or any other outside state.
+var pureFuncs = []string{
+	"base64Decode",
+	"base64Encode",
+	"base64URLDecode",
+	"base64URLEncode",
+	"csvToMaps",
+	"hmacSHA256Hex",
+	"md5sum",
+	"parseJSON",
+	"parseTOML",
+	"parseYAML",
+	"sha1sum",
+	"sha256Hex",
+	"sha256sum",
+	"toJSON",
+	"toJSONPretty",
+	"toTOML",
+	"toUnescapedJSON",
+	"toUnescapedJSONPretty",
+	"toYAML",
+}
+
+// errorType is the type of the error returned by a function.
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// funcCache memoizes the results of pure functions for a single render pass,
+// so a template referencing the same parsed blob in many places parses it
+// once. The zero value is ready to use.
+type funcCache struct {
+	sync.Mutex
+	results map[string][]reflect.Value
+}
+
+// memoize wraps the given function so that calls with the same arguments
+// return the results of the first call. Calls which return an error are not
+// memoized. Arguments are keyed by their Go syntax representation, so values
+// behind nested pointers are keyed by address. Each call returns its own copy
+// of the maps and slices of the results, so a template which modifies them,
+// for example with sprig_set, does not change the results of later calls.
+func (c *funcCache) memoize(name string, fn interface{}) interface{} {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return fn
+	}
+	typ := v.Type()
+
+	return reflect.MakeFunc(typ, func(args []reflect.Value) []reflect.Value {
+		h := sha256.New()
+		io.WriteString(h, name)
+		for _, arg := range args {
+			fmt.Fprintf(h, "\x00%#v", arg.Interface())
+		}
+		key := hex.EncodeToString(h.Sum(nil))
+
+		c.Lock()
+		out, ok := c.results[key]
+		c.Unlock()
+		if ok {
+			return copyResults(out)
+		}
+
+		if typ.IsVariadic() {
+			out = v.CallSlice(args)
+		} else {
+			out = v.Call(args)
+		}
+
+		if n := len(out); n > 0 && typ.Out(n-1) == errorType && !out[n-1].IsNil() {
+			return out
+		}
+
+		c.Lock()
+		if c.results == nil {
+			c.results = make(map[string][]reflect.Value)
+		}
+		c.results[key] = out
+		c.Unlock()
+		return copyResults(out)
+	}).Interface()
+}
+
+// copyResults returns a deep copy of the given function results.
+func copyResults(out []reflect.Value) []reflect.Value {
+	r := make([]reflect.Value, len(out))
+	for i, v := range out {
+		r[i] = deepCopyValue(v)
+	}
+	return r
+}
+
+// deepCopyValue returns a copy of the given value, recursively copying the
+// maps and slices within it. Other values, like strings, are immutable or
+// returned as is.
+func deepCopyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		r := reflect.New(v.Type()).Elem()
+		r.Set(deepCopyValue(v.Elem()))
+		return r
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		r := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			r.SetMapIndex(iter.Key(), deepCopyValue(iter.Value()))
+		}
+		return r
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		r := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			r.Index(i).Set(deepCopyValue(v.Index(i)))
+		}
+		return r
+	default:
+		return v
+	}
+}
@@ -5,13 +5,19 @@ package template
 
 import (
 	"fmt"
+	"net"
+	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 
 	dep "github.com/hashicorp/consul-template/dependency"
 )
@@ -297,6 +303,93 @@ func Test_byPort(t *testing.T) {
 	}
 }
 
+func Test_sortStrings(t *testing.T) {
+	in := []string{"web", "api", "db"}
+	act, err := sortStrings(in)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "db", "web"}, act)
+	assert.Equal(t, []string{"web", "api", "db"}, in)
+
+	act, err = sortStrings(dep.ServiceTags{"b", "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, act)
+
+	act, err = sortStrings([]interface{}{"b", "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, act)
+
+	_, err = sortStrings([]interface{}{"b", 1})
+	assert.EqualError(t, err, "sort: element 1 is not a string: int")
+
+	_, err = sortStrings("a")
+	assert.Error(t, err)
+}
+
+func Test_sortBy(t *testing.T) {
+	services := []*dep.HealthService{
+		{ID: "a", Node: "node2", Port: 10},
+		{ID: "b", Node: "node1", Port: 9},
+		{ID: "c", Node: "node2", Port: 100},
+		{ID: "d", Node: "node1", Port: 10},
+	}
+
+	ids := func(v interface{}) []string {
+		var ids []string
+		for _, s := range v.([]*dep.HealthService) {
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+
+	t.Run("string", func(t *testing.T) {
+		act, err := sortBy("Node", services)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "d", "a", "c"}, ids(act))
+	})
+
+	t.Run("numeric", func(t *testing.T) {
+		act, err := sortBy("Port", services)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a", "d", "c"}, ids(act))
+		assert.Equal(t, []string{"a", "b", "c", "d"}, ids(services))
+	})
+
+	t.Run("maps", func(t *testing.T) {
+		act, err := sortBy("weight", []interface{}{
+			map[string]interface{}{"name": "a", "weight": 10.0},
+			map[string]interface{}{"name": "b"},
+			map[string]interface{}{"name": "c", "weight": "high"},
+			map[string]interface{}{"name": "d", "weight": 2},
+		})
+		require.NoError(t, err)
+		var names []string
+		for _, m := range act.([]interface{}) {
+			names = append(names, m.(map[string]interface{})["name"].(string))
+		}
+		assert.Equal(t, []string{"d", "a", "c", "b"}, names)
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		act, err := sortBy("ServiceMeta.version", []*dep.HealthService{
+			{ID: "a", ServiceMeta: map[string]string{"version": "2"}},
+			{ID: "b", ServiceMeta: map[string]string{"version": "1"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a"}, ids(act))
+	})
+
+	t.Run("unknown_field", func(t *testing.T) {
+		_, err := sortBy("Nope", services)
+		assert.EqualError(t, err,
+			`sortBy: element 0: no field "Nope" in dependency.HealthService`)
+	})
+
+	t.Run("not_a_list", func(t *testing.T) {
+		_, err := sortBy("Node", "web")
+		assert.Error(t, err)
+	})
+}
+
 func Test_sha256Hex(t *testing.T) {
 	type args struct {
 		item string
@@ -363,6 +456,304 @@ func Test_md5sum(t *testing.T) {
 	}
 }
 
+func Test_envWithDefaultFunc(t *testing.T) {
+	t.Setenv("CT_TEST_ENV_SET", "os")
+	t.Setenv("CT_TEST_ENV_EMPTY", "")
+
+	f := envWithDefaultFunc([]string{"CUSTOM_SET=custom", "CUSTOM_EMPTY=", "CT_TEST_ENV_SET=override"})
+
+	cases := []struct {
+		name string
+		key  string
+		exp  string
+	}{
+		{"set", "CT_TEST_ENV_SET", "override"},
+		{"custom_set", "CUSTOM_SET", "custom"},
+		{"custom_empty", "CUSTOM_EMPTY", "default"},
+		{"os_empty", "CT_TEST_ENV_EMPTY", "default"},
+		{"unset", "CT_TEST_ENV_UNSET", "default"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := f(tc.key, "default")
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+
+	t.Run("os_set", func(t *testing.T) {
+		act, err := envWithDefaultFunc(nil)("CT_TEST_ENV_SET", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "os", act)
+	})
+}
+
+func Test_requiredFunc(t *testing.T) {
+	var missing dep.Set
+	required := requiredFunc(&missing)
+
+	cases := []struct {
+		name string
+		v    interface{}
+		err  bool
+	}{
+		{"string", "value", false},
+		{"zero", 0, false},
+		{"false", false, false},
+		{"list", []string{"a"}, false},
+		{"map", map[string]interface{}{"a": 1}, false},
+		{"pointer", &dep.KeyPair{}, false},
+		{"nil", nil, true},
+		{"empty_string", "", true},
+		{"empty_list", []string{}, true},
+		{"nil_list", []*dep.KeyPair(nil), true},
+		{"empty_map", map[string]interface{}{}, true},
+		{"nil_pointer", (*dep.KeyPair)(nil), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := required("value must be set", tc.v)
+			if tc.err {
+				assert.EqualError(t, err, "value must be set")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.v, act)
+		})
+	}
+
+	t.Run("missing_dependencies", func(t *testing.T) {
+		d, err := dep.NewKVGetQuery("key")
+		require.NoError(t, err)
+		missing.Add(d)
+
+		act, err := required("value must be set", "")
+		require.NoError(t, err)
+		assert.Equal(t, "", act)
+	})
+}
+
+func Test_coalesce(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []interface{}
+		exp  interface{}
+	}{
+		{"none", nil, nil},
+		{"all_empty", []interface{}{nil, "", []string{}, map[string]string{}, (*int)(nil)}, nil},
+		{"first_non_empty", []interface{}{"", "a", "b"}, "a"},
+		{"first", []interface{}{"a", "b"}, "a"},
+		{"mixed_number", []interface{}{"", 8080, "80"}, 8080},
+		{"zero_number", []interface{}{"", 0, 8080}, 0},
+		{"mixed_list", []interface{}{nil, []string{"a"}, "b"}, []string{"a"}},
+		{"false", []interface{}{false, "a"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, coalesce(tc.in...))
+		})
+	}
+}
+
+func Test_ternary(t *testing.T) {
+	assert.Equal(t, "yes", ternary("yes", "no", true))
+	assert.Equal(t, "no", ternary("yes", "no", false))
+	assert.Equal(t, 1, ternary(1, "no", true))
+}
+
+func Test_math(t *testing.T) {
+	cases := []struct {
+		name string
+		f    func(b, a interface{}) (interface{}, error)
+		a, b interface{}
+		exp  interface{}
+		err  string
+	}{
+		{"add_int", add, 2, 3, int64(5), ""},
+		{"add_float", add, 2.5, 3.25, 5.75, ""},
+		{"add_mixed", add, 2, 0.5, 2.5, ""},
+		{"add_uint", add, uint(2), uint(3), uint64(5), ""},
+		{"subtract_int", subtract, 5, 7, int64(-2), ""},
+		{"subtract_mixed", subtract, 5.5, 2, 3.5, ""},
+		{"multiply_int", multiply, 4, 3, int64(12), ""},
+		{"multiply_mixed", multiply, 4, 0.5, 2.0, ""},
+		{"divide_int", divide, 7, 2, int64(3), ""},
+		{"divide_mixed", divide, 7, 2.0, 3.5, ""},
+		{"divide_zero", divide, 7, 0, nil, "divide: division by zero"},
+		{"divide_zero_float", divide, 7.0, 0.0, nil, "divide: division by zero"},
+		{"modulo_int", modulo, 7, 3, int64(1), ""},
+		{"modulo_float", modulo, 7.5, 2, 1.5, ""},
+		{"modulo_zero", modulo, 7, 0, nil, "modulo: division by zero"},
+		{"string_int", add, "2", 3, int64(5), ""},
+		{"string_float", multiply, " 1.5 ", "2", 3.0, ""},
+		{"string_invalid", add, "two", 3, nil, "add: unknown type"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := tc.f(tc.b, tc.a)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func Test_dict(t *testing.T) {
+	act, err := dict("a", 1, "b", "two", "c", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": "two", "c": nil}, act)
+
+	act, err = dict()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, act)
+
+	_, err = dict("a", 1, "b")
+	assert.EqualError(t, err, "dict: expected an even number of arguments, got 3")
+
+	_, err = dict(1, "a")
+	assert.EqualError(t, err, "dict: key 0 must be a string, got int")
+}
+
+func Test_list(t *testing.T) {
+	assert.Equal(t, []interface{}{"a", 1, nil}, list("a", 1, nil))
+	assert.Equal(t, []interface{}{}, list())
+}
+
+func Test_merge(t *testing.T) {
+	base := map[string]interface{}{
+		"name": "web",
+		"port": 80,
+		"tls": map[string]interface{}{
+			"enabled": false,
+			"ciphers": []interface{}{"a"},
+		},
+	}
+	overrides := map[string]interface{}{
+		"port": 8080,
+		"tls": map[string]interface{}{
+			"enabled": true,
+			"ciphers": []interface{}{"b"},
+		},
+		"extra": map[string]interface{}{"x": 1},
+	}
+	last := map[string]interface{}{
+		"extra": map[string]interface{}{"y": 2},
+		"name":  "api",
+	}
+
+	act := merge(base, overrides, last)
+	assert.Equal(t, map[string]interface{}{
+		"name": "api",
+		"port": 8080,
+		"tls": map[string]interface{}{
+			"enabled": true,
+			"ciphers": []interface{}{"b"},
+		},
+		"extra": map[string]interface{}{"x": 1, "y": 2},
+	}, act)
+
+	// The inputs are not modified.
+	assert.Equal(t, map[string]interface{}{
+		"name": "web",
+		"port": 80,
+		"tls": map[string]interface{}{
+			"enabled": false,
+			"ciphers": []interface{}{"a"},
+		},
+	}, base)
+	assert.Equal(t, map[string]interface{}{"x": 1}, overrides["extra"])
+
+	// A map replaces a value which is not a map, and the other way around.
+	act = merge(map[string]interface{}{"a": "s", "b": map[string]interface{}{"c": 1}},
+		map[string]interface{}{"a": map[string]interface{}{"d": 2}, "b": "t"})
+	assert.Equal(t, map[string]interface{}{"a": map[string]interface{}{"d": 2}, "b": "t"}, act)
+
+	assert.Equal(t, map[string]interface{}{}, merge())
+}
+
+func Test_base64(t *testing.T) {
+	t.Run("round_trip", func(t *testing.T) {
+		for _, in := range []string{"", "a", "ab", "abc", "<<???>>", "{\"alg\":\"HS256\"}"} {
+			enc, err := base64Encode(in)
+			require.NoError(t, err)
+			act, err := base64Decode(enc)
+			require.NoError(t, err)
+			assert.Equal(t, in, act)
+
+			enc, err = base64URLEncode(in)
+			require.NoError(t, err)
+			assert.NotContains(t, enc, "+")
+			assert.NotContains(t, enc, "/")
+			act, err = base64URLDecode(enc)
+			require.NoError(t, err)
+			assert.Equal(t, in, act)
+
+			// The padding may be dropped.
+			act, err = base64URLDecode(strings.TrimRight(enc, "="))
+			require.NoError(t, err)
+			assert.Equal(t, in, act)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, in := range []string{"aGVsxxbG8=", "aGVsbG8===", "a", "aGVs bG8=", "PDw_Pz8-Pg=="} {
+			_, err := base64Decode(in)
+			assert.Error(t, err, in)
+		}
+		for _, in := range []string{"aGVsxxbG8=", "a", "PDw/Pz8+Pg"} {
+			_, err := base64URLDecode(in)
+			assert.Error(t, err, in)
+		}
+	})
+}
+
+func Test_digests(t *testing.T) {
+	funcs := map[string]func(interface{}) (string, error){
+		"md5sum":    md5sum,
+		"sha1sum":   sha1sum,
+		"sha256sum": sha256sum,
+	}
+
+	cases := []struct {
+		name string
+		f    string
+		item interface{}
+		exp  string
+		err  bool
+	}{
+		{"md5sum", "md5sum", "abc", "900150983cd24fb0d6963f7d28e17f72", false},
+		{"sha1sum", "sha1sum", "bladibla", "3808b1fa21190f2062ff086507add3f01d63c4e9", false},
+		{"sha256sum", "sha256sum", "bladibla", "54cf4c66bcabb5c20e25331c01dd600b73369e97a947861bd8d3a0e0b8b3d70b", false},
+		{"bytes", "sha256sum", []byte("bladibla"), "54cf4c66bcabb5c20e25331c01dd600b73369e97a947861bd8d3a0e0b8b3d70b", false},
+		{"int", "sha256sum", 42, "73475cb40a568e8da8a045ced110137e159f890ac4da883b6b17dc651b3a8049", false},
+		{"stringer", "sha256sum", time.Second, "64c83df872d808a1820aab72aa20bf2cf33b96fff4933e691e30f7646dfcc1be", false},
+		{"empty", "sha1sum", "", "da39a3ee5e6b4b0d3255bfef95601890afd80709", false},
+		{"nil", "sha256sum", nil, "", true},
+		{"nil_pointer", "sha1sum", (*dep.VaultEntity)(nil), "", true},
+		{"map", "md5sum", map[string]string{"a": "b"}, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := funcs[tc.f](tc.item)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
 func Test_hmacSHA256Hex(t *testing.T) {
 	type args struct {
 		message string
@@ -415,3 +806,826 @@ func Test_exportedServicesFunc(t *testing.T) {
 	assert.Equal(t, "list.exportedServices(default), list.exportedServices(ap1)", used.String())
 	assert.Equal(t, "list.exportedServices(default), list.exportedServices(ap1)", missing.String())
 }
+
+// Test_servicesByDCFunc tests that each datacenter tracks its own catalog
+// services dependency, so a change in any of them triggers a render
+func Test_servicesByDCFunc(t *testing.T) {
+	var used, missing dep.Set
+
+	b := NewBrain()
+	f := servicesByDCFunc(b, &used, &missing)
+
+	_, err := f()
+	require.NoError(t, err)
+	assert.Equal(t, "catalog.datacenters", used.String())
+	assert.Equal(t, "catalog.datacenters", missing.String())
+
+	d, err := dep.NewCatalogDatacentersQuery(false)
+	require.NoError(t, err)
+	b.Remember(d, []string{"dc1", "dc2"})
+
+	used, missing = dep.Set{}, dep.Set{}
+	act, err := f()
+	require.NoError(t, err)
+	assert.Empty(t, act)
+	assert.Equal(t, "catalog.datacenters, catalog.services(@dc1), catalog.services(@dc2)", used.String())
+	assert.Equal(t, "catalog.services(@dc1), catalog.services(@dc2)", missing.String())
+
+	_, err = f("dc1", "")
+	require.Error(t, err)
+}
+
+// Test_existsFuncs tests that the existence predicates follow the data of
+// their dependencies as the key or service is added and removed
+func Test_existsFuncs(t *testing.T) {
+	t.Run("kvExists", func(t *testing.T) {
+		var used, missing dep.Set
+		b := NewBrain()
+		f := kvExistsFunc(b, &used, &missing)
+
+		act, err := f("foo/bar")
+		require.NoError(t, err)
+		assert.False(t, act)
+		assert.Equal(t, "kv.exists(foo/bar)", missing.String())
+
+		d, err := dep.NewKVExistsQuery("foo/bar")
+		require.NoError(t, err)
+		for _, exists := range []bool{true, false, true} {
+			b.Remember(d, exists)
+			act, err := f("foo/bar")
+			require.NoError(t, err)
+			assert.Equal(t, exists, act)
+		}
+	})
+
+	t.Run("serviceExists", func(t *testing.T) {
+		var used, missing dep.Set
+		b := NewBrain()
+		f := serviceExistsFunc(b, &used, &missing)
+
+		act, err := f("web@dc1")
+		require.NoError(t, err)
+		assert.False(t, act)
+		assert.Equal(t, "catalog.services(@dc1)", missing.String())
+
+		d, err := dep.NewCatalogServicesQuery("@dc1")
+		require.NoError(t, err)
+		for _, tc := range []struct {
+			services []*dep.CatalogSnippet
+			exp      bool
+		}{
+			{[]*dep.CatalogSnippet{{Name: "consul"}, {Name: "web"}}, true},
+			{[]*dep.CatalogSnippet{{Name: "consul"}}, false},
+			{[]*dep.CatalogSnippet{{Name: "web"}}, true},
+		} {
+			b.Remember(d, tc.services)
+			act, err := f("web@dc1")
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		}
+	})
+}
+
+func Test_hostIPs(t *testing.T) {
+	orig := hostInterfaces
+	t.Cleanup(func() { hostInterfaces = orig })
+	hostInterfaces = func() ([]hostInterface, error) {
+		return []hostInterface{
+			{
+				Name:  "lo",
+				Flags: net.FlagUp | net.FlagLoopback,
+				Addrs: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+			},
+			{
+				Name:  "eth0",
+				Flags: net.FlagUp,
+				Addrs: []net.IP{net.ParseIP("203.0.113.10"), net.ParseIP("2001:db8::10")},
+			},
+			{
+				Name:  "eth1",
+				Flags: 0,
+				Addrs: []net.IP{net.ParseIP("10.0.0.5")},
+			},
+			{
+				Name:  "eth2",
+				Flags: net.FlagUp,
+				Addrs: []net.IP{net.ParseIP("fd00::20"), net.ParseIP("192.168.1.20")},
+			},
+		}, nil
+	}
+
+	t.Run("privateIP", func(t *testing.T) {
+		// eth1 is down, and the IPv6 private address of eth2 is skipped
+		ip, err := privateIP()
+		require.NoError(t, err)
+		assert.Equal(t, "192.168.1.20", ip)
+	})
+
+	cases := []struct {
+		name   string
+		iface  string
+		family []string
+		exp    []string
+		err    bool
+	}{
+		{"all", "eth0", nil, []string{"203.0.113.10", "2001:db8::10"}, false},
+		{"ipv4", "eth0", []string{"ipv4"}, []string{"203.0.113.10"}, false},
+		{"ipv6", "eth0", []string{"ipv6"}, []string{"2001:db8::10"}, false},
+		{"ipv6_none", "eth1", []string{"ipv6"}, []string{}, false},
+		{"missing", "eth9", nil, nil, true},
+		{"bad_family", "eth0", []string{"ipx"}, nil, true},
+	}
+	for _, tc := range cases {
+		t.Run("interfaceIP_"+tc.name, func(t *testing.T) {
+			act, err := interfaceIP(tc.iface, tc.family...)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+
+	t.Run("privateIP_none", func(t *testing.T) {
+		hostInterfaces = func() ([]hostInterface, error) {
+			return []hostInterface{{
+				Name:  "eth0",
+				Flags: net.FlagUp,
+				Addrs: []net.IP{net.ParseIP("203.0.113.10")},
+			}}, nil
+		}
+		_, err := privateIP()
+		require.Error(t, err)
+	})
+}
+
+func Test_compact(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		exp  interface{}
+	}{
+		{"nil", nil, []interface{}{}},
+		{"all_empty", []string{"", ""}, []string{}},
+		{"mixed", []string{"a", "", "b"}, []string{"a", "b"}},
+		{"whitespace_kept", []string{" ", "a"}, []string{" ", "a"}},
+		{"interfaces", []interface{}{nil, "a", "", 0, "b"}, []interface{}{"a", 0, "b"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := compact(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func Test_uniq(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		exp  interface{}
+	}{
+		{"strings", []string{"a", "b", "a", "c", "b"}, []string{"a", "b", "c"}},
+		{"first_occurrence", []string{"web2", "web1", "web2", "web3", "web1"}, []string{"web2", "web1", "web3"}},
+		{"ints", []int{3, 1, 3, 2, 1}, []int{3, 1, 2}},
+		{"interfaces", []interface{}{"a", 1, "a", 1, nil, nil}, []interface{}{"a", 1, nil}},
+		{"nil", nil, []interface{}{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := uniq(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+
+	t.Run("uncomparable", func(t *testing.T) {
+		_, err := uniq([]interface{}{[]string{"a"}})
+		assert.EqualError(t, err, "uniq: element 0 cannot be compared: []string")
+	})
+
+	t.Run("not_a_slice", func(t *testing.T) {
+		_, err := uniq("a")
+		assert.Error(t, err)
+	})
+}
+
+func Test_keysValues(t *testing.T) {
+	m := map[string]interface{}{
+		"web": map[string]interface{}{"port": 80},
+		"api": map[string]interface{}{"port": 8080},
+		"db":  "postgres",
+	}
+
+	k, err := keys(m)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "db", "web"}, k)
+
+	v, err := values(m)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"port": 8080},
+		"postgres",
+		map[string]interface{}{"port": 80},
+	}, v)
+
+	k, err = keys(map[int]string{10: "b", 9: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"9", "10"}, k)
+
+	k, err = keys(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, k)
+
+	_, err = values([]string{"a"})
+	assert.EqualError(t, err, "values: expected a map, got []string")
+}
+
+func Test_trimEach(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		exp  []string
+	}{
+		{"nil", nil, []string{}},
+		{"all_empty", []string{"", ""}, []string{"", ""}},
+		{"mixed", []string{" a", "b\n", "c"}, []string{"a", "b", "c"}},
+		{"whitespace_only", []string{" \t ", "a"}, []string{"", "a"}},
+		{"interfaces", []interface{}{" a ", 1}, []string{"a", "1"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := trimEach(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func Test_bcrypt(t *testing.T) {
+	c := &bcryptCache{}
+
+	t.Run("cost", func(t *testing.T) {
+		h, err := bcryptFunc(c)("s3cret", 5)
+		require.NoError(t, err)
+		require.NoError(t, bcrypt.CompareHashAndPassword([]byte(h), []byte("s3cret")))
+		cost, err := bcrypt.Cost([]byte(h))
+		require.NoError(t, err)
+		assert.Equal(t, 5, cost)
+
+		again, err := bcryptFunc(c)("s3cret", 5)
+		require.NoError(t, err)
+		assert.Equal(t, h, again)
+
+		other, err := bcryptFunc(c)("s3cret", 6)
+		require.NoError(t, err)
+		assert.NotEqual(t, h, other)
+	})
+
+	t.Run("sweep", func(t *testing.T) {
+		c := &bcryptCache{}
+		kept, err := bcryptFunc(c)("kept", 4)
+		require.NoError(t, err)
+		dropped, err := bcryptFunc(c)("dropped", 4)
+		require.NoError(t, err)
+		c.sweep()
+
+		// Only the hashes used since the last sweep are kept
+		again, err := bcryptFunc(c)("kept", 4)
+		require.NoError(t, err)
+		assert.Equal(t, kept, again)
+		c.sweep()
+
+		again, err = bcryptFunc(c)("dropped", 4)
+		require.NoError(t, err)
+		assert.NotEqual(t, dropped, again)
+		assert.Len(t, c.hashes, 1)
+	})
+
+	t.Run("htpasswd", func(t *testing.T) {
+		line, err := htpasswdFunc(c)("alice", "s3cret")
+		require.NoError(t, err)
+		user, h, ok := strings.Cut(line, ":")
+		require.True(t, ok)
+		assert.Equal(t, "alice", user)
+		require.NoError(t, bcrypt.CompareHashAndPassword([]byte(h), []byte("s3cret")))
+		cost, err := bcrypt.Cost([]byte(h))
+		require.NoError(t, err)
+		assert.Equal(t, bcrypt.DefaultCost, cost)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := bcryptFunc(c)("s3cret", bcrypt.MaxCost+1)
+		assert.Error(t, err)
+		_, err = htpasswdFunc(c)("al:ice", "s3cret")
+		assert.Error(t, err)
+		_, err = htpasswdFunc(c)("", "s3cret")
+		assert.Error(t, err)
+	})
+
+	t.Run("stable_across_renders", func(t *testing.T) {
+		tmpl, err := NewTemplate(&NewTemplateInput{
+			Contents: `{{ bcrypt "s3cret" 4 }} {{ "s3cret" | htpasswd "bob" }}`,
+		})
+		require.NoError(t, err)
+
+		first, err := tmpl.Execute(&ExecuteInput{Brain: NewBrain()})
+		require.NoError(t, err)
+		second, err := tmpl.Execute(&ExecuteInput{Brain: NewBrain()})
+		require.NoError(t, err)
+		assert.Equal(t, string(first.Output), string(second.Output))
+	})
+}
+
+func Test_regexFind(t *testing.T) {
+	t.Run("submatch", func(t *testing.T) {
+		act, err := regexFindSubmatch(`v(\d+)\.(\d+)\.(\d+)`, "consul v1.16.2+ent")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"v1.16.2", "1", "16", "2"}, act)
+	})
+
+	t.Run("submatch_no_match", func(t *testing.T) {
+		act, err := regexFindSubmatch(`v(\d+)`, "consul")
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, act)
+	})
+
+	t.Run("named", func(t *testing.T) {
+		act, err := regexFindNamed(`^(?P<role>[a-z]+)-(?P<index>\d+)(\.(?P<zone>[a-z]+))?`, "web-03.internal")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"role": "web", "index": "03", "zone": "internal"}, act)
+	})
+
+	t.Run("named_optional", func(t *testing.T) {
+		act, err := regexFindNamed(`^(?P<role>[a-z]+)-(?P<index>\d+)(\.(?P<zone>[a-z]+))?`, "web-03")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"role": "web", "index": "03", "zone": ""}, act)
+	})
+
+	t.Run("named_no_match", func(t *testing.T) {
+		act, err := regexFindNamed(`^(?P<role>[a-z]+)-(?P<index>\d+)`, "10.0.0.1")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{}, act)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := regexFindSubmatch(`(`, "a")
+		assert.Error(t, err)
+		_, err = regexFindNamed(`(`, "a")
+		assert.Error(t, err)
+	})
+}
+
+func Test_glob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		exp     bool
+	}{
+		{"*", "web", true},
+		{"web-*", "web-1", true},
+		{"web-*", "api-1", false},
+		{"*", "a/b", false},
+		{"app/*/db", "app/prod/db", true},
+		{"web-?", "web-1", true},
+		{"web-?", "web-10", false},
+		{"web-[0-9]", "web-7", true},
+		{"web-[0-9]", "web-x", false},
+		{"web-[^0-9]", "web-x", true},
+		{"web", "web-1", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.pattern+"_"+tc.s, func(t *testing.T) {
+			act, err := globMatch(tc.pattern, tc.s)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := globMatch("web-[", "web-1")
+		assert.Error(t, err)
+		_, err = globFilter("web-[", []string{"db"})
+		assert.Error(t, err)
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		act, err := globFilter("web-?", []string{"web-1", "web-10", "api-1", "web-2"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"web-1", "web-2"}, act)
+
+		act, err = globFilter("web-*", []interface{}{"web-1", "api-1"})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"web-1"}, act)
+
+		act, err = globFilter("nope", []string{"web-1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, act)
+
+		pairs := []*dep.KeyPair{{Key: "db-host"}, {Key: "web-host"}}
+		act, err = globFilter("db-*", pairs)
+		require.NoError(t, err)
+		assert.Equal(t, []*dep.KeyPair{pairs[0]}, act)
+
+		_, err = globFilter("*", []int{1})
+		assert.Error(t, err)
+		_, err = globFilter("*", "web-1")
+		assert.Error(t, err)
+	})
+}
+
+func Test_keysMatching(t *testing.T) {
+	data := map[string]interface{}{
+		"db_user":     "app",
+		"db_password": "s3cret",
+		"api_key":     "abc",
+		"db":          "postgres",
+	}
+
+	t.Run("keys", func(t *testing.T) {
+		act, err := keysMatching("db_*", data)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"db_password", "db_user"}, act)
+
+		act, err = keysMatching("*", data)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"api_key", "db", "db_password", "db_user"}, act)
+
+		act, err = keysMatching("db_?ser", map[string]string{"db_user": "app"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"db_user"}, act)
+	})
+
+	t.Run("pick", func(t *testing.T) {
+		act, err := pickMatching("db_*", data)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"db_user":     "app",
+			"db_password": "s3cret",
+		}, act)
+
+		act, err = pickMatching("api_*", map[string]string{"api_key": "abc", "db": "pg"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"api_key": "abc"}, act)
+	})
+
+	t.Run("no_match", func(t *testing.T) {
+		keys, err := keysMatching("cache_*", data)
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, keys)
+
+		picked, err := pickMatching("cache_*", data)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{}, picked)
+
+		keys, err = keysMatching("*", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, keys)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := keysMatching("db_[", data)
+		assert.Error(t, err)
+		_, err = pickMatching("db_[", data)
+		assert.Error(t, err)
+		_, err = keysMatching("*", []string{"db"})
+		assert.Error(t, err)
+		_, err = pickMatching("*", map[int]string{1: "db"})
+		assert.Error(t, err)
+	})
+}
+
+func Test_csvToMaps(t *testing.T) {
+	cases := []struct {
+		name string
+		s    string
+		exp  []map[string]string
+		err  bool
+	}{
+		{"empty", "", []map[string]string{}, false},
+		{"blank", "  \n", []map[string]string{}, false},
+		{"header_only", "name,port\n", []map[string]string{}, false},
+		{
+			"records",
+			"name,port\nweb,80\napi,8080\n",
+			[]map[string]string{
+				{"name": "web", "port": "80"},
+				{"name": "api", "port": "8080"},
+			},
+			false,
+		},
+		{
+			"quoted",
+			"name,desc\nweb,\"front, end\"\napi,\"say \"\"hi\"\"\nthere\"\n",
+			[]map[string]string{
+				{"name": "web", "desc": "front, end"},
+				{"name": "api", "desc": "say \"hi\"\nthere"},
+			},
+			false,
+		},
+		{"extra_column", "name,port\nweb,80,tcp\n", nil, true},
+		{"missing_column", "name,port\nweb\n", nil, true},
+		{"duplicate_header", "name,name\nweb,api\n", nil, true},
+		{"bare_quote", "name\nwe\"b\n", nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := csvToMaps(tc.s)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+		})
+	}
+}
+
+func Test_indent(t *testing.T) {
+	cases := []struct {
+		name    string
+		s       string
+		indent  string
+		nindent string
+	}{
+		{"empty", "", "", "\n"},
+		{"single_line", "hello", "  hello", "\n  hello"},
+		{"multi_line", "a\nb", "  a\n  b", "\n  a\n  b"},
+		{"trailing_newline", "a\nb\n", "  a\n  b\n", "\n  a\n  b\n"},
+		{"blank_lines", "a\n\nb", "  a\n\n  b", "\n  a\n\n  b"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := indent(2, tc.s)
+			require.NoError(t, err)
+			assert.Equal(t, tc.indent, act)
+
+			act, err = nindent(2, tc.s)
+			require.NoError(t, err)
+			assert.Equal(t, tc.nindent, act)
+		})
+	}
+
+	t.Run("negative", func(t *testing.T) {
+		_, err := nindent(-1, "a")
+		assert.Error(t, err)
+	})
+}
+
+func Test_numCPU(t *testing.T) {
+	assert.Positive(t, numCPU())
+}
+
+func Test_hostname(t *testing.T) {
+	act, err := hostname()
+	require.NoError(t, err)
+	assert.NotEmpty(t, act)
+
+	exp, err := os.Hostname()
+	require.NoError(t, err)
+	assert.Equal(t, exp, act)
+}
+
+func Test_parseTOML(t *testing.T) {
+	t.Run("round_trip", func(t *testing.T) {
+		in := map[string]interface{}{
+			"title": "proxy",
+			"server": map[string]interface{}{
+				"port": int64(8080),
+				"tls": map[string]interface{}{
+					"enabled": true,
+				},
+			},
+			"backends": []map[string]interface{}{
+				{"name": "a", "weight": int64(1)},
+				{"name": "b", "weight": int64(2)},
+			},
+		}
+
+		s, err := toTOML(in)
+		require.NoError(t, err)
+		assert.Contains(t, s, "[server.tls]")
+		assert.Contains(t, s, "[[backends]]")
+
+		act, err := parseTOML(s)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"title": "proxy",
+			"server": map[string]interface{}{
+				"port": int64(8080),
+				"tls": map[string]interface{}{
+					"enabled": true,
+				},
+			},
+			"backends": []map[string]interface{}{
+				{"name": "a", "weight": int64(1)},
+				{"name": "b", "weight": int64(2)},
+			},
+		}, act)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		act, err := parseTOML("")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{}, act)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := parseTOML("[server\nport = ")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "parseTOML")
+	})
+}
+
+func Test_escapeTemplate(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		exp  string
+	}{
+		{"none", []string{"no delimiters"}, "no delimiters"},
+		{"empty", []string{""}, ""},
+		{"single", []string{"{{ .Name }}"}, `{{"{{"}} .Name {{"}}"}}`},
+		{
+			"multiple",
+			[]string{"{{ .A }} and {{ .B }}"},
+			`{{"{{"}} .A {{"}}"}} and {{"{{"}} .B {{"}}"}}`,
+		},
+		{"template_mode", []string{"template", "{{x}}"}, `{{"{{"}}x{{"}}"}}`},
+		{"html", []string{"html", "{{ .A }}{{ .B }}"}, "&#123;&#123; .A &#125;&#125;&#123;&#123; .B &#125;&#125;"},
+		{"html_none", []string{"html", "a { b }"}, "a { b }"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			act, err := escapeTemplate(tc.args...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, act)
+
+			// Unescaping with the same mode restores the input
+			args := append([]string{}, tc.args...)
+			args[len(args)-1] = act
+			back, err := unescapeTemplate(args...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.args[len(tc.args)-1], back)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := escapeTemplate()
+		assert.Error(t, err)
+		_, err = escapeTemplate("xml", "{{")
+		assert.Error(t, err)
+		_, err = unescapeTemplate("a", "b", "c")
+		assert.Error(t, err)
+	})
+}
+
+func Test_mergeAppend(t *testing.T) {
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name": "web",
+			"server": map[string]interface{}{
+				"port":  8080,
+				"hosts": []interface{}{"a", "b"},
+			},
+			"tags": []interface{}{"v1"},
+		}
+	}
+	overrides := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name": "api",
+			"server": map[string]interface{}{
+				"hosts": []interface{}{"c"},
+			},
+			"tags": []interface{}{"v2"},
+		}
+	}
+
+	t.Run("mergeAppend", func(t *testing.T) {
+		act, err := mergeAppend(base(), overrides())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name": "api",
+			"server": map[string]interface{}{
+				"port":  8080,
+				"hosts": []interface{}{"a", "b", "c"},
+			},
+			"tags": []interface{}{"v1", "v2"},
+		}, act)
+	})
+
+	t.Run("mergeMapWithOverride", func(t *testing.T) {
+		act, err := mergeMapWithOverride(base(), overrides())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"name": "api",
+			"server": map[string]interface{}{
+				"port":  8080,
+				"hosts": []interface{}{"c"},
+			},
+			"tags": []interface{}{"v2"},
+		}, act)
+	})
+
+	t.Run("mergeMap", func(t *testing.T) {
+		act, err := mergeMap(base(), overrides())
+		require.NoError(t, err)
+		assert.Equal(t, base(), act)
+	})
+}
+
+func Test_pluginLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires the sleep and yes commands")
+	}
+
+	t.Run("within_limits", func(t *testing.T) {
+		act, err := pluginFunc(time.Second, 16)("echo", "hello")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", act)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := pluginFunc(100*time.Millisecond, 0)("sleep", "10")
+		assert.EqualError(t, err, `exec "sleep": did not finish in 100ms`)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("max_output", func(t *testing.T) {
+		_, err := pluginFunc(10*time.Second, 1024)("yes")
+		assert.EqualError(t, err, `exec "yes": stdout exceeded 1024 bytes`)
+	})
+}
+
+func Test_funcCache(t *testing.T) {
+	var calls int
+	count := func(s string) (string, error) {
+		calls++
+		if s == "" {
+			return "", fmt.Errorf("empty")
+		}
+		return strings.ToUpper(s), nil
+	}
+
+	execute := func(c *funcCache, contents string) (string, error) {
+		tmpl, err := template.New("").Funcs(template.FuncMap{
+			"count": c.memoize("count", count),
+		}).Parse(contents)
+		require.NoError(t, err)
+
+		var b strings.Builder
+		err = tmpl.Execute(&b, nil)
+		return b.String(), err
+	}
+
+	t.Run("same_arguments", func(t *testing.T) {
+		calls = 0
+		act, err := execute(&funcCache{},
+			`{{ count "a" }}{{ count "a" }}{{ "a" | count }}{{ count "b" }}{{ count "a" }}`)
+		require.NoError(t, err)
+		assert.Equal(t, "AAABA", act)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("errors_not_memoized", func(t *testing.T) {
+		calls = 0
+		c := &funcCache{}
+		_, err := execute(c, `{{ count "" }}`)
+		require.Error(t, err)
+		_, err = execute(c, `{{ count "" }}`)
+		require.Error(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("results_copied", func(t *testing.T) {
+		var calls int
+		parse := (&funcCache{}).memoize("parse", func(s string) (interface{}, error) {
+			calls++
+			return map[string]interface{}{"list": []interface{}{s}}, nil
+		}).(func(string) (interface{}, error))
+
+		first, err := parse("a")
+		require.NoError(t, err)
+		first.(map[string]interface{})["extra"] = true
+		first.(map[string]interface{})["list"].([]interface{})[0] = "changed"
+
+		second, err := parse("a")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"list": []interface{}{"a"}}, second)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("cleared_between_passes", func(t *testing.T) {
+		calls = 0
+		for i := 0; i < 3; i++ {
+			_, err := execute(&funcCache{}, `{{ count "a" }}{{ count "a" }}`)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 3, calls)
+	})
+}
@@ -133,6 +133,39 @@ func nomadVariableExistsFunc(b *Brain, used, missing *dep.Set, defaultNS string)
 	}
 }
 
+// nomadVariableItemOrDefaultFunc returns the value of the given item of a
+// variable, or the default if the variable or the item does not exist. Unlike
+// nomadVariableItemsFunc, it does not block rendering on a missing variable.
+func nomadVariableItemOrDefaultFunc(b *Brain, used, missing *dep.Set, defaultNS string) func(string, string, string) (string, error) {
+	return func(s, key, def string) (string, error) {
+		if len(s) == 0 {
+			return def, nil
+		}
+
+		d, err := dep.NewNVGetQuery(defaultNS, s)
+		if err != nil {
+			return "", err
+		}
+
+		used.Add(d)
+
+		if value, ok := b.Recall(d); ok {
+			items, ok := value.(*dep.NomadVarItems)
+			if !ok || items == nil {
+				return def, nil
+			}
+			if item, ok := (*items)[key]; ok {
+				return item.Value, nil
+			}
+			return def, nil
+		}
+
+		missing.Add(d)
+
+		return def, nil
+	}
+}
+
 func nomadSafeVariablesFunc(b *Brain, used, missing *dep.Set, defaultNS string) func(...string) ([]*dep.NomadVarMeta, error) {
 	// call nomadVariablesFunc but explicitly mark that empty data set
 	// returned on monitored variable prefix is NOT safe
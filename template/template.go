@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/pkg/errors"
@@ -33,6 +34,15 @@ var (
 	// ErrMissingReaderFunction is the error returned when the template
 	// configuration is missing a reader function.
 	ErrMissingReaderFunction = errors.New("template: missing a reader function")
+
+	// ErrTemplateBlankDelims is the error returned when a template specifies a
+	// delimiter made of whitespace only, which cannot be told apart from the
+	// text around it.
+	ErrTemplateBlankDelims = errors.New("template: delimiters must not be blank")
+
+	// ErrTemplateSameDelims is the error returned when the left and right
+	// delimiters of a template are the same, which cannot be parsed.
+	ErrTemplateSameDelims = errors.New("template: left and right delimiters must differ")
 )
 
 var (
@@ -87,11 +97,22 @@ type Template struct {
 	// when we render this template
 	functionDenylist []string
 
-	// sandboxPath adds a prefix to any path provided to the `file` function
-	// and causes an error if a relative path tries to traverse outside that
-	// prefix.
+	// sandboxPath restricts the paths read by the `file` and `readFileLines`
+	// functions and written by the `writeToFile` function. A path outside of
+	// it, including through symlinks, causes an error. Paths are not
+	// prefixed with it.
 	sandboxPath string
 
+	// pluginTimeout and pluginMaxOutput limit each invocation of the `plugin`
+	// function.
+	pluginTimeout   time.Duration
+	pluginMaxOutput int
+
+	// bcrypt holds the hashes generated by the bcrypt and htpasswd functions,
+	// so that re-rendering the template yields the same output. Hashes which
+	// are no longer used are dropped after each complete render.
+	bcrypt bcryptCache
+
 	// local reference to configuration for this template
 	config *config.TemplateConfig
 }
@@ -128,11 +149,21 @@ type NewTemplateInput struct {
 	// when we render this template
 	FunctionDenylist []string
 
-	// SandboxPath adds a prefix to any path provided to the `file` function
-	// and causes an error if a relative path tries to traverse outside that
-	// prefix.
+	// SandboxPath restricts the paths read by the `file` and `readFileLines`
+	// functions and written by the `writeToFile` function. A path outside of
+	// it, including through symlinks, causes an error. Paths are not
+	// prefixed with it.
 	SandboxPath string
 
+	// PluginTimeout is the amount of time to wait for each invocation of the
+	// `plugin` function before killing the plugin. It defaults to
+	// config.DefaultTemplatePluginTimeout.
+	PluginTimeout time.Duration
+
+	// PluginMaxOutput is the maximum number of bytes a plugin may write to
+	// stdout or stderr before it is killed. Zero means there is no limit.
+	PluginMaxOutput int
+
 	// Config keeps local reference to config struct
 	Config *config.TemplateConfig
 
@@ -156,6 +187,21 @@ func NewTemplate(i *NewTemplateInput) (*Template, error) {
 		return nil, ErrTemplateMissingContentsAndSource
 	}
 
+	// Validate the delimiters, where empty ones are the "{{" and "}}" defaults
+	leftDelim, rightDelim := i.LeftDelim, i.RightDelim
+	if leftDelim == "" {
+		leftDelim = "{{"
+	}
+	if rightDelim == "" {
+		rightDelim = "}}"
+	}
+	if strings.TrimSpace(leftDelim) == "" || strings.TrimSpace(rightDelim) == "" {
+		return nil, ErrTemplateBlankDelims
+	}
+	if leftDelim == rightDelim {
+		return nil, ErrTemplateSameDelims
+	}
+
 	var t Template
 	t.source = i.Source
 	t.contents = i.Contents
@@ -166,6 +212,8 @@ func NewTemplate(i *NewTemplateInput) (*Template, error) {
 	t.extFuncMap = i.ExtFuncMap
 	t.functionDenylist = i.FunctionDenylist
 	t.sandboxPath = i.SandboxPath
+	t.pluginTimeout = i.PluginTimeout
+	t.pluginMaxOutput = i.PluginMaxOutput
 	t.destination = i.Destination
 	t.config = i.Config
 
@@ -185,8 +233,13 @@ func NewTemplate(i *NewTemplateInput) (*Template, error) {
 		t.contents = string(contents)
 	}
 
-	// Compute the MD5, encode as hex
-	hash := md5.Sum([]byte(t.contents))
+	// Compute the MD5, encode as hex. Custom delimiters are part of the hash,
+	// as the same contents are a different template with them.
+	hashed := t.contents
+	if t.leftDelim != "" || t.rightDelim != "" {
+		hashed += "\x00" + t.leftDelim + "\x00" + t.rightDelim
+	}
+	hash := md5.Sum([]byte(hashed))
 	t.hexMD5 = hex.EncodeToString(hash[:])
 
 	return &t, nil
@@ -268,7 +321,11 @@ func (t *Template) Execute(i *ExecuteInput) (*ExecuteResult, error) {
 		extFuncMap:       t.extFuncMap,
 		functionDenylist: t.functionDenylist,
 		sandboxPath:      t.sandboxPath,
+		pluginTimeout:    t.pluginTimeout,
+		pluginMaxOutput:  t.pluginMaxOutput,
 		destination:      t.destination,
+		bcrypt:           &t.bcrypt,
+		funcCache:        &funcCache{},
 		config:           i.Config,
 	}))
 
@@ -289,6 +346,12 @@ func (t *Template) Execute(i *ExecuteInput) (*ExecuteResult, error) {
 		return nil, errors.Wrap(redactinator(&used, i.Brain, err), "execute")
 	}
 
+	// A render with missing data may not have reached every hash, so those
+	// are only forgotten once the template rendered with all of its data.
+	if missing.Len() == 0 {
+		t.bcrypt.sweep()
+	}
+
 	return &ExecuteResult{
 		Used:    &used,
 		Missing: &missing,
@@ -301,8 +364,18 @@ func redactinator(used *dep.Set, b *Brain, err error) error {
 	for _, d := range used.List() {
 		if data, ok := b.Recall(d); ok {
 			if vd, ok := data.(*dep.Secret); ok {
-				for _, v := range vd.Data {
-					pairs = append(pairs, fmt.Sprintf("%v", v), "[redacted]")
+				pairs = redactSecret(pairs, vd)
+			}
+			if multi, ok := data.(*dep.VaultReadMultiResult); ok {
+				for _, vd := range multi.Secrets {
+					pairs = redactSecret(pairs, vd)
+				}
+			}
+			if versions, ok := data.([]*dep.VaultSecretVersion); ok {
+				for _, v := range versions {
+					if v != nil {
+						pairs = redactSecret(pairs, &dep.Secret{Data: v.Data})
+					}
 				}
 			}
 			if nVar, ok := data.(*dep.NomadVarItems); ok {
@@ -310,11 +383,57 @@ func redactinator(used *dep.Set, b *Brain, err error) error {
 					pairs = append(pairs, fmt.Sprintf("%v", v), "[redacted]")
 				}
 			}
+			if _, ok := d.(*dep.VaultRequestQuery); ok {
+				pairs = redactValues(pairs, data)
+			}
+			if _, ok := d.(*dep.VaultReadQuery); ok {
+				if v, ok := data.(string); ok && v != "" {
+					pairs = append(pairs, v, "[redacted]")
+				}
+			}
+			if td, ok := d.(*dep.VaultTransitQuery); ok && td.Redact() {
+				if v, ok := data.(string); ok && v != "" {
+					pairs = append(pairs, v, "[redacted]")
+				}
+			}
 		}
 	}
 	return errors.New(strings.NewReplacer(pairs...).Replace(err.Error()))
 }
 
+// redactSecret appends replacement pairs for each value of the data of the
+// given secret, which may be nil.
+func redactSecret(pairs []string, s *dep.Secret) []string {
+	if s == nil {
+		return pairs
+	}
+	for _, v := range s.Data {
+		pairs = append(pairs, fmt.Sprintf("%v", v), "[redacted]")
+	}
+	return pairs
+}
+
+// redactValues appends replacement pairs for each leaf value of the given
+// response data, which may be nested.
+func redactValues(pairs []string, data interface{}) []string {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for _, e := range v {
+			pairs = redactValues(pairs, e)
+		}
+	case []interface{}:
+		for _, e := range v {
+			pairs = redactValues(pairs, e)
+		}
+	case nil:
+	default:
+		if s := fmt.Sprintf("%v", v); s != "" {
+			pairs = append(pairs, s, "[redacted]")
+		}
+	}
+	return pairs
+}
+
 // funcMapInput is input to the funcMap, which builds the template functions.
 type funcMapInput struct {
 	newTmpl          *template.Template
@@ -323,9 +442,13 @@ type funcMapInput struct {
 	extFuncMap       map[string]interface{}
 	functionDenylist []string
 	sandboxPath      string
+	pluginTimeout    time.Duration
+	pluginMaxOutput  int
 	destination      string
 	used             *dep.Set
 	missing          *dep.Set
+	bcrypt           *bcryptCache
+	funcCache        *funcCache
 	config           *config.Config
 }
 
@@ -341,14 +464,24 @@ func funcMap(i *funcMapInput) template.FuncMap {
 		nomadNS = *(i.config.Nomad).Namespace
 	}
 
+	pluginTimeout := i.pluginTimeout
+	if pluginTimeout <= 0 {
+		pluginTimeout = config.DefaultTemplatePluginTimeout
+	}
+
 	r := template.FuncMap{
 		// API functions
+		"agentSelf":        agentSelfFunc(i.brain, i.used, i.missing),
+		"autopilotHealth":  autopilotHealthFunc(i.brain, i.used, i.missing),
 		"datacenters":      datacentersFunc(i.brain, i.used, i.missing),
 		"exportedServices": exportedServicesFunc(i.brain, i.used, i.missing),
 		"file":             fileFunc(i.brain, i.used, i.missing, i.sandboxPath),
+		"readFileLines":    readFileLinesFunc(i.brain, i.used, i.missing, i.sandboxPath),
 		"key":              keyFunc(i.brain, i.used, i.missing),
 		"keyExists":        keyExistsFunc(i.brain, i.used, i.missing),
 		"keyOrDefault":     keyWithDefaultFunc(i.brain, i.used, i.missing),
+		"lockHolder":       lockHolderFunc(i.brain, i.used, i.missing),
+		"kvExists":         kvExistsFunc(i.brain, i.used, i.missing),
 		"ls":               lsFunc(i.brain, i.used, i.missing, true),
 		"safeLs":           safeLsFunc(i.brain, i.used, i.missing),
 		"node":             nodeFunc(i.brain, i.used, i.missing),
@@ -356,23 +489,40 @@ func funcMap(i *funcMapInput) template.FuncMap {
 		"partitions":       partitionsFunc(i.brain, i.used, i.missing),
 		"peerings":         peeringsFunc(i.brain, i.used, i.missing),
 		"secret":           secretFunc(i.brain, i.used, i.missing),
+		"secretMulti":      secretMultiFunc(i.brain, i.used, i.missing),
 		"secrets":          secretsFunc(i.brain, i.used, i.missing),
+		"secretMetadata":   secretMetadataFunc(i.brain, i.used, i.missing),
+		"secretVersions":   secretVersionsFunc(i.brain, i.used, i.missing),
+		"vaultRequest":     vaultRequestFunc(i.brain, i.used, i.missing),
+		"vaultKeyStatus":   vaultKeyStatusFunc(i.brain, i.used, i.missing),
+		"vaultLeader":      vaultLeaderFunc(i.brain, i.used, i.missing),
+		"vaultEntityAlias": vaultEntityAliasFunc(i.brain, i.used, i.missing),
+		"vaultHostInfo":    vaultHostInfoFunc(i.brain, i.used, i.missing),
+		"vaultStaticRole":  vaultStaticRoleFunc(i.brain, i.used, i.missing),
+		"vaultAudit":       vaultAuditDevicesFunc(i.brain, i.used, i.missing),
+		"vaultEncrypt":     vaultTransitFunc(i.brain, i.used, i.missing, dep.VaultTransitEncrypt),
+		"vaultDecrypt":     vaultTransitFunc(i.brain, i.used, i.missing, dep.VaultTransitDecrypt),
 		"service":          serviceFunc(i.brain, i.used, i.missing),
 		"connect":          connectFunc(i.brain, i.used, i.missing),
+		"preparedQuery":    preparedQueryFunc(i.brain, i.used, i.missing),
 		"services":         servicesFunc(i.brain, i.used, i.missing),
+		"servicesByDC":     servicesByDCFunc(i.brain, i.used, i.missing),
+		"serviceExists":    serviceExistsFunc(i.brain, i.used, i.missing),
 		"tree":             treeFunc(i.brain, i.used, i.missing, true),
 		"safeTree":         safeTreeFunc(i.brain, i.used, i.missing),
+		"treeChecksum":     treeChecksumFunc(i.brain, i.used, i.missing),
 		"caRoots":          connectCARootsFunc(i.brain, i.used, i.missing),
 		"caLeaf":           connectLeafFunc(i.brain, i.used, i.missing),
 		"pkiCert":          pkiCertFunc(i.brain, i.used, i.missing, i.destination),
 
 		// Nomad Functions.
-		"nomadServices":    nomadServicesFunc(i.brain, i.used, i.missing),
-		"nomadService":     nomadServiceFunc(i.brain, i.used, i.missing),
-		"nomadVarList":     nomadVariablesFunc(i.brain, i.used, i.missing, nomadNS, true),
-		"nomadVarListSafe": nomadSafeVariablesFunc(i.brain, i.used, i.missing, nomadNS),
-		"nomadVar":         nomadVariableItemsFunc(i.brain, i.used, i.missing, nomadNS),
-		"nomadVarExists":   nomadVariableExistsFunc(i.brain, i.used, i.missing, nomadNS),
+		"nomadServices":     nomadServicesFunc(i.brain, i.used, i.missing),
+		"nomadService":      nomadServiceFunc(i.brain, i.used, i.missing),
+		"nomadVarList":      nomadVariablesFunc(i.brain, i.used, i.missing, nomadNS, true),
+		"nomadVarListSafe":  nomadSafeVariablesFunc(i.brain, i.used, i.missing, nomadNS),
+		"nomadVar":          nomadVariableItemsFunc(i.brain, i.used, i.missing, nomadNS),
+		"nomadVarExists":    nomadVariableExistsFunc(i.brain, i.used, i.missing, nomadNS),
+		"nomadVarOrDefault": nomadVariableItemOrDefaultFunc(i.brain, i.used, i.missing, nomadNS),
 
 		// Scratch
 		"scratch": func() *Scratch { return &scratch },
@@ -384,6 +534,8 @@ func funcMap(i *funcMapInput) template.FuncMap {
 		"base64URLEncode":       base64URLEncode,
 		"byKey":                 byKey,
 		"byPort":                byPort,
+		"sort":                  sortStrings,
+		"sortBy":                sortBy,
 		"byTag":                 byTag,
 		"contains":              contains,
 		"containsAll":           containsSomeFunc(true, true),
@@ -393,13 +545,31 @@ func funcMap(i *funcMapInput) template.FuncMap {
 		"env":                   envFunc(i.env),
 		"mustEnv":               mustEnvFunc(i.env),
 		"envOrDefault":          envWithDefaultFunc(i.env),
+		"required":              requiredFunc(i.missing),
+		"coalesce":              coalesce,
+		"ternary":               ternary,
 		"executeTemplate":       executeTemplateFunc(i.newTmpl),
 		"explode":               explode,
 		"explodeMap":            explodeMap,
+		"dict":                  dict,
+		"list":                  list,
+		"merge":                 merge,
 		"mergeMap":              mergeMap,
 		"mergeMapWithOverride":  mergeMapWithOverride,
+		"mergeAppend":           mergeAppend,
 		"in":                    in,
 		"indent":                indent,
+		"nindent":               nindent,
+		"bulletList":            bulletList,
+		"numberedList":          numberedList,
+		"compact":               compact,
+		"trimEach":              trimEach,
+		"uniq":                  uniq,
+		"unique":                uniq,
+		"keys":                  keys,
+		"values":                values,
+		"escapeTemplate":        escapeTemplate,
+		"unescapeTemplate":      unescapeTemplate,
 		"loop":                  loop,
 		"join":                  join,
 		"trim":                  trim,
@@ -411,15 +581,30 @@ func funcMap(i *funcMapInput) template.FuncMap {
 		"parseInt":              parseInt,
 		"parseJSON":             parseJSON,
 		"parseUint":             parseUint,
+		"parseTOML":             parseTOML,
 		"parseYAML":             parseYAML,
-		"plugin":                plugin,
+		"csvToMaps":             csvToMaps,
+		"plugin":                pluginFunc(pluginTimeout, i.pluginMaxOutput),
 		"regexReplaceAll":       regexReplaceAll,
 		"regexMatch":            regexMatch,
+		"regexFindSubmatch":     regexFindSubmatch,
+		"regexFindNamed":        regexFindNamed,
+		"glob":                  globMatch,
+		"globFilter":            globFilter,
+		"keysMatching":          keysMatching,
+		"pickMatching":          pickMatching,
 		"replaceAll":            replaceAll,
 		"sha256Hex":             sha256Hex,
 		"md5sum":                md5sum,
+		"sha1sum":               sha1sum,
+		"sha256sum":             sha256sum,
+		"bcrypt":                bcryptFunc(i.bcrypt),
+		"htpasswd":              htpasswdFunc(i.bcrypt),
 		"hmacSHA256Hex":         hmacSHA256Hex,
 		"timestamp":             timestamp,
+		"now":                   nowTime,
+		"numCPU":                numCPU,
+		"hostname":              hostname,
 		"toLower":               toLower,
 		"toJSON":                toJSON,
 		"toJSONPretty":          toJSONPretty,
@@ -430,18 +615,26 @@ func funcMap(i *funcMapInput) template.FuncMap {
 		"toUpper":               toUpper,
 		"toYAML":                toYAML,
 		"split":                 split,
+		"splitN":                splitN,
+		"cut":                   cut,
 		"splitToMap":            splitToMap,
 		"byMeta":                byMeta,
 		"sockaddr":              sockaddr,
-		"writeToFile":           writeToFile,
+		"privateIP":             privateIP,
+		"interfaceIP":           interfaceIP,
+		"writeToFile":           writeToFileFunc(i.sandboxPath),
 		"JSONKeyExists":         JSONKeyExists,
 
 		// Math functions
 		"add":      add,
 		"subtract": subtract,
+		"sub":      subtract,
 		"multiply": multiply,
+		"mul":      multiply,
 		"divide":   divide,
+		"div":      divide,
 		"modulo":   modulo,
+		"mod":      modulo,
 		"minimum":  minimum,
 		"maximum":  maximum,
 		// Debug functions
@@ -451,6 +644,16 @@ func funcMap(i *funcMapInput) template.FuncMap {
 		"spew_sprintf": spewSprintf,
 	}
 
+	// Memoize the pure functions for this render pass. This is done before the
+	// external functions are added, as they may replace them.
+	if i.funcCache != nil {
+		for _, name := range pureFuncs {
+			if fn, ok := r[name]; ok {
+				r[name] = i.funcCache.memoize(name, fn)
+			}
+		}
+	}
+
 	// Add the pre-computed Sprig functions to the funcmap
 	for k, v := range sprigFuncMap {
 		r[k] = v
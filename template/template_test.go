@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -96,12 +97,41 @@ func TestNewTemplate(t *testing.T) {
 			},
 			&Template{
 				contents:   "test",
-				hexMD5:     "098f6bcd4621d373cade4e832627b4f6",
+				hexMD5:     "b06ce6e30fe07daa5f200ac9dae42cbb",
 				leftDelim:  "<<",
 				rightDelim: ">>",
 			},
 			false,
 		},
+		{
+			"same_delims",
+			&NewTemplateInput{
+				Contents:   "test",
+				LeftDelim:  "%%",
+				RightDelim: "%%",
+			},
+			nil,
+			true,
+		},
+		{
+			"same_as_default_delim",
+			&NewTemplateInput{
+				Contents:  "test",
+				LeftDelim: "}}",
+			},
+			nil,
+			true,
+		},
+		{
+			"blank_delim",
+			&NewTemplateInput{
+				Contents:   "test",
+				LeftDelim:  "  ",
+				RightDelim: "]]",
+			},
+			nil,
+			true,
+		},
 		{
 			"err_missing_key",
 			&NewTemplateInput{
@@ -221,6 +251,15 @@ func TestTemplate_Execute(t *testing.T) {
 			"",
 			true,
 		},
+		{
+			"func_base64Decode_unpadded",
+			&NewTemplateInput{
+				Contents: `{{ base64Decode "aGVsbG8" }}`,
+			},
+			nil,
+			"hello",
+			false,
+		},
 		{
 			"func_base64Encode",
 			&NewTemplateInput{
@@ -248,6 +287,15 @@ func TestTemplate_Execute(t *testing.T) {
 			"",
 			true,
 		},
+		{
+			"func_base64URLDecode_unpadded",
+			&NewTemplateInput{
+				Contents: `{{ base64URLDecode "PDw_Pz8-Pg" }}`,
+			},
+			nil,
+			"<<???>>",
+			false,
+		},
 		{
 			"func_base64URLEncode",
 			&NewTemplateInput{
@@ -266,6 +314,73 @@ func TestTemplate_Execute(t *testing.T) {
 			"6116e95f2827172aa6ef8b22b883f6a77e966aefc129c6b8228ebd0aac74e98d",
 			false,
 		},
+		{
+			"func_agent_self",
+			&NewTemplateInput{
+				Contents: `{{ with agentSelf "30s" }}{{ .Config.NodeName }}@{{ .Config.Datacenter }} {{ .Member.Addr }} {{ .Meta.rack }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewAgentSelfQuery(30 * time.Second)
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.AgentSelf{
+						Config: map[string]interface{}{
+							"NodeName":   "node1",
+							"Datacenter": "dc1",
+						},
+						Member: map[string]interface{}{
+							"Addr": "10.0.0.1",
+						},
+						Meta: map[string]string{
+							"rack": "r1",
+						},
+					})
+					return b
+				}(),
+			},
+			"node1@dc1 10.0.0.1 r1",
+			false,
+		},
+		{
+			"func_agent_self_invalid_interval",
+			&NewTemplateInput{
+				Contents: `{{ agentSelf "soon" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"func_autopilot_health",
+			&NewTemplateInput{
+				Contents: `{{ with autopilotHealth }}{{ .Healthy }} {{ .FailureTolerance }}{{ range .Servers }} {{ .Name }}:{{ .Leader }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewAutopilotHealthQuery()
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.AutopilotHealth{
+						Healthy:          true,
+						FailureTolerance: 1,
+						Servers: []*dep.AutopilotServerHealth{
+							{Name: "server-1", Leader: true, Healthy: true},
+							{Name: "server-2", Healthy: true},
+						},
+					})
+					return b
+				}(),
+			},
+			"true 1 server-1:true server-2:false",
+			false,
+		},
 		{
 			"func_datacenters",
 			&NewTemplateInput{
@@ -318,7 +433,7 @@ func TestTemplate_Execute(t *testing.T) {
 					return b
 				}(),
 			},
-			"400  300",
+			"400 200 300",
 			false,
 		},
 		{
@@ -340,6 +455,25 @@ func TestTemplate_Execute(t *testing.T) {
 			"content",
 			false,
 		},
+		{
+			"func_readFileLines",
+			&NewTemplateInput{
+				Contents: `{{ range readFileLines "/path/to/file" }}[{{ . }}]{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewFileLinesQuery("/path/to/file")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []string{"10.0.0.1", "10.0.0.2"})
+					return b
+				}(),
+			},
+			"[10.0.0.1][10.0.0.2]",
+			false,
+		},
 		{
 			"func_key",
 			&NewTemplateInput{
@@ -360,6 +494,54 @@ func TestTemplate_Execute(t *testing.T) {
 			"5",
 			false,
 		},
+		{
+			"custom_delims",
+			&NewTemplateInput{
+				Contents:   `{{ .Values.name }}: [[ key "key" ]] {{- end }}`,
+				LeftDelim:  "[[",
+				RightDelim: "]]",
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVGetQuery("key")
+					if err != nil {
+						t.Fatal(err)
+					}
+					d.EnableBlocking()
+					b.Remember(d, "5")
+					return b
+				}(),
+			},
+			"{{ .Values.name }}: 5 {{- end }}",
+			false,
+		},
+		{
+			"func_lock_holder",
+			&NewTemplateInput{
+				Contents: `{{ with lockHolder "service/leader" }}{{ if .Held }}{{ .Node }} {{ .Value }} {{ .TTL }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVLockQuery("service/leader")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.KVLock{
+						Key:     "service/leader",
+						Held:    true,
+						Value:   "10.0.0.1:8080",
+						Session: "adf4238a-882b-9ddc-4a9d-5b6758e4159e",
+						Node:    "node-1",
+						TTL:     "15s",
+					})
+					return b
+				}(),
+			},
+			"node-1 10.0.0.1:8080 15s",
+			false,
+		},
 		{
 			"func_keyExists",
 			&NewTemplateInput{
@@ -379,6 +561,48 @@ func TestTemplate_Execute(t *testing.T) {
 			"true false",
 			false,
 		},
+		{
+			"func_kvExists",
+			&NewTemplateInput{
+				Contents: `{{ kvExists "key" }} {{ kvExists "no_key" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					for k, v := range map[string]bool{"key": true, "no_key": false} {
+						d, err := dep.NewKVExistsQuery(k)
+						if err != nil {
+							t.Fatal(err)
+						}
+						b.Remember(d, v)
+					}
+					return b
+				}(),
+			},
+			"true false",
+			false,
+		},
+		{
+			"func_serviceExists",
+			&NewTemplateInput{
+				Contents: `{{ serviceExists "web" }} {{ serviceExists "db" }} {{ serviceExists "db@dc2" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					for dc, name := range map[string]string{"": "web", "@dc2": "db"} {
+						d, err := dep.NewCatalogServicesQuery(dc)
+						if err != nil {
+							t.Fatal(err)
+						}
+						b.Remember(d, []*dep.CatalogSnippet{{Name: name}})
+					}
+					return b
+				}(),
+			},
+			"true false true",
+			false,
+		},
 		{
 			"func_keyOrDefault",
 			&NewTemplateInput{
@@ -527,406 +751,513 @@ func TestTemplate_Execute(t *testing.T) {
 			false,
 		},
 		{
-			"func_secret_nil_pointer_evaluation",
+			"func_secret_read_field",
 			&NewTemplateInput{
-				Contents: `{{ $v := secret "secret/foo" }}{{ $v.Data.zip }}`,
+				Contents: `{{ secret "secret/foo?field=zip" }}`,
 			},
 			&ExecuteInput{
-				Brain: NewBrain(),
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewVaultReadQuery("secret/foo?field=zip")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, "zap")
+					return b
+				}(),
 			},
-			"<no value>",
+			"zap",
 			false,
 		},
 		{
-			"func_secret_read_versions",
+			"func_secret_metadata",
 			&NewTemplateInput{
-				Contents: `{{with secret "secret/foo"}}{{.Data.zip}}{{end}}:{{with secret "secret/foo?version=1"}}{{.Data.zip}}{{end}}`,
+				Contents: `{{ with secretMetadata "secret/foo" }}{{ .CurrentVersion }}{{ range .Versions }}:{{ .Version }}-{{ .Deleted }}-{{ .Destroyed }}{{ end }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewVaultReadQuery("secret/foo")
-					if err != nil {
-						t.Fatal(err)
-					}
-					b.Remember(d, &dep.Secret{
-						Data: map[string]interface{}{"zip": "zap"},
-					})
-					d1, err := dep.NewVaultReadQuery("secret/foo?version=1")
+					d, err := dep.NewVaultMetadataWatchQuery("secret/foo")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d1, &dep.Secret{
-						Data: map[string]interface{}{"zip": "zed"},
+					b.Remember(d, &dep.VaultMetadata{
+						CurrentVersion: 2,
+						OldestVersion:  1,
+						Versions: []*dep.VaultMetadataVersion{
+							{Version: 1, Destroyed: true},
+							{Version: 2},
+						},
 					})
 					return b
 				}(),
 			},
-			"zap:zed",
+			"2:1-false-true:2-false-false",
 			false,
 		},
 		{
-			"func_secret_read_no_exist",
+			"func_secret_versions",
 			&NewTemplateInput{
-				Contents: `{{ with secret "secret/nope" }}{{ .Data.zip }}{{ end }}`,
+				Contents: `{{ range secretVersions "secret/foo" 3 }}{{ .Version }}:{{ if .Destroyed }}destroyed{{ else }}{{ .Data.value }}{{ end }};{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
-					return NewBrain()
+					b := NewBrain()
+					d, err := dep.NewVaultAllVersionsQuery("secret/foo", 3)
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.VaultSecretVersion{
+						{Version: 1, Destroyed: true},
+						{Version: 2, Data: map[string]interface{}{"value": "two"}},
+						{Version: 3, Data: map[string]interface{}{"value": "three"}},
+					})
+					return b
 				}(),
 			},
-			"",
+			"1:destroyed;2:two;3:three;",
 			false,
 		},
 		{
-			"func_secret_read_no_exist_falsey",
+			"func_vault_request",
 			&NewTemplateInput{
-				Contents: `{{ if secret "secret/nope" }}yes{{ else }}no{{ end }}`,
+				Contents: `{{ with vaultRequest "LIST" "secret/metadata" }}{{ range .keys }}{{ . }}{{ end }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
-					return NewBrain()
+					b := NewBrain()
+					d, err := dep.NewVaultRequestQuery("LIST", "secret/metadata", nil)
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, map[string]interface{}{
+						"keys": []interface{}{"bar", "foo"},
+					})
+					return b
 				}(),
 			},
-			"no",
+			"barfoo",
 			false,
 		},
 		{
-			"func_secret_write",
+			"func_vault_key_status",
 			&NewTemplateInput{
-				Contents: `{{ with secret "transit/encrypt/foo" "plaintext=a" }}{{ .Data.ciphertext }}{{ end }}`,
+				Contents: `{{ with vaultKeyStatus }}{{ .Term }} {{ .InstallTime }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewVaultWriteQuery("transit/encrypt/foo", map[string]interface{}{
-						"plaintext": "a",
-					})
+					d, err := dep.NewVaultKeyStatusQuery()
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, &dep.Secret{
-						LeaseID:       "abcd1234",
-						LeaseDuration: 120,
-						Renewable:     true,
-						Data:          map[string]interface{}{"ciphertext": "encrypted"},
+					b.Remember(d, &dep.VaultKeyStatus{
+						Term:        2,
+						InstallTime: "2024-01-02T03:04:05Z",
 					})
 					return b
 				}(),
 			},
-			"encrypted",
+			"2 2024-01-02T03:04:05Z",
 			false,
 		},
 		{
-			"func_secret_write_empty",
+			"func_vault_static_role",
 			&NewTemplateInput{
-				Contents: `{{ with secret "transit/encrypt/foo" "" }}{{ .Data.ciphertext }}{{ end }}`,
+				Contents: `{{ with vaultStaticRole "db/app" }}{{ .Username }} {{ .LastVaultRotation }} {{ .RotationPeriod }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewVaultWriteQuery("transit/encrypt/foo", nil)
+					d, err := dep.NewVaultStaticRoleQuery("db/app")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, &dep.Secret{
-						Data: map[string]interface{}{"ciphertext": "encrypted"},
+					b.Remember(d, &dep.VaultStaticRole{
+						Username:          "app-user",
+						LastVaultRotation: "2024-01-02T03:04:05Z",
+						RotationPeriod:    3600,
+						TTL:               1800,
 					})
 					return b
 				}(),
 			},
-			"encrypted",
+			"app-user 2024-01-02T03:04:05Z 3600",
 			false,
 		},
 		{
-			"func_secret_write_no_exist",
+			"func_vault_leader",
 			&NewTemplateInput{
-				Contents: `{{ with secret "secret/nope" "a=b" }}{{ .Data.zip }}{{ end }}`,
+				Contents: `{{ with vaultLeader }}{{ .HAEnabled }} {{ .IsSelf }} {{ .LeaderAddress }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
-					return NewBrain()
+					b := NewBrain()
+					d, err := dep.NewVaultLeaderQuery()
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.VaultLeader{
+						HAEnabled:     true,
+						LeaderAddress: "https://vault-1.example.com:8200",
+					})
+					return b
 				}(),
 			},
-			"",
+			"true false https://vault-1.example.com:8200",
 			false,
 		},
 		{
-			"func_secret_write_no_exist_falsey",
+			"func_vault_entity_alias",
 			&NewTemplateInput{
-				Contents: `{{ if secret "secret/nope" "a=b" }}yes{{ else }}no{{ end }}`,
+				Contents: `{{ with vaultEntityAlias "auth_userpass_1234" "alice" }}{{ .Name }} {{ .ID }} {{ join "," .Policies }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
-					return NewBrain()
+					b := NewBrain()
+					d, err := dep.NewVaultEntityAliasQuery("auth_userpass_1234", "alice")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.VaultEntity{
+						ID:       "8d6a45e5",
+						Name:     "entity_alice",
+						Policies: []string{"admin", "default"},
+					})
+					return b
 				}(),
 			},
-			"no",
+			"entity_alice 8d6a45e5 admin,default",
 			false,
 		},
 		{
-			"func_secret_no_exist_falsey_with",
+			"func_vault_host_info",
 			&NewTemplateInput{
-				Contents: `{{ with secret "secret/nope" }}{{ .Data.foo.bar }}{{ end }}`,
+				Contents: `{{ with vaultHostInfo }}{{ .Host.Hostname }} {{ len .CPU }} {{ .Memory.UsedPercent }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
-					return NewBrain()
+					b := NewBrain()
+					d, err := dep.NewVaultHostInfoQuery()
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.VaultHostInfo{
+						CPU:    []*dep.VaultHostCPU{{Cores: 4}, {Cores: 4}},
+						Memory: &dep.VaultHostMemory{UsedPercent: 37.5},
+						Host:   &dep.VaultHost{Hostname: "vault-1"},
+					})
+					return b
 				}(),
 			},
-			"",
+			"vault-1 2 37.5",
 			false,
 		},
 		{
-			"func_secrets",
+			"func_vault_audit",
 			&NewTemplateInput{
-				Contents: `{{ secrets "secret/" }}`,
+				Contents: `{{ range vaultAudit }}{{ .Path }} {{ .Type }} {{ .Options.file_path }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewVaultListQuery("secret/")
+					d, err := dep.NewVaultAuditDevicesQuery()
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []string{"bar", "foo"})
+					b.Remember(d, []*dep.VaultAuditDevice{{
+						Path:    "file/",
+						Type:    "file",
+						Options: map[string]string{"file_path": "/var/log/vault_audit.log"},
+					}})
 					return b
 				}(),
 			},
-			"[bar foo]",
+			"file/ file /var/log/vault_audit.log",
 			false,
 		},
 		{
-			"func_secrets_no_exist",
+			"func_vault_encrypt_decrypt",
 			&NewTemplateInput{
-				Contents: `{{ secrets "secret/" }}`,
+				Contents: `{{ vaultEncrypt "my-key" "zap" }}:{{ vaultDecrypt "my-key" "vault:v1:abcd" }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
-					return NewBrain()
-				}(),
-			},
-			"[]",
-			false,
-		},
-		{
-			"func_secrets_no_exist_falsey",
-			&NewTemplateInput{
-				Contents: `{{ if secrets "secret/" }}yes{{ else }}no{{ end }}`,
-			},
-			&ExecuteInput{
-				Brain: func() *Brain {
-					return NewBrain()
+					b := NewBrain()
+					d, err := dep.NewVaultTransitQuery(dep.VaultTransitEncrypt, "my-key", "zap")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, "vault:v1:zip")
+					d1, err := dep.NewVaultTransitQuery(dep.VaultTransitDecrypt, "my-key", "vault:v1:abcd")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d1, "zed")
+					return b
 				}(),
 			},
-			"no",
+			"vault:v1:zip:zed",
 			false,
 		},
 		{
-			"func_secrets_no_exist_falsey_with",
+			"func_secret_nil_pointer_evaluation",
 			&NewTemplateInput{
-				Contents: `{{ with secrets "secret/" }}{{ . }}{{ end }}`,
+				Contents: `{{ $v := secret "secret/foo" }}{{ $v.Data.zip }}`,
 			},
 			&ExecuteInput{
-				Brain: func() *Brain {
-					return NewBrain()
-				}(),
+				Brain: NewBrain(),
 			},
-			"",
+			"<no value>",
 			false,
 		},
 		{
-			"func_service",
+			"func_secret_read_versions",
 			&NewTemplateInput{
-				Contents: `{{ range service "webapp" }}{{ .Address }}{{ end }}`,
+				Contents: `{{with secret "secret/foo"}}{{.Data.zip}}{{end}}:{{with secret "secret/foo?version=1"}}{{.Data.zip}}{{end}}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewVaultReadQuery("secret/foo")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Node:    "node1",
-							Address: "1.2.3.4",
-						},
-						{
-							Node:    "node2",
-							Address: "5.6.7.8",
-						},
+					b.Remember(d, &dep.Secret{
+						Data: map[string]interface{}{"zip": "zap"},
+					})
+					d1, err := dep.NewVaultReadQuery("secret/foo?version=1")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d1, &dep.Secret{
+						Data: map[string]interface{}{"zip": "zed"},
 					})
 					return b
 				}(),
 			},
-			"1.2.3.45.6.7.8",
+			"zap:zed",
 			false,
 		},
 		{
-			"func_service_filter",
+			"func_secret_read_no_exist",
 			&NewTemplateInput{
-				Contents: `{{ range service "webapp" "passing,any" }}{{ .Address }}{{ end }}`,
+				Contents: `{{ with secret "secret/nope" }}{{ .Data.zip }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
-					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp|passing,any")
-					if err != nil {
-						t.Fatal(err)
-					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Node:    "node1",
-							Address: "1.2.3.4",
-						},
-						{
-							Node:    "node2",
-							Address: "5.6.7.8",
-						},
-					})
-					return b
+					return NewBrain()
 				}(),
 			},
-			"1.2.3.45.6.7.8",
+			"",
 			false,
 		},
 		{
-			"func_services",
+			"func_secret_read_no_exist_falsey",
 			&NewTemplateInput{
-				Contents: `{{ range services }}{{ .Name }}{{ end }}`,
+				Contents: `{{ if secret "secret/nope" }}yes{{ else }}no{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					return NewBrain()
+				}(),
+			},
+			"no",
+			false,
+		},
+		{
+			"func_secret_write",
+			&NewTemplateInput{
+				Contents: `{{ with secret "transit/encrypt/foo" "plaintext=a" }}{{ .Data.ciphertext }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewCatalogServicesQuery("")
+					d, err := dep.NewVaultWriteQuery("transit/encrypt/foo", map[string]interface{}{
+						"plaintext": "a",
+					})
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.CatalogSnippet{
-						{
-							Name: "service1",
-						},
-						{
-							Name: "service2",
-						},
+					b.Remember(d, &dep.Secret{
+						LeaseID:       "abcd1234",
+						LeaseDuration: 120,
+						Renewable:     true,
+						Data:          map[string]interface{}{"ciphertext": "encrypted"},
 					})
 					return b
 				}(),
 			},
-			"service1service2",
+			"encrypted",
 			false,
 		},
 		{
-			"func_tree",
+			"func_secret_write_empty",
 			&NewTemplateInput{
-				Contents: `{{ range tree "key" }}{{ .Key }}={{ .Value }}{{ end }}`,
+				Contents: `{{ with secret "transit/encrypt/foo" "" }}{{ .Data.ciphertext }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewKVListQuery("key")
+					d, err := dep.NewVaultWriteQuery("transit/encrypt/foo", nil)
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.KeyPair{
-						{Key: "", Value: ""},
-						{Key: "admin/port", Value: "1134"},
-						{Key: "maxconns", Value: "5"},
-						{Key: "minconns", Value: "2"},
+					b.Remember(d, &dep.Secret{
+						Data: map[string]interface{}{"ciphertext": "encrypted"},
 					})
 					return b
 				}(),
 			},
-			"admin/port=1134maxconns=5minconns=2",
+			"encrypted",
 			false,
 		},
-
-		// scratch
 		{
-			"scratch.Key",
+			"func_secret_write_no_exist",
 			&NewTemplateInput{
-				Contents: `{{ scratch.Set "a" "2" }}{{ scratch.Key "a" }}`,
+				Contents: `{{ with secret "secret/nope" "a=b" }}{{ .Data.zip }}{{ end }}`,
 			},
 			&ExecuteInput{
-				Brain: NewBrain(),
+				Brain: func() *Brain {
+					return NewBrain()
+				}(),
 			},
-			"true",
+			"",
 			false,
 		},
 		{
-			"scratch.Get",
+			"func_secret_write_no_exist_falsey",
 			&NewTemplateInput{
-				Contents: `{{ scratch.Set "a" "2" }}{{ scratch.Get "a" }}`,
+				Contents: `{{ if secret "secret/nope" "a=b" }}yes{{ else }}no{{ end }}`,
 			},
 			&ExecuteInput{
-				Brain: NewBrain(),
+				Brain: func() *Brain {
+					return NewBrain()
+				}(),
 			},
-			"2",
+			"no",
 			false,
 		},
 		{
-			"scratch.SetX",
+			"func_secret_no_exist_falsey_with",
 			&NewTemplateInput{
-				Contents: `{{ scratch.SetX "a" "2" }}{{ scratch.SetX "a" "1" }}{{ scratch.Get "a" }}`,
+				Contents: `{{ with secret "secret/nope" }}{{ .Data.foo.bar }}{{ end }}`,
 			},
 			&ExecuteInput{
-				Brain: NewBrain(),
+				Brain: func() *Brain {
+					return NewBrain()
+				}(),
 			},
-			"2",
+			"",
 			false,
 		},
 		{
-			"scratch.MapSet",
+			"func_secretMulti",
 			&NewTemplateInput{
-				Contents: `{{ scratch.MapSet "a" "foo" "bar" }}{{ scratch.MapValues "a" }}`,
+				Contents: `{{ with secretMulti "secret/foo" "secret/bar" }}{{ (index .Secrets "secret/foo").Data.zip }} {{ index .Errors "secret/bar" }}{{ end }}`,
 			},
 			&ExecuteInput{
-				Brain: NewBrain(),
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewVaultReadMultiQuery([]string{"secret/foo", "secret/bar"})
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.VaultReadMultiResult{
+						Secrets: map[string]*dep.Secret{
+							"secret/foo": {Data: map[string]interface{}{"zip": "zap"}},
+						},
+						Errors: map[string]string{
+							"secret/bar": "no secret exists",
+						},
+					})
+					return b
+				}(),
 			},
-			"[bar]",
+			"zap no secret exists",
 			false,
 		},
 		{
-			"scratch.MapSetX",
+			"func_secrets",
 			&NewTemplateInput{
-				Contents: `{{ scratch.MapSetX "a" "foo" "bar" }}{{ scratch.MapSetX "a" "foo" "baz" }}{{ scratch.MapValues "a" }}`,
+				Contents: `{{ secrets "secret/" }}`,
 			},
 			&ExecuteInput{
-				Brain: NewBrain(),
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewVaultListQuery("secret/")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []string{"bar", "foo"})
+					return b
+				}(),
 			},
-			"[bar]",
+			"[bar foo]",
 			false,
 		},
-
-		// helpers
 		{
-			"helper_by_key",
+			"func_secrets_recursive",
 			&NewTemplateInput{
-				Contents: `{{ range $key, $pairs := tree "list" | byKey }}{{ $key }}:{{ range $pairs }}{{ .Key }}={{ .Value }}{{ end }}{{ end }}`,
+				Contents: `{{ range secrets "secret/teams?recursive=true" }}{{ . }} {{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewKVListQuery("list")
+					d, err := dep.NewVaultListQuery("secret/teams?recursive=true")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.KeyPair{
-						{Key: "", Value: ""},
-						{Key: "foo/bar", Value: "a"},
-						{Key: "zip/zap", Value: "b"},
-					})
+					b.Remember(d, []string{"backend/db", "frontend/api-key"})
 					return b
 				}(),
 			},
-			"foo:bar=azip:zap=b",
+			"backend/db frontend/api-key ",
 			false,
 		},
 		{
-			"helper_by_tag",
+			"func_secrets_no_exist",
 			&NewTemplateInput{
-				Contents: `{{ range $tag, $services := service "webapp" | byTag }}{{ $tag }}:{{ range $services }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ secrets "secret/" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					return NewBrain()
+				}(),
+			},
+			"[]",
+			false,
+		},
+		{
+			"func_secrets_no_exist_falsey",
+			&NewTemplateInput{
+				Contents: `{{ if secrets "secret/" }}yes{{ else }}no{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					return NewBrain()
+				}(),
+			},
+			"no",
+			false,
+		},
+		{
+			"func_secrets_no_exist_falsey_with",
+			&NewTemplateInput{
+				Contents: `{{ with secrets "secret/" }}{{ . }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					return NewBrain()
+				}(),
+			},
+			"",
+			false,
+		},
+		{
+			"func_service",
+			&NewTemplateInput{
+				Contents: `{{ range service "webapp" }}{{ .Address }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
@@ -937,96 +1268,90 @@ func TestTemplate_Execute(t *testing.T) {
 					}
 					b.Remember(d, []*dep.HealthService{
 						{
+							Node:    "node1",
 							Address: "1.2.3.4",
-							Tags:    []string{"prod", "staging"},
 						},
 						{
+							Node:    "node2",
 							Address: "5.6.7.8",
-							Tags:    []string{"staging"},
 						},
 					})
 					return b
 				}(),
 			},
-			"prod:1.2.3.4staging:1.2.3.45.6.7.8",
+			"1.2.3.45.6.7.8",
 			false,
 		},
 		{
-			"helper_contains",
+			"func_service_check_output",
 			&NewTemplateInput{
-				Contents: `{{ range service "webapp" }}{{ if .Tags | contains "prod" }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ range service "webapp|critical" }}{{ range .Checks }}{{ if eq .Status "critical" }}{{ .CheckID }}: {{ .Output }}{{ end }}{{ end }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewHealthServiceQuery("webapp|critical")
 					if err != nil {
 						t.Fatal(err)
 					}
 					b.Remember(d, []*dep.HealthService{
 						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "staging"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"staging"},
+							Node:   "node1",
+							Status: "critical",
+							Checks: api.HealthChecks{
+								{CheckID: "serfHealth", Status: "passing", Output: "Agent alive"},
+								{CheckID: "service:webapp", Status: "critical", Output: "503 Service Unavailable"},
+							},
 						},
 					})
 					return b
 				}(),
 			},
-			"1.2.3.4",
+			"service:webapp: 503 Service Unavailable",
 			false,
 		},
 		{
-			"helper_containsAll",
+			"func_prepared_query",
 			&NewTemplateInput{
-				Contents: `{{ $requiredTags := parseJSON "[\"prod\",\"us-realm\"]" }}{{ range service "webapp" }}{{ if .Tags | containsAll $requiredTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ range preparedQuery "web-failover@dc1" }}{{ .Address }}:{{ .Port }} {{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewHealthPreparedQuery("web-failover@dc1")
 					if err != nil {
 						t.Fatal(err)
 					}
 					b.Remember(d, []*dep.HealthService{
-						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "us-realm"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"prod", "ca-realm"},
-						},
+						{Node: "node1", Address: "1.2.3.4", Port: 80},
+						{Node: "node2", Address: "5.6.7.8", Port: 8080},
 					})
 					return b
 				}(),
 			},
-			"1.2.3.4",
+			"1.2.3.4:80 5.6.7.8:8080 ",
 			false,
 		},
 		{
-			"helper_containsAll__empty",
+			"func_service_filter",
 			&NewTemplateInput{
-				Contents: `{{ $requiredTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsAll $requiredTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ range service "webapp" "passing,any" }}{{ .Address }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewHealthServiceQuery("webapp|passing,any")
 					if err != nil {
 						t.Fatal(err)
 					}
 					b.Remember(d, []*dep.HealthService{
 						{
+							Node:    "node1",
 							Address: "1.2.3.4",
-							Tags:    []string{"prod", "us-realm"},
 						},
 						{
+							Node:    "node2",
 							Address: "5.6.7.8",
-							Tags:    []string{"prod", "ca-realm"},
 						},
 					})
 					return b
@@ -1036,411 +1361,1029 @@ func TestTemplate_Execute(t *testing.T) {
 			false,
 		},
 		{
-			"helper_containsAny",
+			"func_services",
 			&NewTemplateInput{
-				Contents: `{{ $acceptableTags := parseJSON "[\"v2\",\"v3\"]" }}{{ range service "webapp" }}{{ if .Tags | containsAny $acceptableTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ range services }}{{ .Name }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewCatalogServicesQuery("")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.HealthService{
+					b.Remember(d, []*dep.CatalogSnippet{
 						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "v1"},
+							Name: "service1",
 						},
 						{
-							Address: "5.6.7.8",
-							Tags:    []string{"prod", "v2"},
+							Name: "service2",
 						},
 					})
 					return b
 				}(),
 			},
-			"5.6.7.8",
+			"service1service2",
 			false,
 		},
 		{
-			"helper_containsAny__empty",
+			"func_services_by_dc",
 			&NewTemplateInput{
-				Contents: `{{ $acceptableTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsAny $acceptableTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ range $dc, $names := servicesByDC }}{{ $dc }}:{{ join "," $names }};{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewCatalogDatacentersQuery(false)
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "v1"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"prod", "v2"},
-						},
-					})
+					b.Remember(d, []string{"dc1", "dc2"})
+					for dc, names := range map[string][]string{
+						"dc1": {"api", "web"},
+						"dc2": {"db"},
+					} {
+						d, err := dep.NewCatalogServicesQuery("@" + dc)
+						if err != nil {
+							t.Fatal(err)
+						}
+						var services []*dep.CatalogSnippet
+						for _, name := range names {
+							services = append(services, &dep.CatalogSnippet{Name: name})
+						}
+						b.Remember(d, services)
+					}
 					return b
 				}(),
 			},
-			"",
+			"dc1:api,web;dc2:db;",
 			false,
 		},
 		{
-			"helper_containsNone",
+			"func_services_by_dc_named",
 			&NewTemplateInput{
-				Contents: `{{ $forbiddenTags := parseJSON "[\"devel\",\"staging\"]" }}{{ range service "webapp" }}{{ if .Tags | containsNone $forbiddenTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ range $dc, $names := servicesByDC "dc2" }}{{ $dc }}:{{ join "," $names }};{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
-					if err != nil {
-						t.Fatal(err)
+					// The datacenters are not queried when given
+					for dc, names := range map[string][]string{
+						"dc1": {"api", "web"},
+						"dc2": {"db"},
+					} {
+						d, err := dep.NewCatalogServicesQuery("@" + dc)
+						if err != nil {
+							t.Fatal(err)
+						}
+						var services []*dep.CatalogSnippet
+						for _, name := range names {
+							services = append(services, &dep.CatalogSnippet{Name: name})
+						}
+						b.Remember(d, services)
 					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "v1"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"devel", "v2"},
-						},
-					})
 					return b
 				}(),
 			},
-			"1.2.3.4",
+			"dc2:db;",
 			false,
 		},
 		{
-			"helper_containsNone__empty",
+			"func_tree",
 			&NewTemplateInput{
-				Contents: `{{ $forbiddenTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsNone $forbiddenTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ range tree "key" }}{{ .Key }}={{ .Value }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewKVListQuery("key")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Address: "1.2.3.4",
-							Tags:    []string{"staging", "v1"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"devel", "v2"},
-						},
+					b.Remember(d, []*dep.KeyPair{
+						{Key: "", Value: ""},
+						{Key: "admin/port", Value: "1134"},
+						{Key: "maxconns", Value: "5"},
+						{Key: "minconns", Value: "2"},
 					})
 					return b
 				}(),
 			},
-			"1.2.3.45.6.7.8",
+			"admin/port=1134maxconns=5minconns=2",
 			false,
 		},
 		{
-			"helper_containsNotAll",
+			"func_treeChecksum",
 			&NewTemplateInput{
-				Contents: `{{ $excludingTags := parseJSON "[\"es-v1\",\"es-v2\"]" }}{{ range service "webapp" }}{{ if .Tags | containsNotAll $excludingTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ treeChecksum "config/app" }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
+					d, err := dep.NewKVTreeChecksumQuery("config/app")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "es-v1"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"prod", "hybrid", "es-v1", "es-v2"},
-						},
-					})
+					b.Remember(d, "9f86d081884c7d65")
 					return b
 				}(),
 			},
-			"1.2.3.4",
+			"9f86d081884c7d65",
 			false,
 		},
+
+		// scratch
 		{
-			"helper_containsNotAll__empty",
+			"scratch.Key",
 			&NewTemplateInput{
-				Contents: `{{ $excludingTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsNotAll $excludingTags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ scratch.Set "a" "2" }}{{ scratch.Key "a" }}`,
 			},
 			&ExecuteInput{
-				Brain: func() *Brain {
-					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
-					if err != nil {
-						t.Fatal(err)
-					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "es-v1"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"prod", "hybrid", "es-v1", "es-v2"},
-						},
-					})
-					return b
-				}(),
+				Brain: NewBrain(),
 			},
-			"",
+			"true",
 			false,
 		},
 		{
-			"helper_env",
+			"scratch.Get",
 			&NewTemplateInput{
-				Contents: `{{ env "CT_TEST" }}`,
+				Contents: `{{ scratch.Set "a" "2" }}{{ scratch.Get "a" }}`,
 			},
 			&ExecuteInput{
-				Brain: func() *Brain {
-					// Cheat and use the brain callback here to set the env.
-					if err := os.Setenv("CT_TEST", "1"); err != nil {
-						t.Fatal(err)
-					}
-					return NewBrain()
-				}(),
+				Brain: NewBrain(),
 			},
-			"1",
+			"2",
 			false,
 		},
 		{
-			"helper_mustEnv",
+			"scratch.SetX",
 			&NewTemplateInput{
-				Contents: `{{ mustEnv "CT_TEST" }}`,
+				Contents: `{{ scratch.SetX "a" "2" }}{{ scratch.SetX "a" "1" }}{{ scratch.Get "a" }}`,
 			},
 			&ExecuteInput{
-				Brain: func() *Brain {
-					// Cheat and use the brain callback here to set the env.
-					if err := os.Setenv("CT_TEST", "1"); err != nil {
-						t.Fatal(err)
-					}
-					return NewBrain()
-				}(),
+				Brain: NewBrain(),
 			},
-			"1",
+			"2",
 			false,
 		},
 		{
-			"helper_mustEnv_negative",
+			"scratch.MapSet",
 			&NewTemplateInput{
-				Contents: `{{ mustEnv "CT_TEST_NONEXISTENT" }}`,
+				Contents: `{{ scratch.MapSet "a" "foo" "bar" }}{{ scratch.MapValues "a" }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"",
-			true,
+			"[bar]",
+			false,
 		},
 		{
-			"helper_env__override",
+			"scratch.MapSetX",
 			&NewTemplateInput{
-				Contents: `{{ env "CT_TEST" }}`,
+				Contents: `{{ scratch.MapSetX "a" "foo" "bar" }}{{ scratch.MapSetX "a" "foo" "baz" }}{{ scratch.MapValues "a" }}`,
 			},
 			&ExecuteInput{
-				Env: []string{
-					"CT_TEST=2",
-				},
 				Brain: NewBrain(),
 			},
-			"2",
+			"[bar]",
 			false,
 		},
+
+		// helpers
 		{
-			"helper_executeTemplate",
+			"helper_by_key",
 			&NewTemplateInput{
-				Contents: `{{ define "custom" }}{{ key "foo" }}{{ end }}{{ executeTemplate "custom" }}`,
+				Contents: `{{ range $key, $pairs := tree "list" | byKey }}{{ $key }}:{{ range $pairs }}{{ .Key }}={{ .Value }}{{ end }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewKVGetQuery("foo")
+					d, err := dep.NewKVListQuery("list")
 					if err != nil {
 						t.Fatal(err)
 					}
-					d.EnableBlocking()
-					b.Remember(d, "bar")
+					b.Remember(d, []*dep.KeyPair{
+						{Key: "", Value: ""},
+						{Key: "foo/bar", Value: "a"},
+						{Key: "zip/zap", Value: "b"},
+					})
 					return b
 				}(),
 			},
-			"bar",
+			"foo:bar=azip:zap=b",
 			false,
 		},
 		{
-			"helper_executeTemplate__dot",
+			"helper_by_tag",
 			&NewTemplateInput{
-				Contents: `{{ define "custom" }}{{ key . }}{{ end }}{{ executeTemplate "custom" "foo" }}`,
+				Contents: `{{ range $tag, $services := service "webapp" | byTag }}{{ $tag }}:{{ range $services }}{{ .Address }}{{ end }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewKVGetQuery("foo")
+					d, err := dep.NewHealthServiceQuery("webapp")
 					if err != nil {
 						t.Fatal(err)
 					}
-					d.EnableBlocking()
-					b.Remember(d, "bar")
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "staging"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"staging"},
+						},
+					})
 					return b
 				}(),
 			},
-			"bar",
+			"prod:1.2.3.4staging:1.2.3.45.6.7.8",
 			false,
 		},
 		{
-			"helper_mergeMap",
+			"helper_contains",
 			&NewTemplateInput{
-				Contents: `{{ $base := "{\"voo\":{\"bar\":\"v\"}}" | parseJSON}}{{ $role := tree "list" | explode | mergeMap $base}}{{ range $k, $v := $role }}{{ $k }}{{ $v }}{{ end }}`,
+				Contents: `{{ range service "webapp" }}{{ if .Tags | contains "prod" }}{{ .Address }}{{ end }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewKVListQuery("list")
+					d, err := dep.NewHealthServiceQuery("webapp")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.KeyPair{
-						{Key: "", Value: ""},
-						{Key: "foo/bar", Value: "a"},
-						{Key: "zip/zap", Value: "b"},
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "staging"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"staging"},
+						},
 					})
 					return b
 				}(),
 			},
-			"foomap[bar:a]voomap[bar:v]zipmap[zap:b]",
+			"1.2.3.4",
 			false,
 		},
 		{
-			"helper_mergeMapWithOverride",
+			"helper_containsAll",
 			&NewTemplateInput{
-				Contents: `{{ $base := "{\"zip\":{\"zap\":\"t\"},\"voo\":{\"bar\":\"v\"}}" | parseJSON}}{{ $role := tree "list" | explode | mergeMapWithOverride $base}}{{ range $k, $v := $role }}{{ $k }}{{ $v }}{{ end }}`,
+				Contents: `{{ $requiredTags := parseJSON "[\"prod\",\"us-realm\"]" }}{{ range service "webapp" }}{{ if .Tags | containsAll $requiredTags }}{{ .Address }}{{ end }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: func() *Brain {
 					b := NewBrain()
-					d, err := dep.NewKVListQuery("list")
+					d, err := dep.NewHealthServiceQuery("webapp")
 					if err != nil {
 						t.Fatal(err)
 					}
-					b.Remember(d, []*dep.KeyPair{
-						{Key: "", Value: ""},
-						{Key: "foo/bar", Value: "a"},
-						{Key: "zip/zap", Value: "b"},
-					})
-					return b
-				}(),
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "us-realm"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"prod", "ca-realm"},
+						},
+					})
+					return b
+				}(),
+			},
+			"1.2.3.4",
+			false,
+		},
+		{
+			"helper_containsAll__empty",
+			&NewTemplateInput{
+				Contents: `{{ $requiredTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsAll $requiredTags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "us-realm"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"prod", "ca-realm"},
+						},
+					})
+					return b
+				}(),
+			},
+			"1.2.3.45.6.7.8",
+			false,
+		},
+		{
+			"helper_containsAny",
+			&NewTemplateInput{
+				Contents: `{{ $acceptableTags := parseJSON "[\"v2\",\"v3\"]" }}{{ range service "webapp" }}{{ if .Tags | containsAny $acceptableTags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "v1"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"prod", "v2"},
+						},
+					})
+					return b
+				}(),
+			},
+			"5.6.7.8",
+			false,
+		},
+		{
+			"helper_containsAny__empty",
+			&NewTemplateInput{
+				Contents: `{{ $acceptableTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsAny $acceptableTags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "v1"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"prod", "v2"},
+						},
+					})
+					return b
+				}(),
+			},
+			"",
+			false,
+		},
+		{
+			"helper_containsNone",
+			&NewTemplateInput{
+				Contents: `{{ $forbiddenTags := parseJSON "[\"devel\",\"staging\"]" }}{{ range service "webapp" }}{{ if .Tags | containsNone $forbiddenTags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "v1"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"devel", "v2"},
+						},
+					})
+					return b
+				}(),
+			},
+			"1.2.3.4",
+			false,
+		},
+		{
+			"helper_containsNone__empty",
+			&NewTemplateInput{
+				Contents: `{{ $forbiddenTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsNone $forbiddenTags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"staging", "v1"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"devel", "v2"},
+						},
+					})
+					return b
+				}(),
+			},
+			"1.2.3.45.6.7.8",
+			false,
+		},
+		{
+			"helper_containsNotAll",
+			&NewTemplateInput{
+				Contents: `{{ $excludingTags := parseJSON "[\"es-v1\",\"es-v2\"]" }}{{ range service "webapp" }}{{ if .Tags | containsNotAll $excludingTags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "es-v1"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"prod", "hybrid", "es-v1", "es-v2"},
+						},
+					})
+					return b
+				}(),
+			},
+			"1.2.3.4",
+			false,
+		},
+		{
+			"helper_containsNotAll__empty",
+			&NewTemplateInput{
+				Contents: `{{ $excludingTags := parseJSON "[]" }}{{ range service "webapp" }}{{ if .Tags | containsNotAll $excludingTags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "es-v1"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"prod", "hybrid", "es-v1", "es-v2"},
+						},
+					})
+					return b
+				}(),
+			},
+			"",
+			false,
+		},
+		{
+			"helper_env",
+			&NewTemplateInput{
+				Contents: `{{ env "CT_TEST" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					// Cheat and use the brain callback here to set the env.
+					if err := os.Setenv("CT_TEST", "1"); err != nil {
+						t.Fatal(err)
+					}
+					return NewBrain()
+				}(),
+			},
+			"1",
+			false,
+		},
+		{
+			"helper_mustEnv",
+			&NewTemplateInput{
+				Contents: `{{ mustEnv "CT_TEST" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					// Cheat and use the brain callback here to set the env.
+					if err := os.Setenv("CT_TEST", "1"); err != nil {
+						t.Fatal(err)
+					}
+					return NewBrain()
+				}(),
+			},
+			"1",
+			false,
+		},
+		{
+			"helper_required",
+			&NewTemplateInput{
+				Contents: `{{ key "key" | required "key must be set" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVGetQuery("key")
+					if err != nil {
+						t.Fatal(err)
+					}
+					d.EnableBlocking()
+					b.Remember(d, "5")
+					return b
+				}(),
+			},
+			"5",
+			false,
+		},
+		{
+			"helper_required_empty",
+			&NewTemplateInput{
+				Contents: `{{ key "key" | required "key must be set" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVGetQuery("key")
+					if err != nil {
+						t.Fatal(err)
+					}
+					d.EnableBlocking()
+					b.Remember(d, "")
+					return b
+				}(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_required_missing_dependency",
+			&NewTemplateInput{
+				Contents: `{{ key "key" | required "key must be set" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			false,
+		},
+		{
+			"helper_mustEnv_negative",
+			&NewTemplateInput{
+				Contents: `{{ mustEnv "CT_TEST_NONEXISTENT" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_env__override",
+			&NewTemplateInput{
+				Contents: `{{ env "CT_TEST" }}`,
+			},
+			&ExecuteInput{
+				Env: []string{
+					"CT_TEST=2",
+				},
+				Brain: NewBrain(),
+			},
+			"2",
+			false,
+		},
+		{
+			"helper_executeTemplate",
+			&NewTemplateInput{
+				Contents: `{{ define "custom" }}{{ key "foo" }}{{ end }}{{ executeTemplate "custom" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVGetQuery("foo")
+					if err != nil {
+						t.Fatal(err)
+					}
+					d.EnableBlocking()
+					b.Remember(d, "bar")
+					return b
+				}(),
+			},
+			"bar",
+			false,
+		},
+		{
+			"helper_executeTemplate__dot",
+			&NewTemplateInput{
+				Contents: `{{ define "custom" }}{{ key . }}{{ end }}{{ executeTemplate "custom" "foo" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVGetQuery("foo")
+					if err != nil {
+						t.Fatal(err)
+					}
+					d.EnableBlocking()
+					b.Remember(d, "bar")
+					return b
+				}(),
+			},
+			"bar",
+			false,
+		},
+		{
+			"helper_mergeMap",
+			&NewTemplateInput{
+				Contents: `{{ $base := "{\"voo\":{\"bar\":\"v\"}}" | parseJSON}}{{ $role := tree "list" | explode | mergeMap $base}}{{ range $k, $v := $role }}{{ $k }}{{ $v }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVListQuery("list")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.KeyPair{
+						{Key: "", Value: ""},
+						{Key: "foo/bar", Value: "a"},
+						{Key: "zip/zap", Value: "b"},
+					})
+					return b
+				}(),
+			},
+			"foomap[bar:a]voomap[bar:v]zipmap[zap:b]",
+			false,
+		},
+		{
+			"helper_mergeMapWithOverride",
+			&NewTemplateInput{
+				Contents: `{{ $base := "{\"zip\":{\"zap\":\"t\"},\"voo\":{\"bar\":\"v\"}}" | parseJSON}}{{ $role := tree "list" | explode | mergeMapWithOverride $base}}{{ range $k, $v := $role }}{{ $k }}{{ $v }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVListQuery("list")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.KeyPair{
+						{Key: "", Value: ""},
+						{Key: "foo/bar", Value: "a"},
+						{Key: "zip/zap", Value: "b"},
+					})
+					return b
+				}(),
+			},
+			"foomap[bar:a]voomap[bar:v]zipmap[zap:b]",
+			false,
+		},
+		{
+			"helper_mergeAppend",
+			&NewTemplateInput{
+				Contents: `{{ $base := "{\"hosts\":[\"a\"],\"opts\":{\"tags\":[\"x\"],\"port\":1}}" | parseJSON }}{{ $extra := "{\"hosts\":[\"b\"],\"opts\":{\"tags\":[\"y\"],\"port\":2}}" | parseJSON }}{{ $m := mergeAppend $base $extra }}{{ $m.hosts }} {{ $m.opts.tags }} {{ $m.opts.port }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"[a b] [x y] 2",
+			false,
+		},
+		{
+			"helper_explode",
+			&NewTemplateInput{
+				Contents: `{{ range $k, $v := tree "list" | explode }}{{ $k }}{{ $v }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVListQuery("list")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.KeyPair{
+						{Key: "", Value: ""},
+						{Key: "foo/bar", Value: "a"},
+						{Key: "zip/zap", Value: "b"},
+					})
+					return b
+				}(),
+			},
+			"foomap[bar:a]zipmap[zap:b]",
+			false,
+		},
+		{
+			"helper_explodemap",
+			&NewTemplateInput{
+				Contents: `{{ scratch.MapSet "explode-test" "foo/bar" "a"}}{{ scratch.MapSet "explode-test" "qux" "c"}}{{ scratch.MapSet "explode-test" "zip/zap" "d"}}{{ scratch.Get "explode-test" | explodeMap }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"map[foo:map[bar:a] qux:c zip:map[zap:d]]",
+			false,
+		},
+		{
+			"helper_in",
+			&NewTemplateInput{
+				Contents: `{{ range service "webapp" }}{{ if "prod" | in .Tags }}{{ .Address }}{{ end }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewHealthServiceQuery("webapp")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, []*dep.HealthService{
+						{
+							Address: "1.2.3.4",
+							Tags:    []string{"prod", "staging"},
+						},
+						{
+							Address: "5.6.7.8",
+							Tags:    []string{"staging"},
+						},
+					})
+					return b
+				}(),
+			},
+			"1.2.3.4",
+			false,
+		},
+		{
+			"helper_indent",
+			&NewTemplateInput{
+				Contents: `{{ "hello\nhello\r\nHELLO\r\nhello\nHELLO" | indent 4 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"    hello\n    hello\r\n    HELLO\r\n    hello\n    HELLO",
+			false,
+		},
+		{
+			"helper_indent_negative",
+			&NewTemplateInput{
+				Contents: `{{ "hello\nhello\r\nHELLO\r\nhello\nHELLO" | indent -4 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"    hello\n    hello\r\n    HELLO\r\n    hello\n    HELLO",
+			true,
+		},
+		{
+			"helper_indent_zero",
+			&NewTemplateInput{
+				Contents: `{{ "hello\nhello\r\nHELLO\r\nhello\nHELLO" | indent 0 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"hello\nhello\r\nHELLO\r\nhello\nHELLO",
+			false,
+		},
+		{
+			"helper_nindent",
+			&NewTemplateInput{
+				Contents: `cert:{{ "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n" | nindent 2 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"cert:\n  -----BEGIN CERTIFICATE-----\n  MIIB\n  -----END CERTIFICATE-----\n",
+			false,
+		},
+		{
+			"helper_nindent_negative",
+			&NewTemplateInput{
+				Contents: `{{ "hello" | nindent -2 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_bullet_list_empty",
+			&NewTemplateInput{
+				Contents: `{{ split "," "" | bulletList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			false,
+		},
+		{
+			"helper_bullet_list_nil",
+			&NewTemplateInput{
+				Contents: `{{ bulletList nil }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			false,
+		},
+		{
+			"helper_bullet_list_single",
+			&NewTemplateInput{
+				Contents: `{{ split "," "web" | bulletList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"- web",
+			false,
+		},
+		{
+			"helper_bullet_list_multi",
+			&NewTemplateInput{
+				Contents: `{{ split "," "web,api,db" | bulletList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"- web\n- api\n- db",
+			false,
+		},
+		{
+			"helper_bullet_list_multiline",
+			&NewTemplateInput{
+				Contents: `{{ split "," "web\nprimary,db" | bulletList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"- web\n  primary\n- db",
+			false,
+		},
+		{
+			"helper_numbered_list_empty",
+			&NewTemplateInput{
+				Contents: `{{ split "," "" | numberedList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			false,
+		},
+		{
+			"helper_numbered_list_single",
+			&NewTemplateInput{
+				Contents: `{{ split "," "web" | numberedList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"1. web",
+			false,
+		},
+		{
+			"helper_numbered_list_multi",
+			&NewTemplateInput{
+				Contents: `{{ split "," "web,api,db" | numberedList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"1. web\n2. api\n3. db",
+			false,
+		},
+		{
+			"helper_numbered_list_not_slice",
+			&NewTemplateInput{
+				Contents: `{{ "web" | numberedList }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_compact_mixed",
+			&NewTemplateInput{
+				Contents: `{{ split "," "web,,api,,db" | compact | join "|" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"web|api|db",
+			false,
+		},
+		{
+			"helper_compact_all_empty",
+			&NewTemplateInput{
+				Contents: `{{ split "," ",," | compact | len }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"0",
+			false,
+		},
+		{
+			"helper_compact_not_slice",
+			&NewTemplateInput{
+				Contents: `{{ "web" | compact }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_trim_each",
+			&NewTemplateInput{
+				Contents: `{{ split "," " web , api,db " | trimEach | join "|" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
 			},
-			"foomap[bar:a]voomap[bar:v]zipmap[zap:b]",
+			"web|api|db",
 			false,
 		},
 		{
-			"helper_explode",
+			"helper_trim_each_compact",
 			&NewTemplateInput{
-				Contents: `{{ range $k, $v := tree "list" | explode }}{{ $k }}{{ $v }}{{ end }}`,
+				Contents: `{{ split "," "web,  ,\t,db" | trimEach | compact | join "|" }}`,
 			},
 			&ExecuteInput{
-				Brain: func() *Brain {
-					b := NewBrain()
-					d, err := dep.NewKVListQuery("list")
-					if err != nil {
-						t.Fatal(err)
-					}
-					b.Remember(d, []*dep.KeyPair{
-						{Key: "", Value: ""},
-						{Key: "foo/bar", Value: "a"},
-						{Key: "zip/zap", Value: "b"},
-					})
-					return b
-				}(),
+				Brain: NewBrain(),
 			},
-			"foomap[bar:a]zipmap[zap:b]",
+			"web|db",
 			false,
 		},
 		{
-			"helper_explodemap",
+			"helper_glob",
 			&NewTemplateInput{
-				Contents: `{{ scratch.MapSet "explode-test" "foo/bar" "a"}}{{ scratch.MapSet "explode-test" "qux" "c"}}{{ scratch.MapSet "explode-test" "zip/zap" "d"}}{{ scratch.Get "explode-test" | explodeMap }}`,
+				Contents: `{{ glob "web-*" "web-1" }} {{ glob "web-?" "web-10" }} {{ range ("web-1,web-10,api-1,web-2" | split "," | globFilter "web-[0-9]") }}{{ . }},{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"map[foo:map[bar:a] qux:c zip:map[zap:d]]",
+			"true false web-1,web-2,",
 			false,
 		},
 		{
-			"helper_in",
+			"helper_keys_matching",
 			&NewTemplateInput{
-				Contents: `{{ range service "webapp" }}{{ if "prod" | in .Tags }}{{ .Address }}{{ end }}{{ end }}`,
+				Contents: `{{ $m := parseJSON "{\"db_user\":\"app\",\"db_pass\":\"x\",\"api\":\"y\"}" }}{{ keysMatching "db_*" $m }} {{ range $k, $v := pickMatching "db_*" $m }}{{ $k }}={{ $v }},{{ end }}`,
 			},
 			&ExecuteInput{
-				Brain: func() *Brain {
-					b := NewBrain()
-					d, err := dep.NewHealthServiceQuery("webapp")
-					if err != nil {
-						t.Fatal(err)
-					}
-					b.Remember(d, []*dep.HealthService{
-						{
-							Address: "1.2.3.4",
-							Tags:    []string{"prod", "staging"},
-						},
-						{
-							Address: "5.6.7.8",
-							Tags:    []string{"staging"},
-						},
-					})
-					return b
-				}(),
+				Brain: NewBrain(),
 			},
-			"1.2.3.4",
+			"[db_pass db_user] db_pass=x,db_user=app,",
 			false,
 		},
 		{
-			"helper_indent",
+			"helper_glob_invalid",
 			&NewTemplateInput{
-				Contents: `{{ "hello\nhello\r\nHELLO\r\nhello\nHELLO" | indent 4 }}`,
+				Contents: `{{ glob "web-[" "web-1" }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"    hello\n    hello\r\n    HELLO\r\n    hello\n    HELLO",
-			false,
+			"",
+			true,
 		},
 		{
-			"helper_indent_negative",
+			"helper_escape_template",
 			&NewTemplateInput{
-				Contents: `{{ "hello\nhello\r\nHELLO\r\nhello\nHELLO" | indent -4 }}`,
+				Contents: `{{ "{{ .A }}" | escapeTemplate }} {{ "{{ .A }}" | escapeTemplate "html" }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"    hello\n    hello\r\n    HELLO\r\n    hello\n    HELLO",
-			true,
+			`{{"{{"}} .A {{"}}"}} &#123;&#123; .A &#125;&#125;`,
+			false,
 		},
 		{
-			"helper_indent_zero",
+			"helper_unescape_template",
 			&NewTemplateInput{
-				Contents: `{{ "hello\nhello\r\nHELLO\r\nhello\nHELLO" | indent 0 }}`,
+				Contents: `{{ "&#123;&#123; .A &#125;&#125;" | unescapeTemplate "html" }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"hello\nhello\r\nHELLO\r\nhello\nHELLO",
+			"{{ .A }}",
 			false,
 		},
 		{
@@ -1610,6 +2553,28 @@ func TestTemplate_Execute(t *testing.T) {
 			"map[foo:bar]",
 			false,
 		},
+		{
+			"helper_parseJSON_repeated",
+			&NewTemplateInput{
+				Contents: `{{ ("{\"foo\": \"bar\"}" | parseJSON).foo }} {{ ("{\"foo\": \"bar\"}" | parseJSON).foo }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"bar bar",
+			false,
+		},
+		{
+			"helper_parseJSON_repeated_modified",
+			&NewTemplateInput{
+				Contents: `{{ $a := "{\"x\": 1}" | parseJSON }}{{ $_ := sprig_set $a "y" 2 }}{{ len $a }} {{ len ("{\"x\": 1}" | parseJSON) }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"2 1",
+			false,
+		},
 		{
 			"helper_parseUint",
 			&NewTemplateInput{
@@ -1632,6 +2597,116 @@ func TestTemplate_Execute(t *testing.T) {
 			"map[foo:bar]",
 			false,
 		},
+		{
+			"helper_dict_list_merge",
+			&NewTemplateInput{
+				Contents: `{{ $base := dict "name" "web" "tls" (dict "enabled" false "port" 443) }}{{ $extra := "{\"tls\":{\"enabled\":true},\"hosts\":[\"a\"]}" | parseJSON }}{{ merge $base $extra (dict "ports" (list 80 443)) | toJSON }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			`{"hosts":["a"],"name":"web","ports":[80,443],"tls":{"enabled":true,"port":443}}`,
+			false,
+		},
+		{
+			"helper_dict_odd",
+			&NewTemplateInput{
+				Contents: `{{ dict "a" 1 "b" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_sort",
+			&NewTemplateInput{
+				Contents: `{{ range list "web" "api" "db" | sort }}{{ . }} {{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"api db web ",
+			false,
+		},
+		{
+			"helper_sortBy",
+			&NewTemplateInput{
+				Contents: `{{ range sortBy "port" (list (dict "name" "a" "port" 10) (dict "name" "b" "port" 9) (dict "name" "c" "port" 100)) }}{{ .name }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"bac",
+			false,
+		},
+		{
+			"helper_uniq",
+			&NewTemplateInput{
+				Contents: `{{ range list "b" "a" "b" "c" "a" | uniq }}{{ . }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"bac",
+			false,
+		},
+		{
+			"helper_keys_values",
+			&NewTemplateInput{
+				Contents: `{{ $m := dict "web" 80 "api" 8080 }}{{ keys $m | join "," }} {{ range values $m }}{{ . }} {{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"api,web 8080 80 ",
+			false,
+		},
+		{
+			"helper_coalesce",
+			&NewTemplateInput{
+				Contents: `{{ coalesce (env "CT_UNSET_VAR") "" "default" }} {{ coalesce "" nil }} {{ coalesce "" 0 8080 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"default <no value> 0",
+			false,
+		},
+		{
+			"helper_ternary",
+			&NewTemplateInput{
+				Contents: `{{ ternary "on" "off" true }} {{ eq 1 2 | ternary "on" "off" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"on off",
+			false,
+		},
+		{
+			"helper_parseTOML",
+			&NewTemplateInput{
+				Contents: "{{ with $d := \"[server]\\nport = 8080\\n\\n[[backends]]\\nname = \\\"a\\\"\\n\\n[[backends]]\\nname = \\\"b\\\"\" | parseTOML }}{{ $d.server.port }}{{ range $d.backends }} {{ .name }}{{ end }}{{ end }}",
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"8080 a b",
+			false,
+		},
+		{
+			"helper_csvToMaps",
+			&NewTemplateInput{
+				Contents: "{{ range \"name,port\\nweb,80\\napi,8080\" | csvToMaps }}{{ .name }}:{{ .port }};{{ end }}",
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"web:80;api:8080;",
+			false,
+		},
 		{
 			"helper_parseYAMLv2",
 			&NewTemplateInput{
@@ -1666,104 +2741,217 @@ func TestTemplate_Execute(t *testing.T) {
 			false,
 		},
 		{
-			"helper_plugin_disabled",
+			"helper_plugin_disabled",
+			&NewTemplateInput{
+				Contents:         `{{ "1" | plugin "echo" }}`,
+				FunctionDenylist: []string{"plugin"},
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_plugin_timeout",
+			&NewTemplateInput{
+				Contents:      `{{ plugin "sleep" "10" }}`,
+				PluginTimeout: 100 * time.Millisecond,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_plugin_max_output",
+			&NewTemplateInput{
+				Contents:        `{{ plugin "yes" }}`,
+				PluginMaxOutput: 1024,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"sprig_reverse_disabled",
+			&NewTemplateInput{
+				Contents:         `{{ "abcde" | sprig_reverse }}`,
+				FunctionDenylist: []string{"sprig_*"},
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"helper_regexMatch",
+			&NewTemplateInput{
+				Contents: `{{ "foo" | regexMatch "[a-z]+" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"true",
+			false,
+		},
+		{
+			"helper_regexReplaceAll",
+			&NewTemplateInput{
+				Contents: `{{ "foo" | regexReplaceAll "\\w" "x" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"xxx",
+			false,
+		},
+		{
+			"helper_regexFindSubmatch",
+			&NewTemplateInput{
+				Contents: `{{ $m := "consul v1.16.2" | regexFindSubmatch "v(\\d+)\\.(\\d+)" }}{{ index $m 1 }}.{{ index $m 2 }} {{ len ("consul" | regexFindSubmatch "v(\\d+)") }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"1.16 0",
+			false,
+		},
+		{
+			"helper_regexFindNamed",
+			&NewTemplateInput{
+				Contents: `{{ with "web-03" | regexFindNamed "(?P<role>[a-z]+)-(?P<index>\\d+)" }}{{ .role }} {{ .index }}{{ end }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"web 03",
+			false,
+		},
+		{
+			"helper_replaceAll",
+			&NewTemplateInput{
+				Contents: `{{ "hello my hello" | regexReplaceAll "hello" "bye" }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"bye my bye",
+			false,
+		},
+		{
+			"helper_split",
+			&NewTemplateInput{
+				Contents: `{{ "a,b,c" | split "," }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"[a b c]",
+			false,
+		},
+		{
+			"helper_splitN",
 			&NewTemplateInput{
-				Contents:         `{{ "1" | plugin "echo" }}`,
-				FunctionDenylist: []string{"plugin"},
+				Contents: `{{ "a=b=c" | splitN "=" 2 }}:{{ "abc" | splitN "=" 2 }}:{{ "a=b=c" | splitN "=" -1 }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"",
-			true,
+			"[a b=c]:[abc]:[a b c]",
+			false,
 		},
 		{
-			"sprig_reverse_disabled",
+			"helper_cut",
 			&NewTemplateInput{
-				Contents:         `{{ "abcde" | sprig_reverse }}`,
-				FunctionDenylist: []string{"sprig_*"},
+				Contents: `{{ with "host:8080:x" | cut ":" }}{{ .Before }},{{ .After }},{{ .Found }}{{ end }}` +
+					`|{{ with "host" | cut ":" }}{{ .Before }},{{ .After }},{{ .Found }}{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"",
-			true,
+			"host,8080:x,true|host,,false",
+			false,
 		},
 		{
-			"helper_regexMatch",
+			"helper_splitToMap",
 			&NewTemplateInput{
-				Contents: `{{ "foo" | regexMatch "[a-z]+" }}`,
+				Contents: `{{ "a:x,b:y,c:z" | splitToMap "," ":" }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"true",
+			"map[a:x b:y c:z]",
 			false,
 		},
 		{
-			"helper_regexReplaceAll",
+			"helper_sha256sum",
 			&NewTemplateInput{
-				Contents: `{{ "foo" | regexReplaceAll "\\w" "x" }}`,
+				Contents: `{{ "bladibla" | sha256sum }} {{ "bladibla" | sha1sum }} {{ "abc" | md5sum }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"xxx",
+			"54cf4c66bcabb5c20e25331c01dd600b73369e97a947861bd8d3a0e0b8b3d70b 3808b1fa21190f2062ff086507add3f01d63c4e9 900150983cd24fb0d6963f7d28e17f72",
 			false,
 		},
 		{
-			"helper_replaceAll",
+			"helper_sha256sum_nil",
 			&NewTemplateInput{
-				Contents: `{{ "hello my hello" | regexReplaceAll "hello" "bye" }}`,
+				Contents: `{{ sha256sum nil }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"bye my bye",
-			false,
+			"",
+			true,
 		},
 		{
-			"helper_split",
+			"helper_timestamp",
 			&NewTemplateInput{
-				Contents: `{{ "a,b,c" | split "," }}`,
+				Contents: `{{ timestamp }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"[a b c]",
+			"1970-01-01T00:00:00Z",
 			false,
 		},
 		{
-			"helper_splitToMap",
+			"helper_helper_timestamp__formatted",
 			&NewTemplateInput{
-				Contents: `{{ "a:x,b:y,c:z" | splitToMap "," ":" }}`,
+				Contents: `{{ timestamp "2006-01-02" }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"map[a:x b:y c:z]",
+			"1970-01-01",
 			false,
 		},
 		{
-			"helper_timestamp",
+			"helper_now",
 			&NewTemplateInput{
-				Contents: `{{ timestamp }}`,
+				Contents: `{{ (now).Format "2006-01-02" }} {{ now | sprig_unixEpoch }} {{ now | sprig_mustDateModify "1h" | sprig_unixEpoch }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"1970-01-01T00:00:00Z",
+			"1970-01-01 0 3600",
 			false,
 		},
 		{
-			"helper_helper_timestamp__formatted",
+			"helper_numCPU",
 			&NewTemplateInput{
-				Contents: `{{ timestamp "2006-01-02" }}`,
+				Contents: `{{ if gt numCPU 0 }}ok{{ end }}`,
 			},
 			&ExecuteInput{
 				Brain: NewBrain(),
 			},
-			"1970-01-01",
+			"ok",
 			false,
 		},
 		{
@@ -1958,6 +3146,70 @@ func TestTemplate_Execute(t *testing.T) {
 			"1",
 			false,
 		},
+		{
+			"math_aliases",
+			&NewTemplateInput{
+				Contents: `{{ 7 | sub 2 }} {{ 7 | mul 2 }} {{ 7 | div 2 }} {{ 7 | mod 2 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"5 14 3 1",
+			false,
+		},
+		{
+			"math_float",
+			&NewTemplateInput{
+				Contents: `{{ 7 | div 2.0 }} {{ 7.5 | mod 2 }} {{ 1.5 | add 1 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"3.5 1.5 2.5",
+			false,
+		},
+		{
+			"math_strings",
+			&NewTemplateInput{
+				Contents: `{{ key "workers" | mul 2 }} {{ "0.5" | add 1 }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewKVGetQuery("workers")
+					if err != nil {
+						t.Fatal(err)
+					}
+					d.EnableBlocking()
+					b.Remember(d, "4")
+					return b
+				}(),
+			},
+			"8 1.5",
+			false,
+		},
+		{
+			"math_divide_by_zero",
+			&NewTemplateInput{
+				Contents: `{{ 2 | div 0 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
+		{
+			"math_modulo_by_zero",
+			&NewTemplateInput{
+				Contents: `{{ 2 | mod 0.0 }}`,
+			},
+			&ExecuteInput{
+				Brain: NewBrain(),
+			},
+			"",
+			true,
+		},
 		{
 			"math_minimum",
 			&NewTemplateInput{
@@ -2166,6 +3418,27 @@ func TestTemplate_Execute(t *testing.T) {
 			"true false",
 			false,
 		},
+		{
+			"func_nomadVarOrDefault",
+			&NewTemplateInput{
+				Contents: `{{ nomadVarOrDefault "path" "k1" "d1" }} {{ nomadVarOrDefault "path" "k3" "d3" }} {{ nomadVarOrDefault "no_path" "k1" "d1" }}`,
+			},
+			&ExecuteInput{
+				Brain: func() *Brain {
+					b := NewBrain()
+					d, err := dep.NewNVGetQuery("", "path")
+					if err != nil {
+						t.Fatal(err)
+					}
+					b.Remember(d, &dep.NomadVarItems{
+						"k1": dep.NomadVarItem{Key: "k1", Value: "v1"},
+					})
+					return b
+				}(),
+			},
+			"v1 d3 d1",
+			false,
+		},
 		{
 			"func_nomadVariables",
 			&NewTemplateInput{
@@ -2437,6 +3710,121 @@ func TestTemplate_error_secret_leak_SV(t *testing.T) {
 	require.ErrorContains(t, err, "[redacted]")
 }
 
+func TestTemplate_error_secret_field_leak(t *testing.T) {
+	tmplinput := &NewTemplateInput{
+		Contents: `{{ secret "secret/foo?field=password" | parseInt }}`,
+	}
+	execinput := &ExecuteInput{
+		Brain: func() *Brain {
+			b := NewBrain()
+			d, err := dep.NewVaultReadQuery("secret/foo?field=password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Remember(d, "s3cr3t")
+			return b
+		}(),
+	}
+
+	tpl, err := NewTemplate(tmplinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(execinput)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "s3cr3t")
+	require.ErrorContains(t, err, "[redacted]")
+}
+
+func TestTemplate_error_secret_multi_leak(t *testing.T) {
+	tmplinput := &NewTemplateInput{
+		Contents: `{{ with secretMulti "secret/foo" "secret/bar" }}{{ (index .Secrets "secret/bar").Data.password | parseInt }}{{ end }}`,
+	}
+	execinput := &ExecuteInput{
+		Brain: func() *Brain {
+			b := NewBrain()
+			d, err := dep.NewVaultReadMultiQuery([]string{"secret/foo", "secret/bar"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Remember(d, &dep.VaultReadMultiResult{
+				Secrets: map[string]*dep.Secret{
+					"secret/foo": {Data: map[string]interface{}{"password": "f00"}},
+					"secret/bar": {Data: map[string]interface{}{"password": "s3cr3t"}},
+				},
+				Errors: map[string]string{"secret/baz": "permission denied"},
+			})
+			return b
+		}(),
+	}
+
+	tpl, err := NewTemplate(tmplinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(execinput)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "s3cr3t")
+	require.ErrorContains(t, err, "[redacted]")
+}
+
+func TestTemplate_error_secret_versions_leak(t *testing.T) {
+	tmplinput := &NewTemplateInput{
+		Contents: `{{ range secretVersions "secret/foo" }}{{ .Data.password | parseInt }}{{ end }}`,
+	}
+	execinput := &ExecuteInput{
+		Brain: func() *Brain {
+			b := NewBrain()
+			d, err := dep.NewVaultAllVersionsQuery("secret/foo", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Remember(d, []*dep.VaultSecretVersion{
+				{Version: 2, Data: map[string]interface{}{"password": "s3cr3t"}},
+				{Version: 1, Deleted: true},
+			})
+			return b
+		}(),
+	}
+
+	tpl, err := NewTemplate(tmplinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(execinput)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "s3cr3t")
+	require.ErrorContains(t, err, "[redacted]")
+}
+
+func TestTemplate_error_vault_request_leak(t *testing.T) {
+	tmplinput := &NewTemplateInput{
+		Contents: `{{ with vaultRequest "GET" "secret/data/foo" }}{{ .data.password | parseInt }}{{ end }}`,
+	}
+	execinput := &ExecuteInput{
+		Brain: func() *Brain {
+			b := NewBrain()
+			d, err := dep.NewVaultRequestQuery("GET", "secret/data/foo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.Remember(d, map[string]interface{}{
+				"data": map[string]interface{}{"password": "s3cr3t"},
+			})
+			return b
+		}(),
+	}
+
+	tpl, err := NewTemplate(tmplinput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tpl.Execute(execinput)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "s3cr3t")
+	require.ErrorContains(t, err, "[redacted]")
+}
+
 func Test_writeToFile(t *testing.T) {
 	// Use current user and its primary group for input
 	currentUser, err := user.Current()
@@ -2650,6 +4038,100 @@ func Test_writeToFile(t *testing.T) {
 	}
 }
 
+func Test_writeToFile_sandbox(t *testing.T) {
+	sandbox := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(sandbox, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"inside", filepath.Join(sandbox, "ca.pem"), false},
+		{"inside_new_dir", filepath.Join(sandbox, "certs", "ca.pem"), false},
+		{"parent_escape", filepath.Join(sandbox, "..", filepath.Base(outside), "ca.pem"), true},
+		{"outside", filepath.Join(outside, "ca.pem"), true},
+		{"symlink_escape", filepath.Join(sandbox, "link", "ca.pem"), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tpl, err := NewTemplate(&NewTemplateInput{
+				Contents:    fmt.Sprintf(`{{ "bundle" | writeToFile %q "" "" "0600" }}`, tc.path),
+				SandboxPath: sandbox,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = tpl.Execute(nil)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "outside of sandbox") {
+					t.Fatalf("expected sandbox error, got %v", err)
+				}
+				if _, err := os.Stat(filepath.Join(outside, "ca.pem")); !os.IsNotExist(err) {
+					t.Fatalf("expected no file outside of the sandbox, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "bundle" {
+				t.Errorf("writeToFile() got = %q, want %q", b, "bundle")
+			}
+			sts, err := os.Stat(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sts.Mode() != 0o600 {
+				t.Errorf("writeToFile() wrong permissions got = %v, want 0600", sts.Mode())
+			}
+		})
+	}
+}
+
+func Test_writeToFile_atomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, []byte("before"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writeToFile(path, "", "", "0640", "after"); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(before, after) {
+		t.Error("writeToFile() wrote in place, expected the file to be replaced")
+	}
+	if after.Mode() != 0o640 {
+		t.Errorf("writeToFile() wrong permissions got = %v, want 0640", after.Mode())
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "after" {
+		t.Errorf("writeToFile() got = %q, want %q", b, "after")
+	}
+}
+
 const testCert = `
 -----BEGIN CERTIFICATE-----
 MIIDWTCCAkGgAwIBAgIUUARA+vQExU8zjdsX/YXMMu1K5FkwDQYJKoZIhvcNAQEL
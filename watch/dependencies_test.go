@@ -37,6 +37,17 @@ func (d *TestDep) Type() dep.Type {
 	return dep.TypeLocal
 }
 
+// TestDepType is a TestDep which reports the given type, to test behavior
+// which depends on the upstream of a dependency.
+type TestDepType struct {
+	TestDep
+	typ dep.Type
+}
+
+func (d *TestDepType) Type() dep.Type {
+	return d.typ
+}
+
 // TestDepStale is a special dependency that can be used to test what happens when
 // stale data is permitted.
 type TestDepStale struct {
@@ -174,3 +185,58 @@ func (d *TestDepBlock) Fetch(clients *dep.ClientSet, opts *dep.QueryOptions) (in
 func (d *TestDepBlock) String() string {
 	return "test_dep_block"
 }
+
+// TestDepDebug is a dependency that asks for verbose logging
+type TestDepDebug struct {
+	TestDep
+}
+
+func (d *TestDepDebug) Debug() bool {
+	return true
+}
+
+// TestDepRefresh is a dependency that answers non-blocking queries right away
+// and blocks on blocking queries until it is stopped, so it is only fetched
+// again once its view is refreshed.
+type TestDepRefresh struct {
+	sync.Mutex
+	fetches int
+	stopCh  chan struct{}
+}
+
+func (d *TestDepRefresh) Fetch(clients *dep.ClientSet, opts *dep.QueryOptions) (interface{}, *dep.ResponseMetadata, error) {
+	d.Lock()
+	d.fetches++
+	count := d.fetches
+	d.Unlock()
+
+	if opts.WaitIndex != 0 {
+		<-d.stopCh
+		return nil, nil, dep.ErrStopped
+	}
+
+	data := fmt.Sprintf("fetch %d", count)
+	return data, &dep.ResponseMetadata{LastIndex: uint64(count)}, nil
+}
+
+func (d *TestDepRefresh) Fetches() int {
+	d.Lock()
+	defer d.Unlock()
+	return d.fetches
+}
+
+func (d *TestDepRefresh) CanShare() bool {
+	return true
+}
+
+func (d *TestDepRefresh) String() string {
+	return "test_dep_refresh"
+}
+
+func (d *TestDepRefresh) Stop() {
+	close(d.stopCh)
+}
+
+func (d *TestDepRefresh) Type() dep.Type {
+	return dep.TypeLocal
+}
@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package watch
+
+import (
+	"context"
+
+	dep "github.com/hashicorp/consul-template/dependency"
+)
+
+// RateLimiter paces the fetches of the dependencies which share it. It is
+// implemented by *rate.Limiter.
+type RateLimiter interface {
+	// Wait blocks until a fetch is allowed, or returns an error when the
+	// context is canceled first.
+	Wait(ctx context.Context) error
+}
+
+// RateLimitClass is a class of dependencies which share a rate limit.
+type RateLimitClass string
+
+const (
+	RateLimitCatalog RateLimitClass = "catalog"
+	RateLimitHealth  RateLimitClass = "health"
+	RateLimitKV      RateLimitClass = "kv"
+	RateLimitVault   RateLimitClass = "vault"
+)
+
+// rateLimitClass returns the class of the given dependency, or an empty class
+// if it is not rate limited.
+func rateLimitClass(d dep.Dependency) RateLimitClass {
+	switch d.(type) {
+	case *dep.AgentSelfQuery, *dep.CatalogDatacentersQuery,
+		*dep.CatalogNodeQuery, *dep.CatalogNodesQuery,
+		*dep.CatalogServiceQuery, *dep.CatalogServicesQuery,
+		*dep.NomadServiceQuery, *dep.NomadServicesQuery:
+		return RateLimitCatalog
+	case *dep.AutopilotHealthQuery, *dep.HealthServiceQuery,
+		*dep.HealthPreparedQuery:
+		return RateLimitHealth
+	case *dep.KVExistsQuery, *dep.KVGetQuery, *dep.KVKeysQuery,
+		*dep.KVListQuery, *dep.KVLockQuery, *dep.KVTreeChecksumQuery,
+		*dep.NVGetQuery, *dep.NVListQuery:
+		return RateLimitKV
+	}
+
+	if d.Type() == dep.TypeVault {
+		return RateLimitVault
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package watch
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dep "github.com/hashicorp/consul-template/dependency"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitClass(t *testing.T) {
+	must := func(d dep.Dependency, err error) dep.Dependency {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	// Every dependency type is listed, so a new one is not left out of its
+	// class by accident.
+	cases := []struct {
+		name string
+		d    dep.Dependency
+		exp  RateLimitClass
+	}{
+		{"agent_self", must(dep.NewAgentSelfQuery(time.Minute)), RateLimitCatalog},
+		{"catalog_datacenters", must(dep.NewCatalogDatacentersQuery(false)), RateLimitCatalog},
+		{"catalog_node", must(dep.NewCatalogNodeQuery("")), RateLimitCatalog},
+		{"catalog_nodes", must(dep.NewCatalogNodesQuery("")), RateLimitCatalog},
+		{"catalog_service", must(dep.NewCatalogServiceQuery("web")), RateLimitCatalog},
+		{"catalog_services", must(dep.NewCatalogServicesQuery("")), RateLimitCatalog},
+		{"nomad_service", must(dep.NewNomadServiceQuery("web")), RateLimitCatalog},
+		{"nomad_services", must(dep.NewNomadServicesQuery("")), RateLimitCatalog},
+		{"autopilot_health", must(dep.NewAutopilotHealthQuery()), RateLimitHealth},
+		{"health_prepared", must(dep.NewHealthPreparedQuery("web")), RateLimitHealth},
+		{"health_service", must(dep.NewHealthServiceQuery("web")), RateLimitHealth},
+		{"kv_checksum", must(dep.NewKVTreeChecksumQuery("foo")), RateLimitKV},
+		{"kv_exists", must(dep.NewKVExistsQuery("foo")), RateLimitKV},
+		{"kv_get", must(dep.NewKVGetQuery("foo")), RateLimitKV},
+		{"kv_keys", must(dep.NewKVKeysQuery("foo")), RateLimitKV},
+		{"kv_list", must(dep.NewKVListQuery("foo")), RateLimitKV},
+		{"kv_lock", must(dep.NewKVLockQuery("foo")), RateLimitKV},
+		{"nomad_var_get", must(dep.NewNVGetQuery("", "foo")), RateLimitKV},
+		{"nomad_var_list", must(dep.NewNVListQuery("", "foo")), RateLimitKV},
+		{"vault_agent_token", must(dep.NewVaultAgentTokenQuery("/tmp/token")), RateLimitVault},
+		{"vault_audit_devices", must(dep.NewVaultAuditDevicesQuery()), RateLimitVault},
+		{"vault_entity_alias", must(dep.NewVaultEntityAliasQuery("auth_userpass", "foo")), RateLimitVault},
+		{"vault_host_info", must(dep.NewVaultHostInfoQuery()), RateLimitVault},
+		{"vault_key_status", must(dep.NewVaultKeyStatusQuery()), RateLimitVault},
+		{"vault_leader", must(dep.NewVaultLeaderQuery()), RateLimitVault},
+		{"vault_list", must(dep.NewVaultListQuery("secret/foo")), RateLimitVault},
+		{"vault_metadata", must(dep.NewVaultMetadataWatchQuery("secret/foo")), RateLimitVault},
+		{"vault_pki", must(dep.NewVaultPKIQuery("pki/issue/foo", "/tmp/cert", nil)), RateLimitVault},
+		{"vault_read", must(dep.NewVaultReadQuery("secret/foo")), RateLimitVault},
+		{"vault_read_multi", must(dep.NewVaultReadMultiQuery([]string{"secret/foo"})), RateLimitVault},
+		{"vault_request", must(dep.NewVaultRequestQuery("GET", "sys/health", nil)), RateLimitVault},
+		{"vault_static_role", must(dep.NewVaultStaticRoleQuery("database/static-creds/foo")), RateLimitVault},
+		{"vault_token", must(dep.NewVaultTokenQuery("token")), RateLimitVault},
+		{"vault_transit", must(dep.NewVaultTransitQuery("encrypt", "foo", "bar")), RateLimitVault},
+		{"vault_versions", must(dep.NewVaultAllVersionsQuery("secret/foo", 1)), RateLimitVault},
+		{"vault_write", must(dep.NewVaultWriteQuery("secret/foo", nil)), RateLimitVault},
+		{"connect_ca", dep.NewConnectCAQuery(), ""},
+		{"connect_leaf", dep.NewConnectLeafQuery("web"), ""},
+		{"exported_services", must(dep.NewListExportedServicesQuery("")), ""},
+		{"file", must(dep.NewFileQuery("/tmp/foo")), ""},
+		{"partitions", must(dep.NewListPartitionsQuery()), ""},
+		{"peering", must(dep.NewListPeeringQuery("")), ""},
+	}
+
+	listed := make(map[string]bool, len(cases))
+	for i, tc := range cases {
+		listed[reflect.TypeOf(tc.d).Elem().Name()] = true
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			if act := rateLimitClass(tc.d); act != tc.exp {
+				t.Errorf("expected %q, got %q", tc.exp, act)
+			}
+		})
+	}
+
+	for _, name := range dependencyTypes(t) {
+		if !listed[name] {
+			t.Errorf("missing %s", name)
+		}
+	}
+}
+
+// dependencyTypes returns the names of the types of the dependency package
+// which are asserted to implement dep.Dependency.
+func dependencyTypes(t *testing.T) []string {
+	paths, err := filepath.Glob(filepath.Join("..", "dependency", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			spec, ok := n.(*ast.ValueSpec)
+			if !ok || len(spec.Values) != 1 {
+				return true
+			}
+			if ident, ok := spec.Type.(*ast.Ident); !ok || ident.Name != "Dependency" {
+				return true
+			}
+			// _ Dependency = (*Query)(nil)
+			if call, ok := spec.Values[0].(*ast.CallExpr); ok {
+				if paren, ok := call.Fun.(*ast.ParenExpr); ok {
+					if star, ok := paren.X.(*ast.StarExpr); ok {
+						if ident, ok := star.X.(*ast.Ident); ok {
+							names = append(names, ident.Name)
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	if len(names) == 0 {
+		t.Fatal("no dependency types found")
+	}
+	return names
+}
+
+func TestWatcher_rateLimit(t *testing.T) {
+	const (
+		limit = 20 // per second
+		deps  = 10
+	)
+
+	w := NewWatcher(&NewWatcherInput{
+		Clients: dep.NewClientSet(),
+		Once:    true,
+		RateLimiters: map[RateLimitClass]RateLimiter{
+			RateLimitVault: rate.NewLimiter(limit, 1),
+		},
+	})
+	defer w.Stop()
+
+	start := time.Now()
+	for i := 0; i < deps; i++ {
+		d := &TestDepType{TestDep: TestDep{name: fmt.Sprint(i)}, typ: dep.TypeVault}
+		if _, err := w.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Dependencies of other classes are not held back by the limiter
+	if _, err := w.Add(&TestDep{name: "local"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var vault, local time.Duration
+	for i := 0; i < deps+1; i++ {
+		select {
+		case v := <-w.DataCh():
+			if v.Dependency().Type() == dep.TypeVault {
+				vault = time.Since(start)
+			} else {
+				local = time.Since(start)
+			}
+		case err := <-w.ErrCh():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout after %d fetches", i)
+		}
+	}
+
+	// The first fetch uses the burst, the others are spaced at the limit.
+	paced := (deps - 1) * time.Second / limit
+	if vault < paced {
+		t.Errorf("expected %d fetches to take at least %s, took %s", deps, paced, vault)
+	}
+	if local > paced/2 {
+		t.Errorf("expected the local fetch not to be paced, took %s", local)
+	}
+}
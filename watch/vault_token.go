@@ -15,7 +15,9 @@ import (
 	"github.com/hashicorp/vault/api"
 )
 
-// VaultTokenWatcher monitors the vault token for updates
+// VaultTokenWatcher monitors the vault token for updates. The token of a named
+// cluster, given by the name of its configuration, is watched using the
+// client of that cluster.
 func VaultTokenWatcher(
 	clients *dep.ClientSet, c *config.VaultConfig, doneCh chan struct{},
 ) (*Watcher, error) {
@@ -28,7 +30,11 @@ func VaultTokenWatcher(
 	}
 
 	unwrap := config.BoolVal(c.UnwrapToken)
-	vault := clients.Vault()
+	cluster := config.StringVal(c.Name)
+	vault, err := clients.VaultCluster(cluster)
+	if err != nil {
+		return nil, fmt.Errorf("vaultwatcher: %w", err)
+	}
 	// get/set token once when kicked off, async after that..
 	token, err := unpackToken(vault, raw_token, unwrap)
 	if err != nil {
@@ -52,7 +58,7 @@ func VaultTokenWatcher(
 	tokenFile := strings.TrimSpace(config.StringVal(c.VaultAgentTokenFile))
 	if tokenFile != "" {
 		w := getWatcher()
-		watchLoop, err := watchTokenFile(w, tokenFile, raw_token, unwrap, doneCh)
+		watchLoop, err := watchTokenFile(w, vault, tokenFile, raw_token, unwrap, doneCh)
 		if err != nil {
 			return nil, fmt.Errorf("vaultwatcher: %w", err)
 		}
@@ -63,7 +69,7 @@ func VaultTokenWatcher(
 	renewVault := vault.Token() != "" && config.BoolVal(c.RenewToken)
 	if renewVault {
 		w := getWatcher()
-		vt, err := dep.NewVaultTokenQuery(token)
+		vt, err := dep.NewVaultClusterTokenQuery(cluster, token)
 		if err != nil {
 			w.Stop()
 			return nil, fmt.Errorf("vaultwatcher: %w", err)
@@ -78,7 +84,8 @@ func VaultTokenWatcher(
 }
 
 func watchTokenFile(
-	w *Watcher, tokenFile, raw_token string, unwrap bool, doneCh chan struct{},
+	w *Watcher, vault *api.Client, tokenFile, raw_token string, unwrap bool,
+	doneCh chan struct{},
 ) (func(), error) {
 	// watcher, tokenFile, raw_token, unwrap, doneCh
 	atf, err := dep.NewVaultAgentTokenQuery(tokenFile)
@@ -89,7 +96,6 @@ func watchTokenFile(
 		w.Stop()
 		return nil, fmt.Errorf("vaultwatcher: %w", err)
 	}
-	vault := w.clients.Vault()
 	return func() {
 		for {
 			select {
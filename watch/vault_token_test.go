@@ -168,7 +168,7 @@ func TestVaultTokenRefreshToken(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			var wg sync.WaitGroup
 			dCh := make(chan struct{})
-			watchLoop, err := watchTokenFile(watcher, "", "XXX", false, dCh)
+			watchLoop, err := watchTokenFile(watcher, watcher.clients.Vault(), "", "XXX", false, dCh)
 			if err != nil {
 				t.Error(err)
 			}
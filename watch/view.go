@@ -4,6 +4,8 @@
 package watch
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -12,7 +14,11 @@ import (
 	"sync"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
 	dep "github.com/hashicorp/consul-template/dependency"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var errLookup = fmt.Errorf("lookup error")
@@ -34,6 +40,13 @@ type View struct {
 	receivedData bool
 	lastIndex    uint64
 
+	// lastFetch and lastChange are the times of the last successful fetch
+	// and of the last change of the data, and lastErr is the error of the
+	// last fetch if it failed. They are protected by dataLock.
+	lastFetch  time.Time
+	lastChange time.Time
+	lastErr    error
+
 	// blockQueryWaitTime is amount of time in seconds to do a blocking query for
 	blockQueryWaitTime time.Duration
 
@@ -50,8 +63,22 @@ type View struct {
 	// should be attempted.
 	retryFunc RetryFunc
 
+	// rateLimiter paces the fetches of this view, together with the other
+	// views of its class. It may be nil.
+	rateLimiter RateLimiter
+
 	// stopCh is used to stop polling on this View
 	stopCh chan struct{}
+
+	// tracer records a span for each fetch. It may be nil.
+	tracer trace.Tracer
+
+	// metrics counts failed fetches. It may be nil.
+	metrics *metrics.Metrics
+
+	// debug logs the fetches and changes of the dependency at INFO rather
+	// than TRACE, when it was tagged with the debug query parameter.
+	debug bool
 }
 
 // NewViewInput is used as input to the NewView function.
@@ -80,10 +107,26 @@ type NewViewInput struct {
 	// RetryFunc is a function which dictates how this view should retry on
 	// upstream errors.
 	RetryFunc RetryFunc
+
+	// RateLimiter paces the fetches of this view. Fetches are not paced when
+	// nil.
+	RateLimiter RateLimiter
+
+	// Tracer is used to record a span for each fetch. Tracing is disabled
+	// when nil.
+	Tracer trace.Tracer
+
+	// Metrics is used to count failed fetches. Metrics are disabled when nil.
+	Metrics *metrics.Metrics
 }
 
 // NewView constructs a new view with the given inputs.
 func NewView(i *NewViewInput) (*View, error) {
+	var debug bool
+	if d, ok := i.Dependency.(dep.Debugger); ok {
+		debug = d.Debug()
+	}
+
 	return &View{
 		dependency:         i.Dependency,
 		clients:            i.Clients,
@@ -92,7 +135,11 @@ func NewView(i *NewViewInput) (*View, error) {
 		once:               i.Once,
 		failLookupErrors:   i.FailLookupErrors,
 		retryFunc:          i.RetryFunc,
+		rateLimiter:        i.RateLimiter,
+		tracer:             i.Tracer,
+		metrics:            i.Metrics,
 		stopCh:             make(chan struct{}, 1),
+		debug:              debug,
 	}, nil
 }
 
@@ -137,7 +184,7 @@ func (v *View) poll(viewCh chan<- *View, errCh chan<- error, serverErrCh chan<-
 			// have some successful requests
 			retries = 0
 
-			log.Printf("[TRACE] (view) %s received data", v.dependency)
+			v.tracef("(view) %s received data", v.dependency)
 			select {
 			case <-v.stopCh:
 				return
@@ -156,7 +203,7 @@ func (v *View) poll(viewCh chan<- *View, errCh chan<- error, serverErrCh chan<-
 			// example, Consul make have an outage, but when it returns, the view
 			// is unchanged. We have to reset the counter retries, but not update the
 			// actual template.
-			log.Printf("[TRACE] (view) %s successful contact, resetting retries", v.dependency)
+			v.tracef("(view) %s successful contact, resetting retries", v.dependency)
 			retries = 0
 			goto WAIT
 		case err := <-fetchErrCh:
@@ -185,7 +232,7 @@ func (v *View) poll(viewCh chan<- *View, errCh chan<- error, serverErrCh chan<-
 				return
 			}
 		case <-v.stopCh:
-			log.Printf("[TRACE] (view) %s stopping poll (received on view stopCh)", v.dependency)
+			v.tracef("(view) %s stopping poll (received on view stopCh)", v.dependency)
 			return
 		}
 	}
@@ -197,7 +244,7 @@ func (v *View) poll(viewCh chan<- *View, errCh chan<- error, serverErrCh chan<-
 // result of doneCh and errCh. It is assumed that only one instance of fetch
 // is running per View and therefore no locking or mutexes are used.
 func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
-	log.Printf("[TRACE] (view) %s starting fetch", v.dependency)
+	v.tracef("(view) %s starting fetch", v.dependency)
 
 	var allowStale bool
 	if v.maxStale != 0 {
@@ -214,17 +261,26 @@ func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		default:
 		}
 
+		if !v.waitRateLimiter() {
+			return
+		}
+
 		start := time.Now() // for rateLimiter below
 
-		data, rm, err := v.dependency.Fetch(v.clients, &dep.QueryOptions{
+		data, rm, err := v.traceFetch(&dep.QueryOptions{
 			AllowStale: allowStale,
 			WaitTime:   v.blockQueryWaitTime,
 			WaitIndex:  v.lastIndex,
 		})
+
 		if err != nil {
 			if err == dep.ErrStopped {
-				log.Printf("[TRACE] (view) %s reported stop", v.dependency)
+				v.tracef("(view) %s reported stop", v.dependency)
 			} else {
+				if v.metrics != nil {
+					v.metrics.IncrCounter([]string{"fetch", "errors"}, 1)
+				}
+				v.setLastErr(err)
 				errCh <- err
 			}
 			return
@@ -236,10 +292,19 @@ func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 			return
 		}
 
+		if v.debug {
+			log.Printf("[INFO] (view) %s fetched index %d (wait index %d, last contact %s)",
+				v.dependency, rm.LastIndex, v.lastIndex, rm.LastContact)
+		}
+
 		// If we got this far, we received data successfully. That data might not
 		// trigger a data update (because we could continue below), but we need to
 		// inform the poller to reset the retry count.
-		log.Printf("[TRACE] (view) %s marking successful data response", v.dependency)
+		v.tracef("(view) %s marking successful data response", v.dependency)
+		v.dataLock.Lock()
+		v.lastFetch = time.Now()
+		v.lastErr = nil
+		v.dataLock.Unlock()
 		select {
 		case successCh <- struct{}{}:
 		default:
@@ -247,7 +312,7 @@ func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 
 		if allowStale && rm.LastContact > v.maxStale {
 			allowStale = false
-			log.Printf("[TRACE] (view) %s stale data (last contact exceeded max_stale)", v.dependency)
+			v.tracef("(view) %s stale data (last contact exceeded max_stale)", v.dependency)
 			continue
 		}
 
@@ -256,6 +321,7 @@ func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		}
 
 		if v.failLookupErrors && !firstLoop && !v.receivedData {
+			v.setLastErr(errLookup)
 			errCh <- errLookup
 			return
 		}
@@ -268,13 +334,13 @@ func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		// blocking queries that return due to block timeout
 		// will have the same index
 		if rm.LastIndex == v.lastIndex {
-			log.Printf("[TRACE] (view) %s no new data (index was the same)", v.dependency)
+			v.tracef("(view) %s no new data (index was the same)", v.dependency)
 			continue
 		}
 
 		v.dataLock.Lock()
 		if rm.LastIndex < v.lastIndex {
-			log.Printf("[TRACE] (view) %s had a lower index, resetting", v.dependency)
+			v.tracef("(view) %s had a lower index, resetting", v.dependency)
 			v.lastIndex = 0
 			v.dataLock.Unlock()
 			continue
@@ -282,7 +348,7 @@ func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		v.lastIndex = rm.LastIndex
 
 		if v.receivedData && reflect.DeepEqual(data, v.data) {
-			log.Printf("[TRACE] (view) %s no new data (contents were the same)", v.dependency)
+			v.tracef("(view) %s no new data (contents were the same)", v.dependency)
 			v.dataLock.Unlock()
 			continue
 		}
@@ -291,20 +357,71 @@ func (v *View) fetch(doneCh, successCh chan<- struct{}, errCh chan<- error) {
 		// lookup failures, but you want the dependency to act like it is still
 		// blocking and loop back and hit it again.
 		if data == nil && rm.BlockOnNil {
-			log.Printf("[TRACE] (view) %s asked for blocking query", v.dependency)
+			v.tracef("(view) %s asked for blocking query", v.dependency)
 			v.dataLock.Unlock()
 			continue
 		}
 
 		v.data = data
 		v.receivedData = true
+		v.lastChange = time.Now()
 		v.dataLock.Unlock()
 
+		if v.debug {
+			log.Printf("[INFO] (view) %s data changed: %s", v.dependency, debugData(data))
+		}
+
 		close(doneCh)
 		return
 	}
 }
 
+// tracef logs a message about the view at TRACE, or at INFO when the
+// dependency was tagged for verbose logging.
+func (v *View) tracef(format string, args ...interface{}) {
+	level := "TRACE"
+	if v.debug {
+		level = "INFO"
+	}
+	log.Printf("["+level+"] "+format, args...)
+}
+
+// debugData formats the data of a dependency for verbose logging. JSON is used
+// so the values behind pointers are shown.
+func debugData(data interface{}) string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprintf("%#v", data)
+	}
+	return string(b)
+}
+
+// setLastErr records the error of the last fetch.
+func (v *View) setLastErr(err error) {
+	v.dataLock.Lock()
+	defer v.dataLock.Unlock()
+	v.lastErr = err
+}
+
+// status returns a snapshot of the state of this view.
+func (v *View) status() ViewStatus {
+	v.dataLock.RLock()
+	defer v.dataLock.RUnlock()
+
+	s := ViewStatus{
+		Dependency: v.dependency.String(),
+		LastFetch:  v.lastFetch,
+		LastChange: v.lastChange,
+	}
+	if v.receivedData {
+		s.DataAge = time.Since(v.lastChange)
+	}
+	if v.lastErr != nil {
+		s.LastError = v.lastErr.Error()
+	}
+	return s
+}
+
 const minDelayBetweenUpdates = time.Millisecond * 100
 
 // return a duration to sleep to limit the frequency of upstream calls
@@ -317,8 +434,63 @@ func rateLimiter(start time.Time) time.Duration {
 	return 0
 }
 
+// waitRateLimiter blocks until the rate limiter of this view allows a fetch.
+// It returns false if the view was stopped first.
+func (v *View) waitRateLimiter() bool {
+	if v.rateLimiter == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-v.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := v.rateLimiter.Wait(ctx); err != nil {
+		select {
+		case <-v.stopCh:
+			return false
+		default:
+		}
+		// The limiter can never allow a fetch, so fetch without it rather
+		// than stalling the view.
+		log.Printf("[WARN] (view) %s rate limiter: %s", v.dependency, err)
+	}
+	return true
+}
+
 // stop halts polling of this view.
 func (v *View) stop() {
 	v.dependency.Stop()
 	close(v.stopCh)
 }
+
+// traceFetch calls Fetch on the dependency, recording the call as a span when
+// the view has a tracer.
+func (v *View) traceFetch(opts *dep.QueryOptions) (interface{}, *dep.ResponseMetadata, error) {
+	if v.tracer == nil {
+		return v.dependency.Fetch(v.clients, opts)
+	}
+
+	_, span := v.tracer.Start(context.Background(), "fetch",
+		trace.WithAttributes(
+			attribute.String("dependency", v.dependency.String()),
+			attribute.Int64("wait_index", int64(opts.WaitIndex)),
+		))
+	defer span.End()
+
+	data, rm, err := v.dependency.Fetch(v.clients, opts)
+	if err != nil && err != dep.ErrStopped {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if rm != nil {
+		span.SetAttributes(attribute.Int64("last_index", int64(rm.LastIndex)))
+	}
+	return data, rm, err
+}
@@ -4,10 +4,16 @@
 package watch
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"log"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	dep "github.com/hashicorp/consul-template/dependency"
 )
 
 func TestPoll_returnsViewCh(t *testing.T) {
@@ -275,6 +281,51 @@ func TestFetch_savesView(t *testing.T) {
 	}
 }
 
+func TestFetch_debug(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(io.Discard)
+
+	for _, d := range []dep.Dependency{
+		&TestDep{name: "plain"},
+		&TestDepDebug{TestDep{name: "debug"}},
+	} {
+		view, err := NewView(&NewViewInput{
+			Dependency: d,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		doneCh := make(chan struct{})
+		successCh := make(chan struct{})
+		errCh := make(chan error)
+
+		go view.fetch(doneCh, successCh, errCh)
+
+		select {
+		case <-doneCh:
+		case err := <-errCh:
+			t.Fatalf("error while fetching: %s", err)
+		}
+	}
+
+	out := buf.String()
+	for _, exp := range []string{
+		"[INFO] (view) test_dep(debug) starting fetch",
+		"[INFO] (view) test_dep(debug) fetched index 1",
+		`[INFO] (view) test_dep(debug) data changed: "this is some data"`,
+		"[TRACE] (view) test_dep(plain) starting fetch",
+	} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("expected log to contain %q:\n%s", exp, out)
+		}
+	}
+	if strings.Contains(out, "[INFO] (view) test_dep(plain)") {
+		t.Errorf("expected no INFO logs for the plain dependency:\n%s", out)
+	}
+}
+
 func TestFetch_returnsErrCh(t *testing.T) {
 	view, err := NewView(&NewViewInput{
 		Dependency: &TestDepFetchError{},
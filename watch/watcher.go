@@ -5,11 +5,14 @@ package watch
 
 import (
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
 	dep "github.com/hashicorp/consul-template/dependency"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // dataBufferSize is the default number of views to process in a batch.
@@ -59,6 +62,15 @@ type Watcher struct {
 	retryFuncDefault RetryFunc
 	retryFuncVault   RetryFunc
 	retryFuncNomad   RetryFunc
+
+	// rateLimiters pace the fetches of each class of dependencies.
+	rateLimiters map[RateLimitClass]RateLimiter
+
+	// tracer records a span for each dependency fetch. It may be nil.
+	tracer trace.Tracer
+
+	// metrics counts failed dependency fetches. It may be nil.
+	metrics *metrics.Metrics
 }
 
 type NewWatcherInput struct {
@@ -92,6 +104,18 @@ type NewWatcherInput struct {
 	RetryFuncDefault RetryFunc
 	RetryFuncVault   RetryFunc
 	RetryFuncNomad   RetryFunc
+
+	// RateLimiters pace the fetches of each class of dependencies. Classes
+	// without a limiter are not paced.
+	RateLimiters map[RateLimitClass]RateLimiter
+
+	// Tracer is used to record a span for each dependency fetch. Tracing is
+	// disabled when nil.
+	Tracer trace.Tracer
+
+	// Metrics is used to count failed dependency fetches. Metrics are
+	// disabled when nil.
+	Metrics *metrics.Metrics
 }
 
 // NewWatcher creates a new watcher using the given API client.
@@ -110,6 +134,9 @@ func NewWatcher(i *NewWatcherInput) *Watcher {
 		retryFuncDefault:   i.RetryFuncDefault,
 		retryFuncVault:     i.RetryFuncVault,
 		retryFuncNomad:     i.RetryFuncNomad,
+		rateLimiters:       i.RateLimiters,
+		tracer:             i.Tracer,
+		metrics:            i.Metrics,
 	}
 	return w
 }
@@ -182,6 +209,9 @@ func (w *Watcher) Add(d dep.Dependency) (bool, error) {
 		FailLookupErrors:   w.failLookupErrors,
 		Once:               w.once,
 		RetryFunc:          retryFunc,
+		RateLimiter:        w.rateLimiters[rateLimitClass(d)],
+		Tracer:             w.tracer,
+		Metrics:            w.metrics,
 	})
 	if err != nil {
 		return false, errors.Wrap(err, "watcher")
@@ -238,6 +268,75 @@ func (w *Watcher) Remove(d dep.Dependency) bool {
 	return false
 }
 
+// ForceRefresh stops the view of the given dependency, which interrupts the
+// query in flight, and watches the given dependency in its place, so it is
+// fetched right away. A stopped dependency cannot fetch again, so d must be a
+// new instance of the watched dependency. This is intended for embedders
+// which know out-of-band that the data is stale. If the dependency is not
+// being watched, or d is the watched instance, this function returns false.
+func (w *Watcher) ForceRefresh(d dep.Dependency) (bool, error) {
+	w.Lock()
+	view, ok := w.depViewMap[d.String()]
+	if !ok || view == nil {
+		w.Unlock()
+		log.Printf("[TRACE] (watcher) %s did not exist, skipping refresh", d)
+		return false, nil
+	}
+	if view.Dependency() == d {
+		w.Unlock()
+		log.Printf("[WARN] (watcher) %s is the watched instance, skipping refresh", d)
+		return false, nil
+	}
+
+	log.Printf("[DEBUG] (watcher) forcing refresh of %s", d)
+	view.stop()
+	delete(w.depViewMap, d.String())
+	w.Unlock()
+
+	return w.Add(d)
+}
+
+// ViewStatus is a snapshot of the state of a view, for introspection.
+type ViewStatus struct {
+	// Dependency is the string of the watched dependency.
+	Dependency string
+
+	// LastFetch is the time the upstream last responded successfully. It is
+	// zero until the first response.
+	LastFetch time.Time
+
+	// LastChange is the time the data of the view last changed. It is zero
+	// until the first data was received.
+	LastChange time.Time
+
+	// DataAge is the time since the data last changed. It is zero until the
+	// first data was received.
+	DataAge time.Duration
+
+	// LastError is the error of the last fetch, if it failed.
+	LastError string
+}
+
+// Snapshot returns the status of each of the views of this watcher, sorted by
+// dependency. This is intended for embedders which want to show what is being
+// watched, for example at a debug endpoint.
+func (w *Watcher) Snapshot() []ViewStatus {
+	w.Lock()
+	defer w.Unlock()
+
+	statuses := make([]ViewStatus, 0, len(w.depViewMap))
+	for _, view := range w.depViewMap {
+		if view == nil {
+			continue
+		}
+		statuses = append(statuses, view.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Dependency < statuses[j].Dependency
+	})
+	return statuses
+}
+
 // Size returns the number of views this watcher is watching.
 func (w *Watcher) Size() int {
 	w.Lock()
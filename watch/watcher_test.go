@@ -6,6 +6,7 @@ package watch
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	dep "github.com/hashicorp/consul-template/dependency"
 )
@@ -92,6 +93,47 @@ func TestAdd_startsViewPoll(t *testing.T) {
 	}
 }
 
+func TestAdd_retryFunc(t *testing.T) {
+	retryFunc := func(d time.Duration) RetryFunc {
+		return func(int) (bool, time.Duration) { return true, d }
+	}
+
+	w := NewWatcher(&NewWatcherInput{
+		Clients:          dep.NewClientSet(),
+		Once:             true,
+		RetryFuncConsul:  retryFunc(1 * time.Second),
+		RetryFuncVault:   retryFunc(2 * time.Second),
+		RetryFuncNomad:   retryFunc(3 * time.Second),
+		RetryFuncDefault: retryFunc(4 * time.Second),
+	})
+	defer w.Stop()
+
+	cases := []struct {
+		name string
+		typ  dep.Type
+		exp  time.Duration
+	}{
+		{"consul", dep.TypeConsul, 1 * time.Second},
+		{"vault", dep.TypeVault, 2 * time.Second},
+		{"nomad", dep.TypeNomad, 3 * time.Second},
+		{"local", dep.TypeLocal, 4 * time.Second},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%d_%s", i, tc.name), func(t *testing.T) {
+			d := &TestDepType{TestDep: TestDep{name: tc.name}, typ: tc.typ}
+			if _, err := w.Add(d); err != nil {
+				t.Fatal(err)
+			}
+
+			_, act := w.depViewMap[d.String()].retryFunc(0)
+			if act != tc.exp {
+				t.Errorf("expected the %s retry backoff %s, got %s", tc.name, tc.exp, act)
+			}
+		})
+	}
+}
+
 func TestWatching_notExists(t *testing.T) {
 	w := NewWatcher(&NewWatcherInput{
 		Clients: dep.NewClientSet(),
@@ -181,3 +223,122 @@ func TestSize_returnsNumViews(t *testing.T) {
 		t.Errorf("expected %d to be %d", w.Size(), 10)
 	}
 }
+
+func TestForceRefresh_fetches(t *testing.T) {
+	w := NewWatcher(&NewWatcherInput{
+		Clients: dep.NewClientSet(),
+	})
+	defer w.Stop()
+
+	d := &TestDepRefresh{stopCh: make(chan struct{})}
+	if _, err := w.Add(d); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-w.errCh:
+		t.Fatal(err)
+	case <-w.dataCh:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for first fetch")
+	}
+
+	// Wait for the blocking query to be in flight
+	for d.Fetches() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if ok, _ := w.ForceRefresh(d); ok {
+		t.Fatal("expected ForceRefresh to return false for the watched instance")
+	}
+
+	fresh := &TestDepRefresh{stopCh: make(chan struct{})}
+	if ok, err := w.ForceRefresh(fresh); err != nil || !ok {
+		t.Fatalf("expected ForceRefresh to return true, got %t (%v)", ok, err)
+	}
+
+	// The blocking query in flight never returns on its own, so the refreshed
+	// data only arrives if it was interrupted.
+	select {
+	case <-d.stopCh:
+	case <-time.After(time.Second):
+		t.Fatal("expected the query in flight to be interrupted")
+	}
+	select {
+	case err := <-w.errCh:
+		t.Fatal(err)
+	case view := <-w.dataCh:
+		if exp, act := "fetch 1", view.Data(); exp != act {
+			t.Errorf("expected %q, got %q", exp, act)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for refresh fetch")
+	}
+}
+
+func TestForceRefresh_notExists(t *testing.T) {
+	w := NewWatcher(&NewWatcherInput{
+		Clients: dep.NewClientSet(),
+		Once:    true,
+	})
+
+	if ok, _ := w.ForceRefresh(&TestDep{}); ok {
+		t.Errorf("expected ForceRefresh to return false")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	w := NewWatcher(&NewWatcherInput{
+		Clients: dep.NewClientSet(),
+		Once:    true,
+	})
+	defer w.Stop()
+
+	start := time.Now()
+	if _, err := w.Add(&TestDep{name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(&TestDepFetchError{name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-w.DataCh():
+		case <-w.ErrCh():
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for fetches")
+		}
+	}
+	end := time.Now()
+
+	snapshot := w.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("expected 2 views, got %#v", snapshot)
+	}
+
+	ok, failed := snapshot[0], snapshot[1]
+	if ok.Dependency != "test_dep(a)" || failed.Dependency != "test_dep_fetch_error(b)" {
+		t.Fatalf("expected the views sorted by dependency, got %#v", snapshot)
+	}
+
+	if ok.LastFetch.Before(start) || ok.LastFetch.After(end) {
+		t.Errorf("expected the last fetch between %s and %s, got %s", start, end, ok.LastFetch)
+	}
+	if ok.LastChange.Before(ok.LastFetch) || ok.LastChange.After(end) {
+		t.Errorf("expected the last change after the last fetch, got %s", ok.LastChange)
+	}
+	if ok.DataAge <= 0 || ok.DataAge > time.Since(start) {
+		t.Errorf("expected a data age below %s, got %s", time.Since(start), ok.DataAge)
+	}
+	if ok.LastError != "" {
+		t.Errorf("expected no error, got %q", ok.LastError)
+	}
+
+	if !failed.LastFetch.IsZero() || !failed.LastChange.IsZero() || failed.DataAge != 0 {
+		t.Errorf("expected no data for the failed view, got %#v", failed)
+	}
+	if failed.LastError != "failed to contact server" {
+		t.Errorf("expected the fetch error, got %q", failed.LastError)
+	}
+}